@@ -12,6 +12,7 @@ require (
 	github.com/hyperledger/firefly-common v1.1.3
 	github.com/oklog/ulid/v2 v2.1.0
 	github.com/sirupsen/logrus v1.8.1
+	github.com/spf13/cast v1.5.0
 	github.com/spf13/viper v1.12.1-0.20220712161005-5247643f0235
 	github.com/stretchr/testify v1.8.0
 	github.com/syndtr/goleveldb v1.0.1-0.20210819022825-2ae1ddf74ef7
@@ -51,7 +52,6 @@ require (
 	github.com/santhosh-tekuri/jsonschema/v5 v5.0.0 // indirect
 	github.com/shopspring/decimal v1.2.0 // indirect
 	github.com/spf13/afero v1.8.2 // indirect
-	github.com/spf13/cast v1.5.0 // indirect
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/stretchr/objx v0.4.0 // indirect
@@ -46,6 +46,7 @@ type Stream interface {
 	Status() apitypes.EventStreamStatus                                  // Get the current status
 	Start(ctx context.Context) error                                     // Start delivery
 	Stop(ctx context.Context) error                                      // Stop delivery (does not remove checkpoints)
+	Drain(ctx context.Context) error                                     // Stop delivery, once the in-flight batch is delivered and a final checkpoint written
 	Delete(ctx context.Context) error                                    // Stop delivery, and clean up any checkpoint
 }
 
@@ -94,6 +95,7 @@ type startedStreamState struct {
 	eventLoopDone     chan struct{}
 	batchLoopDone     chan struct{}
 	blockListenerDone chan struct{}
+	drain             chan struct{}
 	updates           chan *ffcapi.ListenerEvent
 	blocks            chan *ffcapi.BlockHashEvent
 }
@@ -477,6 +479,7 @@ func (es *eventStream) Start(ctx context.Context) error {
 		startTime:     fftypes.Now(),
 		eventLoopDone: make(chan struct{}),
 		batchLoopDone: make(chan struct{}),
+		drain:         make(chan struct{}),
 		updates:       make(chan *ffcapi.ListenerEvent, int(*es.spec.BatchSize)),
 	}
 	startedState.ctx, startedState.cancelCtx = context.WithCancel(es.bgCtx)
@@ -517,7 +520,7 @@ func (es *eventStream) Start(ctx context.Context) error {
 	return err
 }
 
-func (es *eventStream) requestStop(ctx context.Context) (*startedStreamState, error) {
+func (es *eventStream) requestStop(ctx context.Context, drain bool) (*startedStreamState, error) {
 	es.mux.Lock()
 	defer es.mux.Unlock()
 	startedState := es.currentState
@@ -528,6 +531,12 @@ func (es *eventStream) requestStop(ctx context.Context) (*startedStreamState, er
 	if err := es.checkSetStatus(ctx, apitypes.EventStreamStatusStarted, apitypes.EventStreamStatusStopping); err != nil {
 		return nil, err
 	}
+	if drain {
+		// The batch loop delivers the batch in-flight, and writes a final checkpoint, before exiting
+		log.L(ctx).Infof("Draining event stream %s", es)
+		close(startedState.drain)
+		return startedState, nil
+	}
 	log.L(ctx).Infof("Stopping event stream %s", es)
 
 	// Cancel the context, stop stop the event loop, and shut down the action (WebSockets in particular)
@@ -545,11 +554,36 @@ func (es *eventStream) Status() apitypes.EventStreamStatus {
 func (es *eventStream) Stop(ctx context.Context) error {
 
 	// Request the stop - this phase is locked, and gives us a safe copy of the listeners array to use outside the lock
-	startedState, err := es.requestStop(ctx)
+	startedState, err := es.requestStop(ctx, false)
+	if err != nil || startedState == nil {
+		return err
+	}
+	return es.completeStop(ctx, startedState)
+}
+
+func (es *eventStream) Drain(ctx context.Context) error {
+
+	startedState, err := es.requestStop(ctx, true)
 	if err != nil || startedState == nil {
 		return err
 	}
 
+	// Wait for the batch loop to deliver the batch in-flight and write the final checkpoint, or for the
+	// drain to time out, before we stop the rest of the stream
+	select {
+	case <-startedState.batchLoopDone:
+		log.L(ctx).Infof("Drained event stream %s", es)
+	case <-ctx.Done():
+		log.L(ctx).Warnf("Timed out draining event stream %s", es)
+	}
+	startedState.cancelCtx()
+
+	// The drain context might have expired, so we complete the stop on the background context
+	return es.completeStop(es.bgCtx, startedState)
+}
+
+func (es *eventStream) completeStop(ctx context.Context, startedState *startedStreamState) (err error) {
+
 	// Inform the connector explicitly of the stream stop (it should be shutting down all it's listeners anyway
 	// due to the cancelled context)
 	if _, _, err = es.connector.EventStreamStopped(ctx, &ffcapi.EventStreamStoppedRequest{
@@ -687,6 +721,7 @@ func (es *eventStream) batchLoop(startedState *startedStreamState) {
 			timeoutChannel = checkpointTimer.C
 		}
 		timedOut := false
+		draining := false
 		select {
 		case fev := <-es.batchChannel:
 			if fev.Event != nil {
@@ -734,6 +769,8 @@ func (es *eventStream) batchLoop(startedState *startedStreamState) {
 			if batch == nil {
 				checkpointTimer = time.NewTimer(es.checkpointInterval)
 			}
+		case <-startedState.drain:
+			draining = true
 		case <-ctx.Done():
 			// The started context exited, we are stopping
 			if checkpointTimer != nil {
@@ -743,7 +780,7 @@ func (es *eventStream) batchLoop(startedState *startedStreamState) {
 			return
 		}
 
-		if timedOut || len(batch.events) >= maxSize {
+		if timedOut || draining || len(batch.events) >= maxSize {
 			var err error
 			if batch != nil {
 				batch.timeout.Stop()
@@ -758,6 +795,10 @@ func (es *eventStream) batchLoop(startedState *startedStreamState) {
 				return
 			}
 			batch = nil
+			if draining {
+				log.L(ctx).Debugf("Batch loop exiting after drain")
+				return
+			}
 		}
 	}
 }
@@ -1202,6 +1202,120 @@ func TestStopWhenNotStarted(t *testing.T) {
 
 }
 
+func TestDrainWhenNotStarted(t *testing.T) {
+
+	es := newTestEventStream(t, `{
+		"name": "ut_stream"
+	}`)
+
+	err := es.Drain(es.bgCtx)
+	assert.Regexp(t, "FF21027", err)
+
+}
+
+func TestDrainWritesFinalCheckpoint(t *testing.T) {
+
+	es := newTestEventStream(t, `{
+		"name": "ut_stream"
+	}`)
+
+	mfc := es.connector.(*ffcapimocks.API)
+	mfc.On("EventStreamStart", mock.Anything, mock.Anything).Return(&ffcapi.EventStreamStartResponse{}, ffcapi.ErrorReason(""), nil).Once()
+	mfc.On("EventStreamStopped", mock.Anything, mock.Anything).Return(&ffcapi.EventStreamStoppedResponse{}, ffcapi.ErrorReason(""), nil).Once()
+
+	msp := es.persistence.(*persistencemocks.Persistence)
+	msp.On("GetCheckpoint", mock.Anything, mock.Anything).Return(nil, nil)
+	msp.On("WriteCheckpoint", mock.Anything, mock.MatchedBy(func(cp *apitypes.EventStreamCheckpoint) bool {
+		return cp.StreamID.Equals(es.spec.ID)
+	})).Return(nil).Once()
+
+	err := es.Start(es.bgCtx)
+	assert.NoError(t, err)
+
+	err = es.Drain(es.bgCtx)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.EventStreamStatusStopped, es.Status())
+
+	mfc.AssertExpectations(t)
+	msp.AssertExpectations(t)
+}
+
+func TestDrainTimeout(t *testing.T) {
+
+	es := newTestEventStream(t, `{
+		"name": "ut_stream"
+	}`)
+
+	mfc := es.connector.(*ffcapimocks.API)
+	mfc.On("EventStreamStart", mock.Anything, mock.Anything).Return(&ffcapi.EventStreamStartResponse{}, ffcapi.ErrorReason(""), nil).Once()
+	mfc.On("EventStreamStopped", mock.Anything, mock.Anything).Return(&ffcapi.EventStreamStoppedResponse{}, ffcapi.ErrorReason(""), nil).Once()
+
+	msp := es.persistence.(*persistencemocks.Persistence)
+	msp.On("GetCheckpoint", mock.Anything, mock.Anything).Return(nil, nil)
+	msp.On("WriteCheckpoint", mock.Anything, mock.Anything).Return(fmt.Errorf("pop"))
+
+	err := es.Start(es.bgCtx)
+	assert.NoError(t, err)
+
+	// The final checkpoint retries until the drain times out
+	ctx, cancelCtx := context.WithTimeout(es.bgCtx, 10*time.Millisecond)
+	defer cancelCtx()
+	err = es.Drain(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.EventStreamStatusStopped, es.Status())
+
+	mfc.AssertExpectations(t)
+}
+
+func TestBatchLoopDrainDeliversInFlightBatch(t *testing.T) {
+
+	es := newTestEventStream(t, `{
+		"name": "ut_stream",
+		"batchTimeout": "1h"
+	}`)
+
+	delivered := make(chan []*apitypes.EventWithContext, 1)
+	ss := &startedStreamState{
+		updates:       make(chan *ffcapi.ListenerEvent, 1),
+		batchLoopDone: make(chan struct{}),
+		drain:         make(chan struct{}),
+		action: func(ctx context.Context, batchNumber int64, attempt int, events []*apitypes.EventWithContext) error {
+			delivered <- events
+			return nil
+		},
+	}
+	ss.ctx, ss.cancelCtx = context.WithCancel(context.Background())
+	defer ss.cancelCtx()
+
+	listenerID := fftypes.NewUUID()
+	li := &listener{
+		spec:           &apitypes.Listener{ID: listenerID, Name: strPtr("listener1")},
+		checkpoint:     &utCheckpointType{SomeSequenceNumber: 2000},
+		lastCheckpoint: fftypes.Now(),
+	}
+	es.listeners[*li.spec.ID] = li
+
+	msp := es.persistence.(*persistencemocks.Persistence)
+	msp.On("WriteCheckpoint", mock.Anything, mock.MatchedBy(func(cp *apitypes.EventStreamCheckpoint) bool {
+		return cp.StreamID.Equals(es.spec.ID) && bytes.Equal(cp.Listeners[*li.spec.ID], json.RawMessage(`{"someSequenceNumber":2001}`))
+	})).Return(nil).Once()
+
+	go es.batchLoop(ss)
+	es.batchChannel <- &ffcapi.ListenerEvent{
+		Checkpoint: &utCheckpointType{SomeSequenceNumber: 2001},
+		Event:      &ffcapi.Event{ID: ffcapi.EventID{ListenerID: listenerID, BlockNumber: 2001}},
+	}
+	assert.Eventually(t, func() bool { return len(es.batchChannel) == 0 }, time.Second, time.Millisecond)
+
+	// The batch is waiting on a long timeout, but is delivered on drain
+	close(ss.drain)
+	<-ss.batchLoopDone
+	events := <-delivered
+	assert.Len(t, events, 1)
+
+	msp.AssertExpectations(t)
+}
+
 func TestWebSocketBroadcastActionCloseDuringCheckpoint(t *testing.T) {
 
 	es := newTestEventStream(t, `{
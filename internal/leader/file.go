@@ -0,0 +1,155 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+)
+
+// fileLeaseStore stores a single lease in a file, for instances that share a filesystem on a single host.
+// A lock file is created exclusively around each check-and-update, and removed if left behind by a
+// process that exited part way through an update.
+type fileLeaseStore struct {
+	path      string
+	staleLock time.Duration
+	lockWait  time.Duration
+}
+
+const (
+	defaultLockWait   = 1 * time.Second
+	lockRetryInterval = 10 * time.Millisecond
+)
+
+func NewFileLeaseStore(ctx context.Context, path string, staleLock time.Duration) (LeaseStore, error) {
+	if path == "" {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgLeaderFilePathMissing)
+	}
+	return &fileLeaseStore{
+		path:      path,
+		staleLock: staleLock,
+		lockWait:  defaultLockWait,
+	}, nil
+}
+
+// lock waits briefly if another instance holds the lock, as it is only held for a single read and write of
+// the lease. In particular, a release on shutdown must not fail because a follower is checking the lease.
+func (f *fileLeaseStore) lock(ctx context.Context) (func(), error) {
+	deadline := time.Now().Add(f.lockWait)
+	for {
+		unlock, err := f.tryLock(ctx)
+		if err == nil || !os.IsExist(err) {
+			return unlock, err
+		}
+		if time.Now().After(deadline) {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgLeaderFileLocked, f.path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (f *fileLeaseStore) tryLock(ctx context.Context) (func(), error) {
+	lockPath := f.path + ".lock"
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > f.staleLock {
+			log.L(ctx).Warnf("Removing stale leader lease lock file %s", lockPath)
+			_ = os.Remove(lockPath)
+			lockFile, err = os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		}
+	}
+	if os.IsExist(err) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgLeaderFileAccessFailed, f.path)
+	}
+	_ = lockFile.Close()
+	return func() { _ = os.Remove(lockPath) }, nil
+}
+
+func (f *fileLeaseStore) read(ctx context.Context) (lease *apitypes.LeaderLease, err error) {
+	b, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(b, &lease)
+	}
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgLeaderFileAccessFailed, f.path)
+	}
+	return lease, nil
+}
+
+func (f *fileLeaseStore) write(ctx context.Context, lease *apitypes.LeaderLease) error {
+	// Write to a temporary file then rename, so a reader never sees a partial update
+	b, _ := json.Marshal(lease)
+	tmpPath := f.path + ".tmp"
+	err := os.WriteFile(tmpPath, b, 0600)
+	if err == nil {
+		err = os.Rename(tmpPath, f.path)
+	}
+	if err != nil {
+		return i18n.WrapError(ctx, err, tmmsgs.MsgLeaderFileAccessFailed, f.path)
+	}
+	return nil
+}
+
+func (f *fileLeaseStore) AcquireLease(ctx context.Context, lease *apitypes.LeaderLease) (*apitypes.LeaderLease, error) {
+	unlock, err := f.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	current, err := f.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !current.AvailableTo(lease.Holder, lease.Renewed) {
+		return current, nil
+	}
+	if err := f.write(ctx, lease); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+func (f *fileLeaseStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	unlock, err := f.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := f.read(ctx)
+	if err != nil || current == nil || current.Holder != holder {
+		return err
+	}
+	// Expire the lease, so any instance can acquire it
+	current.Expires = fftypes.Now()
+	return f.write(ctx, current)
+}
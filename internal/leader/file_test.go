@@ -0,0 +1,203 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFileLeaseStore(t *testing.T) (*fileLeaseStore, func()) {
+	dir, err := ioutil.TempDir("", "leader_*")
+	assert.NoError(t, err)
+	store, err := NewFileLeaseStore(context.Background(), path.Join(dir, "leader.json"), 1*time.Minute)
+	assert.NoError(t, err)
+	return store.(*fileLeaseStore), func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func testLease(holder string, duration time.Duration) *apitypes.LeaderLease {
+	now := fftypes.Now()
+	expires := fftypes.FFTime(now.Time().Add(duration))
+	return &apitypes.LeaderLease{
+		Name:    "fftm",
+		Holder:  holder,
+		Renewed: now,
+		Expires: &expires,
+	}
+}
+
+func TestFileLeaseStoreAcquireRenewRelease(t *testing.T) {
+
+	f, done := newTestFileLeaseStore(t)
+	defer done()
+	ctx := context.Background()
+
+	lease, err := f.AcquireLease(ctx, testLease("instance1", 1*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+
+	// Another instance cannot take the lease
+	lease, err = f.AcquireLease(ctx, testLease("instance2", 1*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+
+	// The holder can renew
+	lease, err = f.AcquireLease(ctx, testLease("instance1", 1*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+
+	// Release by another instance has no effect
+	err = f.ReleaseLease(ctx, "fftm", "instance2")
+	assert.NoError(t, err)
+	lease, err = f.AcquireLease(ctx, testLease("instance2", 1*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+
+	// Once released, another instance can take over
+	err = f.ReleaseLease(ctx, "fftm", "instance1")
+	assert.NoError(t, err)
+	lease, err = f.AcquireLease(ctx, testLease("instance2", 1*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance2", lease.Holder)
+
+}
+
+func TestFileLeaseStoreExpiry(t *testing.T) {
+
+	f, done := newTestFileLeaseStore(t)
+	defer done()
+	ctx := context.Background()
+
+	_, err := f.AcquireLease(ctx, testLease("instance1", -1*time.Second))
+	assert.NoError(t, err)
+
+	lease, err := f.AcquireLease(ctx, testLease("instance2", 1*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance2", lease.Holder)
+
+}
+
+func TestFileLeaseStorePathMissing(t *testing.T) {
+	_, err := NewFileLeaseStore(context.Background(), "", 1*time.Minute)
+	assert.Regexp(t, "FF21089", err)
+}
+
+func TestFileLeaseStoreLocked(t *testing.T) {
+
+	f, done := newTestFileLeaseStore(t)
+	defer done()
+	ctx := context.Background()
+
+	err := ioutil.WriteFile(f.path+".lock", []byte{}, 0600)
+	assert.NoError(t, err)
+	f.lockWait = 0
+
+	_, err = f.AcquireLease(ctx, testLease("instance1", 1*time.Minute))
+	assert.Regexp(t, "FF21090", err)
+
+	err = f.ReleaseLease(ctx, "fftm", "instance1")
+	assert.Regexp(t, "FF21090", err)
+
+}
+
+func TestFileLeaseStoreWaitForLock(t *testing.T) {
+
+	f, done := newTestFileLeaseStore(t)
+	defer done()
+	ctx := context.Background()
+
+	err := ioutil.WriteFile(f.path+".lock", []byte{}, 0600)
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Remove(f.path + ".lock")
+	}()
+
+	lease, err := f.AcquireLease(ctx, testLease("instance1", 1*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+
+}
+
+func TestFileLeaseStoreStaleLock(t *testing.T) {
+
+	f, done := newTestFileLeaseStore(t)
+	defer done()
+	ctx := context.Background()
+
+	err := ioutil.WriteFile(f.path+".lock", []byte{}, 0600)
+	assert.NoError(t, err)
+	f.staleLock = 0
+
+	lease, err := f.AcquireLease(ctx, testLease("instance1", 1*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+
+}
+
+func TestFileLeaseStoreLockFail(t *testing.T) {
+
+	f, done := newTestFileLeaseStore(t)
+	defer done()
+	ctx := context.Background()
+	f.path = path.Join(f.path, "missing", "leader.json")
+
+	_, err := f.AcquireLease(ctx, testLease("instance1", 1*time.Minute))
+	assert.Regexp(t, "FF21091", err)
+
+}
+
+func TestFileLeaseStoreReadFail(t *testing.T) {
+
+	f, done := newTestFileLeaseStore(t)
+	defer done()
+	ctx := context.Background()
+
+	err := ioutil.WriteFile(f.path, []byte("!json"), 0600)
+	assert.NoError(t, err)
+
+	_, err = f.AcquireLease(ctx, testLease("instance1", 1*time.Minute))
+	assert.Regexp(t, "FF21091", err)
+
+	err = f.ReleaseLease(ctx, "fftm", "instance1")
+	assert.Regexp(t, "FF21091", err)
+
+}
+
+func TestFileLeaseStoreWriteFail(t *testing.T) {
+
+	f, done := newTestFileLeaseStore(t)
+	defer done()
+	ctx := context.Background()
+
+	err := os.Mkdir(f.path+".tmp", 0700)
+	assert.NoError(t, err)
+
+	_, err = f.AcquireLease(ctx, testLease("instance1", 1*time.Minute))
+	assert.Regexp(t, "FF21091", err)
+
+}
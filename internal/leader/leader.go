@@ -0,0 +1,86 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+)
+
+const (
+	ModeNone        = "none"
+	ModePersistence = "persistence"
+	ModeFile        = "file"
+)
+
+// LeaseStore provides atomic check-and-update of a lease, shared between the instances
+// participating in the election
+type LeaseStore interface {
+	AcquireLease(ctx context.Context, lease *apitypes.LeaderLease) (*apitypes.LeaderLease, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// Elector acquires and renews a time bound lease on leadership, so that only one of a set
+// of active/passive instances runs the policy loop, block listener and event streams
+type Elector interface {
+	ID() string
+	Acquire(ctx context.Context) (*apitypes.LeaderLease, error) // acquires or renews the lease, returning the current lease which might be held by another instance
+	Release(ctx context.Context) error                          // gives up the lease if held, so another instance can take over without waiting for it to expire
+}
+
+type leaseElector struct {
+	store    LeaseStore
+	name     string
+	id       string
+	url      string
+	duration time.Duration
+}
+
+// NewLeaseElector returns an elector for the named lease. The URL of the API of this instance is recorded
+// in the lease while it is held, so followers can forward read-only requests to the leader.
+func NewLeaseElector(store LeaseStore, name, id, url string, duration time.Duration) Elector {
+	return &leaseElector{
+		store:    store,
+		name:     name,
+		id:       id,
+		url:      url,
+		duration: duration,
+	}
+}
+
+func (e *leaseElector) ID() string {
+	return e.id
+}
+
+func (e *leaseElector) Acquire(ctx context.Context) (*apitypes.LeaderLease, error) {
+	now := fftypes.Now()
+	expires := fftypes.FFTime(now.Time().Add(e.duration))
+	return e.store.AcquireLease(ctx, &apitypes.LeaderLease{
+		Name:    e.name,
+		Holder:  e.id,
+		Renewed: now,
+		Expires: &expires,
+		URL:     e.url,
+	})
+}
+
+func (e *leaseElector) Release(ctx context.Context) error {
+	return e.store.ReleaseLease(ctx, e.name, e.id)
+}
@@ -0,0 +1,59 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leader
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLeaseStore struct {
+	acquired   *apitypes.LeaderLease
+	releaseErr error
+}
+
+func (s *testLeaseStore) AcquireLease(ctx context.Context, lease *apitypes.LeaderLease) (*apitypes.LeaderLease, error) {
+	s.acquired = lease
+	return lease, nil
+}
+
+func (s *testLeaseStore) ReleaseLease(ctx context.Context, name, holder string) error {
+	return s.releaseErr
+}
+
+func TestLeaseElectorAcquireRelease(t *testing.T) {
+
+	ctx := context.Background()
+	store := &testLeaseStore{releaseErr: fmt.Errorf("pop")}
+
+	e := NewLeaseElector(store, "fftm", "instance1", "http://instance1:5008", 15*time.Second)
+	assert.Equal(t, "instance1", e.ID())
+
+	lease, err := e.Acquire(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+	assert.Equal(t, "fftm", store.acquired.Name)
+	assert.Equal(t, 15*time.Second, store.acquired.Expires.Time().Sub(*store.acquired.Renewed.Time()))
+
+	err = e.Release(ctx)
+	assert.Regexp(t, "pop", err)
+}
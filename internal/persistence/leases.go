@@ -0,0 +1,53 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-transaction-manager/internal/leader"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+)
+
+const levelDBLeaseFile = "LEADER_LEASE"
+
+// NewLeaseStore returns a store for leader leases, kept with the persistence shared by the instances in the
+// election. Followers do not open persistence, so the store must be usable without it. As only one process can
+// open a LevelDB database, the lease is kept in a file alongside the database files in the LevelDB directory.
+func NewLeaseStore(ctx context.Context, staleLock time.Duration) (leader.LeaseStore, error) {
+	pType := config.GetString(tmconfig.PersistenceType)
+	switch pType {
+	case "leveldb":
+		dbPath := config.GetString(tmconfig.PersistenceLevelDBPath)
+		if dbPath == "" {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgLevelDBPathMissing)
+		}
+		// The first leader to start creates the database, but the lease is needed before that
+		if err := os.MkdirAll(dbPath, 0755); err != nil {
+			return nil, i18n.WrapError(ctx, err, tmmsgs.MsgPersistenceInitFailed, dbPath)
+		}
+		return leader.NewFileLeaseStore(ctx, filepath.Join(dbPath, levelDBLeaseFile), staleLock)
+	default:
+		return nil, i18n.NewError(ctx, tmmsgs.MsgUnknownPersistence, pType)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persistence
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelDBLeaseStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "ldb_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dbDir := path.Join(dir, "db")
+
+	tmconfig.Reset()
+	config.Set(tmconfig.PersistenceLevelDBPath, dbDir)
+	ctx := context.Background()
+
+	// The lease can be acquired before the database is created
+	store, err := NewLeaseStore(ctx, time.Minute)
+	assert.NoError(t, err)
+	now := fftypes.Now()
+	expires := fftypes.FFTime(now.Time().Add(time.Minute))
+	lease, err := store.AcquireLease(ctx, &apitypes.LeaderLease{Name: "fftm", Holder: "instance1", Renewed: now, Expires: &expires})
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+	_, err = os.Stat(path.Join(dbDir, levelDBLeaseFile))
+	assert.NoError(t, err)
+
+	// The database opens with the lease alongside it, while the lease is still accessible
+	p, err := NewLevelDBPersistence(ctx)
+	assert.NoError(t, err)
+	defer p.Close(ctx)
+	lease, err = store.AcquireLease(ctx, &apitypes.LeaderLease{Name: "fftm", Holder: "instance2", Renewed: now})
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", lease.Holder)
+
+}
+
+func TestLevelDBLeaseStoreBadConfig(t *testing.T) {
+
+	tmconfig.Reset()
+	ctx := context.Background()
+
+	_, err := NewLeaseStore(ctx, time.Minute)
+	assert.Regexp(t, "FF21050", err)
+
+	dir, err := ioutil.TempDir("", "ldb_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	notADir := path.Join(dir, "file")
+	err = ioutil.WriteFile(notADir, []byte{}, 0664)
+	assert.NoError(t, err)
+	config.Set(tmconfig.PersistenceLevelDBPath, path.Join(notADir, "db"))
+	_, err = NewLeaseStore(ctx, time.Minute)
+	assert.Regexp(t, "FF21058", err)
+
+	config.Set(tmconfig.PersistenceType, "wrong")
+	_, err = NewLeaseStore(ctx, time.Minute)
+	assert.Regexp(t, "FF21043", err)
+
+}
@@ -17,6 +17,7 @@
 package persistence
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -77,6 +78,11 @@ const txPendingIndexPrefix = "tx_inflight_0/"
 const txPendingIndexEnd = "tx_inflight_1"
 const txCreatedIndexPrefix = "tx_created_0/"
 const txCreatedIndexEnd = "tx_created_1"
+const txDeployIndexPrefix = "tx_deploy_0/"
+const txDeployIndexEnd = "tx_deploy_1"
+const policyEngineConfigPrefix = "policyengine_config_0/"
+const signerStatePrefix = "signer_state_0/"
+const signerStateEnd = "signer_state_1"
 
 func signerNoncePrefix(signer string) string {
 	return fmt.Sprintf("%s%s_0/", nonceAllocationPrefix, signer)
@@ -98,10 +104,22 @@ func txCreatedIndexKey(tx *apitypes.ManagedTX) []byte {
 	return []byte(fmt.Sprintf("%s%.19d/%s", txCreatedIndexPrefix, tx.Created.UnixNano(), tx.SequenceID))
 }
 
+func txDeployIndexKey(tx *apitypes.ManagedTX) []byte {
+	return []byte(fmt.Sprintf("%s%.19d/%s", txDeployIndexPrefix, tx.Created.UnixNano(), tx.SequenceID))
+}
+
 func txDataKey(k string) []byte {
 	return []byte(fmt.Sprintf("%s%s", transactionsPrefix, k))
 }
 
+func policyEngineConfigKey(name string) []byte {
+	return []byte(fmt.Sprintf("%s%s", policyEngineConfigPrefix, name))
+}
+
+func signerStateKey(signer string) []byte {
+	return []byte(fmt.Sprintf("%s%s", signerStatePrefix, signer))
+}
+
 func prefixedKey(prefix string, id fmt.Stringer) []byte {
 	return []byte(fmt.Sprintf("%s%s", prefix, id))
 }
@@ -372,6 +390,14 @@ func (p *leveldbPersistence) ListTransactionsByCreateTime(ctx context.Context, a
 	return p.listTransactionsByIndex(ctx, txCreatedIndexPrefix, txCreatedIndexEnd, afterStr, limit, dir)
 }
 
+func (p *leveldbPersistence) ListDeployments(ctx context.Context, after *apitypes.ManagedTX, limit int, dir SortDirection) ([]*apitypes.ManagedTX, error) {
+	afterStr := ""
+	if after != nil {
+		afterStr = fmt.Sprintf("%.19d/%s", after.Created.UnixNano(), after.SequenceID)
+	}
+	return p.listTransactionsByIndex(ctx, txDeployIndexPrefix, txDeployIndexEnd, afterStr, limit, dir)
+}
+
 func (p *leveldbPersistence) ListTransactionsByNonce(ctx context.Context, signer string, after *fftypes.FFBigInt, limit int, dir SortDirection) ([]*apitypes.ManagedTX, error) {
 	afterStr := ""
 	if after != nil {
@@ -433,6 +459,9 @@ func (p *leveldbPersistence) WriteTransaction(ctx context.Context, tx *apitypes.
 		if err == nil && tx.Status == apitypes.TxStatusPending {
 			err = p.writeKeyValue(ctx, txPendingIndexKey(tx.SequenceID), idKey)
 		}
+		if err == nil && tx.ContractDeploy {
+			err = p.writeKeyValue(ctx, txDeployIndexKey(tx), idKey)
+		}
 		if err == nil {
 			err = p.writeKeyValue(ctx, txNonceAllocationKey(tx.TransactionHeaders.From, tx.Nonce), idKey)
 		}
@@ -448,17 +477,57 @@ func (p *leveldbPersistence) WriteTransaction(ctx context.Context, tx *apitypes.
 }
 
 func (p *leveldbPersistence) DeleteTransaction(ctx context.Context, txID string) error {
+	p.txMux.Lock()
+	defer p.txMux.Unlock()
+
 	var tx *apitypes.ManagedTX
-	err := p.readJSON(ctx, txDataKey(txID), &tx)
+	idKey := txDataKey(txID)
+	err := p.readJSON(ctx, idKey, &tx)
 	if err != nil || tx == nil {
 		return err
 	}
-	return p.deleteKeys(ctx,
-		txDataKey(txID),
+	keys := [][]byte{
+		idKey,
 		txCreatedIndexKey(tx),
+		txDeployIndexKey(tx),
 		txPendingIndexKey(tx.SequenceID),
-		txNonceAllocationKey(tx.TransactionHeaders.From, tx.Nonce),
-	)
+	}
+	// The nonce of a transaction that failed before submission can be re-assigned to a later transaction,
+	// so we only delete the nonce allocation if it still points to this transaction
+	nonceKey := txNonceAllocationKey(tx.TransactionHeaders.From, tx.Nonce)
+	nonceIDKey, err := p.getKeyValue(ctx, nonceKey)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(nonceIDKey, idKey) {
+		keys = append(keys, nonceKey)
+	}
+	return p.deleteKeys(ctx, keys...)
+}
+
+func (p *leveldbPersistence) GetPolicyEngineConfig(ctx context.Context, name string) (peConfig *apitypes.PolicyEngineConfig, err error) {
+	err = p.readJSON(ctx, policyEngineConfigKey(name), &peConfig)
+	return peConfig, err
+}
+
+func (p *leveldbPersistence) WritePolicyEngineConfig(ctx context.Context, peConfig *apitypes.PolicyEngineConfig) error {
+	return p.writeJSON(ctx, policyEngineConfigKey(peConfig.Name), peConfig)
+}
+
+func (p *leveldbPersistence) ListSignerStates(ctx context.Context) ([]*apitypes.SignerState, error) {
+	states := make([]*apitypes.SignerState, 0)
+	if _, err := p.listJSON(ctx, signerStatePrefix, signerStateEnd, "", 0, SortDirectionAscending,
+		func() interface{} { var v *apitypes.SignerState; return &v },
+		func(v interface{}) { states = append(states, *(v.(**apitypes.SignerState))) },
+		nil,
+	); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (p *leveldbPersistence) WriteSignerState(ctx context.Context, state *apitypes.SignerState) error {
+	return p.writeJSON(ctx, signerStateKey(state.Signer), state)
 }
 
 func (p *leveldbPersistence) Close(ctx context.Context) {
@@ -259,6 +259,72 @@ func TestReadWriteCheckpoints(t *testing.T) {
 	assert.Equal(t, cp2.StreamID, cp.StreamID)
 }
 
+func TestReadWritePolicyEngineConfig(t *testing.T) {
+
+	p, done := newTestLevelDBPersistence(t)
+	defer done()
+
+	ctx := context.Background()
+	peConfig, err := p.GetPolicyEngineConfig(ctx, "simple")
+	assert.NoError(t, err)
+	assert.Nil(t, peConfig)
+
+	err = p.WritePolicyEngineConfig(ctx, &apitypes.PolicyEngineConfig{
+		Name:    "simple",
+		Updated: fftypes.Now(),
+		Config: fftypes.JSONObject{
+			"fixedGasPrice": "12345",
+		},
+	})
+	assert.NoError(t, err)
+
+	peConfig, err = p.GetPolicyEngineConfig(ctx, "simple")
+	assert.NoError(t, err)
+	assert.Equal(t, "simple", peConfig.Name)
+	assert.Equal(t, "12345", peConfig.Config.GetString("fixedGasPrice"))
+
+	peConfig, err = p.GetPolicyEngineConfig(ctx, "other")
+	assert.NoError(t, err)
+	assert.Nil(t, peConfig)
+}
+
+func TestReadWriteSignerStates(t *testing.T) {
+
+	p, done := newTestLevelDBPersistence(t)
+	defer done()
+
+	ctx := context.Background()
+	states, err := p.ListSignerStates(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, states)
+
+	err = p.WriteSignerState(ctx, &apitypes.SignerState{Signer: "0xbbbbb", Paused: true, Updated: fftypes.Now()})
+	assert.NoError(t, err)
+	err = p.WriteSignerState(ctx, &apitypes.SignerState{Signer: "0xaaaaa", Paused: true, Updated: fftypes.Now()})
+	assert.NoError(t, err)
+	err = p.WriteSignerState(ctx, &apitypes.SignerState{Signer: "0xbbbbb", Paused: false, Updated: fftypes.Now()})
+	assert.NoError(t, err)
+
+	states, err = p.ListSignerStates(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, states, 2)
+	assert.Equal(t, "0xaaaaa", states[0].Signer)
+	assert.True(t, states[0].Paused)
+	assert.Equal(t, "0xbbbbb", states[1].Signer)
+	assert.False(t, states[1].Paused)
+}
+
+func TestListSignerStatesFail(t *testing.T) {
+
+	p, done := newTestLevelDBPersistence(t)
+	defer done()
+
+	err := p.writeKeyValue(context.Background(), signerStateKey("0xaaaaa"), []byte("!json"))
+	assert.NoError(t, err)
+	_, err = p.ListSignerStates(context.Background())
+	assert.Regexp(t, "FF21054", err)
+}
+
 func newTestTX(signer string, nonce int64, status apitypes.TxStatus) *apitypes.ManagedTX {
 	return &apitypes.ManagedTX{
 		ID:      fmt.Sprintf("ns1/%s", fftypes.NewUUID()),
@@ -352,6 +418,47 @@ func TestReadWriteManagedTransactions(t *testing.T) {
 	assert.Nil(t, v)
 }
 
+func TestReadWriteDeployments(t *testing.T) {
+
+	p, done := newTestLevelDBPersistence(t)
+	defer done()
+
+	ctx := context.Background()
+	submitNewTX := func(nonce int64, deploy bool) *apitypes.ManagedTX {
+		tx := newTestTX("0xaaaaa", nonce, apitypes.TxStatusPending)
+		tx.ContractDeploy = deploy
+		err := p.WriteTransaction(ctx, tx, true)
+		assert.NoError(t, err)
+		return tx
+	}
+
+	d1 := submitNewTX(10001, true)
+	submitNewTX(10002, false)
+	d2 := submitNewTX(10003, true)
+	d3 := submitNewTX(10004, true)
+
+	txns, err := p.ListDeployments(ctx, nil, 0, SortDirectionAscending)
+	assert.NoError(t, err)
+	assert.Len(t, txns, 3)
+	assert.Equal(t, d1.ID, txns[0].ID)
+	assert.Equal(t, d2.ID, txns[1].ID)
+	assert.Equal(t, d3.ID, txns[2].ID)
+
+	txns, err = p.ListDeployments(ctx, d3, 1, SortDirectionDescending)
+	assert.NoError(t, err)
+	assert.Len(t, txns, 1)
+	assert.Equal(t, d2.ID, txns[0].ID)
+
+	// Deleting the transaction removes it from the deployment index
+	err = p.DeleteTransaction(ctx, d2.ID)
+	assert.NoError(t, err)
+	txns, err = p.ListDeployments(ctx, nil, 0, SortDirectionDescending)
+	assert.NoError(t, err)
+	assert.Len(t, txns, 2)
+	assert.Equal(t, d3.ID, txns[0].ID)
+	assert.Equal(t, d1.ID, txns[1].ID)
+}
+
 func TestListStreamsBadJSON(t *testing.T) {
 	p, done := newTestLevelDBPersistence(t)
 	defer done()
@@ -635,3 +742,30 @@ func TestDeleteTransactionMissing(t *testing.T) {
 	assert.NoError(t, err)
 
 }
+
+func TestDeleteTransactionNonceReassigned(t *testing.T) {
+	p, done := newTestLevelDBPersistence(t)
+	defer done()
+
+	ctx := context.Background()
+	failed := newTestTX("0xaaaaa", 10001, apitypes.TxStatusFailed)
+	err := p.WriteTransaction(ctx, failed, true)
+	assert.NoError(t, err)
+	reissued := newTestTX("0xaaaaa", 10001, apitypes.TxStatusPending)
+	err = p.WriteTransaction(ctx, reissued, true)
+	assert.NoError(t, err)
+
+	// Deleting the failed transaction leaves the nonce allocation of the transaction it was re-issued to
+	err = p.DeleteTransaction(ctx, failed.ID)
+	assert.NoError(t, err)
+	tx, err := p.GetTransactionByNonce(ctx, "0xaaaaa", fftypes.NewFFBigInt(10001))
+	assert.NoError(t, err)
+	assert.Equal(t, reissued.ID, tx.ID)
+
+	err = p.DeleteTransaction(ctx, reissued.ID)
+	assert.NoError(t, err)
+	tx, err = p.GetTransactionByNonce(ctx, "0xaaaaa", fftypes.NewFFBigInt(10001))
+	assert.NoError(t, err)
+	assert.Nil(t, tx)
+
+}
@@ -42,10 +42,17 @@ type Persistence interface {
 	ListTransactionsByCreateTime(ctx context.Context, after *apitypes.ManagedTX, limit int, dir SortDirection) ([]*apitypes.ManagedTX, error)         // reverse create time order
 	ListTransactionsByNonce(ctx context.Context, signer string, after *fftypes.FFBigInt, limit int, dir SortDirection) ([]*apitypes.ManagedTX, error) // reverse nonce order within signer
 	ListTransactionsPending(ctx context.Context, after *fftypes.UUID, limit int, dir SortDirection) ([]*apitypes.ManagedTX, error)                    // reverse UUIDv1 order, only those in pending state
+	ListDeployments(ctx context.Context, after *apitypes.ManagedTX, limit int, dir SortDirection) ([]*apitypes.ManagedTX, error)                      // reverse create time order, only those that deploy a contract
 	GetTransactionByID(ctx context.Context, txID string) (*apitypes.ManagedTX, error)
 	GetTransactionByNonce(ctx context.Context, signer string, nonce *fftypes.FFBigInt) (*apitypes.ManagedTX, error)
 	WriteTransaction(ctx context.Context, tx *apitypes.ManagedTX, new bool) error // must reject if new is true, and the request ID is no
 	DeleteTransaction(ctx context.Context, txID string) error
 
+	GetPolicyEngineConfig(ctx context.Context, name string) (*apitypes.PolicyEngineConfig, error)
+	WritePolicyEngineConfig(ctx context.Context, peConfig *apitypes.PolicyEngineConfig) error
+
+	ListSignerStates(ctx context.Context) ([]*apitypes.SignerState, error)
+	WriteSignerState(ctx context.Context, state *apitypes.SignerState) error
+
 	Close(ctx context.Context)
 }
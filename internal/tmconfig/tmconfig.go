@@ -31,9 +31,23 @@ var (
 	ConfirmationsStaleReceiptTimeout              = ffc("confirmations.staleReceiptTimeout")
 	ConfirmationsNotificationQueueLength          = ffc("confirmations.notificationQueueLength")
 	TransactionsErrorHistoryCount                 = ffc("transactions.errorHistoryCount")
+	TransactionsHistoryCount                      = ffc("transactions.historyCount")
 	TransactionsMaxInFlight                       = ffc("transactions.maxInFlight")
 	TransactionsNonceStateTimeout                 = ffc("transactions.nonceStateTimeout")
+	TransactionsIdempotentResubmit                = ffc("transactions.idempotentResubmit")
+	TransactionsRawResubmitInterval               = ffc("transactions.rawResubmitInterval")
+	TransactionsRateLimitCount                    = ffc("transactions.rateLimit.count")
+	TransactionsRateLimitInterval                 = ffc("transactions.rateLimit.interval")
+	TransactionsRateLimitSigners                  = ffc("transactions.rateLimit.signers")
+	TransactionsSpendLimitLimit                   = ffc("transactions.spendLimit.limit")
+	TransactionsSpendLimitWindow                  = ffc("transactions.spendLimit.window")
+	TransactionsSpendLimitAction                  = ffc("transactions.spendLimit.action")
+	TransactionsSpendLimitSigners                 = ffc("transactions.spendLimit.signers")
+	TransactionsInsufficientFundsPark             = ffc("transactions.insufficientFunds.park")
+	TransactionsInsufficientFundsCheckInterval    = ffc("transactions.insufficientFunds.checkInterval")
+	TransactionsInsufficientFundsMinBalance       = ffc("transactions.insufficientFunds.minBalance")
 	PolicyLoopInterval                            = ffc("policyloop.interval")
+	PolicyLoopWorkers                             = ffc("policyloop.workers")
 	PolicyLoopRetryInitDelay                      = ffc("policyloop.retry.initialDelay")
 	PolicyLoopRetryMaxDelay                       = ffc("policyloop.retry.maxDelay")
 	PolicyLoopRetryFactor                         = ffc("policyloop.retry.factor")
@@ -57,6 +71,24 @@ var (
 	APIDefaultRequestTimeout                      = ffc("api.defaultRequestTimeout")
 	APIMaxRequestTimeout                          = ffc("api.maxRequestTimeout")
 	DebugPort                                     = ffc("debug.port")
+	DrainTimeout                                  = ffc("drain.timeout")
+	DrainSignal                                   = ffc("drain.signal")
+	LeaderMode                                    = ffc("leader.mode")
+	LeaderID                                      = ffc("leader.id")
+	LeaderLeaseName                               = ffc("leader.leaseName")
+	LeaderLeaseDuration                           = ffc("leader.leaseDuration")
+	LeaderRenewInterval                           = ffc("leader.renewInterval")
+	LeaderFilePath                                = ffc("leader.file.path")
+	LeaderURL                                     = ffc("leader.url")
+	ResilienceTimeout                             = ffc("resilience.timeout")
+	ResilienceRetryCount                          = ffc("resilience.retry.count")
+	ResilienceRetryInitDelay                      = ffc("resilience.retry.initialDelay")
+	ResilienceRetryMaxDelay                       = ffc("resilience.retry.maxDelay")
+	ResilienceRetryFactor                         = ffc("resilience.retry.factor")
+	ResilienceRetryReasons                        = ffc("resilience.retry.reasons")
+	ResilienceCircuitBreakerFailures              = ffc("resilience.circuitBreaker.failures")
+	ResilienceCircuitBreakerResetTimeout          = ffc("resilience.circuitBreaker.resetTimeout")
+	ResilienceCircuitBreakerReasons               = ffc("resilience.circuitBreaker.reasons")
 )
 
 var APIConfig config.Section
@@ -65,17 +97,86 @@ var CorsConfig config.Section
 
 var PolicyEngineBaseConfig config.Section
 
+// PolicyEngineInstancesConfig is an array of additional named policy engine instances, which can be
+// selected per transaction. Each entry has a name, a type, and a sub-section for the configuration of
+// the policy engine of that type
+var PolicyEngineInstancesConfig config.ArraySection
+
+const (
+	PolicyEngineInstanceName = "name"
+	PolicyEngineInstanceType = "type"
+)
+
+// TransactionsFailureRulesConfig is an ordered array of rules, that map repeated errors returned by the
+// policy engine for a transaction to an outcome
+var TransactionsFailureRulesConfig config.ArraySection
+
+const (
+	FailureRuleReasons  = "reasons"
+	FailureRuleFailures = "failures"
+	FailureRuleDuration = "duration"
+	FailureRuleAction   = "action"
+)
+
+// TransactionsSignerPolicyConfig is an array of the signers permitted to submit transactions, each with
+// optional restrictions. When empty, any signer is permitted
+var TransactionsSignerPolicyConfig config.ArraySection
+
+const (
+	SignerPolicySigner   = "signer"
+	SignerPolicyTo       = "to"
+	SignerPolicyMaxValue = "maxValue"
+)
+
+// TransactionsSpendLimitWindowsConfig is an array of additional rolling windows for the spend limit, such
+// as a per-hour limit alongside the per-day limit, each with its own default limit and signer overrides
+var TransactionsSpendLimitWindowsConfig config.ArraySection
+
+const (
+	SpendLimitWindowWindow  = "window"
+	SpendLimitWindowLimit   = "limit"
+	SpendLimitWindowSigners = "signers"
+)
+
+// ResilienceMethodsConfig is an array of overrides of the timeout and retry count of calls to the
+// connector, for individual connector methods
+var ResilienceMethodsConfig config.ArraySection
+
+const (
+	ResilienceMethodName       = "name"
+	ResilienceMethodTimeout    = "timeout"
+	ResilienceMethodRetryCount = "retryCount"
+)
+
 var WebhookPrefix config.Section
 
+const (
+	SignerAlertsTopic = "topic"
+)
+
+// SignerAlertsConfig is an optional webhook, that is called when a signer is parked automatically,
+// and when a parked signer is resumed. Alerts are always broadcast on a websocket topic.
+var SignerAlertsConfig config.Section
+
 func setDefaults() {
 	viper.SetDefault(string(TransactionsMaxInFlight), 100)
 	viper.SetDefault(string(TransactionsErrorHistoryCount), 25)
+	viper.SetDefault(string(TransactionsHistoryCount), 50)
 	viper.SetDefault(string(TransactionsNonceStateTimeout), "1h")
+	viper.SetDefault(string(TransactionsIdempotentResubmit), false)
+	viper.SetDefault(string(TransactionsRawResubmitInterval), "5m")
+	viper.SetDefault(string(TransactionsRateLimitCount), 0)
+	viper.SetDefault(string(TransactionsRateLimitInterval), "1s")
+	viper.SetDefault(string(TransactionsSpendLimitWindow), "24h")
+	viper.SetDefault(string(TransactionsSpendLimitAction), "hold")
+	viper.SetDefault(string(TransactionsInsufficientFundsPark), true)
+	viper.SetDefault(string(TransactionsInsufficientFundsCheckInterval), "1m")
 	viper.SetDefault(string(ConfirmationsRequired), 20)
 	viper.SetDefault(string(ConfirmationsBlockQueueLength), 50)
 	viper.SetDefault(string(ConfirmationsNotificationQueueLength), 50)
 	viper.SetDefault(string(ConfirmationsStaleReceiptTimeout), "1m")
 	viper.SetDefault(string(PolicyLoopInterval), "10s")
+	viper.SetDefault(string(PolicyLoopWorkers), 1)
 	viper.SetDefault(string(PolicyEngineName), "simple")
 
 	viper.SetDefault(string(EventStreamsDefaultsBatchSize), 50)
@@ -102,6 +203,21 @@ func setDefaults() {
 	viper.SetDefault(string(EventStreamsRetryMaxDelay), "30s")
 	viper.SetDefault(string(EventStreamsRetryFactor), 2.0)
 	viper.SetDefault(string(DebugPort), -1)
+	viper.SetDefault(string(DrainTimeout), "30s")
+	viper.SetDefault(string(DrainSignal), true)
+	viper.SetDefault(string(LeaderMode), "none")
+	viper.SetDefault(string(LeaderLeaseName), "fftm")
+	viper.SetDefault(string(LeaderLeaseDuration), "15s")
+	viper.SetDefault(string(LeaderRenewInterval), "5s")
+	viper.SetDefault(string(ResilienceTimeout), "0")
+	viper.SetDefault(string(ResilienceRetryCount), 0)
+	viper.SetDefault(string(ResilienceRetryInitDelay), "250ms")
+	viper.SetDefault(string(ResilienceRetryMaxDelay), "5s")
+	viper.SetDefault(string(ResilienceRetryFactor), 2.0)
+	viper.SetDefault(string(ResilienceRetryReasons), []string{"downstream_down"})
+	viper.SetDefault(string(ResilienceCircuitBreakerFailures), 0)
+	viper.SetDefault(string(ResilienceCircuitBreakerResetTimeout), "30s")
+	viper.SetDefault(string(ResilienceCircuitBreakerReasons), []string{"downstream_down"})
 }
 
 func Reset() {
@@ -117,6 +233,34 @@ func Reset() {
 	ffresty.InitConfig(WebhookPrefix)
 
 	PolicyEngineBaseConfig = config.RootSection("policyengine")
+	PolicyEngineInstancesConfig = PolicyEngineBaseConfig.SubArray("instances")
+	PolicyEngineInstancesConfig.AddKnownKey(PolicyEngineInstanceName)
+	PolicyEngineInstancesConfig.AddKnownKey(PolicyEngineInstanceType)
 	// policy engines must be registered outside of this package
 
+	TransactionsFailureRulesConfig = config.RootSection("transactions").SubArray("failureRules")
+	TransactionsFailureRulesConfig.AddKnownKey(FailureRuleReasons)
+	TransactionsFailureRulesConfig.AddKnownKey(FailureRuleFailures, 0)
+	TransactionsFailureRulesConfig.AddKnownKey(FailureRuleDuration)
+	TransactionsFailureRulesConfig.AddKnownKey(FailureRuleAction, "fail")
+
+	TransactionsSignerPolicyConfig = config.RootSection("transactions").SubArray("signerPolicy")
+	TransactionsSignerPolicyConfig.AddKnownKey(SignerPolicySigner)
+	TransactionsSignerPolicyConfig.AddKnownKey(SignerPolicyTo)
+	TransactionsSignerPolicyConfig.AddKnownKey(SignerPolicyMaxValue)
+
+	TransactionsSpendLimitWindowsConfig = config.RootSection("transactions").SubSection("spendLimit").SubArray("windows")
+	TransactionsSpendLimitWindowsConfig.AddKnownKey(SpendLimitWindowWindow)
+	TransactionsSpendLimitWindowsConfig.AddKnownKey(SpendLimitWindowLimit)
+	TransactionsSpendLimitWindowsConfig.AddKnownKey(SpendLimitWindowSigners)
+
+	SignerAlertsConfig = config.RootSection("transactions").SubSection("signerAlerts")
+	ffresty.InitConfig(SignerAlertsConfig)
+	SignerAlertsConfig.AddKnownKey(SignerAlertsTopic, "fftm_signer_alerts")
+
+	ResilienceMethodsConfig = config.RootSection("resilience").SubArray("methods")
+	ResilienceMethodsConfig.AddKnownKey(ResilienceMethodName)
+	ResilienceMethodsConfig.AddKnownKey(ResilienceMethodTimeout)
+	ResilienceMethodsConfig.AddKnownKey(ResilienceMethodRetryCount)
+
 }
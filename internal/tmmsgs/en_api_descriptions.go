@@ -27,7 +27,7 @@ var ffm = func(key, translation string) i18n.MessageKey {
 
 //revive:disable
 var (
-	APIEndpointPostRoot                     = ffm("api.endpoints.post.root", "RPC/webhook style interface initiate a submit transactions, and execute queries")
+	APIEndpointPostRoot                     = ffm("api.endpoints.post.root", "RPC/webhook style interface initiate a submit transactions, and execute queries. A PrepareTransaction request assigns a nonce and returns the unsigned transaction, for signing outside of the connector. A SendRawTransaction request broadcasts and tracks a transaction that is already signed")
 	APIEndpointPostRootQueryOutput          = ffm("api.endpoints.post.root.query.output", "The data result of a query against a smart contract")
 	APIEndpointPostEventStream              = ffm("api.endpoints.post.eventstreams", "Create a new event stream")
 	APIEndpointPatchEventStream             = ffm("api.endpoints.patch.eventstreams", "Update an existing event stream")
@@ -37,7 +37,23 @@ var (
 	APIEndpointGetEventStream               = ffm("api.endpoints.get.eventstream", "Get an event stream with status")
 	APIEndpointDeleteEventStream            = ffm("api.endpoints.delete.eventstream", "Delete an event stream")
 	APIEndpointDeleteTransaction            = ffm("api.endpoints.delete.transaction", "Request transaction deletion by the policy engine. Result could be immediate (200), asynchronous (202), or rejected with an error")
+	APIEndpointPostTransactionSigned        = ffm("api.endpoints.post.transaction.signed", "Submit a transaction that was prepared for external signing with a PrepareTransaction request, once it has been signed. Receipts and confirmations are then tracked as for any other transaction")
+	APIEndpointGetDeployments               = ffm("api.endpoints.get.deployments", "List the transactions that deploy a contract, including the location of each deployed contract once the deployment is confirmed")
+	APIEndpointGetGasOracle                 = ffm("api.endpoints.get.gasoracle", "Get the status of the gas price sources of each policy engine, including the health and last value of each source")
+	APIEndpointGetPolicyEngineConfig        = ffm("api.endpoints.get.policyengine.config", "Get the runtime configuration overrides applied to the policy engine")
+	APIEndpointPutPolicyEngineConfig        = ffm("api.endpoints.put.policyengine.config", "Replace the runtime configuration overrides applied to the policy engine. The new configuration is validated, persisted, and applied between policy loop cycles")
+	APIEndpointGetRateLimits                = ffm("api.endpoints.get.ratelimits", "List the current token bucket state of the transaction submission rate limit for each signer")
+	APIEndpointGetSpendLimits               = ffm("api.endpoints.get.spendlimits", "List the spend in the current rolling window for each signer with a spend limit")
+	APIEndpointPostSpendLimitReset          = ffm("api.endpoints.post.spendlimit.reset", "Operator override to clear the spend recorded in the rolling window for a signer, allowing held transactions to be submitted")
+	APIEndpointGetSignerNonce               = ffm("api.endpoints.get.signer.nonce", "Get the nonce management state for a signer, including the next nonce that would be assigned and the next nonce reported by the blockchain node")
+	APIEndpointPutSignerNonce               = ffm("api.endpoints.put.signer.nonce", "Operator override to set the nonce that will be assigned to the next transaction submitted for a signer. The override is persisted until a transaction is assigned the nonce. A nonce at or below that of a pending transaction for the signer is rejected, unless force is set")
+	APIEndpointPostSignerPause              = ffm("api.endpoints.post.signer.pause", "Pause transaction processing for a signer. No nonces are assigned to new transactions, and no transactions are submitted, until the signer is resumed. Receipts continue to be tracked for transactions already submitted")
+	APIEndpointGetStatusLeader              = ffm("api.endpoints.get.status.leader", "Get the leader election status of this instance, including the current holder of the leader lease")
+	APIEndpointPostDrain                    = ffm("api.endpoints.post.drain", "Start a graceful drain of the transaction manager. New transactions are rejected, pending transactions are submitted, and event streams deliver in-flight batches and write final checkpoints, before the transaction manager closes")
+	APIEndpointPostSignerResume             = ffm("api.endpoints.post.signer.resume", "Resume transaction processing for a paused signer, or a signer that was parked automatically")
+	APIEndpointPostSignerNonceResync        = ffm("api.endpoints.post.signer.nonce.resync", "Operator override to force the next transaction submitted for a signer to use the next nonce reported by the blockchain node, regardless of the transactions in the local state store")
 	APIEndpointGetStatusLive                = ffm("api.endpoints.get.status.live", "Get the liveness status of the connector")
+	APIEndpointGetStatusPolicyLoop          = ffm("api.endpoints.get.status.policyloop", "Get the status of the policy loop workers, including the duration of the last cycle of each worker")
 	APIEndpointGetStatusReady               = ffm("api.endpoints.get.status.ready", "Get the readiness status of the connector")
 	APIEndpointGetSubscriptions             = ffm("api.endpoints.get.subscriptions", "Get listeners - route deprecated in favor of /eventstreams/{streamId}/listeners")
 	APIEndpointGetSubscription              = ffm("api.endpoints.get.subscription", "Get listener - route deprecated in favor of /eventstreams/{streamId}/listeners/{listenerId}")
@@ -55,9 +71,11 @@ var (
 	APIParamStreamID      = ffm("api.params.streamId", "Event Stream ID")
 	APIParamListenerID    = ffm("api.params.listenerId", "Listener ID")
 	APIParamTransactionID = ffm("api.params.transactionId", "Transaction ID")
+	APIParamSigner        = ffm("api.params.signer", "Signing address")
 	APIParamLimit         = ffm("api.params.limit", "Maximum number of entries to return")
 	APIParamAfter         = ffm("api.params.after", "Return entries after this ID - for pagination (non-inclusive)")
 	APIParamTXSigner      = ffm("api.params.txSigner", "Return only transactions for a specific signing address, in reverse nonce order")
 	APIParamTXPending     = ffm("api.params.txPending", "Return only pending transactions, in reverse submission sequence (a 'sequenceId' is assigned to each transaction to determine its sequence")
 	APIParamSortDirection = ffm("api.params.sortDirection", "Sort direction: 'asc'/'ascending' or 'desc'/'descending'")
+	APIParamPolicyEngine  = ffm("api.params.policyEngine", "The name of a policy engine instance - the default policy engine if not specified")
 )
@@ -38,28 +38,101 @@ var (
 
 	ConfigDebugPort = ffc("config.debug.port", "An HTTP port on which to enable the go debugger", i18n.IntType)
 
+	ConfigDrainSignal  = ffc("config.drain.signal", "When true, a SIGTERM received by the process starts a graceful drain of the transaction manager, rather than requiring the caller to close it", i18n.BooleanType)
+	ConfigDrainTimeout = ffc("config.drain.timeout", "The maximum time to wait during a drain for pending transactions to be submitted, and for event streams to deliver in-flight batches and write final checkpoints, before closing", i18n.TimeDurationType)
+
+	ConfigLeaderFilePath      = ffc("config.leader.file.path", "The path of the lease file for the 'file' leader election mode, on a filesystem shared by all the instances on a single host", i18n.StringType)
+	ConfigLeaderID            = ffc("config.leader.id", "A unique identifier for this instance in leader election. Defaults to the hostname, with a random suffix", i18n.StringType)
+	ConfigLeaderLeaseDuration = ffc("config.leader.leaseDuration", "How long the leader lease is valid after each renewal. A follower takes over once the lease of the leader expires", i18n.TimeDurationType)
+	ConfigLeaderLeaseName     = ffc("config.leader.leaseName", "The name of the lease, which must be the same for all instances in the election", i18n.StringType)
+	ConfigLeaderMode          = ffc("config.leader.mode", "Active/passive high availability mode: 'none' to always run as leader, 'persistence' for a lease stored with the persistence shared by the instances (for LevelDB in a file in the database directory, as followers cannot open the database), or 'file' for a lease file shared by the instances on a single host. Only the leader opens persistence, so the persistence of all the instances must be the same storage, such as a LevelDB path on a shared volume. Only the leader runs the policy loop, block listener and event streams, and serves requests that change state - followers serve read-only requests by forwarding them to the leader (see leader.url), and status requests for themselves. A leader that fails to renew its lease before it expires closes, so it must be restarted to rejoin as a follower", i18n.StringType)
+	ConfigLeaderRenewInterval = ffc("config.leader.renewInterval", "How often the leader renews its lease, and followers attempt to acquire the lease. Must be less than the lease duration. A leader that has not renewed its lease steps down once it is within this interval of expiring, so a follower can never take over while it is still running", i18n.TimeDurationType)
+	ConfigLeaderURL           = ffc("config.leader.url", "The URL at which the other instances in the election can reach the API of this instance, such as 'http://fftm-0.fftm:5008'. It is recorded in the lease while this instance is leader, so that followers serve read-only (GET) requests by forwarding them to the leader. When not set, followers reject read-only requests while this instance is leader", i18n.StringType)
+
 	ConfigConfirmationsBlockCacheSize           = ffc("config.confirmations.blockCacheSize", "The maximum number of block headers to keep in the cache", i18n.IntType)
 	ConfigConfirmationsBlockQueueLength         = ffc("config.confirmations.blockQueueLength", "Internal queue length for notifying the confirmations manager of new blocks", i18n.IntType)
 	ConfigConfirmationsNotificationsQueueLength = ffc("config.confirmations.notificationQueueLength", "Internal queue length for notifying the confirmations manager of new transactions/events", i18n.IntType)
 	ConfigConfirmationsRequired                 = ffc("config.confirmations.required", "Number of confirmations required to consider a transaction/event final", i18n.IntType)
 	ConfigConfirmationsStaleReceiptTimeout      = ffc("config.confirmations.staleReceiptTimeout", "Duration after which to force a receipt check for a pending transaction", i18n.TimeDurationType)
 
-	ConfigTransactionsErrorHistoryCount = ffc("config.transactions.errorHistoryCount", "The number of historical errors to retain in the operation", i18n.IntType)
-	ConfigTransactionsMaxInflight       = ffc("config.transactions.maxInFlight", "The maximum number of transactions to have in-flight with the policy engine / blockchain transaction pool", i18n.IntType)
-	ConfigTransactionsNonceStateTimeout = ffc("config.transactions.nonceStateTimeout", "How old the most recently submitted transaction record in our local state needs to be, before we make a request to the node to query the next nonce for a signing address", i18n.TimeDurationType)
+	ConfigTransactionsErrorHistoryCount              = ffc("config.transactions.errorHistoryCount", "The number of historical errors to retain in the operation", i18n.IntType)
+	ConfigTransactionsFailureRulesAction             = ffc("config.transactions.failureRules[].action", "The outcome when the rule is triggered: 'fail' to mark the transaction Failed, 'park' to pause the signer until an operator resumes it (a signer parked for insufficient_funds also resumes automatically once funds arrive), or 'retry' to keep retrying, so that later rules do not apply to these reasons", i18n.StringType)
+	ConfigTransactionsFailureRulesDuration           = ffc("config.transactions.failureRules[].duration", "The rule is triggered once the transaction has been failing continuously for this duration. Combined with failures, both must be reached", i18n.TimeDurationType)
+	ConfigTransactionsFailureRulesFailures           = ffc("config.transactions.failureRules[].failures", "The rule is triggered once the policy engine has returned this many consecutive errors for the transaction. Combined with duration, both must be reached", i18n.IntType)
+	ConfigTransactionsFailureRulesReasons            = ffc("config.transactions.failureRules[].reasons", "The error reasons returned by the policy engine that this rule applies to, such as 'insufficient_funds' or 'invalid_inputs'. The first rule that matches the reason applies. Empty matches errors with any reason, including errors with no reason", i18n.ArrayStringType)
+	ConfigTransactionsHistoryCount                   = ffc("config.transactions.historyCount", "The number of actions to retain in the history of each transaction, such as submissions, receipts and errors. The oldest actions are discarded first, except for submissions which are always retained, and errors are also limited to errorHistoryCount. Zero disables the history", i18n.IntType)
+	ConfigTransactionsInsufficientFundsPark          = ffc("config.transactions.insufficientFunds.park", "When true, a signer is parked when the policy engine returns an insufficient_funds error for one of its transactions. No transactions are submitted for a parked signer, but new transactions are accepted and queued. The signer resumes automatically once a balance check finds the balance covers the transaction that failed, and the minimum balance if set", i18n.BooleanType)
+	ConfigTransactionsInsufficientFundsCheckInterval = ffc("config.transactions.insufficientFunds.checkInterval", "The interval at which the balance of each signer parked for insufficient funds is checked", i18n.TimeDurationType)
+	ConfigTransactionsInsufficientFundsMinBalance    = ffc("config.transactions.insufficientFunds.minBalance", "A minimum balance for a signer parked for insufficient funds to be resumed, as a base 10 or 0x prefixed hex integer string. The balance must also cover the value and maximum gas cost of the transaction that failed. If the cost of the transaction is unknown and no minimum balance is set, the signer remains parked until resumed by an operator", i18n.StringType)
+	ConfigTransactionsIdempotentResubmit             = ffc("config.transactions.idempotentResubmit", "When true, a request that re-uses the ID of an existing transaction with identical content returns the existing transaction, rather than a conflict error", i18n.BooleanType)
+	ConfigTransactionsMaxInflight                    = ffc("config.transactions.maxInFlight", "The maximum number of transactions to have in-flight with the policy engine / blockchain transaction pool", i18n.IntType)
+	ConfigTransactionsNonceStateTimeout              = ffc("config.transactions.nonceStateTimeout", "How old the most recently submitted transaction record in our local state needs to be, before we make a request to the node to query the next nonce for a signing address", i18n.TimeDurationType)
+	ConfigTransactionsRawResubmitInterval            = ffc("config.transactions.rawResubmitInterval", "The interval at which a transaction signed outside of the connector is broadcast again, until it is confirmed", i18n.TimeDurationType)
+	ConfigTransactionsRateLimitCount                 = ffc("config.transactions.rateLimit.count", "The default maximum number of transaction submissions per signer, in each rate limit interval. Zero disables rate limiting by default", i18n.IntType)
+	ConfigTransactionsRateLimitInterval              = ffc("config.transactions.rateLimit.interval", "The interval over which the rate limit count of transaction submissions is replenished for each signer", i18n.TimeDurationType)
+	ConfigTransactionsRateLimitSigners               = ffc("config.transactions.rateLimit.signers", "A map of signing address to a rate limit count, overriding the default count for individual signers. Signing addresses are matched case-insensitively", "`map[string]int`")
+	ConfigTransactionsSignerAlertsURL                = ffc("config.transactions.signerAlerts.url", "The URL of a webhook to POST a JSON alert to when a signer is parked automatically, and when a parked signer is resumed. Empty disables the webhook - alerts are always sent on the websocket", i18n.StringType)
+	ConfigTransactionsSignerAlertsTopic              = ffc("config.transactions.signerAlerts.topic", "The websocket topic that alerts with a type of SignerParked or SignerResumed are broadcast on. Listen on the topic to receive alerts - they are not sent to connections that only listen for replies", i18n.StringType)
+	ConfigTransactionsSignerAlertsProxyURL           = ffc("config.transactions.signerAlerts.proxy.url", "Optional HTTP proxy URL to use for the signer alerts webhook", i18n.StringType)
+	ConfigTransactionsSignerPolicySigner             = ffc("config.transactions.signerPolicy[].signer", "A signing address permitted to submit transactions, matched case-insensitively. When any signer policy entries are configured, requests from any other signer are rejected", i18n.StringType)
+	ConfigTransactionsSignerPolicyTo                 = ffc("config.transactions.signerPolicy[].to", "The addresses the signer is permitted to send transactions to, matched case-insensitively. Empty permits any address. A signer restricted to a list of addresses cannot deploy contracts", i18n.ArrayStringType)
+	ConfigTransactionsSignerPolicyMaxValue           = ffc("config.transactions.signerPolicy[].maxValue", "The maximum value the signer is permitted to send in a single transaction or contract deployment, as a base 10 or 0x prefixed hex integer string. Empty permits any value", i18n.StringType)
+	ConfigTransactionsSpendLimitAction               = ffc("config.transactions.spendLimit.action", "The action to take when a transaction would exceed the spend limit for its signer: 'hold' to wait until the spend in the window allows it to be submitted, or 'reject' to fail the transaction before it is first submitted. A re-submission of a transaction that would exceed the limit, such as at a higher gas price, is always held as the earlier submission can still be mined", i18n.StringType)
+	ConfigTransactionsSpendLimitLimit                = ffc("config.transactions.spendLimit.limit", "The default maximum value plus gas multiplied by gas price that a signer can submit within the rolling window, as a base 10 or 0x prefixed hex integer string. Empty disables the spend limit by default", i18n.StringType)
+	ConfigTransactionsSpendLimitSigners              = ffc("config.transactions.spendLimit.signers", "A map of signing address to a spend limit, overriding the default limit for individual signers. Signing addresses are matched case-insensitively", i18n.MapStringStringType)
+	ConfigTransactionsSpendLimitWindow               = ffc("config.transactions.spendLimit.window", "The duration of the rolling window over which spend is accumulated for each signer. A transaction counts against the window from the time it was first submitted", i18n.TimeDurationType)
+	ConfigTransactionsSpendLimitWindowsLimit         = ffc("config.transactions.spendLimit.windows[].limit", "The default maximum value plus gas multiplied by gas price that a signer can submit within this additional rolling window, as a base 10 or 0x prefixed hex integer string", i18n.StringType)
+	ConfigTransactionsSpendLimitWindowsSigners       = ffc("config.transactions.spendLimit.windows[].signers", "A map of signing address to a spend limit within this additional rolling window, overriding its default limit for individual signers", i18n.MapStringStringType)
+	ConfigTransactionsSpendLimitWindowsWindow        = ffc("config.transactions.spendLimit.windows[].window", "The duration of an additional rolling window with its own spend limit, such as 1h alongside a 24h window. A transaction must be within the limits of every window to be submitted", i18n.TimeDurationType)
 
-	ConfigPolicyEngineName = ffc("config.policyengine.name", "The name of the policy engine to use", i18n.StringType)
+	ConfigPolicyEngineName          = ffc("config.policyengine.name", "The name of the policy engine to use", i18n.StringType)
+	ConfigPolicyEngineInstancesName = ffc("config.policyengine.instances[].name", "The name of an additional policy engine instance, which can be selected for a transaction with the policyEngine request header", i18n.StringType)
+	ConfigPolicyEngineInstancesType = ffc("config.policyengine.instances[].type", "The type of policy engine for this instance, such as 'simple' or 'remote'. The configuration for the policy engine is in a sub-section of the instance with this name", i18n.StringType)
 
 	ConfigLoopInterval = ffc("config.policyloop.interval", "Interval at which to invoke the policy engine to evaluate outstanding transactions", i18n.TimeDurationType)
+	ConfigLoopWorkers  = ffc("config.policyloop.workers", "The number of workers that evaluate outstanding transactions in parallel in each policy loop cycle. Transactions are partitioned across the workers by signer, so the transactions for each signer are evaluated in order by a single worker", i18n.IntType)
+
+	ConfigPolicyEngineSimpleFixedGasPrice           = ffc("config.policyengine.simple.fixedGasPrice", "A fixed gasPrice value/structure to pass to the connector. When a gas oracle is configured, this is used as a fallback if all the gas oracle sources fail", "Raw JSON")
+	ConfigPolicyEngineSimpleResubmitInterval        = ffc("config.policyengine.simple.resubmitInterval", "The time between warning and re-sending a transaction (same nonce) when a blockchain transaction has not been allocated a receipt", i18n.TimeDurationType)
+	ConfigPolicyEngineSimpleGasOracleEnabled        = ffc("config.policyengine.simple.gasOracle.mode", "The gas oracle mode, when a list of gas oracle sources is not configured", "'connector', 'restapi', 'fixed', or 'disabled'")
+	ConfigPolicyEngineSimpleGasOracleGoTemplate     = ffc("config.policyengine.simple.gasOracle.template", "REST API Gas Oracle: A go template to execute against the result from the Gas Oracle, to create a JSON block that will be passed as the gas price to the connector", i18n.GoTemplateType)
+	ConfigPolicyEngineSimpleGasOracleURL            = ffc("config.policyengine.simple.gasOracle.url", "REST API Gas Oracle: The URL of a Gas Oracle REST API to call", i18n.StringType)
+	ConfigPolicyEngineSimpleGasOracleProxyURL       = ffc("config.policyengine.simple.gasOracle.proxy.url", "Optional HTTP proxy URL to use for the Gas Oracle REST API", i18n.StringType)
+	ConfigPolicyEngineSimpleGasOracleMethod         = ffc("config.policyengine.simple.gasOracle.method", "The HTTP Method to use when invoking the Gas Oracle REST API", i18n.StringType)
+	ConfigPolicyEngineSimpleGasOracleQueryInterval  = ffc("config.policyengine.simple.gasOracle.queryInterval", "The minimum interval between queries to the Gas Oracle", i18n.TimeDurationType)
+	ConfigPolicyEngineSimpleGasOracleAggregation    = ffc("config.policyengine.simple.gasOracle.aggregation", "How the gas prices from the gas oracle sources are combined. 'firstSuccess' uses the first source that succeeds, in order. 'median' and 'max' query every source, and require numeric gas prices", "'firstSuccess', 'median' or 'max'")
+	ConfigPolicyEngineSimpleGasOracleCeiling        = ffc("config.policyengine.simple.gasOracle.ceiling", "A maximum gas price to apply to the result from the gas oracle sources. Requires numeric gas prices", "Raw JSON")
+	ConfigPolicyEngineSimpleGasOracleFloor          = ffc("config.policyengine.simple.gasOracle.floor", "A minimum gas price to apply to the result from the gas oracle sources. Requires numeric gas prices", "Raw JSON")
+	ConfigPolicyEngineSimpleGasOracleSourceName     = ffc("config.policyengine.simple.gasOracle.sources[].name", "The name of the gas oracle source, reported in the gas oracle status", i18n.StringType)
+	ConfigPolicyEngineSimpleGasOracleSourceType     = ffc("config.policyengine.simple.gasOracle.sources[].type", "The type of the gas oracle source", "'connector' or 'restapi'")
+	ConfigPolicyEngineSimpleGasOracleSourceMethod   = ffc("config.policyengine.simple.gasOracle.sources[].method", "The HTTP Method to use when invoking the REST API of the gas oracle source", i18n.StringType)
+	ConfigPolicyEngineSimpleGasOracleSourceURL      = ffc("config.policyengine.simple.gasOracle.sources[].url", "The URL of the REST API of the gas oracle source", i18n.StringType)
+	ConfigPolicyEngineSimpleGasOracleSourceTemplate = ffc("config.policyengine.simple.gasOracle.sources[].template", "A go template to execute against the result from the REST API of the gas oracle source, to create a JSON block that will be used as the gas price", i18n.GoTemplateType)
 
-	ConfigPolicyEngineSimpleFixedGasPrice          = ffc("config.policyengine.simple.fixedGasPrice", "A fixed gasPrice value/structure to pass to the connector", "Raw JSON")
-	ConfigPolicyEngineSimpleResubmitInterval       = ffc("config.policyengine.simple.resubmitInterval", "The time between warning and re-sending a transaction (same nonce) when a blockchain transaction has not been allocated a receipt", i18n.TimeDurationType)
-	ConfigPolicyEngineSimpleGasOracleEnabled       = ffc("config.policyengine.simple.gasOracle.mode", "The gas oracle mode", "'connector', 'restapi', 'fixed', or 'disabled'")
-	ConfigPolicyEngineSimpleGasOracleGoTemplate    = ffc("config.policyengine.simple.gasOracle.template", "REST API Gas Oracle: A go template to execute against the result from the Gas Oracle, to create a JSON block that will be passed as the gas price to the connector", i18n.GoTemplateType)
-	ConfigPolicyEngineSimpleGasOracleURL           = ffc("config.policyengine.simple.gasOracle.url", "REST API Gas Oracle: The URL of a Gas Oracle REST API to call", i18n.StringType)
-	ConfigPolicyEngineSimpleGasOracleProxyURL      = ffc("config.policyengine.simple.gasOracle.proxy.url", "Optional HTTP proxy URL to use for the Gas Oracle REST API", i18n.StringType)
-	ConfigPolicyEngineSimpleGasOracleMethod        = ffc("config.policyengine.simple.gasOracle.method", "The HTTP Method to use when invoking the Gas Oracle REST API", i18n.StringType)
-	ConfigPolicyEngineSimpleGasOracleQueryInterval = ffc("config.policyengine.simple.gasOracle.queryInterval", "The minimum interval between queries to the Gas Oracle", i18n.TimeDurationType)
+	ConfigPolicyEngineRemoteFallbackGasPrice = ffc("config.policyengine.remote.fallbackGasPrice", "A gasPrice value/structure used to submit new transactions locally when the remote policy engine cannot be reached, or returns an invalid response. When set, deletions are also completed locally. When not set, the transaction is retried on the next policy loop cycle", "Raw JSON")
+	ConfigPolicyEngineRemoteURL              = ffc("config.policyengine.remote.url", "The URL of the remote policy engine, to which each transaction is POSTed when the policy engine is executed", i18n.StringType)
+	ConfigPolicyEngineRemoteProxyURL         = ffc("config.policyengine.remote.proxy.url", "Optional HTTP proxy URL to use for the remote policy engine", i18n.StringType)
+
+	ConfigPolicyEngineInstancesRemoteFallbackGasPrice = ffc("config.policyengine.instances[].remote.fallbackGasPrice", "A gasPrice value/structure used to submit new transactions locally when the remote policy engine cannot be reached, or returns an invalid response. When set, deletions are also completed locally. When not set, the transaction is retried on the next policy loop cycle", "Raw JSON")
+	ConfigPolicyEngineInstancesRemoteURL              = ffc("config.policyengine.instances[].remote.url", "The URL of the remote policy engine, to which each transaction is POSTed when the policy engine is executed", i18n.StringType)
+	ConfigPolicyEngineInstancesRemoteProxyURL         = ffc("config.policyengine.instances[].remote.proxy.url", "Optional HTTP proxy URL to use for the remote policy engine", i18n.StringType)
+
+	ConfigPolicyEngineInstancesSimpleFixedGasPrice           = ffc("config.policyengine.instances[].simple.fixedGasPrice", "A fixed gasPrice value/structure to pass to the connector. When a gas oracle is configured, this is used as a fallback if all the gas oracle sources fail", "Raw JSON")
+	ConfigPolicyEngineInstancesSimpleResubmitInterval        = ffc("config.policyengine.instances[].simple.resubmitInterval", "The time between warning and re-sending a transaction (same nonce) when a blockchain transaction has not been allocated a receipt", i18n.TimeDurationType)
+	ConfigPolicyEngineInstancesSimpleGasOracleEnabled        = ffc("config.policyengine.instances[].simple.gasOracle.mode", "The gas oracle mode, when a list of gas oracle sources is not configured", "'connector', 'restapi', 'fixed', or 'disabled'")
+	ConfigPolicyEngineInstancesSimpleGasOracleGoTemplate     = ffc("config.policyengine.instances[].simple.gasOracle.template", "REST API Gas Oracle: A go template to execute against the result from the Gas Oracle, to create a JSON block that will be passed as the gas price to the connector", i18n.GoTemplateType)
+	ConfigPolicyEngineInstancesSimpleGasOracleURL            = ffc("config.policyengine.instances[].simple.gasOracle.url", "REST API Gas Oracle: The URL of a Gas Oracle REST API to call", i18n.StringType)
+	ConfigPolicyEngineInstancesSimpleGasOracleProxyURL       = ffc("config.policyengine.instances[].simple.gasOracle.proxy.url", "Optional HTTP proxy URL to use for the Gas Oracle REST API", i18n.StringType)
+	ConfigPolicyEngineInstancesSimpleGasOracleMethod         = ffc("config.policyengine.instances[].simple.gasOracle.method", "The HTTP Method to use when invoking the Gas Oracle REST API", i18n.StringType)
+	ConfigPolicyEngineInstancesSimpleGasOracleQueryInterval  = ffc("config.policyengine.instances[].simple.gasOracle.queryInterval", "The minimum interval between queries to the Gas Oracle", i18n.TimeDurationType)
+	ConfigPolicyEngineInstancesSimpleGasOracleAggregation    = ffc("config.policyengine.instances[].simple.gasOracle.aggregation", "How the gas prices from the gas oracle sources are combined. 'firstSuccess' uses the first source that succeeds, in order. 'median' and 'max' query every source, and require numeric gas prices", "'firstSuccess', 'median' or 'max'")
+	ConfigPolicyEngineInstancesSimpleGasOracleCeiling        = ffc("config.policyengine.instances[].simple.gasOracle.ceiling", "A maximum gas price to apply to the result from the gas oracle sources. Requires numeric gas prices", "Raw JSON")
+	ConfigPolicyEngineInstancesSimpleGasOracleFloor          = ffc("config.policyengine.instances[].simple.gasOracle.floor", "A minimum gas price to apply to the result from the gas oracle sources. Requires numeric gas prices", "Raw JSON")
+	ConfigPolicyEngineInstancesSimpleGasOracleSourceName     = ffc("config.policyengine.instances[].simple.gasOracle.sources[].name", "The name of the gas oracle source, reported in the gas oracle status", i18n.StringType)
+	ConfigPolicyEngineInstancesSimpleGasOracleSourceType     = ffc("config.policyengine.instances[].simple.gasOracle.sources[].type", "The type of the gas oracle source", "'connector' or 'restapi'")
+	ConfigPolicyEngineInstancesSimpleGasOracleSourceMethod   = ffc("config.policyengine.instances[].simple.gasOracle.sources[].method", "The HTTP Method to use when invoking the REST API of the gas oracle source", i18n.StringType)
+	ConfigPolicyEngineInstancesSimpleGasOracleSourceURL      = ffc("config.policyengine.instances[].simple.gasOracle.sources[].url", "The URL of the REST API of the gas oracle source", i18n.StringType)
+	ConfigPolicyEngineInstancesSimpleGasOracleSourceTemplate = ffc("config.policyengine.instances[].simple.gasOracle.sources[].template", "A go template to execute against the result from the REST API of the gas oracle source, to create a JSON block that will be used as the gas price", i18n.GoTemplateType)
 
 	ConfigEventStreamsDefaultsBatchSize                 = ffc("config.eventstreams.defaults.batchSize", "Default batch size for newly created event streams", i18n.IntType)
 	ConfigEventStreamsDefaultsBatchTimeout              = ffc("config.eventstreams.defaults.batchTimeout", "Default batch timeout for newly created event streams", i18n.TimeDurationType)
@@ -78,6 +151,19 @@ var (
 	ConfigPersistenceLevelDBMaxHandles = ffc("config.persistence.leveldb.maxHandles", "The maximum number of cached file handles LevelDB should keep open", i18n.IntType)
 	ConfigPersistenceLevelDBSyncWrites = ffc("config.persistence.leveldb.syncWrites", "Whether to synchronously perform writes to the storage", i18n.BooleanType)
 
+	ConfigResilienceTimeout                    = ffc("config.resilience.timeout", "The default timeout of each call to the connector, after which the call fails with reason 'downstream_down'. Zero disables the timeout. Calls that start an event stream or block listener are not subject to the timeout", i18n.TimeDurationType)
+	ConfigResilienceRetryCount                 = ffc("config.resilience.retry.count", "The default number of times a call to the connector is retried, when it fails with one of the retry reasons. Zero disables retries. Calls that submit a transaction are never retried, so the policy engine decides whether to submit again", i18n.IntType)
+	ConfigResilienceRetryInitDelay             = ffc("config.resilience.retry.initialDelay", "Initial delay before retrying a call to the connector", i18n.TimeDurationType)
+	ConfigResilienceRetryMaxDelay              = ffc("config.resilience.retry.maxDelay", "Maximum delay between retries of a call to the connector", i18n.TimeDurationType)
+	ConfigResilienceRetryFactor                = ffc("config.resilience.retry.factor", "Factor to increase the delay by, between each retry of a call to the connector", i18n.FloatType)
+	ConfigResilienceRetryReasons               = ffc("config.resilience.retry.reasons", "The error reasons returned by the connector for which a call is retried", i18n.ArrayStringType)
+	ConfigResilienceCircuitBreakerFailures     = ffc("config.resilience.circuitBreaker.failures", "The number of consecutive calls to the connector that fail with one of the circuit breaker reasons, after which the circuit breaker opens and calls fail immediately with reason 'downstream_down'. Zero disables the circuit breaker. The state of the circuit breaker is reported by the ready status endpoint", i18n.IntType)
+	ConfigResilienceCircuitBreakerResetTimeout = ffc("config.resilience.circuitBreaker.resetTimeout", "How long the circuit breaker stays open, before a single call is allowed through to test the connector. The circuit breaker closes if the call succeeds, or re-opens if it fails", i18n.TimeDurationType)
+	ConfigResilienceCircuitBreakerReasons      = ffc("config.resilience.circuitBreaker.reasons", "The error reasons returned by the connector that count as failures towards opening the circuit breaker. A call that succeeds, or fails with any other reason, resets the count", i18n.ArrayStringType)
+	ConfigResilienceMethodsName                = ffc("config.resilience.methods[].name", "The name of the connector method this override applies to, such as 'TransactionSend' or 'BlockInfoByNumber'", i18n.StringType)
+	ConfigResilienceMethodsTimeout             = ffc("config.resilience.methods[].timeout", "The timeout of each call to this connector method, overriding the default timeout", i18n.TimeDurationType)
+	ConfigResilienceMethodsRetryCount          = ffc("config.resilience.methods[].retryCount", "The number of times a call to this connector method is retried, overriding the default retry count. Ignored for TransactionSend and TransactionSendRaw, which are never retried", i18n.IntType)
+
 	ConfigWebhooksAllowPrivateIPs = ffc("config.webhooks.allowPrivateIPs", "Whether to allow WebHook URLs that resolve to Private IP address ranges (vs. internet addresses)", i18n.BooleanType)
 	ConfigWebhooksURL             = ffc("config.webhooks.url", "Unused (overridden by the WebHook configuration of an individual event stream)", i18n.IgnoredType)
 	ConfigWebhooksProxyURL        = ffc("config.webhooks.proxy.url", "Optional HTTP proxy to use when invoking WebHooks", i18n.StringType)
@@ -29,60 +29,124 @@ var ffe = func(key, translation string, statusHint ...int) i18n.ErrorMessageKey
 
 //revive:disable
 var (
-	MsgInvalidOutputType             = ffe("FF21010", "Invalid output type: %s")
-	MsgConnectorError                = ffe("FF21012", "Connector failed request. requestId=%s reason=%s error: %s")
-	MsgConnectorInvalidContentType   = ffe("FF21013", "Connector failed request. requestId=%s invalid response content type: %s")
-	MsgInvalidConfirmationRequest    = ffe("FF21016", "Invalid confirmation request %+v")
-	MsgCoreError                     = ffe("FF21017", "Error from core status=%d: %s")
-	MsgConfigParamNotSet             = ffe("FF21018", "Configuration parameter '%s' must be set")
-	MsgPolicyEngineNotRegistered     = ffe("FF21019", "No policy engine registered with name '%s'")
-	MsgNoGasConfigSetForPolicyEngine = ffe("FF21020", "A fixed gas price must be set when not using a gas oracle")
-	MsgErrorQueryingGasOracleAPI     = ffe("FF21021", "Error from gas station API [%d]: %s")
-	MsgInvalidRequestErr             = ffe("FF21022", "Invalid '%s' request: %s", http.StatusBadRequest)
-	MsgUnsupportedRequestType        = ffe("FF21023", "Unsupported request type: %s", http.StatusBadRequest)
-	MsgMissingGOTemplate             = ffe("FF21024", "Missing template for processing response from Gas Oracle REST API")
-	MsgBadGOTemplate                 = ffe("FF21025", "Invalid Go template: %s")
-	MsgGasOracleResultError          = ffe("FF21026", "Error processing result from gas station API via template")
-	MsgStreamStateError              = ffe("FF21027", "Event stream is in %s state", http.StatusConflict)
-	MsgMissingName                   = ffe("FF21028", "Name is required", http.StatusBadRequest)
-	MsgInvalidStreamType             = ffe("FF21029", "Invalid event stream type '%s'", http.StatusBadRequest)
-	MsgMissingWebhookURL             = ffe("FF21030", "'url' is required for webhook configuration", http.StatusBadRequest)
-	MsgStopFailedUpdatingESConfig    = ffe("FF21031", "Failed to stop event stream to apply updated configuration: %s")
-	MsgStartFailedUpdatingESConfig   = ffe("FF21032", "Failed to restart event stream while applying updated configuration: %s")
-	MsgBlockWebhookAddress           = ffe("FF21033", "Cannot send Webhook POST to address '%s' for host '%s'")
-	MsgInvalidDistributionMode       = ffe("FF21034", "Invalid distribution mode for WebSocket: %s", http.StatusBadRequest)
-	MsgWebhookFailedStatus           = ffe("FF21035", "Webhook request failed with status %d")
-	MsgWSErrorFromClient             = ffe("FF21036", "Error received from WebSocket client: %s")
-	MsgWebSocketClosed               = ffe("FF21037", "WebSocket '%s' closed")
-	MsgWebSocketInterruptedSend      = ffe("FF21038", "Interrupted waiting for WebSocket connection to send event")
-	MsgWebSocketInterruptedReceive   = ffe("FF21039", "Interrupted waiting for WebSocket acknowledgment")
-	MsgBadListenerOptions            = ffe("FF21040", "Invalid listener options: %s", http.StatusBadRequest)
-	MsgInvalidHost                   = ffe("FF21041", "Cannot send Webhook POST to host '%s': %s")
-	MsgWebhookErr                    = ffe("FF21042", "Webhook request failed: %s")
-	MsgUnknownPersistence            = ffe("FF21043", "Unknown persistence type '%s'")
-	MsgInvalidLimit                  = ffe("FF21044", "Invalid limit string '%s': %s")
-	MsgStreamNotFound                = ffe("FF21045", "Event stream '%v' not found", http.StatusNotFound)
-	MsgListenerNotFound              = ffe("FF21046", "Event listener '%v' not found", http.StatusNotFound)
-	MsgDuplicateStreamName           = ffe("FF21047", "Duplicate event stream name '%s' used by stream '%s'", http.StatusConflict)
-	MsgMissingID                     = ffe("FF21048", "ID is required", http.StatusBadRequest)
-	MsgPersistenceInitFail           = ffe("FF21049", "Failed to initialize '%s' persistence: %s")
-	MsgLevelDBPathMissing            = ffe("FF21050", "Path must be supplied for LevelDB persistence")
-	MsgFilterUpdateNotAllowed        = ffe("FF21051", "Event filters cannot be updated after a listener is created. Previous signature: '%s'. New signature: '%s'")
-	MsgResetStreamNotFound           = ffe("FF21052", "Attempt to reset listener '%s', which is not currently registered on stream '%s'", http.StatusNotFound)
-	MsgPersistenceMarshalFailed      = ffe("FF21053", "JSON serialization failed while writing to persistence")
-	MsgPersistenceUnmarshalFailed    = ffe("FF21054", "JSON parsing failed while reading from persistence")
-	MsgPersistenceReadFailed         = ffe("FF21055", "Failed to read key '%s' from persistence")
-	MsgPersistenceWriteFailed        = ffe("FF21056", "Failed to read key '%s' from persistence")
-	MsgPersistenceDeleteFailed       = ffe("FF21057", "Failed to delete key '%s' from persistence")
-	MsgPersistenceInitFailed         = ffe("FF21058", "Failed to initialize persistence at path '%s'")
-	MsgPersistenceTXIncomplete       = ffe("FF21059", "Transaction is missing indexed fields")
-	MsgNotStarted                    = ffe("FF21060", "Connector has not fully started yet", http.StatusServiceUnavailable)
-	MsgPaginationErrTxNotFound       = ffe("FF21062", "The ID specified in the 'after' option (for pagination) must match an existing transaction: '%s'", http.StatusNotFound)
-	MsgTXConflictSignerPending       = ffe("FF21063", "Only one of 'signer' and 'pending' can be supplied when querying transactions", http.StatusBadRequest)
-	MsgInvalidSortDirection          = ffe("FF21064", "Sort direction must be 'asc'/'ascending' or 'desc'/'descending': '%s'", http.StatusBadRequest)
-	MsgDuplicateID                   = ffe("FF21065", "ID '%s' is not unique", http.StatusConflict)
-	MsgTransactionFailed             = ffe("FF21066", "Transaction execution failed")
-	MsgTransactionNotFound           = ffe("FF21067", "Transaction '%s' not found", http.StatusNotFound)
-	MsgPolicyEngineRequestTimeout    = ffe("FF21068", "The policy engine did not acknowledge the request after %.2fs", 408)
-	MsgPolicyEngineRequestInvalid    = ffe("FF21069", "Invalid policy engine request type '%d'")
+	MsgInvalidOutputType                   = ffe("FF21010", "Invalid output type: %s")
+	MsgConnectorError                      = ffe("FF21012", "Connector failed request. requestId=%s reason=%s error: %s")
+	MsgConnectorInvalidContentType         = ffe("FF21013", "Connector failed request. requestId=%s invalid response content type: %s")
+	MsgInvalidConfirmationRequest          = ffe("FF21016", "Invalid confirmation request %+v")
+	MsgCoreError                           = ffe("FF21017", "Error from core status=%d: %s")
+	MsgConfigParamNotSet                   = ffe("FF21018", "Configuration parameter '%s' must be set")
+	MsgPolicyEngineNotRegistered           = ffe("FF21019", "No policy engine registered with name '%s'")
+	MsgNoGasConfigSetForPolicyEngine       = ffe("FF21020", "A fixed gas price must be set when not using a gas oracle")
+	MsgErrorQueryingGasOracleAPI           = ffe("FF21021", "Error from gas station API [%d]: %s")
+	MsgInvalidRequestErr                   = ffe("FF21022", "Invalid '%s' request: %s", http.StatusBadRequest)
+	MsgUnsupportedRequestType              = ffe("FF21023", "Unsupported request type: %s", http.StatusBadRequest)
+	MsgMissingGOTemplate                   = ffe("FF21024", "Missing template for processing response from Gas Oracle REST API")
+	MsgBadGOTemplate                       = ffe("FF21025", "Invalid Go template: %s")
+	MsgGasOracleResultError                = ffe("FF21026", "Error processing result from gas station API via template")
+	MsgStreamStateError                    = ffe("FF21027", "Event stream is in %s state", http.StatusConflict)
+	MsgMissingName                         = ffe("FF21028", "Name is required", http.StatusBadRequest)
+	MsgInvalidStreamType                   = ffe("FF21029", "Invalid event stream type '%s'", http.StatusBadRequest)
+	MsgMissingWebhookURL                   = ffe("FF21030", "'url' is required for webhook configuration", http.StatusBadRequest)
+	MsgStopFailedUpdatingESConfig          = ffe("FF21031", "Failed to stop event stream to apply updated configuration: %s")
+	MsgStartFailedUpdatingESConfig         = ffe("FF21032", "Failed to restart event stream while applying updated configuration: %s")
+	MsgBlockWebhookAddress                 = ffe("FF21033", "Cannot send Webhook POST to address '%s' for host '%s'")
+	MsgInvalidDistributionMode             = ffe("FF21034", "Invalid distribution mode for WebSocket: %s", http.StatusBadRequest)
+	MsgWebhookFailedStatus                 = ffe("FF21035", "Webhook request failed with status %d")
+	MsgWSErrorFromClient                   = ffe("FF21036", "Error received from WebSocket client: %s")
+	MsgWebSocketClosed                     = ffe("FF21037", "WebSocket '%s' closed")
+	MsgWebSocketInterruptedSend            = ffe("FF21038", "Interrupted waiting for WebSocket connection to send event")
+	MsgWebSocketInterruptedReceive         = ffe("FF21039", "Interrupted waiting for WebSocket acknowledgment")
+	MsgBadListenerOptions                  = ffe("FF21040", "Invalid listener options: %s", http.StatusBadRequest)
+	MsgInvalidHost                         = ffe("FF21041", "Cannot send Webhook POST to host '%s': %s")
+	MsgWebhookErr                          = ffe("FF21042", "Webhook request failed: %s")
+	MsgUnknownPersistence                  = ffe("FF21043", "Unknown persistence type '%s'")
+	MsgInvalidLimit                        = ffe("FF21044", "Invalid limit string '%s': %s")
+	MsgStreamNotFound                      = ffe("FF21045", "Event stream '%v' not found", http.StatusNotFound)
+	MsgListenerNotFound                    = ffe("FF21046", "Event listener '%v' not found", http.StatusNotFound)
+	MsgDuplicateStreamName                 = ffe("FF21047", "Duplicate event stream name '%s' used by stream '%s'", http.StatusConflict)
+	MsgMissingID                           = ffe("FF21048", "ID is required", http.StatusBadRequest)
+	MsgPersistenceInitFail                 = ffe("FF21049", "Failed to initialize '%s' persistence: %s")
+	MsgLevelDBPathMissing                  = ffe("FF21050", "Path must be supplied for LevelDB persistence")
+	MsgFilterUpdateNotAllowed              = ffe("FF21051", "Event filters cannot be updated after a listener is created. Previous signature: '%s'. New signature: '%s'")
+	MsgResetStreamNotFound                 = ffe("FF21052", "Attempt to reset listener '%s', which is not currently registered on stream '%s'", http.StatusNotFound)
+	MsgPersistenceMarshalFailed            = ffe("FF21053", "JSON serialization failed while writing to persistence")
+	MsgPersistenceUnmarshalFailed          = ffe("FF21054", "JSON parsing failed while reading from persistence")
+	MsgPersistenceReadFailed               = ffe("FF21055", "Failed to read key '%s' from persistence")
+	MsgPersistenceWriteFailed              = ffe("FF21056", "Failed to read key '%s' from persistence")
+	MsgPersistenceDeleteFailed             = ffe("FF21057", "Failed to delete key '%s' from persistence")
+	MsgPersistenceInitFailed               = ffe("FF21058", "Failed to initialize persistence at path '%s'")
+	MsgPersistenceTXIncomplete             = ffe("FF21059", "Transaction is missing indexed fields")
+	MsgNotStarted                          = ffe("FF21060", "Connector has not fully started yet", http.StatusServiceUnavailable)
+	MsgPaginationErrTxNotFound             = ffe("FF21062", "The ID specified in the 'after' option (for pagination) must match an existing transaction: '%s'", http.StatusNotFound)
+	MsgTXConflictSignerPending             = ffe("FF21063", "Only one of 'signer' and 'pending' can be supplied when querying transactions", http.StatusBadRequest)
+	MsgInvalidSortDirection                = ffe("FF21064", "Sort direction must be 'asc'/'ascending' or 'desc'/'descending': '%s'", http.StatusBadRequest)
+	MsgDuplicateID                         = ffe("FF21065", "ID '%s' is not unique", http.StatusConflict)
+	MsgTransactionFailed                   = ffe("FF21066", "Transaction execution failed")
+	MsgTransactionNotFound                 = ffe("FF21067", "Transaction '%s' not found", http.StatusNotFound)
+	MsgPolicyEngineRequestTimeout          = ffe("FF21068", "The policy engine did not acknowledge the request after %.2fs", 408)
+	MsgPolicyEngineRequestInvalid          = ffe("FF21069", "Invalid policy engine request type '%d'")
+	MsgPolicyEngineConfigInvalid           = ffe("FF21070", "Invalid configuration for policy engine '%s': %s", http.StatusBadRequest)
+	MsgPolicyEngineConfigRestoreFail       = ffe("FF21071", "Failed to apply persisted runtime configuration for policy engine '%s': %s")
+	MsgSignerRateLimited                   = ffe("FF21072", "Transaction submission for signer '%s' deferred by rate limit", http.StatusTooManyRequests)
+	MsgSpendLimitExceeded                  = ffe("FF21073", "Transaction for signer '%s' with cost %s would exceed the spend limit %s within %s (spent in window: %s)")
+	MsgSpendLimitInvalid                   = ffe("FF21074", "Invalid spend limit '%s' for signer '%s'")
+	MsgSpendLimitActionInvalid             = ffe("FF21075", "Invalid spend limit action '%s'")
+	MsgPolicyEngineInstanceInvalid         = ffe("FF21076", "Policy engine instance %d must have a unique name, that is not the name of the default policy engine '%s': '%s'")
+	MsgPolicyEngineNotFound                = ffe("FF21077", "Policy engine '%s' not found", http.StatusBadRequest)
+	MsgNonceRequired                       = ffe("FF21078", "A non-negative nonce must be supplied", http.StatusBadRequest)
+	MsgGasOracleSourceTypeInvalid          = ffe("FF21079", "Invalid type '%s' for gas oracle source '%s'")
+	MsgGasOracleAggregationInvalid         = ffe("FF21080", "Invalid gas oracle aggregation '%s'")
+	MsgGasPriceNotNumeric                  = ffe("FF21081", "Gas price from '%s' is not numeric: %s")
+	MsgSignerPaused                        = ffe("FF21082", "Transaction processing for signer '%s' is paused", http.StatusConflict)
+	MsgMissingRemotePolicyEngineURL        = ffe("FF21083", "URL must be set for the remote policy engine")
+	MsgRemotePolicyEngineError             = ffe("FF21084", "Error from remote policy engine [%d]: %s")
+	MsgRemotePolicyEngineUpdateTypeInvalid = ffe("FF21085", "Invalid update type '%s' returned by remote policy engine")
+	MsgDraining                            = ffe("FF21086", "The transaction manager is draining, and is not accepting new transactions", http.StatusServiceUnavailable)
+	MsgNotLeader                           = ffe("FF21087", "This instance is not the leader, and only serves read-only requests. Current leader: '%s'", http.StatusServiceUnavailable)
+	MsgLeaderModeUnknown                   = ffe("FF21088", "Unknown leader election mode '%s'")
+	MsgLeaderFilePathMissing               = ffe("FF21089", "Path must be supplied for file based leader election")
+	MsgLeaderFileLocked                    = ffe("FF21090", "Leader lease file '%s' is locked by another instance")
+	MsgLeaderFileAccessFailed              = ffe("FF21091", "Failed to access leader lease file '%s'")
+	MsgFailureRuleActionInvalid            = ffe("FF21092", "Invalid action '%s' for transaction failure rule %d")
+	MsgFailureRuleThresholdMissing         = ffe("FF21093", "Transaction failure rule %d must set failures or duration")
+	MsgMinBalanceInvalid                   = ffe("FF21094", "Invalid minimum balance '%s' to resume signers parked for insufficient funds")
+	MsgQueryBlockConflict                  = ffe("FF21095", "Only one of blockNumber, blockHash or blockTag can be set on a query", http.StatusBadRequest)
+	MsgQueryBlockTagInvalid                = ffe("FF21096", "Invalid block tag '%s' - must be one of 'latest', 'safe' or 'finalized'", http.StatusBadRequest)
+	MsgSignerPolicySignerMissing           = ffe("FF21097", "Signer must be set for signer policy entry %d")
+	MsgSignerPolicyMaxValueInvalid         = ffe("FF21098", "Invalid maximum value '%s' in the signer policy for signer '%s'")
+	MsgSignerNotPermitted                  = ffe("FF21099", "Signer '%s' is not permitted by the signer policy", http.StatusForbidden)
+	MsgSignerToNotPermitted                = ffe("FF21100", "Signer '%s' is not permitted by the signer policy to send transactions to '%s'", http.StatusForbidden)
+	MsgSignerDeployNotPermitted            = ffe("FF21101", "Signer '%s' is restricted by the signer policy to sending transactions to specific addresses, so cannot deploy contracts", http.StatusForbidden)
+	MsgSignerMaxValueExceeded              = ffe("FF21102", "Value %s exceeds the maximum of %s permitted by the signer policy for signer '%s'", http.StatusForbidden)
+	MsgMissingRawTransaction               = ffe("FF21103", "The signed raw transaction must be supplied", http.StatusBadRequest)
+	MsgTransactionNotSignExternally        = ffe("FF21104", "Transaction '%s' was not prepared for external signing", http.StatusConflict)
+	MsgTransactionAlreadySubmitted         = ffe("FF21105", "Transaction '%s' has already been submitted, or is no longer pending", http.StatusConflict)
+	MsgRawTransactionDecodeIncomplete      = ffe("FF21106", "The connector did not return the signer and nonce of the raw transaction")
+	MsgNonceAlreadyAssigned                = ffe("FF21107", "Nonce %s / %s is already assigned to transaction '%s'", http.StatusConflict)
+	MsgRemoteConnectorRequestInvalid       = ffe("FF21108", "Invalid request to remote connector: %s", http.StatusBadRequest)
+	MsgRemoteConnectorRequestTypeUnknown   = ffe("FF21109", "Unknown remote connector request type '%s'", http.StatusBadRequest)
+	MsgRemoteConnectorStreamClosed         = ffe("FF21110", "Remote connector stream '%s' closed before it started")
+	MsgMissingRemoteConnectorURL           = ffe("FF21111", "URL must be set for the remote connector")
+	MsgSimulatorInjectedError              = ffe("FF21112", "Simulated connector injected error for %s (reason=%s)")
+	MsgSimulatorConfigInvalid              = ffe("FF21113", "Invalid value '%s' for '%s' in the simulated connector configuration")
+	MsgSimulatorInvalidTransaction         = ffe("FF21114", "Invalid transaction for the simulated connector: %s")
+	MsgSimulatorNonceTooLow                = ffe("FF21115", "Nonce %s too low for signer '%s' - next nonce is %d")
+	MsgSimulatorKnownTransaction           = ffe("FF21116", "Transaction '%s' is already known")
+	MsgSimulatorReplacementUnderpriced     = ffe("FF21117", "Replacement transaction for nonce %s / %s must have a higher gas price than %s")
+	MsgSimulatorInsufficientFunds          = ffe("FF21118", "Insufficient funds for signer '%s': balance %s, cost %s")
+	MsgSimulatorReverted                   = ffe("FF21119", "Execution reverted for contract '%s'")
+	MsgSimulatorBlockNotFound              = ffe("FF21120", "Block '%s' not found")
+	MsgSimulatorReceiptNotFound            = ffe("FF21121", "Receipt for transaction '%s' not found")
+	MsgSimulatorStreamNotFound             = ffe("FF21122", "Event stream '%s' not found")
+	MsgSimulatorStreamAlreadyStarted       = ffe("FF21123", "Event stream '%s' is already started")
+	MsgSimulatorListenerNotFound           = ffe("FF21124", "Event listener '%s' not found in event stream '%s'")
+	MsgSimulatorListenerOptionsInvalid     = ffe("FF21125", "Invalid event listener options: %s")
+	MsgSimulatorReorgDepthInvalid          = ffe("FF21126", "Reorg depth %d is invalid - must be between 1 and the current block number %d")
+	MsgResilienceMethodUnknown             = ffe("FF21127", "Unknown connector method '%s' in resilience method override %d")
+	MsgConnectorCircuitOpen                = ffe("FF21128", "Connector calls are suspended by the circuit breaker after %d consecutive failures with reason '%s' - retrying in %s", http.StatusServiceUnavailable)
+	MsgConnectorCallTimeout                = ffe("FF21129", "Connector call %s timed out after %s")
+	MsgNonceHeldByPending                  = ffe("FF21130", "Nonce %s / %s is at or below nonce %s of pending transaction '%s' - set force to re-issue it", http.StatusConflict)
+	MsgSignedTransactionMismatch           = ffe("FF21131", "The signed transaction does not match transaction '%s' prepared for signing - %s is '%s' rather than '%s'", http.StatusBadRequest)
+	MsgLeaderRenewInterval                 = ffe("FF21132", "Leader renew interval '%s' must be greater than zero and less than the lease duration '%s'")
+	MsgPolicyEngineConfigArrayOverride     = ffe("FF21133", "The list '%s' cannot be overridden at runtime, and must be set in the configuration file", http.StatusBadRequest)
 )
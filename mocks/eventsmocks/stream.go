@@ -54,6 +54,20 @@ func (_m *Stream) Delete(ctx context.Context) error {
 	return r0
 }
 
+// Drain provides a mock function with given fields: ctx
+func (_m *Stream) Drain(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RemoveListener provides a mock function with given fields: ctx, id
 func (_m *Stream) RemoveListener(ctx context.Context, id *fftypes.UUID) error {
 	ret := _m.Called(ctx, id)
@@ -14,6 +14,36 @@ type API struct {
 	mock.Mock
 }
 
+// BalanceForSigner provides a mock function with given fields: ctx, req
+func (_m *API) BalanceForSigner(ctx context.Context, req *ffcapi.BalanceForSignerRequest) (*ffcapi.BalanceForSignerResponse, ffcapi.ErrorReason, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 *ffcapi.BalanceForSignerResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *ffcapi.BalanceForSignerRequest) *ffcapi.BalanceForSignerResponse); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ffcapi.BalanceForSignerResponse)
+		}
+	}
+
+	var r1 ffcapi.ErrorReason
+	if rf, ok := ret.Get(1).(func(context.Context, *ffcapi.BalanceForSignerRequest) ffcapi.ErrorReason); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Get(1).(ffcapi.ErrorReason)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *ffcapi.BalanceForSignerRequest) error); ok {
+		r2 = rf(ctx, req)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // BlockInfoByHash provides a mock function with given fields: ctx, req
 func (_m *API) BlockInfoByHash(ctx context.Context, req *ffcapi.BlockInfoByHashRequest) (*ffcapi.BlockInfoByHashResponse, ffcapi.ErrorReason, error) {
 	ret := _m.Called(ctx, req)
@@ -480,6 +510,36 @@ func (_m *API) QueryInvoke(ctx context.Context, req *ffcapi.QueryInvokeRequest)
 	return r0, r1, r2
 }
 
+// TransactionDecode provides a mock function with given fields: ctx, req
+func (_m *API) TransactionDecode(ctx context.Context, req *ffcapi.TransactionDecodeRequest) (*ffcapi.TransactionDecodeResponse, ffcapi.ErrorReason, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 *ffcapi.TransactionDecodeResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *ffcapi.TransactionDecodeRequest) *ffcapi.TransactionDecodeResponse); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ffcapi.TransactionDecodeResponse)
+		}
+	}
+
+	var r1 ffcapi.ErrorReason
+	if rf, ok := ret.Get(1).(func(context.Context, *ffcapi.TransactionDecodeRequest) ffcapi.ErrorReason); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Get(1).(ffcapi.ErrorReason)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *ffcapi.TransactionDecodeRequest) error); ok {
+		r2 = rf(ctx, req)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // TransactionPrepare provides a mock function with given fields: ctx, req
 func (_m *API) TransactionPrepare(ctx context.Context, req *ffcapi.TransactionPrepareRequest) (*ffcapi.TransactionPrepareResponse, ffcapi.ErrorReason, error) {
 	ret := _m.Called(ctx, req)
@@ -569,3 +629,33 @@ func (_m *API) TransactionSend(ctx context.Context, req *ffcapi.TransactionSendR
 
 	return r0, r1, r2
 }
+
+// TransactionSendRaw provides a mock function with given fields: ctx, req
+func (_m *API) TransactionSendRaw(ctx context.Context, req *ffcapi.TransactionSendRawRequest) (*ffcapi.TransactionSendRawResponse, ffcapi.ErrorReason, error) {
+	ret := _m.Called(ctx, req)
+
+	var r0 *ffcapi.TransactionSendRawResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *ffcapi.TransactionSendRawRequest) *ffcapi.TransactionSendRawResponse); ok {
+		r0 = rf(ctx, req)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*ffcapi.TransactionSendRawResponse)
+		}
+	}
+
+	var r1 ffcapi.ErrorReason
+	if rf, ok := ret.Get(1).(func(context.Context, *ffcapi.TransactionSendRawRequest) ffcapi.ErrorReason); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Get(1).(ffcapi.ErrorReason)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, *ffcapi.TransactionSendRawRequest) error); ok {
+		r2 = rf(ctx, req)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
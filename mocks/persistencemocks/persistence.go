@@ -126,6 +126,29 @@ func (_m *Persistence) GetListener(ctx context.Context, listenerID *fftypes.UUID
 	return r0, r1
 }
 
+// GetPolicyEngineConfig provides a mock function with given fields: ctx, name
+func (_m *Persistence) GetPolicyEngineConfig(ctx context.Context, name string) (*apitypes.PolicyEngineConfig, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 *apitypes.PolicyEngineConfig
+	if rf, ok := ret.Get(0).(func(context.Context, string) *apitypes.PolicyEngineConfig); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*apitypes.PolicyEngineConfig)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetStream provides a mock function with given fields: ctx, streamID
 func (_m *Persistence) GetStream(ctx context.Context, streamID *fftypes.UUID) (*apitypes.EventStream, error) {
 	ret := _m.Called(ctx, streamID)
@@ -195,6 +218,29 @@ func (_m *Persistence) GetTransactionByNonce(ctx context.Context, signer string,
 	return r0, r1
 }
 
+// ListDeployments provides a mock function with given fields: ctx, after, limit, dir
+func (_m *Persistence) ListDeployments(ctx context.Context, after *apitypes.ManagedTX, limit int, dir persistence.SortDirection) ([]*apitypes.ManagedTX, error) {
+	ret := _m.Called(ctx, after, limit, dir)
+
+	var r0 []*apitypes.ManagedTX
+	if rf, ok := ret.Get(0).(func(context.Context, *apitypes.ManagedTX, int, persistence.SortDirection) []*apitypes.ManagedTX); ok {
+		r0 = rf(ctx, after, limit, dir)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*apitypes.ManagedTX)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *apitypes.ManagedTX, int, persistence.SortDirection) error); ok {
+		r1 = rf(ctx, after, limit, dir)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ListListeners provides a mock function with given fields: ctx, after, limit, dir
 func (_m *Persistence) ListListeners(ctx context.Context, after *fftypes.UUID, limit int, dir persistence.SortDirection) ([]*apitypes.Listener, error) {
 	ret := _m.Called(ctx, after, limit, dir)
@@ -218,6 +264,29 @@ func (_m *Persistence) ListListeners(ctx context.Context, after *fftypes.UUID, l
 	return r0, r1
 }
 
+// ListSignerStates provides a mock function with given fields: ctx
+func (_m *Persistence) ListSignerStates(ctx context.Context) ([]*apitypes.SignerState, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []*apitypes.SignerState
+	if rf, ok := ret.Get(0).(func(context.Context) []*apitypes.SignerState); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*apitypes.SignerState)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ListStreamListeners provides a mock function with given fields: ctx, after, limit, dir, streamID
 func (_m *Persistence) ListStreamListeners(ctx context.Context, after *fftypes.UUID, limit int, dir persistence.SortDirection, streamID *fftypes.UUID) ([]*apitypes.Listener, error) {
 	ret := _m.Called(ctx, after, limit, dir, streamID)
@@ -361,6 +430,34 @@ func (_m *Persistence) WriteListener(ctx context.Context, spec *apitypes.Listene
 	return r0
 }
 
+// WritePolicyEngineConfig provides a mock function with given fields: ctx, peConfig
+func (_m *Persistence) WritePolicyEngineConfig(ctx context.Context, peConfig *apitypes.PolicyEngineConfig) error {
+	ret := _m.Called(ctx, peConfig)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *apitypes.PolicyEngineConfig) error); ok {
+		r0 = rf(ctx, peConfig)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// WriteSignerState provides a mock function with given fields: ctx, state
+func (_m *Persistence) WriteSignerState(ctx context.Context, state *apitypes.SignerState) error {
+	ret := _m.Called(ctx, state)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *apitypes.SignerState) error); ok {
+		r0 = rf(ctx, state)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // WriteStream provides a mock function with given fields: ctx, spec
 func (_m *Persistence) WriteStream(ctx context.Context, spec *apitypes.EventStream) error {
 	ret := _m.Called(ctx, spec)
@@ -121,12 +121,160 @@ type ListenerWithStatus struct {
 	ffcapi.EventListenerHWMResponse
 }
 
+// PolicyEngineConfig is the set of runtime configuration overrides for the policy engine, which are
+// applied on top of the static configuration for the policy engine in the configuration file
+type PolicyEngineConfig struct {
+	Name    string             `ffstruct:"policyengineconfig" json:"name" ffexcludeinput:"true"`
+	Updated *fftypes.FFTime    `ffstruct:"policyengineconfig" json:"updated,omitempty" ffexcludeinput:"true"`
+	Config  fftypes.JSONObject `ffstruct:"policyengineconfig" json:"config"`
+}
+
+// RateLimitStatus is the current state of the token bucket limiting the rate of transaction
+// submissions for an individual signer
+type RateLimitStatus struct {
+	Signer     string             `ffstruct:"ratelimitstatus" json:"signer"`
+	Limit      int                `ffstruct:"ratelimitstatus" json:"limit"`
+	Interval   fftypes.FFDuration `ffstruct:"ratelimitstatus" json:"interval"`
+	Tokens     float64            `ffstruct:"ratelimitstatus" json:"tokens"`
+	LastRefill *fftypes.FFTime    `ffstruct:"ratelimitstatus" json:"lastRefill"`
+}
+
+// SpendLimitStatus is the total spend (value plus gas multiplied by gas price) recorded for an
+// individual signer within the rolling spend limit window
+type SpendLimitStatus struct {
+	Signer       string             `ffstruct:"spendlimitstatus" json:"signer"`
+	Limit        *fftypes.FFBigInt  `ffstruct:"spendlimitstatus" json:"limit"`
+	Window       fftypes.FFDuration `ffstruct:"spendlimitstatus" json:"window"`
+	Spent        *fftypes.FFBigInt  `ffstruct:"spendlimitstatus" json:"spent"`
+	Transactions int                `ffstruct:"spendlimitstatus" json:"transactions"`
+}
+
+// SignerNonceStatus is the nonce management state for an individual signer
+type SignerNonceStatus struct {
+	Signer                string            `ffstruct:"signernoncestatus" json:"signer"`
+	NextNonce             *fftypes.FFBigInt `ffstruct:"signernoncestatus" json:"nextNonce"`
+	NodeNextNonce         *fftypes.FFBigInt `ffstruct:"signernoncestatus" json:"nodeNextNonce"`
+	HighestPersistedNonce *fftypes.FFBigInt `ffstruct:"signernoncestatus" json:"highestPersistedNonce,omitempty"`
+	Pending               int               `ffstruct:"signernoncestatus" json:"pending"`
+	Override              bool              `ffstruct:"signernoncestatus" json:"override"`
+	Paused                bool              `ffstruct:"signernoncestatus" json:"paused"`
+}
+
+// SignerNonceRequest is an operator request to set the next nonce for a signer
+type SignerNonceRequest struct {
+	Nonce *fftypes.FFBigInt `ffstruct:"signernoncerequest" json:"nonce"`
+	Force bool              `ffstruct:"signernoncerequest" json:"force,omitempty"` // re-issue a nonce held by a pending transaction
+}
+
+// SignerState is the persisted operator state for an individual signer, such as whether transaction
+// processing has been paused by an operator, or parked automatically for a reason such as insufficient funds,
+// and any nonce set by an operator for the next transaction
+type SignerState struct {
+	Signer          string             `ffstruct:"signerstate" json:"signer"`
+	Paused          bool               `ffstruct:"signerstate" json:"paused"`
+	Parked          bool               `ffstruct:"signerstate" json:"parked,omitempty"`
+	Reason          ffcapi.ErrorReason `ffstruct:"signerstate" json:"reason,omitempty"`
+	Balance         *fftypes.FFBigInt  `ffstruct:"signerstate" json:"balance,omitempty"`
+	RequiredBalance *fftypes.FFBigInt  `ffstruct:"signerstate" json:"requiredBalance,omitempty"` // cost of the transaction that failed for insufficient funds
+	NextNonce       *fftypes.FFBigInt  `ffstruct:"signerstate" json:"nextNonce,omitempty"`       // operator override for the nonce of the next transaction
+	Updated         *fftypes.FFTime    `ffstruct:"signerstate" json:"updated,omitempty"`
+}
+
+// SignerStateReply is broadcast on the signer alerts topic of the websocket when a signer is automatically parked,
+// and when a parked signer resumes - with a type of SignerParked or SignerResumed
+type SignerStateReply struct {
+	Headers ReplyHeaders `json:"headers"`
+	SignerState
+}
+
+// LeaderLease is a time bound lease on leadership, held by one instance of a set of active/passive instances
+type LeaderLease struct {
+	Name    string          `ffstruct:"leaderlease" json:"name"`
+	Holder  string          `ffstruct:"leaderlease" json:"holder"`
+	Renewed *fftypes.FFTime `ffstruct:"leaderlease" json:"renewed"`
+	Expires *fftypes.FFTime `ffstruct:"leaderlease" json:"expires"`
+	URL     string          `ffstruct:"leaderlease" json:"url,omitempty"` // where other instances can reach the API of the holder
+}
+
+// AvailableTo returns true if the lease is not held by another holder, or has expired
+func (l *LeaderLease) AvailableTo(holder string, now *fftypes.FFTime) bool {
+	return l == nil || l.Holder == holder || l.Expires == nil || !now.Time().Before(*l.Expires.Time())
+}
+
+// LeaderStatus reports whether this instance is the leader, and runs the policy loop, block listener and event streams
+type LeaderStatus struct {
+	Mode   string       `ffstruct:"leaderstatus" json:"mode"`
+	ID     string       `ffstruct:"leaderstatus" json:"id"`
+	Leader bool         `ffstruct:"leaderstatus" json:"leader"`
+	Lease  *LeaderLease `ffstruct:"leaderstatus" json:"lease,omitempty"`
+}
+
+// DrainStatus reports the progress of a graceful drain of the transaction manager
+type DrainStatus struct {
+	Draining bool            `ffstruct:"drainstatus" json:"draining"`
+	Started  *fftypes.FFTime `ffstruct:"drainstatus" json:"started,omitempty"`
+}
+
+// GasOracleStatus is the state of the gas price sources of a policy engine
+type GasOracleStatus struct {
+	PolicyEngine string                   `ffstruct:"gasoraclestatus" json:"policyEngine"`
+	Aggregation  string                   `ffstruct:"gasoraclestatus" json:"aggregation"`
+	LastValue    *fftypes.JSONAny         `ffstruct:"gasoraclestatus" json:"lastValue,omitempty"`
+	LastQuery    *fftypes.FFTime          `ffstruct:"gasoraclestatus" json:"lastQuery,omitempty"`
+	Sources      []*GasOracleSourceStatus `ffstruct:"gasoraclestatus" json:"sources"`
+}
+
+// GasOracleSourceStatus is the result of the most recent queries of an individual gas price source
+type GasOracleSourceStatus struct {
+	Name          string           `ffstruct:"gasoraclesourcestatus" json:"name"`
+	Type          string           `ffstruct:"gasoraclesourcestatus" json:"type"`
+	Healthy       bool             `ffstruct:"gasoraclesourcestatus" json:"healthy"`
+	LastValue     *fftypes.JSONAny `ffstruct:"gasoraclesourcestatus" json:"lastValue,omitempty"`
+	LastSuccess   *fftypes.FFTime  `ffstruct:"gasoraclesourcestatus" json:"lastSuccess,omitempty"`
+	LastError     string           `ffstruct:"gasoraclesourcestatus" json:"lastError,omitempty"`
+	LastErrorTime *fftypes.FFTime  `ffstruct:"gasoraclesourcestatus" json:"lastErrorTime,omitempty"`
+}
+
+// PolicyLoopStatus reports on each of the workers that evaluate in-flight transactions in the policy loop
+type PolicyLoopStatus struct {
+	Workers       []*PolicyLoopWorkerStatus `ffstruct:"policyloopstatus" json:"workers"`
+	PausedSigners []string                  `ffstruct:"policyloopstatus" json:"pausedSigners"`
+}
+
+type PolicyLoopWorkerStatus struct {
+	Worker            int                `ffstruct:"policyloopworkerstatus" json:"worker"`
+	Transactions      int                `ffstruct:"policyloopworkerstatus" json:"transactions"`
+	LastCycleStart    *fftypes.FFTime    `ffstruct:"policyloopworkerstatus" json:"lastCycleStart,omitempty"`
+	LastCycleDuration fftypes.FFDuration `ffstruct:"policyloopworkerstatus" json:"lastCycleDuration"`
+}
+
 type LiveStatus struct {
 	ffcapi.LiveResponse
 }
 
 type ReadyStatus struct {
 	ffcapi.ReadyResponse
+	CircuitBreaker *CircuitBreakerStatus `ffstruct:"readystatus" json:"circuitBreaker,omitempty"`
+}
+
+type CircuitBreakerState string
+
+const (
+	// CircuitBreakerStateClosed is the normal state, where calls are passed to the connector
+	CircuitBreakerStateClosed CircuitBreakerState = "closed"
+	// CircuitBreakerStateOpen is the state after consecutive failures, where calls fail without reaching the connector
+	CircuitBreakerStateOpen CircuitBreakerState = "open"
+	// CircuitBreakerStateHalfOpen is the state after the reset timeout, where a single call is passed to the connector to test it
+	CircuitBreakerStateHalfOpen CircuitBreakerState = "half_open"
+)
+
+// CircuitBreakerStatus is the state of the circuit breaker on calls to the connector
+type CircuitBreakerStatus struct {
+	State               CircuitBreakerState `ffstruct:"circuitbreakerstatus" json:"state"`
+	ConsecutiveFailures int                 `ffstruct:"circuitbreakerstatus" json:"consecutiveFailures"`
+	LastFailureReason   ffcapi.ErrorReason  `ffstruct:"circuitbreakerstatus" json:"lastFailureReason,omitempty"`
+	LastFailure         string              `ffstruct:"circuitbreakerstatus" json:"lastFailure,omitempty"`
+	OpenedAt            *fftypes.FFTime     `ffstruct:"circuitbreakerstatus" json:"openedAt,omitempty"`
 }
 
 // CheckUpdateString helper merges supplied configuration, with a base, and applies a default if unset
@@ -252,3 +252,18 @@ func TestUnmarshalFail(t *testing.T) {
 	assert.Error(t, err)
 
 }
+
+func TestLeaderLeaseAvailableTo(t *testing.T) {
+	now := fftypes.Now()
+	expires := fftypes.FFTime(now.Time().Add(1 * time.Minute))
+	var noLease *LeaderLease
+	assert.True(t, noLease.AvailableTo("instance1", now))
+
+	lease := &LeaderLease{Name: "fftm", Holder: "instance1", Renewed: now, Expires: &expires}
+	assert.True(t, lease.AvailableTo("instance1", now))
+	assert.False(t, lease.AvailableTo("instance2", now))
+	assert.True(t, lease.AvailableTo("instance2", &expires))
+
+	lease.Expires = nil
+	assert.True(t, lease.AvailableTo("instance2", now))
+}
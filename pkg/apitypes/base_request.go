@@ -38,14 +38,17 @@ func (br *BaseRequest) UnmarshalTo(o interface{}) error {
 }
 
 type RequestHeaders struct {
-	ID   string      `ffstruct:"fftmrequest" json:"id"`
-	Type RequestType `json:"type"`
+	ID           string      `ffstruct:"fftmrequest" json:"id"`
+	Type         RequestType `json:"type"`
+	PolicyEngine string      `ffstruct:"fftmrequest" json:"policyEngine,omitempty"`
 }
 
 type RequestType string
 
 const (
-	RequestTypeSendTransaction RequestType = "SendTransaction"
-	RequestTypeQuery           RequestType = "Query"
-	RequestTypeDeploy          RequestType = "DeployContract"
+	RequestTypeSendTransaction    RequestType = "SendTransaction"
+	RequestTypePrepareTransaction RequestType = "PrepareTransaction"
+	RequestTypeSendRawTransaction RequestType = "SendRawTransaction"
+	RequestTypeQuery              RequestType = "Query"
+	RequestTypeDeploy             RequestType = "DeployContract"
 )
@@ -34,6 +34,42 @@ const (
 	TxStatusFailed TxStatus = "Failed"
 )
 
+// TxAction is a type of action recorded in the history of a transaction
+type TxAction string
+
+const (
+	// TxActionPrepared is recorded when the transaction has been prepared by the connector for submission
+	TxActionPrepared TxAction = "Prepared"
+	// TxActionNonceAssigned is recorded when the transaction has been assigned a nonce, and persisted
+	TxActionNonceAssigned TxAction = "NonceAssigned"
+	// TxActionSigned is recorded when a transaction signed outside of the connector is supplied
+	TxActionSigned TxAction = "Signed"
+	// TxActionSubmitted is recorded when the transaction is first submitted to the blockchain
+	TxActionSubmitted TxAction = "Submitted"
+	// TxActionResubmitted is recorded for each subsequent submission, such as with an updated gas price
+	TxActionResubmitted TxAction = "Resubmitted"
+	// TxActionReceipt is recorded when a receipt is received for the transaction
+	TxActionReceipt TxAction = "Receipt"
+	// TxActionConfirmed is recorded when the transaction has reached the required number of confirmations
+	TxActionConfirmed TxAction = "Confirmed"
+	// TxActionError is recorded for each error processing the transaction
+	TxActionError TxAction = "Error"
+	// TxActionDeleteRequested is recorded when deletion of the transaction is requested
+	TxActionDeleteRequested TxAction = "DeleteRequested"
+)
+
+// ManagedTXHistoryEntry is a structured record of an action performed on a transaction
+type ManagedTXHistoryEntry struct {
+	Time            *fftypes.FFTime    `json:"time"`
+	Action          TxAction           `json:"action"`
+	Nonce           *fftypes.FFBigInt  `json:"nonce,omitempty"`
+	TransactionHash string             `json:"transactionHash,omitempty"`
+	GasPrice        *fftypes.JSONAny   `json:"gasPrice,omitempty"`
+	BlockNumber     *fftypes.FFBigInt  `json:"blockNumber,omitempty"`
+	Error           string             `json:"error,omitempty"`
+	Mapped          ffcapi.ErrorReason `json:"mapped,omitempty"`
+}
+
 type ManagedTXError struct {
 	Time   *fftypes.FFTime    `json:"time"`
 	Error  string             `json:"error,omitempty"`
@@ -51,6 +87,8 @@ type ManagedTXError struct {
 //     the key includes the ID of the TX for uniqueness.
 //   - Pending sequence: An entry in this index only exists while the transaction is pending, and is
 //     ordered by a UUIDv1 sequence allocated to each entry.
+//   - Deployments: a timestamp ordered index, like the created time index, that only contains the
+//     transactions that deploy a contract.
 //
 // Index cleanup after partial write:
 //   - All indexes are stored before the TX itself.
@@ -67,23 +105,43 @@ type ManagedTX struct {
 	Gas                *fftypes.FFBigInt                  `json:"gas"`
 	TransactionHeaders ffcapi.TransactionHeaders          `json:"transactionHeaders"`
 	TransactionData    string                             `json:"transactionData"`
+	RequestHash        *fftypes.Bytes32                   `json:"requestHash,omitempty"`
+	PolicyEngine       string                             `json:"policyEngine,omitempty"`
+	ContractDeploy     bool                               `json:"contractDeploy,omitempty"`
+	SignExternally     bool                               `json:"signExternally,omitempty"`
+	RawTransaction     string                             `json:"rawTransaction,omitempty"`
 	TransactionHash    string                             `json:"transactionHash,omitempty"`
 	GasPrice           *fftypes.JSONAny                   `json:"gasPrice"`
 	PolicyInfo         *fftypes.JSONAny                   `json:"policyInfo"`
 	FirstSubmit        *fftypes.FFTime                    `json:"firstSubmit,omitempty"`
 	LastSubmit         *fftypes.FFTime                    `json:"lastSubmit,omitempty"`
 	Receipt            *ffcapi.TransactionReceiptResponse `json:"receipt,omitempty"`
+	ContractLocation   *fftypes.JSONAny                   `json:"contractLocation,omitempty"`
 	ErrorMessage       string                             `json:"errorMessage,omitempty"`
 	ErrorHistory       []*ManagedTXError                  `json:"errorHistory"`
+	ConsecutiveErrors  int                                `json:"consecutiveErrors,omitempty"`
+	ErrorsSince        *fftypes.FFTime                    `json:"errorsSince,omitempty"`
+	History            []*ManagedTXHistoryEntry           `json:"history,omitempty"`
 	Confirmations      []confirmations.BlockInfo          `json:"confirmations,omitempty"`
 }
 
+// AddHistory appends an action to the history of the transaction, setting the time if not supplied.
+// The history is capped to the configured length by the transaction manager when it is persisted.
+func (mtx *ManagedTX) AddHistory(entry *ManagedTXHistoryEntry) {
+	if entry.Time == nil {
+		entry.Time = fftypes.Now()
+	}
+	mtx.History = append(mtx.History, entry)
+}
+
 type ReplyType string
 
 const (
 	TransactionUpdate        ReplyType = "TransactionUpdate"
 	TransactionUpdateSuccess ReplyType = "TransactionSuccess"
 	TransactionUpdateFailure ReplyType = "TransactionFailure"
+	SignerParked             ReplyType = "SignerParked"
+	SignerResumed            ReplyType = "SignerResumed"
 )
 
 type ReplyHeaders struct {
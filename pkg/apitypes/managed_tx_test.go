@@ -0,0 +1,37 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apitypes
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddHistory(t *testing.T) {
+	mtx := &ManagedTX{}
+
+	mtx.AddHistory(&ManagedTXHistoryEntry{Action: TxActionPrepared})
+	assert.NotNil(t, mtx.History[0].Time)
+
+	submitted := fftypes.Now()
+	mtx.AddHistory(&ManagedTXHistoryEntry{Time: submitted, Action: TxActionSubmitted, TransactionHash: "0x12345"})
+	assert.Len(t, mtx.History, 2)
+	assert.Equal(t, submitted, mtx.History[1].Time)
+	assert.Equal(t, TxActionSubmitted, mtx.History[1].Action)
+}
@@ -17,6 +17,7 @@
 package apitypes
 
 import (
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
 )
 
@@ -24,6 +25,9 @@ import (
 type QueryRequest struct {
 	Headers RequestHeaders `json:"headers"`
 	ffcapi.TransactionInput
+	BlockNumber *fftypes.FFBigInt `json:"blockNumber,omitempty"` // optional - pins the query to a block number
+	BlockHash   string            `json:"blockHash,omitempty"`   // optional - pins the query to a block hash
+	BlockTag    ffcapi.BlockTag   `json:"blockTag,omitempty"`    // optional - one of "latest", "safe" or "finalized"
 }
 
 // QueryResponse is the response payload for a query
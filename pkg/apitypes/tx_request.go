@@ -31,3 +31,16 @@ type ContractDeployRequest struct {
 	Headers RequestHeaders `json:"headers"`
 	ffcapi.ContractDeployPrepareRequest
 }
+
+// SignedTransactionRequest is the payload sent to submit a transaction that was prepared for
+// external signing, once it has been signed
+type SignedTransactionRequest struct {
+	RawTransaction string `json:"rawTransaction"`
+}
+
+// RawTransactionRequest is the payload sent to broadcast and track a transaction that was signed outside
+// of the transaction manager
+type RawTransactionRequest struct {
+	Headers RequestHeaders `json:"headers"`
+	SignedTransactionRequest
+}
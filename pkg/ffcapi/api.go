@@ -38,6 +38,9 @@ type API interface {
 	// NextNonceForSigner is used when there are no outstanding transactions for a given signing identity, to determine the next nonce to use for submission of a transaction
 	NextNonceForSigner(ctx context.Context, req *NextNonceForSignerRequest) (*NextNonceForSignerResponse, ErrorReason, error)
 
+	// BalanceForSigner queries the balance of the native coin held by a signing identity, such as to determine when a signer that ran out of funds can resume submitting transactions
+	BalanceForSigner(ctx context.Context, req *BalanceForSignerRequest) (*BalanceForSignerResponse, ErrorReason, error)
+
 	// GasPriceEstimate provides a blockchain specific gas price estimate
 	GasPriceEstimate(ctx context.Context, req *GasPriceEstimateRequest) (*GasPriceEstimateResponse, ErrorReason, error)
 
@@ -53,6 +56,12 @@ type API interface {
 	// TransactionSend combines a previously prepared encoded transaction, with a current gas price, and submits it to the transaction pool of the blockchain for mining
 	TransactionSend(ctx context.Context, req *TransactionSendRequest) (*TransactionSendResponse, ErrorReason, error)
 
+	// TransactionSendRaw submits a transaction that was signed outside of the connector to the transaction pool of the blockchain, as-is
+	TransactionSendRaw(ctx context.Context, req *TransactionSendRawRequest) (*TransactionSendRawResponse, ErrorReason, error)
+
+	// TransactionDecode decodes a transaction that was signed outside of the connector, to extract the signer, nonce and transaction hash
+	TransactionDecode(ctx context.Context, req *TransactionDecodeRequest) (*TransactionDecodeResponse, ErrorReason, error)
+
 	// DeployContractPrepare
 	DeployContractPrepare(ctx context.Context, req *ContractDeployPrepareRequest) (*TransactionPrepareResponse, ErrorReason, error)
 
@@ -185,6 +194,8 @@ const (
 	ErrorKnownTransaction ErrorReason = "known_transaction"
 	// ErrorReasonDownstreamDown if the downstream JSONRPC endpoint is down
 	ErrorReasonDownstreamDown = "downstream_down"
+	// ErrorReasonSpendLimitExceeded if the transaction manager rejected the transaction before submission, as it would exceed the spend limit for the signer (not returned by connectors)
+	ErrorReasonSpendLimitExceeded ErrorReason = "spend_limit_exceeded"
 )
 
 // TransactionInput is a standardized set of parameters that describe a transaction submission to a blockchain.
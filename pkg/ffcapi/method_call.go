@@ -26,11 +26,25 @@ import (
 //
 // See the list of standard error reasons that should be returned for situations that can be
 // detected by the back-end connector.
+//
+// By default the query runs against the latest state. At most one of BlockNumber, BlockHash
+// or BlockTag can be set, to pin the query to a specific block.
 type QueryInvokeRequest struct {
 	TransactionInput
 	BlockNumber *fftypes.FFBigInt `json:"blockNumber,omitempty"`
+	BlockHash   string            `json:"blockHash,omitempty"`
+	BlockTag    BlockTag          `json:"blockTag,omitempty"`
 }
 
+// BlockTag is a named reference to a block, resolved by the connector at the time of the query
+type BlockTag string
+
+const (
+	BlockTagLatest    BlockTag = "latest"
+	BlockTagSafe      BlockTag = "safe"
+	BlockTagFinalized BlockTag = "finalized"
+)
+
 type QueryInvokeResponse struct {
 	Outputs *fftypes.JSONAny `json:"outputs"` // The data output from the method call - can be array or object structure
 }
@@ -0,0 +1,35 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapi
+
+import "github.com/hyperledger/firefly-common/pkg/fftypes"
+
+// TransactionDecodeRequest is used to decode a transaction that was signed outside of the
+// transaction manager, so it can be tracked through to confirmation
+type TransactionDecodeRequest struct {
+	RawTransaction string `json:"rawTransaction"`
+}
+
+// TransactionDecodeResponse must include at least the signer (from) and nonce, as well as the hash
+// the transaction will have once submitted. The gas price and transaction data are used to check the
+// transaction against the one prepared for signing, and the cost of the transaction against spend limits.
+type TransactionDecodeResponse struct {
+	TransactionHeaders
+	GasPrice        *fftypes.JSONAny `json:"gasPrice,omitempty"`
+	TransactionData string           `json:"transactionData,omitempty"`
+	TransactionHash string           `json:"transactionHash"`
+}
@@ -29,5 +29,6 @@ type TransactionReceiptResponse struct {
 	TransactionIndex *fftypes.FFBigInt `json:"transactionIndex"`
 	BlockHash        string            `json:"blockHash"`
 	Success          bool              `json:"success"`
+	ContractLocation *fftypes.JSONAny  `json:"contractLocation,omitempty"` // for a contract deployment, the blockchain specific location of the new contract - such as {"address":"0x..."}
 	ExtraInfo        *fftypes.JSONAny  `json:"extraInfo"`
 }
@@ -0,0 +1,29 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapi
+
+// TransactionSendRawRequest is used to send a transaction that has already been signed outside
+// of the connector, such as by a hardware-backed signer. The connector is responsible for adding
+// it to the transaction pool of the blockchain, without any modification.
+type TransactionSendRawRequest struct {
+	TransactionHeaders
+	RawTransaction string `json:"rawTransaction"`
+}
+
+type TransactionSendRawResponse struct {
+	TransactionHash string `json:"transactionHash"`
+}
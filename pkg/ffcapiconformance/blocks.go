@@ -0,0 +1,179 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+var checkLiveAndReady = &check{
+	name:     "LiveAndReady",
+	contract: "IsLive reports the connector is up, and IsReady reports it is ready, once it is connected to its node - these drive the status endpoints of the manager",
+	run: func(cc *checkContext) {
+		live, reason, err := cc.api.IsLive(cc.ctx)
+		switch {
+		case err != nil:
+			cc.failf("IsLive failed (reason=%s): %s", reason, err)
+		case !live.Up:
+			cc.failf("IsLive reported the connector is not up")
+		}
+		ready, reason, err := cc.api.IsReady(cc.ctx)
+		switch {
+		case err != nil:
+			cc.failf("IsReady failed (reason=%s): %s", reason, err)
+		case !ready.Ready:
+			cc.failf("IsReady reported the connector is not ready: %s", ready.DownstreamDetails)
+		}
+	},
+}
+
+var checkBlockInfo = &check{
+	name:     "BlockInfo",
+	contract: "BlockInfoByHash and BlockInfoByNumber return the same block, linked to its parent by ParentHash - the confirmation manager uses both to walk the chain",
+	run: func(cc *checkContext) {
+		bl := cc.startBlockListener()
+		defer bl.stop()
+		cc.mineBlock()
+		blockHash := bl.nextBlock()
+		byHash := cc.blockByHash(blockHash)
+		if byHash.BlockHash != blockHash {
+			cc.failf("BlockInfoByHash for block %s returned block hash %s", blockHash, byHash.BlockHash)
+		}
+		if byHash.BlockNumber == nil {
+			cc.fatalf("BlockInfoByHash for block %s returned no block number", blockHash)
+		}
+		if byHash.ParentHash == "" {
+			cc.failf("BlockInfoByHash for block %s returned no parent hash", blockHash)
+		}
+		byNumber := cc.blockByNumber(byHash.BlockNumber.Int())
+		if byNumber.BlockHash != byHash.BlockHash || byNumber.ParentHash != byHash.ParentHash {
+			cc.failf("BlockInfoByNumber for block %s returned hash=%s parent=%s, but BlockInfoByHash returned hash=%s parent=%s",
+				byHash.BlockNumber, byNumber.BlockHash, byNumber.ParentHash, byHash.BlockHash, byHash.ParentHash)
+		}
+		if byHash.BlockNumber.Int().Sign() > 0 {
+			parent := cc.blockByNumber(new(big.Int).Sub(byHash.BlockNumber.Int(), big.NewInt(1)))
+			if parent.BlockHash != byHash.ParentHash {
+				cc.failf("block %s has parent hash %s, but BlockInfoByNumber for block %s returned hash %s",
+					byHash.BlockNumber, byHash.ParentHash, parent.BlockNumber, parent.BlockHash)
+			}
+		}
+	},
+}
+
+var checkBlockListener = &check{
+	name:     "BlockListener",
+	contract: "each block hash notified to a block listener is returned by BlockInfoByHash, and the blocks notified are linked by ParentHash - the confirmation manager relies on the notifications to detect new blocks and forks",
+	run: func(cc *checkContext) {
+		bl := cc.startBlockListener()
+		defer bl.stop()
+		var previous *ffcapi.BlockInfo
+		for i := 0; i < 3; i++ {
+			cc.mineBlock()
+			be := bl.next()
+			for len(be.BlockHashes) == 0 {
+				be = bl.next()
+			}
+			if be.GapPotential {
+				// Blocks might have been missed, so there is no parent to check against
+				previous = nil
+			}
+			for _, blockHash := range be.BlockHashes {
+				block := cc.blockByHash(blockHash)
+				if previous != nil && block.ParentHash != previous.BlockHash {
+					cc.failf("block %s (%s) was notified after block %s (%s), but has parent hash %s",
+						block.BlockNumber, block.BlockHash, previous.BlockNumber, previous.BlockHash, block.ParentHash)
+				}
+				previous = block
+			}
+		}
+	},
+}
+
+var checkGapPotential = &check{
+	name:     "GapPotential",
+	contract: "after the connector reconnects to its node, the next notification to each block listener has GapPotential set - the confirmation manager then re-checks the chain for blocks it missed",
+	run: func(cc *checkContext) {
+		rh, ok := cc.h.(ReconnectHarness)
+		if !ok {
+			cc.skip("harness does not implement ReconnectHarness")
+		}
+		bl := cc.startBlockListener()
+		defer bl.stop()
+		cc.mineBlock()
+		bl.nextBlock()
+		if err := rh.SimulateReconnect(cc.ctx); err != nil {
+			cc.fatalf("harness failed to simulate a reconnect: %s", err)
+		}
+		cc.mineBlock()
+		timeout := time.After(cc.options.Timeout)
+		for {
+			select {
+			case be := <-bl.blocks:
+				if be.GapPotential {
+					return
+				}
+			case <-timeout:
+				cc.fatalf("no notification with GapPotential set was received within %s of a reconnect", cc.options.Timeout)
+			}
+		}
+	},
+}
+
+var checkNotFound = &check{
+	name:     "NotFound",
+	contract: "BlockInfoByHash, BlockInfoByNumber and TransactionReceipt fail with ErrorReasonNotFound for a block or transaction that does not exist - the confirmation manager and policy engine treat any other failure as an error to retry",
+	run: func(cc *checkContext) {
+		res, reason, err := cc.api.BlockInfoByHash(cc.ctx, &ffcapi.BlockInfoByHashRequest{BlockHash: cc.options.UnknownBlockHash})
+		cc.checkNotFound("BlockInfoByHash", cc.options.UnknownBlockHash, res, reason, err)
+
+		blockNumber := fftypes.NewFFBigInt(1 << 62)
+		res2, reason, err := cc.api.BlockInfoByNumber(cc.ctx, &ffcapi.BlockInfoByNumberRequest{BlockNumber: blockNumber})
+		cc.checkNotFound("BlockInfoByNumber", blockNumber.String(), res2, reason, err)
+
+		res3, reason, err := cc.api.TransactionReceipt(cc.ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: cc.options.UnknownTransactionHash})
+		cc.checkNotFound("TransactionReceipt", cc.options.UnknownTransactionHash, res3, reason, err)
+	},
+}
+
+func (cc *checkContext) checkNotFound(method, id string, res interface{}, reason ffcapi.ErrorReason, err error) {
+	switch {
+	case err == nil:
+		cc.failf("%s for %s did not fail, and returned %+v", method, id, res)
+	case reason != ffcapi.ErrorReasonNotFound:
+		cc.failf("%s for %s failed with reason %q instead of %q: %s", method, id, reason, ffcapi.ErrorReasonNotFound, err)
+	}
+}
+
+func (cc *checkContext) blockByHash(blockHash string) *ffcapi.BlockInfo {
+	res, reason, err := cc.api.BlockInfoByHash(cc.ctx, &ffcapi.BlockInfoByHashRequest{BlockHash: blockHash})
+	if err != nil {
+		cc.fatalf("BlockInfoByHash failed for block %s (reason=%s): %s", blockHash, reason, err)
+	}
+	return &res.BlockInfo
+}
+
+func (cc *checkContext) blockByNumber(blockNumber *big.Int) *ffcapi.BlockInfo {
+	res, reason, err := cc.api.BlockInfoByNumber(cc.ctx, &ffcapi.BlockInfoByNumberRequest{BlockNumber: (*fftypes.FFBigInt)(blockNumber)})
+	if err != nil {
+		cc.fatalf("BlockInfoByNumber failed for block %s (reason=%s): %s", blockNumber, reason, err)
+	}
+	return &res.BlockInfo
+}
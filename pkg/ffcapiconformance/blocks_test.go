@@ -0,0 +1,204 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapisim"
+)
+
+func TestBlockChecksReportFailures(t *testing.T) {
+	runFaultTestCases(t, []*faultTestCase{
+		{
+			name:  "LiveAndReadyFail",
+			check: checkLiveAndReady,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodIsLive, ffcapi.ErrorReasonDownstreamDown, -1)
+				h.sim.InjectError(ffcapisim.MethodIsReady, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^IsLive failed \(reason=downstream_down\): FF21112`,
+				`^IsReady failed \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "LiveAndReadyDown",
+			check: checkLiveAndReady,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.live = func(res *ffcapi.LiveResponse) *ffcapi.LiveResponse {
+					return &ffcapi.LiveResponse{Up: false}
+				}
+				fc.ready = func(res *ffcapi.ReadyResponse) *ffcapi.ReadyResponse {
+					return &ffcapi.ReadyResponse{Ready: false, DownstreamDetails: fftypes.JSONAnyPtr(`{"syncing":true}`)}
+				}
+			},
+			failures: []string{
+				`^IsLive reported the connector is not up$`,
+				`^IsReady reported the connector is not ready: {"syncing":true}$`,
+			},
+		},
+		{
+			name:  "BlockInfoWrongBlock",
+			check: checkBlockInfo,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.blockByHash = func(res *ffcapi.BlockInfoByHashResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.BlockInfoByHashResponse, ffcapi.ErrorReason, error) {
+					if err == nil {
+						res.BlockHash = "0xwrong"
+						res.ParentHash = ""
+					}
+					return res, reason, err
+				}
+			},
+			failures: []string{
+				`^BlockInfoByHash for block 0x\w+ returned block hash 0xwrong$`,
+				`^BlockInfoByHash for block 0x\w+ returned no parent hash$`,
+				`^BlockInfoByNumber for block 1 returned hash=0x\w+ parent=0x\w+, but BlockInfoByHash returned hash=0xwrong parent=$`,
+				`^block 1 has parent hash , but BlockInfoByNumber for block 0 returned hash 0x\w+$`,
+			},
+		},
+		{
+			name:  "BlockInfoNoBlockNumber",
+			check: checkBlockInfo,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.blockByHash = func(res *ffcapi.BlockInfoByHashResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.BlockInfoByHashResponse, ffcapi.ErrorReason, error) {
+					if err == nil {
+						res.BlockNumber = nil
+					}
+					return res, reason, err
+				}
+			},
+			failures: []string{
+				`^BlockInfoByHash for block 0x\w+ returned no block number$`,
+			},
+		},
+		{
+			name:  "BlockInfoByHashFail",
+			check: checkBlockInfo,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodBlockInfoByHash, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^BlockInfoByHash failed for block 0x\w+ \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "BlockInfoByNumberFail",
+			check: checkBlockInfo,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodBlockInfoByNumber, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^BlockInfoByNumber failed for block 1 \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "MineBlockFail",
+			check: checkBlockInfo,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.failing = "MineBlock"
+			},
+			failures: []string{
+				`^harness failed to mine a block: pop$`,
+			},
+		},
+		{
+			name:  "BlockListenerFail",
+			check: checkBlockListener,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodNewBlockListener, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^NewBlockListener failed \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:    "BlockListenerSilent",
+			check:   checkBlockListener,
+			timeout: 10 * time.Millisecond,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.blocks = func(be *ffcapi.BlockHashEvent) []*ffcapi.BlockHashEvent {
+					return nil
+				}
+			},
+			failures: []string{
+				`^timed out after 10ms waiting for a notification on the block listener$`,
+			},
+		},
+		{
+			name:  "BlockListenerRepeatsBlocks",
+			check: checkBlockListener,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.blocks = func(be *ffcapi.BlockHashEvent) []*ffcapi.BlockHashEvent {
+					return []*ffcapi.BlockHashEvent{be, be}
+				}
+			},
+			failures: []string{
+				`^block 1 \(0x\w+\) was notified after block 1 \(0x\w+\), but has parent hash 0x\w+$`,
+			},
+		},
+		{
+			// Empty notifications, and notifications that might follow missed blocks, are both allowed
+			name:  "BlockListenerGapPotential",
+			check: checkBlockListener,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.blocks = func(be *ffcapi.BlockHashEvent) []*ffcapi.BlockHashEvent {
+					return []*ffcapi.BlockHashEvent{
+						{GapPotential: true},
+						{BlockHashes: be.BlockHashes, GapPotential: true},
+					}
+				}
+			},
+		},
+		{
+			name:  "GapPotentialReconnectFail",
+			check: checkGapPotential,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.failing = "SimulateReconnect"
+			},
+			failures: []string{
+				`^harness failed to simulate a reconnect: pop$`,
+			},
+		},
+		{
+			name:    "GapPotentialMissing",
+			check:   checkGapPotential,
+			timeout: 10 * time.Millisecond,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.blocks = func(be *ffcapi.BlockHashEvent) []*ffcapi.BlockHashEvent {
+					return []*ffcapi.BlockHashEvent{{BlockHashes: be.BlockHashes}}
+				}
+			},
+			failures: []string{
+				`^no notification with GapPotential set was received within 10ms of a reconnect$`,
+			},
+		},
+		{
+			name:  "NotFoundBlockExists",
+			check: checkNotFound,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				options.UnknownBlockHash = h.sim.MineBlock().BlockHash
+			},
+			failures: []string{
+				`^BlockInfoByHash for 0x\w+ did not fail, and returned &{BlockInfo:{BlockNumber:1 `,
+			},
+		},
+	})
+}
@@ -0,0 +1,235 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ffcapiconformance is a test suite that a connector runs against its ffcapi.API implementation, to verify
+// the contracts the transaction manager relies on. Such as the ordering of events and checkpoints, removed events
+// on a reorg, the GapPotential flag on block notifications, and the mapping of errors to an ffcapi.ErrorReason.
+//
+// The connector supplies a Harness that drives the blockchain behind the connector. Checks that need a capability
+// the harness does not implement (ReorgHarness, ReconnectHarness, TransactionHarness) are skipped.
+//
+// From a Go test of the connector:
+//
+//	func TestConformance(t *testing.T) {
+//		ffcapiconformance.Run(t, newMyHarness(t), nil)
+//	}
+package ffcapiconformance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// Harness drives the blockchain behind the connector under test
+type Harness interface {
+	// Connector returns the connector under test
+	Connector() ffcapi.API
+	// ListenerOptions returns the filters and options of a listener that matches the events emitted by EmitEvents. The FromBlock is set by each check
+	ListenerOptions() ffcapi.EventListenerOptions
+	// EmitEvents emits the requested number of events, which can be spread across blocks, and returns once they are all mined
+	EmitEvents(ctx context.Context, count int) error
+	// MineBlock returns once at least one new block has been mined
+	MineBlock(ctx context.Context) error
+}
+
+// ReorgHarness is implemented by a harness that can cause a reorg of the chain
+type ReorgHarness interface {
+	// Reorg replaces every block from fromBlock onwards with a longer fork, that includes the same transactions
+	Reorg(ctx context.Context, fromBlock uint64) error
+}
+
+// ReconnectHarness is implemented by a harness that can break the connection between the connector and its node
+type ReconnectHarness interface {
+	// SimulateReconnect causes the connector to lose, and then re-establish, its connection to its node
+	SimulateReconnect(ctx context.Context) error
+}
+
+// TransactionHarness is implemented by a harness that can supply transactions to submit
+type TransactionHarness interface {
+	// TransactionInput returns a transaction that will succeed, from a signer with the funds to pay for it. The nonce is assigned by the check
+	TransactionInput() *ffcapi.TransactionInput
+}
+
+// Options configure a run of the suite. Any field left empty uses the default.
+type Options struct {
+	Timeout                time.Duration // the maximum time to wait for an event, block or receipt
+	UnknownBlockHash       string        // a block hash that is valid for the blockchain, but does not exist
+	UnknownTransactionHash string        // a transaction hash that is valid for the blockchain, but does not exist
+}
+
+const (
+	defaultTimeout     = 30 * time.Second
+	defaultUnknownHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Name     string   // the name of the check
+	Contract string   // the contract that was checked, and the component of the transaction manager that relies on it
+	Skipped  string   // if set, the reason the check was skipped
+	Failures []string // each violation of the contract detected by the check
+}
+
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// String is a report of the result, that includes the contract and each violation of it when the check failed
+func (r *Result) String() string {
+	switch {
+	case r.Skipped != "":
+		return fmt.Sprintf("SKIP %s: %s", r.Name, r.Skipped)
+	case r.Passed():
+		return fmt.Sprintf("PASS %s", r.Name)
+	default:
+		return fmt.Sprintf("FAIL %s\n  contract: %s\n  - %s", r.Name, r.Contract, strings.Join(r.Failures, "\n  - "))
+	}
+}
+
+type check struct {
+	name     string
+	contract string
+	run      func(cc *checkContext)
+}
+
+var checks = []*check{
+	checkLiveAndReady,
+	checkBlockInfo,
+	checkBlockListener,
+	checkGapPotential,
+	checkNotFound,
+	checkEventOrdering,
+	checkCheckpointRestore,
+	checkResumeFromCheckpoint,
+	checkHighWaterMark,
+	checkRemovedEvents,
+	checkStreamRestart,
+	checkTransactionSubmission,
+}
+
+// checkAborted is used to stop a check after a failure that it cannot continue from
+type checkAborted struct{}
+
+type checkContext struct {
+	ctx     context.Context
+	h       Harness
+	api     ffcapi.API
+	options *Options
+	result  *Result
+}
+
+func (cc *checkContext) failf(format string, args ...interface{}) {
+	cc.result.Failures = append(cc.result.Failures, fmt.Sprintf(format, args...))
+}
+
+func (cc *checkContext) fatalf(format string, args ...interface{}) {
+	cc.failf(format, args...)
+	panic(checkAborted{})
+}
+
+func (cc *checkContext) skip(reason string) {
+	cc.result.Skipped = reason
+	panic(checkAborted{})
+}
+
+func (cc *checkContext) emitEvents(count int) {
+	if err := cc.h.EmitEvents(cc.ctx, count); err != nil {
+		cc.fatalf("harness failed to emit %d events: %s", count, err)
+	}
+}
+
+func (cc *checkContext) mineBlock() {
+	if err := cc.h.MineBlock(cc.ctx); err != nil {
+		cc.fatalf("harness failed to mine a block: %s", err)
+	}
+}
+
+func (o *Options) withDefaults() *Options {
+	resolved := &Options{}
+	if o != nil {
+		*resolved = *o
+	}
+	if resolved.Timeout <= 0 {
+		resolved.Timeout = defaultTimeout
+	}
+	if resolved.UnknownBlockHash == "" {
+		resolved.UnknownBlockHash = defaultUnknownHash
+	}
+	if resolved.UnknownTransactionHash == "" {
+		resolved.UnknownTransactionHash = defaultUnknownHash
+	}
+	return resolved
+}
+
+func runCheck(ctx context.Context, h Harness, options *Options, c *check) (result *Result) {
+	result = &Result{
+		Name:     c.name,
+		Contract: c.contract,
+	}
+	cc := &checkContext{
+		ctx:     ctx,
+		h:       h,
+		api:     h.Connector(),
+		options: options,
+		result:  result,
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(checkAborted); !ok {
+				result.Failures = append(result.Failures, fmt.Sprintf("panic: %v", r))
+			}
+		}
+	}()
+	c.run(cc)
+	return result
+}
+
+// Check runs every check against the connector of the harness, and returns the results in order
+func Check(ctx context.Context, h Harness, options *Options) []*Result {
+	options = options.withDefaults()
+	results := make([]*Result, len(checks))
+	for i, c := range checks {
+		results[i] = runCheck(ctx, h, options, c)
+	}
+	return results
+}
+
+// Run runs every check against the connector of the harness as a sub-test, reporting the contract and
+// each violation of it when a check fails
+func Run(t *testing.T, h Harness, options *Options) {
+	options = options.withDefaults()
+	for _, c := range checks {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			reportResult(t, runCheck(context.Background(), h, options, c))
+		})
+	}
+}
+
+// reportResult skips the test if the check was skipped, or fails it with the report of the result if the check failed
+func reportResult(t testing.TB, result *Result) {
+	if result.Skipped != "" {
+		t.Skip(result.Skipped)
+	}
+	if !result.Passed() {
+		t.Error(result.String())
+	}
+}
@@ -0,0 +1,478 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapiremote"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapisim"
+	"github.com/stretchr/testify/assert"
+)
+
+const testContract = "0xc0ffee"
+
+type simHarness struct {
+	sim           ffcapisim.Simulator
+	connector     ffcapi.API
+	failing       string // the name of a method of the harness that fails
+	blockPerEvent bool   // mine each event in its own block
+}
+
+func newSimHarness(t *testing.T) *simHarness {
+	sim := ffcapisim.NewSimulator(context.Background(), &ffcapisim.Options{})
+	t.Cleanup(sim.Close)
+	return &simHarness{sim: sim, connector: sim}
+}
+
+func (h *simHarness) Connector() ffcapi.API {
+	return h.connector
+}
+
+func (h *simHarness) ListenerOptions() ffcapi.EventListenerOptions {
+	return ffcapi.EventListenerOptions{
+		Filters: []fftypes.JSONAny{*fftypes.JSONAnyPtr(`{"address":"` + testContract + `"}`)},
+	}
+}
+
+func (h *simHarness) fail(method string) error {
+	if h.failing == method {
+		return fmt.Errorf("pop")
+	}
+	return nil
+}
+
+func (h *simHarness) EmitEvents(ctx context.Context, count int) error {
+	if err := h.fail("EmitEvents"); err != nil {
+		return err
+	}
+	for i := 0; i < count; i++ {
+		h.sim.EmitEvent(testContract, "Changed", fftypes.JSONAnyPtr(`{"value":1}`))
+		if i%2 == 1 || h.blockPerEvent {
+			h.sim.MineBlock()
+		}
+	}
+	h.sim.MineBlock()
+	return nil
+}
+
+func (h *simHarness) MineBlock(ctx context.Context) error {
+	if err := h.fail("MineBlock"); err != nil {
+		return err
+	}
+	h.sim.MineBlock()
+	return nil
+}
+
+func (h *simHarness) Reorg(ctx context.Context, fromBlock uint64) error {
+	if err := h.fail("Reorg"); err != nil {
+		return err
+	}
+	_, err := h.sim.Reorg(int(h.sim.BlockNumber() - fromBlock + 1))
+	return err
+}
+
+func (h *simHarness) SimulateReconnect(ctx context.Context) error {
+	if err := h.fail("SimulateReconnect"); err != nil {
+		return err
+	}
+	h.sim.SimulateReconnect()
+	return nil
+}
+
+func (h *simHarness) TransactionInput() *ffcapi.TransactionInput {
+	return &ffcapi.TransactionInput{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa", To: testContract},
+		Method:             fftypes.JSONAnyPtr(`{"name":"set"}`),
+		Params:             []*fftypes.JSONAny{fftypes.JSONAnyPtr("1")},
+	}
+}
+
+// basicHarness hides the optional capabilities of the harness it wraps
+type basicHarness struct {
+	h Harness
+}
+
+func (b *basicHarness) Connector() ffcapi.API {
+	return b.h.Connector()
+}
+
+func (b *basicHarness) ListenerOptions() ffcapi.EventListenerOptions {
+	return b.h.ListenerOptions()
+}
+
+func (b *basicHarness) EmitEvents(ctx context.Context, count int) error {
+	return b.h.EmitEvents(ctx, count)
+}
+
+func (b *basicHarness) MineBlock(ctx context.Context) error {
+	return b.h.MineBlock(ctx)
+}
+
+// faultyConnector breaks the contracts checked by the suite, by altering the results of the connector it wraps.
+// Each alteration is made only when set.
+type faultyConnector struct {
+	ffcapi.API
+	live        func(res *ffcapi.LiveResponse) *ffcapi.LiveResponse
+	ready       func(res *ffcapi.ReadyResponse) *ffcapi.ReadyResponse
+	blockByHash func(res *ffcapi.BlockInfoByHashResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.BlockInfoByHashResponse, ffcapi.ErrorReason, error)
+	blocks      func(be *ffcapi.BlockHashEvent) []*ffcapi.BlockHashEvent
+	events      func(start int, ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent // start counts the calls to EventStreamStart
+	hwm         func(call int, checkpoint ffcapi.EventListenerCheckpoint) ffcapi.EventListenerCheckpoint
+	prepare     func(res *ffcapi.TransactionPrepareResponse) *ffcapi.TransactionPrepareResponse
+	send        func(call int, res *ffcapi.TransactionSendResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.TransactionSendResponse, ffcapi.ErrorReason, error)
+	receipt     func(res *ffcapi.TransactionReceiptResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.TransactionReceiptResponse, ffcapi.ErrorReason, error)
+	starts      int
+	hwmCalls    int
+	sends       int
+}
+
+func (fc *faultyConnector) IsLive(ctx context.Context) (*ffcapi.LiveResponse, ffcapi.ErrorReason, error) {
+	res, reason, err := fc.API.IsLive(ctx)
+	if err == nil && fc.live != nil {
+		res = fc.live(res)
+	}
+	return res, reason, err
+}
+
+func (fc *faultyConnector) IsReady(ctx context.Context) (*ffcapi.ReadyResponse, ffcapi.ErrorReason, error) {
+	res, reason, err := fc.API.IsReady(ctx)
+	if err == nil && fc.ready != nil {
+		res = fc.ready(res)
+	}
+	return res, reason, err
+}
+
+func (fc *faultyConnector) BlockInfoByHash(ctx context.Context, req *ffcapi.BlockInfoByHashRequest) (*ffcapi.BlockInfoByHashResponse, ffcapi.ErrorReason, error) {
+	res, reason, err := fc.API.BlockInfoByHash(ctx, req)
+	if fc.blockByHash != nil {
+		return fc.blockByHash(res, reason, err)
+	}
+	return res, reason, err
+}
+
+func (fc *faultyConnector) NewBlockListener(ctx context.Context, req *ffcapi.NewBlockListenerRequest) (*ffcapi.NewBlockListenerResponse, ffcapi.ErrorReason, error) {
+	if fc.blocks == nil {
+		return fc.API.NewBlockListener(ctx, req)
+	}
+	blocks := make(chan *ffcapi.BlockHashEvent)
+	upstream := req.BlockListener
+	go func() {
+		for {
+			select {
+			case be := <-blocks:
+				for _, altered := range fc.blocks(be) {
+					select {
+					case upstream <- altered:
+					case <-req.ListenerContext.Done():
+						return
+					}
+				}
+			case <-req.ListenerContext.Done():
+				return
+			}
+		}
+	}()
+	wrapped := *req
+	wrapped.BlockListener = blocks
+	return fc.API.NewBlockListener(ctx, &wrapped)
+}
+
+func (fc *faultyConnector) EventStreamStart(ctx context.Context, req *ffcapi.EventStreamStartRequest) (*ffcapi.EventStreamStartResponse, ffcapi.ErrorReason, error) {
+	fc.starts++
+	if fc.events == nil {
+		return fc.API.EventStreamStart(ctx, req)
+	}
+	start := fc.starts
+	events := make(chan *ffcapi.ListenerEvent)
+	upstream := req.EventStream
+	go func() {
+		for {
+			select {
+			case ev := <-events:
+				for _, altered := range fc.events(start, ev) {
+					select {
+					case upstream <- altered:
+					case <-req.StreamContext.Done():
+						return
+					}
+				}
+			case <-req.StreamContext.Done():
+				return
+			}
+		}
+	}()
+	wrapped := *req
+	wrapped.EventStream = events
+	return fc.API.EventStreamStart(ctx, &wrapped)
+}
+
+func (fc *faultyConnector) EventListenerHWM(ctx context.Context, req *ffcapi.EventListenerHWMRequest) (*ffcapi.EventListenerHWMResponse, ffcapi.ErrorReason, error) {
+	res, reason, err := fc.API.EventListenerHWM(ctx, req)
+	if err == nil && fc.hwm != nil {
+		fc.hwmCalls++
+		res.Checkpoint = fc.hwm(fc.hwmCalls, res.Checkpoint)
+	}
+	return res, reason, err
+}
+
+func (fc *faultyConnector) TransactionPrepare(ctx context.Context, req *ffcapi.TransactionPrepareRequest) (*ffcapi.TransactionPrepareResponse, ffcapi.ErrorReason, error) {
+	res, reason, err := fc.API.TransactionPrepare(ctx, req)
+	if err == nil && fc.prepare != nil {
+		res = fc.prepare(res)
+	}
+	return res, reason, err
+}
+
+func (fc *faultyConnector) TransactionSend(ctx context.Context, req *ffcapi.TransactionSendRequest) (*ffcapi.TransactionSendResponse, ffcapi.ErrorReason, error) {
+	res, reason, err := fc.API.TransactionSend(ctx, req)
+	if fc.send != nil {
+		fc.sends++
+		return fc.send(fc.sends, res, reason, err)
+	}
+	return res, reason, err
+}
+
+func (fc *faultyConnector) TransactionReceipt(ctx context.Context, req *ffcapi.TransactionReceiptRequest) (*ffcapi.TransactionReceiptResponse, ffcapi.ErrorReason, error) {
+	res, reason, err := fc.API.TransactionReceipt(ctx, req)
+	if fc.receipt != nil {
+		return fc.receipt(res, reason, err)
+	}
+	return res, reason, err
+}
+
+// copyEvent returns a copy of the event, that can be altered without affecting the original
+func copyEvent(ev *ffcapi.ListenerEvent) *ffcapi.ListenerEvent {
+	c := *ev
+	if ev.Event != nil {
+		event := *ev.Event
+		c.Event = &event
+	}
+	return &c
+}
+
+// eagerCheckpoint is LessThan every checkpoint, including itself
+type eagerCheckpoint struct {
+	ffcapisim.Checkpoint
+}
+
+func (cp *eagerCheckpoint) LessThan(b ffcapi.EventListenerCheckpoint) bool {
+	return true
+}
+
+// stuckCheckpoint is not LessThan any checkpoint
+type stuckCheckpoint struct {
+	ffcapisim.Checkpoint
+}
+
+func (cp *stuckCheckpoint) LessThan(b ffcapi.EventListenerCheckpoint) bool {
+	return false
+}
+
+// unserializableCheckpoint cannot be serialized to JSON
+type unserializableCheckpoint struct {
+	eagerCheckpoint
+}
+
+func (cp *unserializableCheckpoint) MarshalJSON() ([]byte, error) {
+	return nil, fmt.Errorf("pop")
+}
+
+// foreignCheckpoint serializes to JSON that cannot be restored into the checkpoint of the simulator
+type foreignCheckpoint struct {
+	eagerCheckpoint
+}
+
+func (cp *foreignCheckpoint) MarshalJSON() ([]byte, error) {
+	return []byte(`"foreign"`), nil
+}
+
+// faultTestCase runs a check against a connector, or harness, that breaks a contract of the check
+type faultTestCase struct {
+	name     string
+	check    *check
+	timeout  time.Duration
+	setup    func(h *simHarness, fc *faultyConnector, options *Options)
+	failures []string // each failure reported matches one of these, and each of these matches a failure
+}
+
+func runFaultTestCases(t *testing.T, testCases []*faultTestCase) {
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			h := newSimHarness(t)
+			fc := &faultyConnector{API: h.sim}
+			h.connector = fc
+			options := &Options{Timeout: tc.timeout}
+			if options.Timeout == 0 {
+				options.Timeout = 5 * time.Second
+			}
+			if tc.setup != nil {
+				tc.setup(h, fc, options)
+			}
+			result := runCheck(context.Background(), h, options.withDefaults(), tc.check)
+			for _, expected := range tc.failures {
+				matched := false
+				for _, failure := range result.Failures {
+					matched = matched || regexp.MustCompile(expected).MatchString(failure)
+				}
+				assert.True(t, matched, "no failure matches %q: %s", expected, result)
+			}
+			for _, failure := range result.Failures {
+				matched := false
+				for _, expected := range tc.failures {
+					matched = matched || regexp.MustCompile(expected).MatchString(failure)
+				}
+				assert.True(t, matched, "unexpected failure %q: %s", failure, result)
+			}
+		})
+	}
+}
+
+func TestConformanceSimulator(t *testing.T) {
+	Run(t, newSimHarness(t), &Options{Timeout: 5 * time.Second})
+}
+
+func TestConformanceSimulatorRemote(t *testing.T) {
+	h := newSimHarness(t)
+	ctx := context.Background()
+	server := ffcapiremote.NewServer(ctx, h.sim)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer server.Close()
+
+	config.RootConfigReset()
+	conf := config.RootSection("unittest.remote")
+	ffcapiremote.InitConfig(conf)
+	conf.Set(ffresty.HTTPConfigURL, ts.URL)
+	conf.Set(ffresty.HTTPConfigRetryEnabled, false)
+	c, err := ffcapiremote.NewClient(ctx, conf, h.sim.EventStreamNewCheckpointStruct)
+	assert.NoError(t, err)
+	h.connector = c
+
+	Run(t, h, &Options{Timeout: 5 * time.Second})
+}
+
+func TestCheckSkipsWithoutCapabilities(t *testing.T) {
+	results := Check(context.Background(), &basicHarness{h: newSimHarness(t)}, nil)
+	assert.Len(t, results, len(checks))
+	skipped := []string{}
+	for _, r := range results {
+		assert.True(t, r.Passed(), r.String())
+		if r.Skipped != "" {
+			skipped = append(skipped, r.Name)
+			assert.Regexp(t, "^SKIP "+r.Name+": harness does not implement", r.String())
+		} else {
+			assert.Equal(t, "PASS "+r.Name, r.String())
+		}
+	}
+	assert.Equal(t, []string{"GapPotential", "RemovedEvents", "TransactionSubmission"}, skipped)
+}
+
+func TestCheckReportsFailures(t *testing.T) {
+	h := newSimHarness(t)
+	h.connector = &faultyConnector{
+		API: h.sim,
+		// A missing block is not mapped to ErrorReasonNotFound
+		blockByHash: func(res *ffcapi.BlockInfoByHashResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.BlockInfoByHashResponse, ffcapi.ErrorReason, error) {
+			return res, "", err
+		},
+		// Events are delivered without checkpoints
+		events: func(start int, ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+			ev.Checkpoint = nil
+			return []*ffcapi.ListenerEvent{ev}
+		},
+	}
+	results := Check(context.Background(), h, &Options{Timeout: 5 * time.Second})
+
+	failed := map[string]*Result{}
+	for _, r := range results {
+		if !r.Passed() {
+			failed[r.Name] = r
+		}
+	}
+	assert.Contains(t, failed, "NotFound")
+	assert.Equal(t, "FAIL NotFound\n  contract: "+checkNotFound.contract+"\n"+
+		`  - BlockInfoByHash for 0x0000000000000000000000000000000000000000000000000000000000000000 failed with reason "" instead of "not_found": FF21120: Block '0x0000000000000000000000000000000000000000000000000000000000000000' not found`,
+		failed["NotFound"].String())
+	for _, name := range []string{"EventOrdering", "CheckpointRestore", "ResumeFromCheckpoint", "HighWaterMark", "RemovedEvents", "StreamRestart"} {
+		assert.Contains(t, failed, name)
+		assert.Regexp(t, "has no checkpoint", failed[name].String())
+	}
+	assert.Len(t, failed, 7)
+}
+
+func TestCheckReportsPanic(t *testing.T) {
+	h := newSimHarness(t)
+	// IsLive returns no response
+	h.connector = &faultyConnector{API: h.sim, live: func(res *ffcapi.LiveResponse) *ffcapi.LiveResponse { return nil }}
+	result := runCheck(context.Background(), h, (&Options{}).withDefaults(), checkLiveAndReady)
+	assert.False(t, result.Passed())
+	assert.Regexp(t, "panic: runtime error", result.String())
+}
+
+func TestCheckReportsTimeout(t *testing.T) {
+	h := newSimHarness(t)
+	result := runCheck(context.Background(), &basicHarness{h: &silentHarness{h}}, (&Options{Timeout: 1 * time.Millisecond}).withDefaults(), checkEventOrdering)
+	assert.Regexp(t, "timed out after 1ms waiting for an event on stream", result.String())
+}
+
+// silentHarness reports events as emitted without emitting them
+type silentHarness struct {
+	*simHarness
+}
+
+func (s *silentHarness) EmitEvents(ctx context.Context, count int) error {
+	return nil
+}
+
+// recordingTB records the results reported to a test
+type recordingTB struct {
+	testing.TB
+	skipped string
+	errors  []string
+}
+
+func (r *recordingTB) Skip(args ...interface{}) {
+	r.skipped = fmt.Sprint(args...)
+}
+
+func (r *recordingTB) Error(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func TestReportResult(t *testing.T) {
+	r := &recordingTB{}
+	reportResult(r, &Result{Name: "Check1"})
+	assert.Equal(t, &recordingTB{}, r)
+
+	reportResult(r, &Result{Name: "Check1", Skipped: "not supported"})
+	assert.Equal(t, "not supported", r.skipped)
+	assert.Empty(t, r.errors)
+
+	reportResult(r, &Result{Name: "Check1", Contract: "the contract", Failures: []string{"pop"}})
+	assert.Equal(t, []string{"FAIL Check1\n  contract: the contract\n  - pop"}, r.errors)
+}
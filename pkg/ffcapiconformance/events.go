@@ -0,0 +1,318 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+const hwmPollInterval = 100 * time.Millisecond
+
+var checkEventOrdering = &check{
+	name:     "EventOrdering",
+	contract: "events are delivered in block, transaction and log order, each with the ID of its listener and a checkpoint that is LessThan the checkpoint of every later event - the event stream drops any event whose checkpoint is not after the checkpoint it holds",
+	run: func(cc *checkContext) {
+		streamID, listenerID := fftypes.NewUUID(), fftypes.NewUUID()
+		ts := cc.startStream(streamID, cc.listenerRequest(streamID, listenerID, nil))
+		defer ts.stop()
+		cc.emitEvents(3)
+		cc.mineBlock()
+		cc.emitEvents(3)
+		events := ts.nextEvents(6)
+		for i, ev := range events {
+			cc.checkEvent(ev, listenerID)
+			if ev.Checkpoint.LessThan(ev.Checkpoint) {
+				cc.failf("the checkpoint of event %s is LessThan itself", ev.Event)
+			}
+			if i > 0 {
+				cc.checkEventOrder(events[i-1], ev)
+			}
+			block := cc.blockByHash(ev.Event.ID.BlockHash)
+			if block.BlockNumber == nil || block.BlockNumber.Uint64() != uint64(ev.Event.ID.BlockNumber) {
+				cc.failf("event %s is in block %d, but BlockInfoByHash returned block number %s", ev.Event, ev.Event.ID.BlockNumber, block.BlockNumber)
+			}
+		}
+	},
+}
+
+var checkCheckpointRestore = &check{
+	name:     "CheckpointRestore",
+	contract: "a checkpoint serialized to JSON and restored into EventStreamNewCheckpointStruct compares the same as the original - the event stream persists checkpoints, and restores them when it restarts",
+	run: func(cc *checkContext) {
+		streamID, listenerID := fftypes.NewUUID(), fftypes.NewUUID()
+		ts := cc.startStream(streamID, cc.listenerRequest(streamID, listenerID, nil))
+		defer ts.stop()
+		cc.emitEvents(3)
+		events := ts.nextEvents(3)
+		for i, ev := range events {
+			cc.checkEvent(ev, listenerID)
+			restored := cc.restoreCheckpoint(ev.Checkpoint)
+			for j, other := range events {
+				if restored.LessThan(other.Checkpoint) != (i < j) || other.Checkpoint.LessThan(restored) != (j < i) {
+					cc.failf("the restored checkpoint %s of event %s does not compare the same as the original with the checkpoint %s of event %s",
+						cc.checkpointJSON(restored), ev.Event, cc.checkpointJSON(other.Checkpoint), other.Event)
+				}
+			}
+		}
+		hwm := cc.listenerHWM(streamID, listenerID)
+		restored := cc.restoreCheckpoint(hwm)
+		if restored.LessThan(hwm) || hwm.LessThan(restored) {
+			cc.failf("the restored high water mark %s does not compare the same as the original %s", cc.checkpointJSON(restored), cc.checkpointJSON(hwm))
+		}
+	},
+}
+
+var checkResumeFromCheckpoint = &check{
+	name:     "ResumeFromCheckpoint",
+	contract: "a listener restarted with a checkpoint delivers every event after the checkpoint, including the events emitted while the stream was stopped - events at or before the checkpoint can be detected again, and are dropped by the event stream",
+	run: func(cc *checkContext) {
+		streamID, listenerID := fftypes.NewUUID(), fftypes.NewUUID()
+		ts := cc.startStream(streamID, cc.listenerRequest(streamID, listenerID, nil))
+		defer ts.stop()
+		cc.emitEvents(4)
+		events := ts.nextEvents(4)
+		for _, ev := range events {
+			cc.checkEvent(ev, listenerID)
+		}
+		ts.stop()
+
+		// Resume from part way through the events, with more emitted while the stream is stopped
+		checkpoint := events[1].Checkpoint
+		cc.emitEvents(2)
+		ts2 := cc.startStream(streamID, cc.listenerRequest(streamID, listenerID, checkpoint))
+		defer ts2.stop()
+		var resumed []*ffcapi.ListenerEvent
+		for len(resumed) < 4 {
+			ev := ts2.next()
+			if ev.Removed {
+				cc.fatalf("stream %s delivered removed event %s, when no reorg has occurred", streamID, ev.Event)
+			}
+			cc.checkEvent(ev, listenerID)
+			if !checkpoint.LessThan(ev.Checkpoint) {
+				continue
+			}
+			if len(resumed) > 0 {
+				cc.checkEventOrder(resumed[len(resumed)-1], ev)
+			}
+			resumed = append(resumed, ev)
+		}
+		for i, ev := range events[2:] {
+			if resumed[i].Event.ID.ProtocolID() != ev.Event.ID.ProtocolID() || resumed[i].Event.ID.TransactionHash != ev.Event.ID.TransactionHash {
+				cc.failf("event %s was not delivered again after resuming from the checkpoint %s of event %s - received %s instead",
+					ev.Event, cc.checkpointJSON(checkpoint), events[1].Event, resumed[i].Event)
+			}
+		}
+	},
+}
+
+var checkHighWaterMark = &check{
+	name:     "HighWaterMark",
+	contract: "EventListenerHWM returns a checkpoint that catches up with the last event delivered, and never moves backwards - the event stream persists it as the checkpoint when no events are in flight",
+	run: func(cc *checkContext) {
+		streamID, listenerID := fftypes.NewUUID(), fftypes.NewUUID()
+		ts := cc.startStream(streamID, cc.listenerRequest(streamID, listenerID, nil))
+		defer ts.stop()
+		cc.emitEvents(2)
+		events := ts.nextEvents(2)
+		last := events[1]
+		cc.checkEvent(last, listenerID)
+
+		var hwm ffcapi.EventListenerCheckpoint
+		for timeout := time.Now().Add(cc.options.Timeout); ; {
+			hwm = cc.listenerHWM(streamID, listenerID)
+			if !hwm.LessThan(last.Checkpoint) {
+				break
+			}
+			if time.Now().After(timeout) {
+				cc.fatalf("the high water mark %s did not catch up with the checkpoint %s of the last event delivered %s within %s",
+					cc.checkpointJSON(hwm), cc.checkpointJSON(last.Checkpoint), last.Event, cc.options.Timeout)
+			}
+			time.Sleep(hwmPollInterval)
+		}
+
+		cc.mineBlock()
+		if hwm2 := cc.listenerHWM(streamID, listenerID); hwm2.LessThan(hwm) {
+			cc.failf("the high water mark moved backwards from %s to %s", cc.checkpointJSON(hwm), cc.checkpointJSON(hwm2))
+		}
+	},
+}
+
+var checkRemovedEvents = &check{
+	name:     "RemovedEvents",
+	contract: "when a reorg replaces the block of an event, the event is delivered with Removed set and the ID of the original event, before the event is delivered again from the new block - the confirmation manager uses removed events to reset the confirmations of the event",
+	run: func(cc *checkContext) {
+		rh, ok := cc.h.(ReorgHarness)
+		if !ok {
+			cc.skip("harness does not implement ReorgHarness")
+		}
+		streamID, listenerID := fftypes.NewUUID(), fftypes.NewUUID()
+		ts := cc.startStream(streamID, cc.listenerRequest(streamID, listenerID, nil))
+		defer ts.stop()
+		cc.emitEvents(2)
+		events := ts.nextEvents(2)
+		original := make(map[string]*ffcapi.ListenerEvent)
+		pendingRedelivery := make(map[string]int)
+		for _, ev := range events {
+			cc.checkEvent(ev, listenerID)
+			original[ev.Event.ID.String()] = ev
+			pendingRedelivery[ev.Event.ID.TransactionHash]++
+		}
+
+		if err := rh.Reorg(cc.ctx, uint64(events[0].Event.ID.BlockNumber)); err != nil {
+			cc.fatalf("harness failed to reorg from block %d: %s", events[0].Event.ID.BlockNumber, err)
+		}
+		removed := make(map[string]bool)
+		for len(removed) < len(original) || len(pendingRedelivery) > 0 {
+			ev := ts.next()
+			if ev.Removed {
+				id := ev.Event.ID.String()
+				switch {
+				case original[id] == nil:
+					cc.failf("removed event %s does not match an event delivered before the reorg", ev.Event)
+				case removed[id]:
+					cc.failf("event %s was removed more than once", ev.Event)
+				}
+				removed[id] = true
+				continue
+			}
+			cc.checkEvent(ev, listenerID)
+			txHash := ev.Event.ID.TransactionHash
+			if pendingRedelivery[txHash] == 0 {
+				cc.failf("event %s was delivered after the reorg, but does not match an event delivered before the reorg", ev.Event)
+				continue
+			}
+			for id, prev := range original {
+				if prev.Event.ID.TransactionHash != txHash {
+					continue
+				}
+				if !removed[id] {
+					cc.failf("event %s was delivered from the new block before event %s was removed", ev.Event, prev.Event)
+				}
+				if prev.Event.ID.BlockHash == ev.Event.ID.BlockHash {
+					cc.failf("event %s was delivered again from block %s, which was replaced by the reorg", ev.Event, ev.Event.ID.BlockHash)
+				}
+			}
+			if pendingRedelivery[txHash]--; pendingRedelivery[txHash] == 0 {
+				delete(pendingRedelivery, txHash)
+			}
+		}
+	},
+}
+
+var checkStreamRestart = &check{
+	name:     "StreamRestart",
+	contract: "listeners can be added to and removed from a started stream, and a stream can be started again with the same ID once EventStreamStopped has been called - the event stream restarts with the same IDs whenever it is stopped or updated",
+	run: func(cc *checkContext) {
+		streamID, listenerA, listenerB := fftypes.NewUUID(), fftypes.NewUUID(), fftypes.NewUUID()
+		ts := cc.startStream(streamID, cc.listenerRequest(streamID, listenerA, nil))
+		defer ts.stop()
+
+		if _, reason, err := cc.api.EventListenerAdd(cc.ctx, cc.listenerRequest(streamID, listenerB, nil)); err != nil {
+			cc.fatalf("EventListenerAdd failed for listener %s on stream %s (reason=%s): %s", listenerB, streamID, reason, err)
+		}
+		cc.emitEvents(1)
+		var lastA *ffcapi.ListenerEvent
+		for receivedB := false; lastA == nil || !receivedB; {
+			ev := ts.nextEvents(1)[0]
+			cc.checkEvent(ev, listenerA, listenerB)
+			if ev.Event.ID.ListenerID.Equals(listenerA) {
+				lastA = ev
+			} else {
+				receivedB = true
+			}
+		}
+
+		if _, reason, err := cc.api.EventListenerRemove(cc.ctx, &ffcapi.EventListenerRemoveRequest{StreamID: streamID, ListenerID: listenerB}); err != nil {
+			cc.fatalf("EventListenerRemove failed for listener %s on stream %s (reason=%s): %s", listenerB, streamID, reason, err)
+		}
+		cc.emitEvents(1)
+		ev := ts.nextEvents(1)[0]
+		cc.checkEvent(ev, listenerA)
+		cc.checkEventOrder(lastA, ev)
+		lastA = ev
+		ts.stop()
+
+		ts2 := cc.startStream(streamID, cc.listenerRequest(streamID, listenerA, lastA.Checkpoint))
+		defer ts2.stop()
+		cc.emitEvents(1)
+		for {
+			ev := ts2.nextEvents(1)[0]
+			cc.checkEvent(ev, listenerA)
+			if lastA.Checkpoint.LessThan(ev.Checkpoint) {
+				break
+			}
+		}
+	},
+}
+
+// checkEvent checks the fields the event stream and confirmation manager rely on are set, and fails the
+// check if the event has no checkpoint as it cannot be compared with any other event
+func (cc *checkContext) checkEvent(ev *ffcapi.ListenerEvent, listenerIDs ...*fftypes.UUID) {
+	if ev.Checkpoint == nil {
+		cc.fatalf("event %s has no checkpoint", ev.Event)
+	}
+	matched := false
+	for _, listenerID := range listenerIDs {
+		matched = matched || ev.Event.ID.ListenerID.Equals(listenerID)
+	}
+	if !matched {
+		cc.failf("event %s has listener ID %s, instead of one of %s", ev.Event, ev.Event.ID.ListenerID, listenerIDs)
+	}
+	if ev.Event.ID.BlockHash == "" || ev.Event.ID.TransactionHash == "" {
+		cc.failf("event %s does not have a block hash and transaction hash", ev.Event)
+	}
+}
+
+// checkEventOrder checks an event was delivered after the previous event, in both the order of the events
+// on the chain and the order of their checkpoints
+func (cc *checkContext) checkEventOrder(prev, ev *ffcapi.ListenerEvent) {
+	if ev.Event.ID.ProtocolID() <= prev.Event.ID.ProtocolID() {
+		cc.failf("event %s was delivered after event %s", ev.Event, prev.Event)
+	}
+	if !prev.Checkpoint.LessThan(ev.Checkpoint) {
+		cc.failf("the checkpoint %s of event %s is not LessThan the checkpoint %s of the event %s delivered after it",
+			cc.checkpointJSON(prev.Checkpoint), prev.Event, cc.checkpointJSON(ev.Checkpoint), ev.Event)
+	}
+	if ev.Checkpoint.LessThan(prev.Checkpoint) {
+		cc.failf("the checkpoint %s of event %s is LessThan the checkpoint %s of the event %s delivered before it",
+			cc.checkpointJSON(ev.Checkpoint), ev.Event, cc.checkpointJSON(prev.Checkpoint), prev.Event)
+	}
+}
+
+func (cc *checkContext) listenerHWM(streamID, listenerID *fftypes.UUID) ffcapi.EventListenerCheckpoint {
+	res, reason, err := cc.api.EventListenerHWM(cc.ctx, &ffcapi.EventListenerHWMRequest{StreamID: streamID, ListenerID: listenerID})
+	if err != nil {
+		cc.fatalf("EventListenerHWM failed for listener %s on stream %s (reason=%s): %s", listenerID, streamID, reason, err)
+	}
+	if res.Checkpoint == nil {
+		cc.fatalf("EventListenerHWM returned no checkpoint for listener %s on stream %s", listenerID, streamID)
+	}
+	return res.Checkpoint
+}
+
+// checkpointJSON is used to report a checkpoint in a failure, in the form it is persisted
+func (cc *checkContext) checkpointJSON(checkpoint ffcapi.EventListenerCheckpoint) string {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
@@ -0,0 +1,384 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapisim"
+)
+
+// alterEvents alters every event delivered by the streams started from the nth start onwards
+func alterEvents(fromStart int, alter func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent) func(start int, ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+	return func(start int, ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+		if start < fromStart {
+			return []*ffcapi.ListenerEvent{ev}
+		}
+		return alter(ev)
+	}
+}
+
+func TestEventChecksReportFailures(t *testing.T) {
+	runFaultTestCases(t, []*faultTestCase{
+		{
+			name:  "EmitEventsFail",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.failing = "EmitEvents"
+			},
+			failures: []string{
+				`^harness failed to emit 3 events: pop$`,
+			},
+		},
+		{
+			name:  "EventOrderingEagerCheckpoints",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Checkpoint = &eagerCheckpoint{Checkpoint: *ev.Checkpoint.(*ffcapisim.Checkpoint)}
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^the checkpoint of event \S+ is LessThan itself$`,
+				`^the checkpoint {"block":1,"transactionIndex":0,"logIndex":1} of event \S+ is LessThan the checkpoint {"block":1,"transactionIndex":0,"logIndex":0} of the event \S+ delivered before it$`,
+				`^the checkpoint .* is LessThan the checkpoint .* delivered before it$`,
+			},
+		},
+		{
+			name:  "EventOrderingStuckCheckpoints",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Checkpoint = &stuckCheckpoint{Checkpoint: *ev.Checkpoint.(*ffcapisim.Checkpoint)}
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^the checkpoint {"block":1,"transactionIndex":0,"logIndex":0} of event \S+ is not LessThan the checkpoint {"block":1,"transactionIndex":0,"logIndex":1} of the event \S+ delivered after it$`,
+				`^the checkpoint .* is not LessThan the checkpoint .* delivered after it$`,
+			},
+		},
+		{
+			name:  "EventOrderingWrongBlockNumbers",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Event.ID.BlockNumber = 1000 - ev.Event.ID.BlockNumber
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^event 000000000999/000000/000000/\S+ is in block 999, but BlockInfoByHash returned block number 1$`,
+				`^event \S+ is in block \d+, but BlockInfoByHash returned block number \d+$`,
+				`^event \S+ was delivered after event \S+$`,
+			},
+		},
+		{
+			name:  "EventOrderingRemovedEvents",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Removed = true
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^stream \S+ delivered removed event \S+, when no reorg has occurred$`,
+			},
+		},
+		{
+			name:  "EventOrderingNoEvent",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					return []*ffcapi.ListenerEvent{{Checkpoint: ev.Checkpoint}}
+				})
+			},
+			failures: []string{
+				`^stream \S+ delivered a ListenerEvent without an Event: `,
+			},
+		},
+		{
+			name:  "CheckpointRestoreStuckCheckpoints",
+			check: checkCheckpointRestore,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Checkpoint = &stuckCheckpoint{Checkpoint: *ev.Checkpoint.(*ffcapisim.Checkpoint)}
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^the restored checkpoint {"block":1,"transactionIndex":0,"logIndex":0} of event \S+ does not compare the same as the original with the checkpoint {"block":1,"transactionIndex":0,"logIndex":1} of event \S+$`,
+				`^the restored checkpoint .* does not compare the same as the original with the checkpoint .*$`,
+			},
+		},
+		{
+			name:  "CheckpointRestoreUnserializable",
+			check: checkCheckpointRestore,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Checkpoint = &unserializableCheckpoint{}
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^checkpoint .* cannot be serialized to JSON: json: error calling MarshalJSON .*: pop$`,
+			},
+		},
+		{
+			name:  "CheckpointRestoreForeign",
+			check: checkCheckpointRestore,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Checkpoint = &foreignCheckpoint{}
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^checkpoint "foreign" cannot be restored into EventStreamNewCheckpointStruct: json: cannot unmarshal string`,
+			},
+		},
+		{
+			name:  "CheckpointRestoreHighWaterMark",
+			check: checkCheckpointRestore,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.hwm = func(call int, checkpoint ffcapi.EventListenerCheckpoint) ffcapi.EventListenerCheckpoint {
+					return &eagerCheckpoint{Checkpoint: *checkpoint.(*ffcapisim.Checkpoint)}
+				}
+			},
+			failures: []string{
+				`^the restored high water mark {"block":3,"transactionIndex":-1,"logIndex":-1} does not compare the same as the original {"block":3,"transactionIndex":-1,"logIndex":-1}$`,
+			},
+		},
+		{
+			// Events at or before the checkpoint are allowed to be delivered again
+			name:  "ResumeFromCheckpointEarlierEvents",
+			check: checkResumeFromCheckpoint,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(2, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					earlier := copyEvent(ev)
+					earlier.Checkpoint = &ffcapisim.Checkpoint{}
+					return []*ffcapi.ListenerEvent{earlier, ev}
+				})
+			},
+		},
+		{
+			name:  "ResumeFromCheckpointRemovedEvents",
+			check: checkResumeFromCheckpoint,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(2, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					removed := copyEvent(ev)
+					removed.Removed = true
+					return []*ffcapi.ListenerEvent{removed, ev}
+				})
+			},
+			failures: []string{
+				`^stream \S+ delivered removed event \S+, when no reorg has occurred$`,
+			},
+		},
+		{
+			name:  "ResumeFromCheckpointDifferentEvents",
+			check: checkResumeFromCheckpoint,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(2, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Event.ID.TransactionHash = "0xother"
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^event \S+ was not delivered again after resuming from the checkpoint {"block":1,"transactionIndex":0,"logIndex":1} of event \S+ - received \S+ instead$`,
+			},
+		},
+		{
+			name:    "HighWaterMarkBehind",
+			check:   checkHighWaterMark,
+			timeout: 10 * time.Millisecond,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.hwm = func(call int, checkpoint ffcapi.EventListenerCheckpoint) ffcapi.EventListenerCheckpoint {
+					return &unserializableCheckpoint{}
+				}
+			},
+			failures: []string{
+				`^the high water mark json: error calling MarshalJSON .*: pop did not catch up with the checkpoint {"block":1,"transactionIndex":0,"logIndex":1} of the last event delivered \S+ within 10ms$`,
+			},
+		},
+		{
+			name:  "HighWaterMarkBackwards",
+			check: checkHighWaterMark,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.hwm = func(call int, checkpoint ffcapi.EventListenerCheckpoint) ffcapi.EventListenerCheckpoint {
+					if call > 1 {
+						return &ffcapisim.Checkpoint{}
+					}
+					return checkpoint
+				}
+			},
+			failures: []string{
+				`^the high water mark moved backwards from {"block":3,"transactionIndex":-1,"logIndex":-1} to {"block":0,"transactionIndex":0,"logIndex":0}$`,
+			},
+		},
+		{
+			name:  "HighWaterMarkFail",
+			check: checkHighWaterMark,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodEventListenerHWM, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^EventListenerHWM failed for listener \S+ on stream \S+ \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "HighWaterMarkMissing",
+			check: checkHighWaterMark,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.hwm = func(call int, checkpoint ffcapi.EventListenerCheckpoint) ffcapi.EventListenerCheckpoint {
+					return nil
+				}
+			},
+			failures: []string{
+				`^EventListenerHWM returned no checkpoint for listener \S+ on stream \S+$`,
+			},
+		},
+		{
+			name:  "RemovedEventsReorgFail",
+			check: checkRemovedEvents,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.failing = "Reorg"
+			},
+			failures: []string{
+				`^harness failed to reorg from block 1: pop$`,
+			},
+		},
+		{
+			// Events in different transactions are each delivered again
+			name:  "RemovedEventsBlockPerEvent",
+			check: checkRemovedEvents,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.blockPerEvent = true
+			},
+		},
+		{
+			name:  "RemovedEventsUnknown",
+			check: checkRemovedEvents,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					if ev.Removed {
+						ev.Event.ID.LogIndex += 100
+					}
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^removed event \S+ does not match an event delivered before the reorg$`,
+				`^event \S+ was delivered from the new block before event \S+ was removed$`,
+			},
+		},
+		{
+			name:  "RemovedEventsTwice",
+			check: checkRemovedEvents,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					if ev.Removed {
+						return []*ffcapi.ListenerEvent{ev, ev}
+					}
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^event \S+ was removed more than once$`,
+			},
+		},
+		{
+			name:  "RemovedEventsUnknownRedelivery",
+			check: checkRemovedEvents,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					if !ev.Removed {
+						return []*ffcapi.ListenerEvent{ev}
+					}
+					unknown := copyEvent(ev)
+					unknown.Removed = false
+					unknown.Checkpoint = &ffcapisim.Checkpoint{}
+					unknown.Event.ID.TransactionHash = "0xunknown"
+					return []*ffcapi.ListenerEvent{ev, unknown}
+				})
+			},
+			failures: []string{
+				`^event \S+ was delivered after the reorg, but does not match an event delivered before the reorg$`,
+			},
+		},
+		{
+			name:  "RemovedEventsSameBlock",
+			check: checkRemovedEvents,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				originalBlocks := make(map[string]string)
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					if !ev.Removed {
+						if blockHash, ok := originalBlocks[ev.Event.ID.TransactionHash]; ok {
+							ev.Event.ID.BlockHash = blockHash
+						} else {
+							originalBlocks[ev.Event.ID.TransactionHash] = ev.Event.ID.BlockHash
+						}
+					}
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^event \S+ was delivered again from block 0x\w+, which was replaced by the reorg$`,
+			},
+		},
+		{
+			name:  "StreamRestartListenerAddFail",
+			check: checkStreamRestart,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodEventListenerAdd, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^EventListenerAdd failed for listener \S+ on stream \S+ \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "StreamRestartListenerRemoveFail",
+			check: checkStreamRestart,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodEventListenerRemove, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^EventListenerRemove failed for listener \S+ on stream \S+ \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "EventsIncomplete",
+			check: checkCheckpointRestore,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.events = alterEvents(1, func(ev *ffcapi.ListenerEvent) []*ffcapi.ListenerEvent {
+					ev.Event.ID.ListenerID = fftypes.NewUUID()
+					ev.Event.ID.BlockHash = ""
+					return []*ffcapi.ListenerEvent{ev}
+				})
+			},
+			failures: []string{
+				`^event \S+ has listener ID \S+, instead of one of \[\S+\]$`,
+				`^event \S+ does not have a block hash and transaction hash$`,
+			},
+		},
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+const listenerName = "conformance"
+
+type blockListener struct {
+	cc     *checkContext
+	cancel context.CancelFunc
+	blocks chan *ffcapi.BlockHashEvent
+}
+
+type testStream struct {
+	cc         *checkContext
+	id         *fftypes.UUID
+	cancel     context.CancelFunc
+	events     chan *ffcapi.ListenerEvent
+	blocksDone chan struct{}
+	stopped    bool
+}
+
+func (cc *checkContext) startBlockListener() *blockListener {
+	ctx, cancel := context.WithCancel(cc.ctx)
+	bl := &blockListener{
+		cc:     cc,
+		cancel: cancel,
+		blocks: make(chan *ffcapi.BlockHashEvent, 1),
+	}
+	_, reason, err := cc.api.NewBlockListener(cc.ctx, &ffcapi.NewBlockListenerRequest{
+		ID:              fftypes.NewUUID(),
+		ListenerContext: ctx,
+		BlockListener:   bl.blocks,
+	})
+	if err != nil {
+		cancel()
+		cc.fatalf("NewBlockListener failed (reason=%s): %s", reason, err)
+	}
+	return bl
+}
+
+// next returns the next block notification, failing the check if one does not arrive before the timeout
+func (bl *blockListener) next() *ffcapi.BlockHashEvent {
+	select {
+	case be := <-bl.blocks:
+		return be
+	case <-time.After(bl.cc.options.Timeout):
+		bl.cc.fatalf("timed out after %s waiting for a notification on the block listener", bl.cc.options.Timeout)
+		return nil
+	}
+}
+
+// nextBlock returns the hash of the latest block in the next notification that has new blocks
+func (bl *blockListener) nextBlock() string {
+	for {
+		be := bl.next()
+		if len(be.BlockHashes) > 0 {
+			return be.BlockHashes[len(be.BlockHashes)-1]
+		}
+	}
+}
+
+func (bl *blockListener) stop() {
+	bl.cancel()
+}
+
+// listenerRequest builds the request to add a listener for the events emitted by the harness, in the same way
+// as the event stream of the manager does - which verifies the options when the listener is created, and persists
+// the checkpoint as JSON to restore into a new checkpoint struct when the stream restarts
+func (cc *checkContext) listenerRequest(streamID, listenerID *fftypes.UUID, checkpoint ffcapi.EventListenerCheckpoint) *ffcapi.EventListenerAddRequest {
+	options := cc.h.ListenerOptions()
+	options.FromBlock = ffcapi.FromBlockLatest
+	res, reason, err := cc.api.EventListenerVerifyOptions(cc.ctx, &ffcapi.EventListenerVerifyOptionsRequest{
+		EventListenerOptions: options,
+	})
+	if err != nil {
+		cc.fatalf("EventListenerVerifyOptions rejected the listener options of the harness (reason=%s): %s", reason, err)
+	}
+	options.Options = &res.ResolvedOptions
+	return &ffcapi.EventListenerAddRequest{
+		EventListenerOptions: options,
+		ListenerID:           listenerID,
+		StreamID:             streamID,
+		Name:                 listenerName,
+		Checkpoint:           cc.restoreCheckpoint(checkpoint),
+	}
+}
+
+// restoreCheckpoint serializes the checkpoint to JSON and restores it into a new checkpoint struct, as
+// the checkpoint is when it is persisted by the event stream of the manager
+func (cc *checkContext) restoreCheckpoint(checkpoint ffcapi.EventListenerCheckpoint) ffcapi.EventListenerCheckpoint {
+	if checkpoint == nil {
+		return nil
+	}
+	jsonCP, err := json.Marshal(checkpoint)
+	if err != nil {
+		cc.fatalf("checkpoint %+v cannot be serialized to JSON: %s", checkpoint, err)
+	}
+	restored := cc.api.EventStreamNewCheckpointStruct()
+	if err := json.Unmarshal(jsonCP, &restored); err != nil {
+		cc.fatalf("checkpoint %s cannot be restored into EventStreamNewCheckpointStruct: %s", jsonCP, err)
+	}
+	return restored
+}
+
+func (cc *checkContext) startStream(streamID *fftypes.UUID, listeners ...*ffcapi.EventListenerAddRequest) *testStream {
+	ctx, cancel := context.WithCancel(cc.ctx)
+	ts := &testStream{
+		cc:         cc,
+		id:         streamID,
+		cancel:     cancel,
+		events:     make(chan *ffcapi.ListenerEvent, 1),
+		blocksDone: make(chan struct{}),
+	}
+	blocks := make(chan *ffcapi.BlockHashEvent)
+	go func() {
+		// The stream guarantees to consume from the block listener until the stream context closes
+		defer close(ts.blocksDone)
+		for {
+			select {
+			case <-blocks:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	_, reason, err := cc.api.EventStreamStart(cc.ctx, &ffcapi.EventStreamStartRequest{
+		ID:               streamID,
+		StreamContext:    ctx,
+		EventStream:      ts.events,
+		BlockListener:    blocks,
+		InitialListeners: listeners,
+	})
+	if err != nil {
+		cancel()
+		<-ts.blocksDone
+		cc.fatalf("EventStreamStart failed for stream %s (reason=%s): %s", streamID, reason, err)
+	}
+	return ts
+}
+
+// next returns the next event on the stream, failing the check if one does not arrive before the timeout
+func (ts *testStream) next() *ffcapi.ListenerEvent {
+	select {
+	case ev := <-ts.events:
+		if ev == nil || ev.Event == nil {
+			ts.cc.fatalf("stream %s delivered a ListenerEvent without an Event: %+v", ts.id, ev)
+		}
+		return ev
+	case <-time.After(ts.cc.options.Timeout):
+		ts.cc.fatalf("timed out after %s waiting for an event on stream %s", ts.cc.options.Timeout, ts.id)
+		return nil
+	}
+}
+
+// nextEvents returns the next count events, failing the check if any of them is a removed event
+func (ts *testStream) nextEvents(count int) []*ffcapi.ListenerEvent {
+	events := make([]*ffcapi.ListenerEvent, count)
+	for i := range events {
+		events[i] = ts.next()
+		if events[i].Removed {
+			ts.cc.fatalf("stream %s delivered removed event %s, when no reorg has occurred", ts.id, events[i].Event)
+		}
+	}
+	return events
+}
+
+// stop stops the stream the same way the event stream of the manager does, by cancelling the stream
+// context then informing the connector the stream has stopped
+func (ts *testStream) stop() {
+	if ts.stopped {
+		return
+	}
+	ts.stopped = true
+	ts.cancel()
+	<-ts.blocksDone
+	if _, reason, err := ts.cc.api.EventStreamStopped(ts.cc.ctx, &ffcapi.EventStreamStoppedRequest{ID: ts.id}); err != nil {
+		ts.cc.failf("EventStreamStopped failed for stream %s (reason=%s): %s", ts.id, reason, err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapisim"
+)
+
+func TestStreamChecksReportFailures(t *testing.T) {
+	runFaultTestCases(t, []*faultTestCase{
+		{
+			name:  "VerifyOptionsFail",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodEventListenerVerifyOptions, ffcapi.ErrorReasonInvalidInputs, -1)
+			},
+			failures: []string{
+				`^EventListenerVerifyOptions rejected the listener options of the harness \(reason=invalid_inputs\): FF21112`,
+			},
+		},
+		{
+			name:  "StreamStartFail",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodEventStreamStart, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^EventStreamStart failed for stream \S+ \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "StreamStoppedFail",
+			check: checkEventOrdering,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				h.sim.InjectError(ffcapisim.MethodEventStreamStopped, ffcapi.ErrorReasonDownstreamDown, -1)
+			},
+			failures: []string{
+				`^EventStreamStopped failed for stream \S+ \(reason=downstream_down\): FF21112`,
+			},
+		},
+	})
+}
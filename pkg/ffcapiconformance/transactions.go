@@ -0,0 +1,117 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+const receiptPollInterval = 100 * time.Millisecond
+
+var checkTransactionSubmission = &check{
+	name:     "TransactionSubmission",
+	contract: "submitting the same transaction again succeeds with the same hash, or fails with ErrorKnownTransaction or ErrorReasonNonceTooLow, and a different transaction with a nonce already mined fails with ErrorReasonNonceTooLow - the policy engine relies on these reasons when it resubmits transactions, and on the receipt of a mined transaction to track it to confirmation",
+	run: func(cc *checkContext) {
+		th, ok := cc.h.(TransactionHarness)
+		if !ok {
+			cc.skip("harness does not implement TransactionHarness")
+		}
+		input := th.TransactionInput()
+		nonceRes, reason, err := cc.api.NextNonceForSigner(cc.ctx, &ffcapi.NextNonceForSignerRequest{Signer: input.From})
+		if err != nil {
+			cc.fatalf("NextNonceForSigner failed for signer %s (reason=%s): %s", input.From, reason, err)
+		}
+		input.Nonce = nonceRes.Nonce
+		prepared, reason, err := cc.api.TransactionPrepare(cc.ctx, &ffcapi.TransactionPrepareRequest{TransactionInput: *input})
+		if err != nil {
+			cc.fatalf("TransactionPrepare failed (reason=%s): %s", reason, err)
+		}
+		if prepared.Gas == nil {
+			cc.fatalf("TransactionPrepare returned no gas estimate")
+		}
+		gasPrice, reason, err := cc.api.GasPriceEstimate(cc.ctx, &ffcapi.GasPriceEstimateRequest{})
+		if err != nil {
+			cc.fatalf("GasPriceEstimate failed (reason=%s): %s", reason, err)
+		}
+		sendReq := &ffcapi.TransactionSendRequest{
+			GasPrice:           gasPrice.GasPrice,
+			TransactionHeaders: input.TransactionHeaders,
+			TransactionData:    prepared.TransactionData,
+		}
+		sendReq.Gas = prepared.Gas
+
+		sent, reason, err := cc.api.TransactionSend(cc.ctx, sendReq)
+		if err != nil {
+			cc.fatalf("TransactionSend failed for nonce %s (reason=%s): %s", input.Nonce, reason, err)
+		}
+		if sent.TransactionHash == "" {
+			cc.fatalf("TransactionSend returned no transaction hash")
+		}
+		resent, reason, err := cc.api.TransactionSend(cc.ctx, sendReq)
+		switch {
+		case err == nil && resent.TransactionHash != sent.TransactionHash:
+			cc.failf("submitting transaction %s again returned a different transaction hash %s", sent.TransactionHash, resent.TransactionHash)
+		case err != nil && reason != ffcapi.ErrorKnownTransaction && reason != ffcapi.ErrorReasonNonceTooLow:
+			cc.failf("submitting transaction %s again failed with reason %q instead of %q or %q: %s",
+				sent.TransactionHash, reason, ffcapi.ErrorKnownTransaction, ffcapi.ErrorReasonNonceTooLow, err)
+		}
+
+		cc.mineBlock()
+		receipt := cc.waitForReceipt(sent.TransactionHash)
+		if !receipt.Success {
+			cc.failf("the receipt of transaction %s reports it failed", sent.TransactionHash)
+		}
+		if receipt.BlockNumber == nil {
+			cc.fatalf("the receipt of transaction %s has no block number", sent.TransactionHash)
+		}
+		if block := cc.blockByHash(receipt.BlockHash); block.BlockNumber == nil || block.BlockNumber.Int().Cmp(receipt.BlockNumber.Int()) != 0 {
+			cc.failf("the receipt of transaction %s is for block %s (%s), but BlockInfoByHash returned block number %s",
+				sent.TransactionHash, receipt.BlockNumber, receipt.BlockHash, block.BlockNumber)
+		}
+
+		// A different transaction with the same nonce
+		sendReq.Gas = (*fftypes.FFBigInt)(new(big.Int).Add(prepared.Gas.Int(), big.NewInt(1)))
+		res, reason, err := cc.api.TransactionSend(cc.ctx, sendReq)
+		switch {
+		case err == nil:
+			cc.failf("submitting a different transaction with nonce %s, which has been mined, did not fail and returned transaction hash %s", input.Nonce, res.TransactionHash)
+		case reason != ffcapi.ErrorReasonNonceTooLow:
+			cc.failf("submitting a different transaction with nonce %s, which has been mined, failed with reason %q instead of %q: %s",
+				input.Nonce, reason, ffcapi.ErrorReasonNonceTooLow, err)
+		}
+	},
+}
+
+// waitForReceipt polls for the receipt of a transaction until it is mined, as the policy engine does
+func (cc *checkContext) waitForReceipt(txHash string) *ffcapi.TransactionReceiptResponse {
+	for timeout := time.Now().Add(cc.options.Timeout); ; {
+		receipt, reason, err := cc.api.TransactionReceipt(cc.ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: txHash})
+		switch {
+		case err == nil:
+			return receipt
+		case reason != ffcapi.ErrorReasonNotFound:
+			cc.fatalf("TransactionReceipt failed for transaction %s (reason=%s): %s", txHash, reason, err)
+		case time.Now().After(timeout):
+			cc.fatalf("no receipt was available for transaction %s within %s", txHash, cc.options.Timeout)
+		}
+		time.Sleep(receiptPollInterval)
+	}
+}
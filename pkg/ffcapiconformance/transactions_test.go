@@ -0,0 +1,187 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiconformance
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapisim"
+)
+
+func TestTransactionChecksReportFailures(t *testing.T) {
+	injectError := func(method ffcapisim.Method) func(h *simHarness, fc *faultyConnector, options *Options) {
+		return func(h *simHarness, fc *faultyConnector, options *Options) {
+			h.sim.InjectError(method, ffcapi.ErrorReasonDownstreamDown, 1)
+		}
+	}
+	alterReceipt := func(alter func(res *ffcapi.TransactionReceiptResponse)) func(h *simHarness, fc *faultyConnector, options *Options) {
+		return func(h *simHarness, fc *faultyConnector, options *Options) {
+			fc.receipt = func(res *ffcapi.TransactionReceiptResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.TransactionReceiptResponse, ffcapi.ErrorReason, error) {
+				if err == nil {
+					alter(res)
+				}
+				return res, reason, err
+			}
+		}
+	}
+	runFaultTestCases(t, []*faultTestCase{
+		{
+			name:  "NextNonceFail",
+			check: checkTransactionSubmission,
+			setup: injectError(ffcapisim.MethodNextNonceForSigner),
+			failures: []string{
+				`^NextNonceForSigner failed for signer 0xaaaa \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "PrepareFail",
+			check: checkTransactionSubmission,
+			setup: injectError(ffcapisim.MethodTransactionPrepare),
+			failures: []string{
+				`^TransactionPrepare failed \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "PrepareNoGas",
+			check: checkTransactionSubmission,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.prepare = func(res *ffcapi.TransactionPrepareResponse) *ffcapi.TransactionPrepareResponse {
+					res.Gas = nil
+					return res
+				}
+			},
+			failures: []string{
+				`^TransactionPrepare returned no gas estimate$`,
+			},
+		},
+		{
+			name:  "GasPriceFail",
+			check: checkTransactionSubmission,
+			setup: injectError(ffcapisim.MethodGasPriceEstimate),
+			failures: []string{
+				`^GasPriceEstimate failed \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "SendFail",
+			check: checkTransactionSubmission,
+			setup: injectError(ffcapisim.MethodTransactionSend),
+			failures: []string{
+				`^TransactionSend failed for nonce 0 \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:  "SendNoHash",
+			check: checkTransactionSubmission,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.send = func(call int, res *ffcapi.TransactionSendResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.TransactionSendResponse, ffcapi.ErrorReason, error) {
+					return &ffcapi.TransactionSendResponse{}, "", nil
+				}
+			},
+			failures: []string{
+				`^TransactionSend returned no transaction hash$`,
+			},
+		},
+		{
+			name:  "ResubmitSucceeds",
+			check: checkTransactionSubmission,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.send = func(call int, res *ffcapi.TransactionSendResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.TransactionSendResponse, ffcapi.ErrorReason, error) {
+					if call > 1 {
+						return &ffcapi.TransactionSendResponse{TransactionHash: "0xother"}, "", nil
+					}
+					return res, reason, err
+				}
+			},
+			failures: []string{
+				`^submitting transaction 0x\w+ again returned a different transaction hash 0xother$`,
+				`^submitting a different transaction with nonce 0, which has been mined, did not fail and returned transaction hash 0xother$`,
+			},
+		},
+		{
+			name:  "ResubmitWrongReason",
+			check: checkTransactionSubmission,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.send = func(call int, res *ffcapi.TransactionSendResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.TransactionSendResponse, ffcapi.ErrorReason, error) {
+					if call > 1 {
+						return nil, ffcapi.ErrorReasonDownstreamDown, fmt.Errorf("pop")
+					}
+					return res, reason, err
+				}
+			},
+			failures: []string{
+				`^submitting transaction 0x\w+ again failed with reason "downstream_down" instead of "known_transaction" or "nonce_too_low": pop$`,
+				`^submitting a different transaction with nonce 0, which has been mined, failed with reason "downstream_down" instead of "nonce_too_low": pop$`,
+			},
+		},
+		{
+			name:  "ReceiptFailed",
+			check: checkTransactionSubmission,
+			setup: alterReceipt(func(res *ffcapi.TransactionReceiptResponse) {
+				res.Success = false
+			}),
+			failures: []string{
+				`^the receipt of transaction 0x\w+ reports it failed$`,
+			},
+		},
+		{
+			name:  "ReceiptNoBlockNumber",
+			check: checkTransactionSubmission,
+			setup: alterReceipt(func(res *ffcapi.TransactionReceiptResponse) {
+				res.BlockNumber = nil
+			}),
+			failures: []string{
+				`^the receipt of transaction 0x\w+ has no block number$`,
+			},
+		},
+		{
+			name:  "ReceiptWrongBlockNumber",
+			check: checkTransactionSubmission,
+			setup: alterReceipt(func(res *ffcapi.TransactionReceiptResponse) {
+				res.BlockNumber = fftypes.NewFFBigInt(res.BlockNumber.Int64() + 1)
+			}),
+			failures: []string{
+				`^the receipt of transaction 0x\w+ is for block 2 \(0x\w+\), but BlockInfoByHash returned block number 1$`,
+			},
+		},
+		{
+			name:  "ReceiptFail",
+			check: checkTransactionSubmission,
+			setup: injectError(ffcapisim.MethodTransactionReceipt),
+			failures: []string{
+				`^TransactionReceipt failed for transaction 0x\w+ \(reason=downstream_down\): FF21112`,
+			},
+		},
+		{
+			name:    "ReceiptMissing",
+			check:   checkTransactionSubmission,
+			timeout: 10 * time.Millisecond,
+			setup: func(h *simHarness, fc *faultyConnector, options *Options) {
+				fc.receipt = func(res *ffcapi.TransactionReceiptResponse, reason ffcapi.ErrorReason, err error) (*ffcapi.TransactionReceiptResponse, ffcapi.ErrorReason, error) {
+					return nil, ffcapi.ErrorReasonNotFound, fmt.Errorf("pop")
+				}
+			},
+			failures: []string{
+				`^no receipt was available for transaction 0x\w+ within 10ms$`,
+			},
+		},
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// RequestType identifies the ffcapi.API function invoked by a request to a remote connector
+type RequestType string
+
+const (
+	RequestTypeBlockInfoByHash            RequestType = "block_info_by_hash"
+	RequestTypeBlockInfoByNumber          RequestType = "block_info_by_number"
+	RequestTypeNextNonceForSigner         RequestType = "next_nonce_for_signer"
+	RequestTypeBalanceForSigner           RequestType = "balance_for_signer"
+	RequestTypeGasPriceEstimate           RequestType = "gas_price_estimate"
+	RequestTypeQueryInvoke                RequestType = "query_invoke"
+	RequestTypeTransactionReceipt         RequestType = "transaction_receipt"
+	RequestTypeTransactionPrepare         RequestType = "transaction_prepare"
+	RequestTypeTransactionSend            RequestType = "transaction_send"
+	RequestTypeTransactionSendRaw         RequestType = "transaction_send_raw"
+	RequestTypeTransactionDecode          RequestType = "transaction_decode"
+	RequestTypeDeployContractPrepare      RequestType = "deploy_contract_prepare"
+	RequestTypeEventStreamStart           RequestType = "event_stream_start"
+	RequestTypeEventStreamStopped         RequestType = "event_stream_stopped"
+	RequestTypeEventListenerVerifyOptions RequestType = "event_listener_verify_options"
+	RequestTypeEventListenerAdd           RequestType = "event_listener_add"
+	RequestTypeEventListenerRemove        RequestType = "event_listener_remove"
+	RequestTypeEventListenerHWM           RequestType = "event_listener_hwm"
+	RequestTypeNewBlockListener           RequestType = "new_block_listener"
+	RequestTypeIsLive                     RequestType = "is_live"
+	RequestTypeIsReady                    RequestType = "is_ready"
+)
+
+const (
+	// RequestPath is the path the server accepts requests on, with a POST
+	RequestPath = "/"
+	// StreamPath is the path the server accepts WebSocket connections on, to start event streams and block listeners
+	StreamPath = "/ws"
+)
+
+// RequestHeader is included in every request to a remote connector
+type RequestHeader struct {
+	RequestID *fftypes.UUID `json:"id"`
+	Type      RequestType   `json:"type"`
+}
+
+// Request is the envelope of a request to a remote connector. The payload is the JSON of the ffcapi request
+// object, and the response is the JSON of the ffcapi response object (or an ErrorResponse on failure).
+// The first message sent on a stream WebSocket is also a Request, of type event_stream_start or new_block_listener.
+type Request struct {
+	Header  RequestHeader   `json:"ffcapi"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ErrorResponse is returned by the server with a non-200 status code when a request fails
+type ErrorResponse struct {
+	Error  string             `json:"error"`
+	Reason ffcapi.ErrorReason `json:"reason,omitempty"`
+}
+
+// EventStreamStartPayload is the serializable subset of ffcapi.EventStreamStartRequest, as the channels and
+// context of the request remain in the client process
+type EventStreamStartPayload struct {
+	ID               *fftypes.UUID                     `json:"id"`
+	InitialListeners []*ffcapi.EventListenerAddRequest `json:"initialListeners"`
+}
+
+// NewBlockListenerPayload is the serializable subset of ffcapi.NewBlockListenerRequest
+type NewBlockListenerPayload struct {
+	ID *fftypes.UUID `json:"id"`
+}
+
+// StreamMessageType is the type of a message sent by the server on a stream WebSocket
+type StreamMessageType string
+
+const (
+	// StreamMessageTypeStarted is sent once the connector has started the stream, and is always the first message on success
+	StreamMessageTypeStarted StreamMessageType = "started"
+	// StreamMessageTypeError is sent if the connector failed to start the stream, after which the server closes the WebSocket
+	StreamMessageTypeError StreamMessageType = "error"
+	// StreamMessageTypeEvent delivers an event (or checkpoint) from the event stream
+	StreamMessageTypeEvent StreamMessageType = "event"
+	// StreamMessageTypeBlock delivers a block notification
+	StreamMessageTypeBlock StreamMessageType = "block"
+)
+
+// StreamMessage is a message sent by the server on a stream WebSocket
+type StreamMessage struct {
+	Type   StreamMessageType      `json:"type"`
+	Error  string                 `json:"error,omitempty"`
+	Reason ffcapi.ErrorReason     `json:"reason,omitempty"`
+	Event  *ffcapi.ListenerEvent  `json:"event,omitempty"`
+	Block  *ffcapi.BlockHashEvent `json:"block,omitempty"`
+}
@@ -0,0 +1,92 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// Checkpoint is used by the client for checkpoints when the checkpoint type of the connector is not
+// linked into the process. It holds the JSON of the connector's checkpoint as-is, and orders checkpoints
+// by comparing the top-level fields in the order the connector serializes them - numerically when both
+// values are JSON numbers. So a checkpoint such as {"block":1,"transactionIndex":2,"logIndex":3} sorts correctly.
+type Checkpoint struct {
+	raw json.RawMessage
+}
+
+func NewCheckpoint() ffcapi.EventListenerCheckpoint {
+	return &Checkpoint{}
+}
+
+func (cp *Checkpoint) MarshalJSON() ([]byte, error) {
+	if len(cp.raw) == 0 {
+		return []byte("null"), nil
+	}
+	return cp.raw, nil
+}
+
+func (cp *Checkpoint) UnmarshalJSON(b []byte) error {
+	cp.raw = append(json.RawMessage{}, b...)
+	return nil
+}
+
+func (cp *Checkpoint) LessThan(b ffcapi.EventListenerCheckpoint) bool {
+	bcp, ok := b.(*Checkpoint)
+	if !ok {
+		return false
+	}
+	aFields, bFields := cp.fields(), bcp.fields()
+	for i := 0; i < len(aFields) && i < len(bFields); i++ {
+		if c := compareJSONValues(aFields[i], bFields[i]); c != 0 {
+			return c < 0
+		}
+	}
+	return len(aFields) < len(bFields)
+}
+
+// fields returns the values of the top-level fields of the checkpoint object, in order
+func (cp *Checkpoint) fields() []json.RawMessage {
+	dec := json.NewDecoder(bytes.NewReader(cp.raw))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil
+	}
+	var fields []json.RawMessage
+	for dec.More() {
+		var value json.RawMessage
+		if _, err := dec.Token(); err != nil {
+			return nil
+		}
+		if err := dec.Decode(&value); err != nil {
+			return nil
+		}
+		fields = append(fields, value)
+	}
+	return fields
+}
+
+func compareJSONValues(a, b json.RawMessage) int {
+	aNum, aOK := new(big.Float).SetString(string(a))
+	bNum, bOK := new(big.Float).SetString(string(b))
+	if aOK && bOK {
+		return aNum.Cmp(bNum)
+	}
+	return bytes.Compare(a, b)
+}
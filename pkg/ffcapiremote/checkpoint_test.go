@@ -0,0 +1,74 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+)
+
+type otherCheckpoint struct{}
+
+func (cp *otherCheckpoint) LessThan(b ffcapi.EventListenerCheckpoint) bool {
+	return false
+}
+
+func testCheckpoint(t *testing.T, s string) ffcapi.EventListenerCheckpoint {
+	cp := NewCheckpoint()
+	err := json.Unmarshal([]byte(s), &cp)
+	assert.NoError(t, err)
+	return cp
+}
+
+func TestCheckpointOrdering(t *testing.T) {
+	cp1 := testCheckpoint(t, `{"block":10,"transactionIndex":2,"logIndex":1}`)
+	cp2 := testCheckpoint(t, `{"block":10,"transactionIndex":10,"logIndex":0}`)
+	cp3 := testCheckpoint(t, `{"block":9,"transactionIndex":20,"logIndex":0}`)
+	assert.True(t, cp1.LessThan(cp2))
+	assert.False(t, cp2.LessThan(cp1))
+	assert.True(t, cp3.LessThan(cp1))
+	assert.False(t, cp1.LessThan(cp1))
+
+	// Non-numeric values are compared as strings
+	assert.True(t, testCheckpoint(t, `{"hash":"0xaa"}`).LessThan(testCheckpoint(t, `{"hash":"0xbb"}`)))
+
+	// An empty checkpoint is less than any other
+	assert.True(t, NewCheckpoint().LessThan(cp1))
+	assert.False(t, cp1.LessThan(NewCheckpoint()))
+	assert.True(t, testCheckpoint(t, `{"block":1}`).LessThan(testCheckpoint(t, `{"block":1,"logIndex":0}`)))
+
+	// Checkpoints that are not valid objects are treated as empty
+	assert.False(t, testCheckpoint(t, `[1]`).LessThan(testCheckpoint(t, `[2]`)))
+	assert.True(t, (&Checkpoint{raw: []byte(`{"block"`)}).LessThan(cp1))
+	assert.True(t, (&Checkpoint{raw: []byte(`{"block":`)}).LessThan(cp1))
+	assert.True(t, (&Checkpoint{raw: []byte(`{1:2}`)}).LessThan(cp1))
+
+	assert.False(t, cp1.LessThan(&otherCheckpoint{}))
+}
+
+func TestCheckpointJSON(t *testing.T) {
+	b, err := json.Marshal(NewCheckpoint())
+	assert.NoError(t, err)
+	assert.Equal(t, `null`, string(b))
+
+	b, err = json.Marshal(testCheckpoint(t, `{"block":10}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"block":10}`, string(b))
+}
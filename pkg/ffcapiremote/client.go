@@ -0,0 +1,282 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/wsclient"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+type client struct {
+	client        *resty.Client
+	wsConf        *wsclient.WSConfig
+	newCheckpoint func() ffcapi.EventListenerCheckpoint
+	mux           sync.Mutex
+	streams       map[fftypes.UUID]*clientStream
+}
+
+// NewClient returns an ffcapi.API implementation that invokes a connector running in a separate process, exposed
+// over HTTP/JSON by a Server. Checkpoints are restored into the structure returned by newCheckpoint, which should
+// be the checkpoint type of the connector where it is available. When nil the generic Checkpoint is used.
+func NewClient(ctx context.Context, conf config.Section, newCheckpoint func() ffcapi.EventListenerCheckpoint) (ffcapi.API, error) {
+	if conf.GetString(ffresty.HTTPConfigURL) == "" {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgMissingRemoteConnectorURL)
+	}
+	if newCheckpoint == nil {
+		newCheckpoint = NewCheckpoint
+	}
+	wsConf := wsclient.GenerateConfig(conf)
+	if wsConf.WSKeyPath == "" {
+		wsConf.WSKeyPath = path.Join(urlPath(wsConf.HTTPURL), StreamPath)
+	}
+	return &client{
+		client:        ffresty.New(ctx, conf),
+		wsConf:        wsConf,
+		newCheckpoint: newCheckpoint,
+		streams:       make(map[fftypes.UUID]*clientStream),
+	}, nil
+}
+
+// urlPath returns the path of the configured URL, so the WebSocket path can be resolved relative to it
+func urlPath(httpURL string) string {
+	u, err := url.Parse(httpURL)
+	if err != nil {
+		// The error is reported when the WebSocket connects
+		return ""
+	}
+	return u.Path
+}
+
+func (c *client) buildRequest(ctx context.Context, requestType RequestType, payload interface{}) (*Request, error) {
+	req := &Request{
+		Header: RequestHeader{
+			RequestID: fftypes.NewUUID(),
+			Type:      requestType,
+		},
+	}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgRemoteConnectorRequestInvalid, err)
+		}
+		req.Payload = b
+	}
+	return req, nil
+}
+
+// invoke sends a request to the server, and parses the response into the supplied result
+func (c *client) invoke(ctx context.Context, requestType RequestType, payload, result interface{}) (ffcapi.ErrorReason, error) {
+	req, err := c.buildRequest(ctx, requestType, payload)
+	if err != nil {
+		return ffcapi.ErrorReasonInvalidInputs, err
+	}
+	requestID := req.Header.RequestID
+	log.L(ctx).Tracef("--> %s %s", requestType, requestID)
+
+	var errRes ErrorResponse
+	res, err := c.client.R().
+		SetContext(ctx).
+		SetBody(req).
+		SetResult(result).
+		SetError(&errRes).
+		Post(RequestPath)
+	if err != nil {
+		return ffcapi.ErrorReasonDownstreamDown, i18n.NewError(ctx, tmmsgs.MsgConnectorError, requestID, ffcapi.ErrorReasonDownstreamDown, err)
+	}
+	if contentType := res.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		return "", i18n.NewError(ctx, tmmsgs.MsgConnectorInvalidContentType, requestID, contentType)
+	}
+	log.L(ctx).Tracef("<-- %s %s [%d]", requestType, requestID, res.StatusCode())
+	if res.IsError() {
+		return errRes.Reason, i18n.NewError(ctx, tmmsgs.MsgConnectorError, requestID, errRes.Reason, errRes.Error)
+	}
+	return "", nil
+}
+
+func (c *client) BlockInfoByHash(ctx context.Context, req *ffcapi.BlockInfoByHashRequest) (*ffcapi.BlockInfoByHashResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.BlockInfoByHashResponse
+	if reason, err := c.invoke(ctx, RequestTypeBlockInfoByHash, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) BlockInfoByNumber(ctx context.Context, req *ffcapi.BlockInfoByNumberRequest) (*ffcapi.BlockInfoByNumberResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.BlockInfoByNumberResponse
+	if reason, err := c.invoke(ctx, RequestTypeBlockInfoByNumber, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) NextNonceForSigner(ctx context.Context, req *ffcapi.NextNonceForSignerRequest) (*ffcapi.NextNonceForSignerResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.NextNonceForSignerResponse
+	if reason, err := c.invoke(ctx, RequestTypeNextNonceForSigner, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) BalanceForSigner(ctx context.Context, req *ffcapi.BalanceForSignerRequest) (*ffcapi.BalanceForSignerResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.BalanceForSignerResponse
+	if reason, err := c.invoke(ctx, RequestTypeBalanceForSigner, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) GasPriceEstimate(ctx context.Context, req *ffcapi.GasPriceEstimateRequest) (*ffcapi.GasPriceEstimateResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.GasPriceEstimateResponse
+	if reason, err := c.invoke(ctx, RequestTypeGasPriceEstimate, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) QueryInvoke(ctx context.Context, req *ffcapi.QueryInvokeRequest) (*ffcapi.QueryInvokeResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.QueryInvokeResponse
+	if reason, err := c.invoke(ctx, RequestTypeQueryInvoke, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) TransactionReceipt(ctx context.Context, req *ffcapi.TransactionReceiptRequest) (*ffcapi.TransactionReceiptResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.TransactionReceiptResponse
+	if reason, err := c.invoke(ctx, RequestTypeTransactionReceipt, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) TransactionPrepare(ctx context.Context, req *ffcapi.TransactionPrepareRequest) (*ffcapi.TransactionPrepareResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.TransactionPrepareResponse
+	if reason, err := c.invoke(ctx, RequestTypeTransactionPrepare, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) TransactionSend(ctx context.Context, req *ffcapi.TransactionSendRequest) (*ffcapi.TransactionSendResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.TransactionSendResponse
+	if reason, err := c.invoke(ctx, RequestTypeTransactionSend, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) TransactionSendRaw(ctx context.Context, req *ffcapi.TransactionSendRawRequest) (*ffcapi.TransactionSendRawResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.TransactionSendRawResponse
+	if reason, err := c.invoke(ctx, RequestTypeTransactionSendRaw, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) TransactionDecode(ctx context.Context, req *ffcapi.TransactionDecodeRequest) (*ffcapi.TransactionDecodeResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.TransactionDecodeResponse
+	if reason, err := c.invoke(ctx, RequestTypeTransactionDecode, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) DeployContractPrepare(ctx context.Context, req *ffcapi.ContractDeployPrepareRequest) (*ffcapi.TransactionPrepareResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.TransactionPrepareResponse
+	if reason, err := c.invoke(ctx, RequestTypeDeployContractPrepare, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) EventListenerVerifyOptions(ctx context.Context, req *ffcapi.EventListenerVerifyOptionsRequest) (*ffcapi.EventListenerVerifyOptionsResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.EventListenerVerifyOptionsResponse
+	if reason, err := c.invoke(ctx, RequestTypeEventListenerVerifyOptions, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) EventListenerAdd(ctx context.Context, req *ffcapi.EventListenerAddRequest) (*ffcapi.EventListenerAddResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.EventListenerAddResponse
+	if reason, err := c.invoke(ctx, RequestTypeEventListenerAdd, req, &res); err != nil {
+		return nil, reason, err
+	}
+	// Keep track of the listener, so it can be restored if the stream needs to be restarted
+	if cs := c.getStream(req.StreamID); cs != nil {
+		cs.listenerAdded(req)
+	}
+	return &res, "", nil
+}
+
+func (c *client) EventListenerRemove(ctx context.Context, req *ffcapi.EventListenerRemoveRequest) (*ffcapi.EventListenerRemoveResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.EventListenerRemoveResponse
+	if reason, err := c.invoke(ctx, RequestTypeEventListenerRemove, req, &res); err != nil {
+		return nil, reason, err
+	}
+	if cs := c.getStream(req.StreamID); cs != nil {
+		cs.listenerRemoved(req.ListenerID)
+	}
+	return &res, "", nil
+}
+
+func (c *client) EventListenerHWM(ctx context.Context, req *ffcapi.EventListenerHWMRequest) (*ffcapi.EventListenerHWMResponse, ffcapi.ErrorReason, error) {
+	res := ffcapi.EventListenerHWMResponse{
+		Checkpoint: c.newCheckpoint(),
+	}
+	if reason, err := c.invoke(ctx, RequestTypeEventListenerHWM, req, &res); err != nil {
+		return nil, reason, err
+	}
+	if cs := c.getStream(req.StreamID); cs != nil {
+		cs.listenerCheckpoint(req.ListenerID, res.Checkpoint)
+	}
+	return &res, "", nil
+}
+
+func (c *client) EventStreamNewCheckpointStruct() ffcapi.EventListenerCheckpoint {
+	return c.newCheckpoint()
+}
+
+func (c *client) IsLive(ctx context.Context) (*ffcapi.LiveResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.LiveResponse
+	if reason, err := c.invoke(ctx, RequestTypeIsLive, nil, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) IsReady(ctx context.Context) (*ffcapi.ReadyResponse, ffcapi.ErrorReason, error) {
+	var res ffcapi.ReadyResponse
+	if reason, err := c.invoke(ctx, RequestTypeIsReady, nil, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
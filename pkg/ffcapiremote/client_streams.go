@@ -0,0 +1,282 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/wsclient"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// clientStream is an event stream or block listener running on the remote connector, connected over a WebSocket.
+// If the WebSocket reconnects, the stream is started again on the connector from the last checkpoints delivered.
+type clientStream struct {
+	client      *client
+	ctx         context.Context
+	requestType RequestType
+	id          *fftypes.UUID
+	events      chan<- *ffcapi.ListenerEvent
+	blocks      chan<- *ffcapi.BlockHashEvent
+	wsc         wsclient.WSClient
+	done        chan struct{}
+	mux         sync.Mutex
+	connected   bool
+	requestID   *fftypes.UUID
+	listeners   map[fftypes.UUID]*ffcapi.EventListenerAddRequest
+}
+
+func (c *client) newStream(ctx context.Context, requestType RequestType, id *fftypes.UUID, events chan<- *ffcapi.ListenerEvent, blocks chan<- *ffcapi.BlockHashEvent) *clientStream {
+	return &clientStream{
+		client:      c,
+		ctx:         log.WithLogField(ctx, "remotestream", id.String()),
+		requestType: requestType,
+		id:          id,
+		events:      events,
+		blocks:      blocks,
+		done:        make(chan struct{}),
+		listeners:   make(map[fftypes.UUID]*ffcapi.EventListenerAddRequest),
+	}
+}
+
+func (c *client) getStream(id *fftypes.UUID) *clientStream {
+	if id == nil {
+		return nil
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.streams[*id]
+}
+
+func (c *client) EventStreamStart(ctx context.Context, req *ffcapi.EventStreamStartRequest) (*ffcapi.EventStreamStartResponse, ffcapi.ErrorReason, error) {
+	cs := c.newStream(req.StreamContext, RequestTypeEventStreamStart, req.ID, req.EventStream, req.BlockListener)
+	for _, l := range req.InitialListeners {
+		cs.listenerAdded(l)
+	}
+	if reason, err := cs.start(ctx); err != nil {
+		return nil, reason, err
+	}
+	c.mux.Lock()
+	c.streams[*req.ID] = cs
+	c.mux.Unlock()
+	return &ffcapi.EventStreamStartResponse{}, "", nil
+}
+
+func (c *client) EventStreamStopped(ctx context.Context, req *ffcapi.EventStreamStoppedRequest) (*ffcapi.EventStreamStoppedResponse, ffcapi.ErrorReason, error) {
+	if cs := c.getStream(req.ID); cs != nil {
+		// Wait for the WebSocket to close, as the connector needs the stream context to be cancelled before it is stopped
+		select {
+		case <-cs.done:
+		case <-ctx.Done():
+			return nil, "", i18n.NewError(ctx, i18n.MsgContextCanceled)
+		}
+		c.mux.Lock()
+		delete(c.streams, *req.ID)
+		c.mux.Unlock()
+	}
+	var res ffcapi.EventStreamStoppedResponse
+	if reason, err := c.invoke(ctx, RequestTypeEventStreamStopped, req, &res); err != nil {
+		return nil, reason, err
+	}
+	return &res, "", nil
+}
+
+func (c *client) NewBlockListener(ctx context.Context, req *ffcapi.NewBlockListenerRequest) (*ffcapi.NewBlockListenerResponse, ffcapi.ErrorReason, error) {
+	cs := c.newStream(req.ListenerContext, RequestTypeNewBlockListener, req.ID, nil, req.BlockListener)
+	if reason, err := cs.start(ctx); err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.NewBlockListenerResponse{}, "", nil
+}
+
+// start connects the WebSocket, and waits for the connector to confirm the stream has started
+func (cs *clientStream) start(ctx context.Context) (reason ffcapi.ErrorReason, err error) {
+	cs.wsc, err = wsclient.New(cs.ctx, cs.client.wsConf, nil, cs.afterConnect)
+	if err != nil {
+		return ffcapi.ErrorReasonInvalidInputs, err
+	}
+	if err = cs.wsc.Connect(); err != nil {
+		return ffcapi.ErrorReasonDownstreamDown, err
+	}
+
+	// The first message on the connection is the result of starting the stream
+	select {
+	case b, ok := <-cs.wsc.Receive():
+		if !ok {
+			err = i18n.NewError(ctx, tmmsgs.MsgRemoteConnectorStreamClosed, cs.id)
+			break
+		}
+		var msg StreamMessage
+		if err = json.Unmarshal(b, &msg); err == nil && msg.Type == StreamMessageTypeError {
+			reason = msg.Reason
+			err = i18n.NewError(ctx, tmmsgs.MsgConnectorError, cs.getRequestID(), msg.Reason, msg.Error)
+		}
+	case <-ctx.Done():
+		err = i18n.NewError(ctx, i18n.MsgContextCanceled)
+	}
+	if err != nil {
+		cs.close()
+		return reason, err
+	}
+
+	go cs.run()
+	return "", nil
+}
+
+// afterConnect is called by the WebSocket client on every connection, to start the stream on the connector
+func (cs *clientStream) afterConnect(ctx context.Context, w wsclient.WSClient) error {
+	cs.mux.Lock()
+	reconnect := cs.connected
+	cs.connected = true
+	cs.mux.Unlock()
+
+	if reconnect && cs.requestType == RequestTypeEventStreamStart {
+		// The connector might hold the state of the stream from the previous connection, which must be
+		// stopped before the stream can be started again
+		if _, err := cs.client.invoke(ctx, RequestTypeEventStreamStopped, &ffcapi.EventStreamStoppedRequest{ID: cs.id}, &ffcapi.EventStreamStoppedResponse{}); err != nil {
+			log.L(ctx).Warnf("Failed to stop event stream before restarting it: %s", err)
+		}
+	}
+
+	req, err := cs.client.buildRequest(ctx, cs.requestType, cs.startPayload())
+	if err != nil {
+		return err
+	}
+	cs.mux.Lock()
+	cs.requestID = req.Header.RequestID
+	cs.mux.Unlock()
+	b, _ := json.Marshal(req)
+	log.L(ctx).Debugf("Starting %s on remote connector (reconnect=%t) requestId=%s", cs.requestType, reconnect, req.Header.RequestID)
+	return w.Send(ctx, b)
+}
+
+func (cs *clientStream) startPayload() interface{} {
+	if cs.requestType == RequestTypeNewBlockListener {
+		return &NewBlockListenerPayload{ID: cs.id}
+	}
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	payload := &EventStreamStartPayload{
+		ID:               cs.id,
+		InitialListeners: make([]*ffcapi.EventListenerAddRequest, 0, len(cs.listeners)),
+	}
+	for _, l := range cs.listeners {
+		payload.InitialListeners = append(payload.InitialListeners, l)
+	}
+	return payload
+}
+
+func (cs *clientStream) getRequestID() *fftypes.UUID {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	return cs.requestID
+}
+
+func (cs *clientStream) listenerAdded(req *ffcapi.EventListenerAddRequest) {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	// Take a copy, as the checkpoint is updated as events are delivered
+	l := *req
+	cs.listeners[*req.ListenerID] = &l
+}
+
+func (cs *clientStream) listenerRemoved(listenerID *fftypes.UUID) {
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	delete(cs.listeners, *listenerID)
+}
+
+// listenerCheckpoint records the latest checkpoint delivered for a listener, to restart the listener from
+func (cs *clientStream) listenerCheckpoint(listenerID *fftypes.UUID, checkpoint ffcapi.EventListenerCheckpoint) {
+	if listenerID == nil || checkpoint == nil {
+		return
+	}
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	if l := cs.listeners[*listenerID]; l != nil {
+		l.Checkpoint = checkpoint
+	}
+}
+
+// close closes the WebSocket when the stream fails to start, draining anything the WebSocket client is still delivering so it can exit
+func (cs *clientStream) close() {
+	cs.wsc.Close()
+	go func() {
+		for range cs.wsc.Receive() {
+		}
+	}()
+}
+
+func (cs *clientStream) run() {
+	defer close(cs.done)
+	go func() {
+		<-cs.ctx.Done()
+		log.L(cs.ctx).Debugf("Stream context closed")
+		cs.wsc.Close()
+	}()
+	// The WebSocket client reconnects until it is closed, which happens when the stream context closes
+	for b := range cs.wsc.Receive() {
+		cs.dispatch(b)
+	}
+}
+
+func (cs *clientStream) dispatch(b []byte) {
+	msg := &StreamMessage{
+		Event: &ffcapi.ListenerEvent{Checkpoint: cs.client.newCheckpoint()},
+	}
+	if err := json.Unmarshal(b, msg); err != nil {
+		log.L(cs.ctx).Errorf("Invalid message from remote connector: %s", err)
+		return
+	}
+	switch msg.Type {
+	case StreamMessageTypeStarted:
+		// The stream was started again after a reconnect, so blocks might have been missed
+		log.L(cs.ctx).Infof("Stream restarted on remote connector")
+		cs.deliverBlock(&ffcapi.BlockHashEvent{GapPotential: true})
+	case StreamMessageTypeError:
+		// The server closes the connection, so the start is retried when the WebSocket reconnects
+		log.L(cs.ctx).Errorf("Failed to restart stream on remote connector. requestId=%s reason=%s error: %s", cs.getRequestID(), msg.Reason, msg.Error)
+	case StreamMessageTypeEvent:
+		if msg.Event.Event != nil {
+			cs.listenerCheckpoint(msg.Event.Event.ID.ListenerID, msg.Event.Checkpoint)
+		}
+		select {
+		case cs.events <- msg.Event:
+		case <-cs.ctx.Done():
+		}
+	case StreamMessageTypeBlock:
+		cs.deliverBlock(msg.Block)
+	default:
+		log.L(cs.ctx).Warnf("Unexpected message type from remote connector: %s", msg.Type)
+	}
+}
+
+func (cs *clientStream) deliverBlock(block *ffcapi.BlockHashEvent) {
+	if cs.blocks == nil || block == nil {
+		return
+	}
+	select {
+	case cs.blocks <- block:
+	case <-cs.ctx.Done():
+	}
+}
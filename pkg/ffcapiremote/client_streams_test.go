@@ -0,0 +1,323 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/wsclient"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestEventStreamE2EWithReconnect(t *testing.T) {
+	c, s, mapi := newTestClientServer(t)
+	ctx := context.Background()
+	streamID := fftypes.NewUUID()
+	listenerID := fftypes.NewUUID()
+
+	started := make(chan *ffcapi.EventStreamStartRequest, 1)
+	mapi.On("EventStreamStart", mock.Anything, mock.Anything).Return(&ffcapi.EventStreamStartResponse{}, ffcapi.ErrorReason(""), nil).Run(func(args mock.Arguments) {
+		started <- args[1].(*ffcapi.EventStreamStartRequest)
+	})
+	mapi.On("EventStreamStopped", mock.Anything, &ffcapi.EventStreamStoppedRequest{ID: streamID}).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop")).Once()
+	mapi.On("EventStreamStopped", mock.Anything, &ffcapi.EventStreamStoppedRequest{ID: streamID}).Return(&ffcapi.EventStreamStoppedResponse{}, ffcapi.ErrorReason(""), nil)
+	mapi.On("EventListenerAdd", mock.Anything, mock.Anything).Return(&ffcapi.EventListenerAddResponse{}, ffcapi.ErrorReason(""), nil)
+	mapi.On("EventListenerRemove", mock.Anything, mock.Anything).Return(&ffcapi.EventListenerRemoveResponse{}, ffcapi.ErrorReason(""), nil)
+	mapi.On("EventListenerHWM", mock.Anything, mock.Anything).Return(&ffcapi.EventListenerHWMResponse{
+		Checkpoint: &Checkpoint{raw: []byte(`{"block":6}`)},
+	}, ffcapi.ErrorReason(""), nil)
+
+	events := make(chan *ffcapi.ListenerEvent)
+	blocks := make(chan *ffcapi.BlockHashEvent)
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	_, _, err := c.EventStreamStart(ctx, &ffcapi.EventStreamStartRequest{
+		ID:            streamID,
+		StreamContext: streamCtx,
+		EventStream:   events,
+		BlockListener: blocks,
+		InitialListeners: []*ffcapi.EventListenerAddRequest{
+			{ListenerID: listenerID, StreamID: streamID, Name: "listener1"},
+		},
+	})
+	assert.NoError(t, err)
+	startReq := <-started
+	assert.Equal(t, streamID, startReq.ID)
+	assert.Len(t, startReq.InitialListeners, 1)
+	assert.Equal(t, "listener1", startReq.InitialListeners[0].Name)
+	assert.Nil(t, startReq.InitialListeners[0].Checkpoint)
+
+	// Deliver an event and a block from the connector
+	go func() {
+		startReq.EventStream <- &ffcapi.ListenerEvent{
+			Checkpoint: &Checkpoint{raw: []byte(`{"block":5}`)},
+			Event: &ffcapi.Event{
+				ID:   ffcapi.EventID{ListenerID: listenerID, BlockNumber: 5},
+				Data: fftypes.JSONAnyPtr(`{"value":1}`),
+			},
+		}
+		startReq.BlockListener <- &ffcapi.BlockHashEvent{BlockHashes: []string{"0x12345"}}
+	}()
+	ev := <-events
+	assert.Equal(t, listenerID, ev.Event.ID.ListenerID)
+	assert.Equal(t, fftypes.FFuint64(5), ev.Event.ID.BlockNumber)
+	assert.JSONEq(t, `{"value":1}`, ev.Event.Data.String())
+	assert.Equal(t, &Checkpoint{raw: []byte(`{"block":5}`)}, ev.Checkpoint)
+	block := <-blocks
+	assert.Equal(t, []string{"0x12345"}, block.BlockHashes)
+
+	// Add and remove a second listener, and query the checkpoint of the first
+	listener2ID := fftypes.NewUUID()
+	_, _, err = c.EventListenerAdd(ctx, &ffcapi.EventListenerAddRequest{ListenerID: listener2ID, StreamID: streamID, Name: "listener2"})
+	assert.NoError(t, err)
+	assert.Len(t, c.getStream(streamID).listeners, 2)
+	_, _, err = c.EventListenerRemove(ctx, &ffcapi.EventListenerRemoveRequest{ListenerID: listener2ID, StreamID: streamID})
+	assert.NoError(t, err)
+	_, _, err = c.EventListenerHWM(ctx, &ffcapi.EventListenerHWMRequest{ListenerID: listenerID, StreamID: streamID})
+	assert.NoError(t, err)
+
+	// Drop the connection from the server side, and check the stream is restarted from the last checkpoint
+	s.Close()
+	<-startReq.StreamContext.Done()
+	restartReq := <-started
+	assert.Len(t, restartReq.InitialListeners, 1)
+	assert.Equal(t, listenerID, restartReq.InitialListeners[0].ListenerID)
+	assert.Equal(t, &Checkpoint{raw: []byte(`{"block":6}`)}, restartReq.InitialListeners[0].Checkpoint)
+	block = <-blocks
+	assert.True(t, block.GapPotential)
+
+	// Stop the stream
+	cancelStream()
+	_, _, err = c.EventStreamStopped(ctx, &ffcapi.EventStreamStoppedRequest{ID: streamID})
+	assert.NoError(t, err)
+	<-restartReq.StreamContext.Done()
+	assert.Nil(t, c.getStream(streamID))
+}
+
+func TestEventStreamStartFail(t *testing.T) {
+	c, _, mapi := newTestClientServer(t)
+	ctx := context.Background()
+
+	mapi.On("EventStreamStart", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReasonInvalidInputs, fmt.Errorf("pop"))
+
+	_, reason, err := c.EventStreamStart(ctx, &ffcapi.EventStreamStartRequest{
+		ID:            fftypes.NewUUID(),
+		StreamContext: ctx,
+	})
+	assert.Regexp(t, "FF21012.*pop", err)
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+}
+
+func TestEventStreamStoppedTimeout(t *testing.T) {
+	c := newTestClient(t, "http://localhost:12345")
+	streamID := fftypes.NewUUID()
+	c.streams[*streamID] = &clientStream{done: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := c.EventStreamStopped(ctx, &ffcapi.EventStreamStoppedRequest{ID: streamID})
+	assert.Regexp(t, "FF00154", err)
+}
+
+func TestNewBlockListenerE2EWithReconnect(t *testing.T) {
+	c, s, mapi := newTestClientServer(t)
+	ctx := context.Background()
+	listenerID := fftypes.NewUUID()
+
+	started := make(chan *ffcapi.NewBlockListenerRequest, 1)
+	mapi.On("NewBlockListener", mock.Anything, mock.Anything).Return(&ffcapi.NewBlockListenerResponse{}, ffcapi.ErrorReason(""), nil).Run(func(args mock.Arguments) {
+		started <- args[1].(*ffcapi.NewBlockListenerRequest)
+	})
+
+	blocks := make(chan *ffcapi.BlockHashEvent)
+	listenerCtx, cancelListener := context.WithCancel(ctx)
+	_, _, err := c.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{
+		ID:              listenerID,
+		ListenerContext: listenerCtx,
+		BlockListener:   blocks,
+	})
+	assert.NoError(t, err)
+	startReq := <-started
+	assert.Equal(t, listenerID, startReq.ID)
+
+	go func() {
+		startReq.BlockListener <- &ffcapi.BlockHashEvent{BlockHashes: []string{"0x12345"}}
+	}()
+	block := <-blocks
+	assert.Equal(t, []string{"0x12345"}, block.BlockHashes)
+
+	s.Close()
+	<-startReq.ListenerContext.Done()
+	restartReq := <-started
+	block = <-blocks
+	assert.True(t, block.GapPotential)
+
+	cancelListener()
+	<-restartReq.ListenerContext.Done()
+}
+
+func TestNewBlockListenerFail(t *testing.T) {
+	c, _, mapi := newTestClientServer(t)
+	ctx := context.Background()
+
+	mapi.On("NewBlockListener", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+
+	_, _, err := c.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{
+		ID:              fftypes.NewUUID(),
+		ListenerContext: ctx,
+	})
+	assert.Regexp(t, "FF21012.*pop", err)
+}
+
+func TestStreamStartBadURL(t *testing.T) {
+	c := newTestClient(t, ":::bad")
+	ctx := context.Background()
+
+	_, reason, err := c.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{
+		ID:              fftypes.NewUUID(),
+		ListenerContext: ctx,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+}
+
+func TestStreamStartConnectFail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+	c := newTestClient(t, ts.URL)
+	ctx := context.Background()
+
+	_, reason, err := c.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{
+		ID:              fftypes.NewUUID(),
+		ListenerContext: ctx,
+	})
+	assert.Regexp(t, "FF00148", err)
+	assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), reason)
+}
+
+func TestStreamStartContextCancelled(t *testing.T) {
+	toServer, _, url, done := wsclient.NewTestWSServer(nil)
+	defer done()
+	c := newTestClient(t, strings.Replace(url, "ws:", "http:", 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-toServer
+		cancel()
+	}()
+	_, _, err := c.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{
+		ID:              fftypes.NewUUID(),
+		ListenerContext: context.Background(),
+	})
+	assert.Regexp(t, "FF00154", err)
+}
+
+func TestStreamStartClosed(t *testing.T) {
+	toServer, _, url, done := wsclient.NewTestWSServer(nil)
+	c := newTestClient(t, strings.Replace(url, "ws:", "http:", 1))
+
+	listenerCtx, cancelListener := context.WithCancel(context.Background())
+	go func() {
+		<-toServer
+		cancelListener()
+		done()
+	}()
+	_, _, err := c.NewBlockListener(context.Background(), &ffcapi.NewBlockListenerRequest{
+		ID:              fftypes.NewUUID(),
+		ListenerContext: listenerCtx,
+	})
+	assert.Regexp(t, "FF21110", err)
+}
+
+func TestStreamDispatch(t *testing.T) {
+	toServer, fromServer, url, done := wsclient.NewTestWSServer(nil)
+	defer done()
+	c := newTestClient(t, strings.Replace(url, "ws:", "http:", 1))
+	streamID := fftypes.NewUUID()
+	listenerID := fftypes.NewUUID()
+
+	go func() {
+		var req Request
+		err := json.Unmarshal([]byte(<-toServer), &req)
+		assert.NoError(t, err)
+		assert.Equal(t, RequestTypeEventStreamStart, req.Header.Type)
+		fromServer <- `{"type":"started"}`
+	}()
+
+	events := make(chan *ffcapi.ListenerEvent)
+	blocks := make(chan *ffcapi.BlockHashEvent)
+	streamCtx, cancelStream := context.WithCancel(context.Background())
+	_, _, err := c.EventStreamStart(context.Background(), &ffcapi.EventStreamStartRequest{
+		ID:               streamID,
+		StreamContext:    streamCtx,
+		EventStream:      events,
+		BlockListener:    blocks,
+		InitialListeners: []*ffcapi.EventListenerAddRequest{{ListenerID: listenerID, StreamID: streamID}},
+	})
+	assert.NoError(t, err)
+
+	fromServer <- `!!! not JSON`
+	fromServer <- `{"type":"unexpected"}`
+	fromServer <- `{"type":"error","error":"pop","reason":"downstream_down"}`
+	fromServer <- `{"type":"block"}`
+	fromServer <- `{"type":"started"}`
+	block := <-blocks
+	assert.True(t, block.GapPotential)
+
+	fromServer <- fmt.Sprintf(`{"type":"event","event":{"checkpoint":{"block":1},"event":{"ID":{"listenerId":"%s","blockNumber":"1"}}}}`, listenerID)
+	ev := <-events
+	assert.Equal(t, listenerID, ev.Event.ID.ListenerID)
+	assert.Equal(t, &Checkpoint{raw: []byte(`{"block":1}`)}, c.getStream(streamID).listeners[*listenerID].Checkpoint)
+
+	fromServer <- fmt.Sprintf(`{"type":"event","event":{"checkpoint":null,"event":{"ID":{"listenerId":"%s"}}}}`, listenerID)
+	ev = <-events
+	assert.Nil(t, ev.Checkpoint)
+	assert.Equal(t, &Checkpoint{raw: []byte(`{"block":1}`)}, c.getStream(streamID).listeners[*listenerID].Checkpoint)
+
+	cancelStream()
+	<-c.getStream(streamID).done
+}
+
+func TestStreamStartBadPayload(t *testing.T) {
+	c, _, mapi := newTestClientServer(t)
+	mapi.On("EventStreamStopped", mock.Anything, mock.Anything).Return(&ffcapi.EventStreamStoppedResponse{}, ffcapi.ErrorReason(""), nil).Maybe()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	streamCtx, cancelStream := context.WithCancel(context.Background())
+	defer cancelStream()
+	_, _, err := c.EventStreamStart(ctx, &ffcapi.EventStreamStartRequest{
+		ID:            fftypes.NewUUID(),
+		StreamContext: streamCtx,
+		InitialListeners: []*ffcapi.EventListenerAddRequest{{
+			ListenerID: fftypes.NewUUID(),
+			EventListenerOptions: ffcapi.EventListenerOptions{
+				Options: fftypes.JSONAnyPtr(`!!! not JSON`),
+			},
+		}},
+	})
+	assert.Regexp(t, "FF00154", err)
+}
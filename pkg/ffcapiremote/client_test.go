@@ -0,0 +1,362 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/wsclient"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestClient(t *testing.T, url string) *client {
+	config.RootConfigReset()
+	conf := config.RootSection("unittest.remote")
+	InitConfig(conf)
+	conf.Set(ffresty.HTTPConfigURL, url)
+	conf.Set(ffresty.HTTPConfigRetryEnabled, false)
+	conf.Set(ffresty.HTTPConfigRetryInitDelay, "1ms")
+	conf.Set(wsclient.WSConfigKeyInitialConnectAttempts, 1)
+	c, err := NewClient(context.Background(), conf, nil)
+	assert.NoError(t, err)
+	return c.(*client)
+}
+
+func newTestClientServer(t *testing.T) (*client, *server, *ffcapimocks.API) {
+	mapi := &ffcapimocks.API{}
+	mapi.On("EventStreamNewCheckpointStruct").Return(NewCheckpoint()).Maybe()
+	s := NewServer(context.Background(), mapi).(*server)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		s.Close()
+		ts.Close()
+		mapi.AssertExpectations(t)
+	})
+	return newTestClient(t, ts.URL), s, mapi
+}
+
+func TestRequestsOK(t *testing.T) {
+	c, _, mapi := newTestClientServer(t)
+	ctx := context.Background()
+
+	mapi.On("BlockInfoByHash", mock.Anything, &ffcapi.BlockInfoByHashRequest{BlockHash: "0x12345"}).
+		Return(&ffcapi.BlockInfoByHashResponse{BlockInfo: ffcapi.BlockInfo{BlockHash: "0x12345"}}, ffcapi.ErrorReason(""), nil)
+	bihr, _, err := c.BlockInfoByHash(ctx, &ffcapi.BlockInfoByHashRequest{BlockHash: "0x12345"})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x12345", bihr.BlockHash)
+
+	mapi.On("BlockInfoByNumber", mock.Anything, &ffcapi.BlockInfoByNumberRequest{BlockNumber: fftypes.NewFFBigInt(12345)}).
+		Return(&ffcapi.BlockInfoByNumberResponse{BlockInfo: ffcapi.BlockInfo{BlockNumber: fftypes.NewFFBigInt(12345)}}, ffcapi.ErrorReason(""), nil)
+	binr, _, err := c.BlockInfoByNumber(ctx, &ffcapi.BlockInfoByNumberRequest{BlockNumber: fftypes.NewFFBigInt(12345)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12345), binr.BlockNumber.Int64())
+
+	mapi.On("NextNonceForSigner", mock.Anything, &ffcapi.NextNonceForSignerRequest{Signer: "0xaaaa"}).
+		Return(&ffcapi.NextNonceForSignerResponse{Nonce: fftypes.NewFFBigInt(10)}, ffcapi.ErrorReason(""), nil)
+	nnr, _, err := c.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{Signer: "0xaaaa"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), nnr.Nonce.Int64())
+
+	mapi.On("BalanceForSigner", mock.Anything, &ffcapi.BalanceForSignerRequest{Signer: "0xaaaa"}).
+		Return(&ffcapi.BalanceForSignerResponse{Balance: fftypes.NewFFBigInt(1000)}, ffcapi.ErrorReason(""), nil)
+	bfsr, _, err := c.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{Signer: "0xaaaa"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), bfsr.Balance.Int64())
+
+	mapi.On("GasPriceEstimate", mock.Anything, &ffcapi.GasPriceEstimateRequest{}).
+		Return(&ffcapi.GasPriceEstimateResponse{GasPrice: fftypes.JSONAnyPtr(`{"maxFeePerGas":12345}`)}, ffcapi.ErrorReason(""), nil)
+	gper, _, err := c.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"maxFeePerGas":12345}`, gper.GasPrice.String())
+
+	mapi.On("QueryInvoke", mock.Anything, mock.MatchedBy(func(req *ffcapi.QueryInvokeRequest) bool {
+		return req.BlockTag == ffcapi.BlockTagSafe && req.Method.String() == `{"name":"get"}`
+	})).Return(&ffcapi.QueryInvokeResponse{Outputs: fftypes.JSONAnyPtr(`[1]`)}, ffcapi.ErrorReason(""), nil)
+	qir, _, err := c.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{
+		TransactionInput: ffcapi.TransactionInput{Method: fftypes.JSONAnyPtr(`{"name":"get"}`)},
+		BlockTag:         ffcapi.BlockTagSafe,
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[1]`, qir.Outputs.String())
+
+	mapi.On("TransactionReceipt", mock.Anything, &ffcapi.TransactionReceiptRequest{TransactionHash: "0x1111"}).
+		Return(&ffcapi.TransactionReceiptResponse{Success: true, ContractLocation: fftypes.JSONAnyPtr(`{"address":"0x2222"}`)}, ffcapi.ErrorReason(""), nil)
+	trr, _, err := c.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: "0x1111"})
+	assert.NoError(t, err)
+	assert.True(t, trr.Success)
+	assert.JSONEq(t, `{"address":"0x2222"}`, trr.ContractLocation.String())
+
+	mapi.On("TransactionPrepare", mock.Anything, mock.MatchedBy(func(req *ffcapi.TransactionPrepareRequest) bool {
+		return req.From == "0xaaaa" && len(req.Params) == 1
+	})).Return(&ffcapi.TransactionPrepareResponse{TransactionData: "0x3333", Gas: fftypes.NewFFBigInt(21000)}, ffcapi.ErrorReason(""), nil)
+	tpr, _, err := c.TransactionPrepare(ctx, &ffcapi.TransactionPrepareRequest{
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa"},
+			Params:             []*fftypes.JSONAny{fftypes.JSONAnyPtr(`"x"`)},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x3333", tpr.TransactionData)
+	assert.Equal(t, int64(21000), tpr.Gas.Int64())
+
+	mapi.On("TransactionSend", mock.Anything, mock.MatchedBy(func(req *ffcapi.TransactionSendRequest) bool {
+		return req.TransactionData == "0x3333" && req.Nonce.Int64() == 10
+	})).Return(&ffcapi.TransactionSendResponse{TransactionHash: "0x4444"}, ffcapi.ErrorReason(""), nil)
+	tsr, _, err := c.TransactionSend(ctx, &ffcapi.TransactionSendRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{Nonce: fftypes.NewFFBigInt(10)},
+		TransactionData:    "0x3333",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x4444", tsr.TransactionHash)
+
+	mapi.On("TransactionSendRaw", mock.Anything, mock.MatchedBy(func(req *ffcapi.TransactionSendRawRequest) bool {
+		return req.RawTransaction == "0x5555" && req.From == "0xaaaa"
+	})).Return(&ffcapi.TransactionSendRawResponse{TransactionHash: "0x6666"}, ffcapi.ErrorReason(""), nil)
+	tsrr, _, err := c.TransactionSendRaw(ctx, &ffcapi.TransactionSendRawRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa"},
+		RawTransaction:     "0x5555",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x6666", tsrr.TransactionHash)
+
+	mapi.On("TransactionDecode", mock.Anything, &ffcapi.TransactionDecodeRequest{RawTransaction: "0x5555"}).
+		Return(&ffcapi.TransactionDecodeResponse{
+			TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa", Nonce: fftypes.NewFFBigInt(11)},
+			TransactionHash:    "0x6666",
+		}, ffcapi.ErrorReason(""), nil)
+	tdr, _, err := c.TransactionDecode(ctx, &ffcapi.TransactionDecodeRequest{RawTransaction: "0x5555"})
+	assert.NoError(t, err)
+	assert.Equal(t, "0xaaaa", tdr.From)
+	assert.Equal(t, int64(11), tdr.Nonce.Int64())
+	assert.Equal(t, "0x6666", tdr.TransactionHash)
+
+	mapi.On("DeployContractPrepare", mock.Anything, mock.MatchedBy(func(req *ffcapi.ContractDeployPrepareRequest) bool {
+		return req.Contract.String() == `"0x7777"`
+	})).Return(&ffcapi.TransactionPrepareResponse{TransactionData: "0x8888"}, ffcapi.ErrorReason(""), nil)
+	dcpr, _, err := c.DeployContractPrepare(ctx, &ffcapi.ContractDeployPrepareRequest{Contract: fftypes.JSONAnyPtr(`"0x7777"`)})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x8888", dcpr.TransactionData)
+
+	mapi.On("EventListenerVerifyOptions", mock.Anything, mock.MatchedBy(func(req *ffcapi.EventListenerVerifyOptionsRequest) bool {
+		return req.FromBlock == ffcapi.FromBlockLatest
+	})).Return(&ffcapi.EventListenerVerifyOptionsResponse{ResolvedSignature: "Changed(uint256)"}, ffcapi.ErrorReason(""), nil)
+	elvor, _, err := c.EventListenerVerifyOptions(ctx, &ffcapi.EventListenerVerifyOptionsRequest{
+		EventListenerOptions: ffcapi.EventListenerOptions{FromBlock: ffcapi.FromBlockLatest},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Changed(uint256)", elvor.ResolvedSignature)
+
+	mapi.On("IsLive", mock.Anything).Return(&ffcapi.LiveResponse{Up: true}, ffcapi.ErrorReason(""), nil)
+	lr, _, err := c.IsLive(ctx)
+	assert.NoError(t, err)
+	assert.True(t, lr.Up)
+
+	mapi.On("IsReady", mock.Anything).Return(&ffcapi.ReadyResponse{Ready: true, DownstreamDetails: fftypes.JSONAnyPtr(`{"chainId":1}`)}, ffcapi.ErrorReason(""), nil)
+	rr, _, err := c.IsReady(ctx)
+	assert.NoError(t, err)
+	assert.True(t, rr.Ready)
+	assert.JSONEq(t, `{"chainId":1}`, rr.DownstreamDetails.String())
+}
+
+func TestListenerRequestsOK(t *testing.T) {
+	c, _, mapi := newTestClientServer(t)
+	ctx := context.Background()
+	streamID := fftypes.NewUUID()
+	listenerID := fftypes.NewUUID()
+
+	mapi.On("EventListenerAdd", mock.Anything, mock.MatchedBy(func(req *ffcapi.EventListenerAddRequest) bool {
+		b, _ := req.Checkpoint.(*Checkpoint).MarshalJSON()
+		return req.ListenerID.Equals(listenerID) && string(b) == `{"block":10}`
+	})).Return(&ffcapi.EventListenerAddResponse{}, ffcapi.ErrorReason(""), nil)
+	cp := NewCheckpoint()
+	assert.NoError(t, cp.(*Checkpoint).UnmarshalJSON([]byte(`{"block":10}`)))
+	_, _, err := c.EventListenerAdd(ctx, &ffcapi.EventListenerAddRequest{
+		StreamID:   streamID,
+		ListenerID: listenerID,
+		Checkpoint: cp,
+	})
+	assert.NoError(t, err)
+
+	hwm := &Checkpoint{raw: []byte(`{"block":20}`)}
+	mapi.On("EventListenerHWM", mock.Anything, &ffcapi.EventListenerHWMRequest{StreamID: streamID, ListenerID: listenerID}).
+		Return(&ffcapi.EventListenerHWMResponse{Checkpoint: hwm}, ffcapi.ErrorReason(""), nil)
+	hwmr, _, err := c.EventListenerHWM(ctx, &ffcapi.EventListenerHWMRequest{StreamID: streamID, ListenerID: listenerID})
+	assert.NoError(t, err)
+	assert.Equal(t, hwm, hwmr.Checkpoint)
+	assert.False(t, hwmr.Checkpoint.LessThan(hwm))
+
+	mapi.On("EventListenerRemove", mock.Anything, &ffcapi.EventListenerRemoveRequest{StreamID: streamID, ListenerID: listenerID}).
+		Return(&ffcapi.EventListenerRemoveResponse{}, ffcapi.ErrorReason(""), nil)
+	_, _, err = c.EventListenerRemove(ctx, &ffcapi.EventListenerRemoveRequest{StreamID: streamID, ListenerID: listenerID})
+	assert.NoError(t, err)
+
+	mapi.On("EventStreamStopped", mock.Anything, &ffcapi.EventStreamStoppedRequest{ID: streamID}).
+		Return(&ffcapi.EventStreamStoppedResponse{}, ffcapi.ErrorReason(""), nil)
+	_, _, err = c.EventStreamStopped(ctx, &ffcapi.EventStreamStoppedRequest{ID: streamID})
+	assert.NoError(t, err)
+
+	assert.IsType(t, &Checkpoint{}, c.EventStreamNewCheckpointStruct())
+}
+
+func TestRequestsFail(t *testing.T) {
+	c, _, mapi := newTestClientServer(t)
+	ctx := context.Background()
+
+	mapi.On("BlockInfoByHash", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReasonNotFound, fmt.Errorf("pop"))
+	_, reason, err := c.BlockInfoByHash(ctx, &ffcapi.BlockInfoByHashRequest{})
+	assert.Regexp(t, "FF21012.*not_found.*pop", err)
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+
+	mapi.On("BlockInfoByNumber", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReasonInvalidInputs, fmt.Errorf("pop"))
+	_, reason, err = c.BlockInfoByNumber(ctx, &ffcapi.BlockInfoByNumberRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+
+	mapi.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("BalanceForSigner", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("GasPriceEstimate", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("QueryInvoke", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReasonTransactionReverted, fmt.Errorf("pop"))
+	_, reason, err = c.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+	assert.Equal(t, ffcapi.ErrorReasonTransactionReverted, reason)
+
+	mapi.On("TransactionReceipt", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("TransactionPrepare", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.TransactionPrepare(ctx, &ffcapi.TransactionPrepareRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("TransactionSend", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReasonNonceTooLow, fmt.Errorf("pop"))
+	_, reason, err = c.TransactionSend(ctx, &ffcapi.TransactionSendRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+	assert.Equal(t, ffcapi.ErrorReasonNonceTooLow, reason)
+
+	mapi.On("TransactionSendRaw", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorKnownTransaction, fmt.Errorf("pop"))
+	_, reason, err = c.TransactionSendRaw(ctx, &ffcapi.TransactionSendRawRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+	assert.Equal(t, ffcapi.ErrorKnownTransaction, reason)
+
+	mapi.On("TransactionDecode", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.TransactionDecode(ctx, &ffcapi.TransactionDecodeRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("DeployContractPrepare", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.DeployContractPrepare(ctx, &ffcapi.ContractDeployPrepareRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("EventStreamStopped", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.EventStreamStopped(ctx, &ffcapi.EventStreamStoppedRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("EventListenerVerifyOptions", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.EventListenerVerifyOptions(ctx, &ffcapi.EventListenerVerifyOptionsRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("EventListenerAdd", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.EventListenerAdd(ctx, &ffcapi.EventListenerAddRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("EventListenerRemove", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.EventListenerRemove(ctx, &ffcapi.EventListenerRemoveRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("EventListenerHWM", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.EventListenerHWM(ctx, &ffcapi.EventListenerHWMRequest{})
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("IsLive", mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+	_, _, err = c.IsLive(ctx)
+	assert.Regexp(t, "FF21012.*pop", err)
+
+	mapi.On("IsReady", mock.Anything).Return(nil, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), fmt.Errorf("pop"))
+	_, reason, err = c.IsReady(ctx)
+	assert.Regexp(t, "FF21012.*pop", err)
+	assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), reason)
+}
+
+func TestRequestInvalidContentType(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+	c := newTestClient(t, ts.URL)
+
+	_, _, err := c.IsLive(context.Background())
+	assert.Regexp(t, "FF21013.*text/plain", err)
+}
+
+func TestRequestConnectFail(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.Close()
+	c := newTestClient(t, ts.URL)
+
+	_, reason, err := c.IsLive(context.Background())
+	assert.Regexp(t, "FF21012", err)
+	assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), reason)
+}
+
+func TestRequestBadPayload(t *testing.T) {
+	c := newTestClient(t, "http://localhost:12345")
+
+	_, reason, err := c.QueryInvoke(context.Background(), &ffcapi.QueryInvokeRequest{
+		TransactionInput: ffcapi.TransactionInput{Method: fftypes.JSONAnyPtr(`!!! not JSON`)},
+	})
+	assert.Regexp(t, "FF21108", err)
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+}
+
+func TestNewClientWSPath(t *testing.T) {
+	c := newTestClient(t, "http://localhost:12345/api/connector")
+	assert.Equal(t, "/api/connector/ws", c.wsConf.WSKeyPath)
+
+	c = newTestClient(t, "http://localhost:12345")
+	assert.Equal(t, "/ws", c.wsConf.WSKeyPath)
+
+	c = newTestClient(t, ":::bad")
+	assert.Equal(t, "/ws", c.wsConf.WSKeyPath)
+}
+
+func TestNewClientMissingURL(t *testing.T) {
+	config.RootConfigReset()
+	conf := config.RootSection("unittest.remote")
+	InitConfig(conf)
+
+	_, err := NewClient(context.Background(), conf, nil)
+	assert.Regexp(t, "FF21111", err)
+}
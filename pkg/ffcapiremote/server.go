@@ -0,0 +1,243 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// Server exposes an ffcapi.API implementation over HTTP/JSON, for use by a client created with NewClient.
+// Requests are accepted with a POST on RequestPath, and event streams and block listeners are started over a
+// WebSocket connected on StreamPath. The stream runs until the WebSocket closes.
+type Server interface {
+	http.Handler
+	// Close stops all streams that are running
+	Close()
+}
+
+type server struct {
+	ctx      context.Context
+	api      ffcapi.API
+	router   *mux.Router
+	upgrader *websocket.Upgrader
+	mux      sync.Mutex
+	streams  map[fftypes.UUID]*serverStream
+}
+
+type serverStream struct {
+	cancel func()
+	done   chan struct{}
+}
+
+func NewServer(ctx context.Context, api ffcapi.API) Server {
+	s := &server{
+		ctx:    ctx,
+		api:    api,
+		router: mux.NewRouter(),
+		upgrader: &websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+		streams: make(map[fftypes.UUID]*serverStream),
+	}
+	s.router.HandleFunc(RequestPath, s.serveRequest).Methods(http.MethodPost)
+	s.router.HandleFunc(StreamPath, s.serveStream).Methods(http.MethodGet)
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *server) Close() {
+	s.mux.Lock()
+	streams := make([]*serverStream, 0, len(s.streams))
+	for _, ss := range s.streams {
+		streams = append(streams, ss)
+	}
+	s.mux.Unlock()
+	for _, ss := range streams {
+		ss.cancel()
+		<-ss.done
+	}
+}
+
+func (s *server) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *server) writeError(w http.ResponseWriter, reason ffcapi.ErrorReason, err error) {
+	status := http.StatusInternalServerError
+	switch reason {
+	case ffcapi.ErrorReasonInvalidInputs:
+		status = http.StatusBadRequest
+	case ffcapi.ErrorReasonNotFound:
+		status = http.StatusNotFound
+	}
+	s.writeJSON(w, status, &ErrorResponse{Error: err.Error(), Reason: reason})
+}
+
+func (s *server) serveRequest(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, ffcapi.ErrorReasonInvalidInputs, i18n.NewError(r.Context(), tmmsgs.MsgRemoteConnectorRequestInvalid, err))
+		return
+	}
+	ctx := log.WithLogField(r.Context(), "requestId", req.Header.RequestID.String())
+	log.L(ctx).Debugf("--> %s", req.Header.Type)
+	res, reason, err := s.invoke(ctx, &req)
+	if err != nil {
+		log.L(ctx).Debugf("<-- %s failed (reason=%s): %s", req.Header.Type, reason, err)
+		s.writeError(w, reason, err)
+		return
+	}
+	log.L(ctx).Debugf("<-- %s", req.Header.Type)
+	s.writeJSON(w, http.StatusOK, res)
+}
+
+func (s *server) decode(ctx context.Context, payload json.RawMessage, req interface{}) (ffcapi.ErrorReason, error) {
+	if len(payload) == 0 {
+		payload = json.RawMessage("{}")
+	}
+	if err := json.Unmarshal(payload, req); err != nil {
+		return ffcapi.ErrorReasonInvalidInputs, i18n.NewError(ctx, tmmsgs.MsgRemoteConnectorRequestInvalid, err)
+	}
+	return "", nil
+}
+
+// decodeListenerAdd decodes an add listener request, restoring the checkpoint into the checkpoint type of the connector
+func (s *server) decodeListenerAdd(ctx context.Context, payload json.RawMessage) (*ffcapi.EventListenerAddRequest, ffcapi.ErrorReason, error) {
+	req := &ffcapi.EventListenerAddRequest{
+		Checkpoint: s.api.EventStreamNewCheckpointStruct(),
+	}
+	if reason, err := s.decode(ctx, payload, req); err != nil {
+		return nil, reason, err
+	}
+	return req, "", nil
+}
+
+func (s *server) invoke(ctx context.Context, req *Request) (res interface{}, reason ffcapi.ErrorReason, err error) {
+	switch req.Header.Type {
+	case RequestTypeBlockInfoByHash:
+		var r ffcapi.BlockInfoByHashRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.BlockInfoByHash(ctx, &r)
+		}
+	case RequestTypeBlockInfoByNumber:
+		var r ffcapi.BlockInfoByNumberRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.BlockInfoByNumber(ctx, &r)
+		}
+	case RequestTypeNextNonceForSigner:
+		var r ffcapi.NextNonceForSignerRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.NextNonceForSigner(ctx, &r)
+		}
+	case RequestTypeBalanceForSigner:
+		var r ffcapi.BalanceForSignerRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.BalanceForSigner(ctx, &r)
+		}
+	case RequestTypeGasPriceEstimate:
+		var r ffcapi.GasPriceEstimateRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.GasPriceEstimate(ctx, &r)
+		}
+	case RequestTypeQueryInvoke:
+		var r ffcapi.QueryInvokeRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.QueryInvoke(ctx, &r)
+		}
+	case RequestTypeTransactionReceipt:
+		var r ffcapi.TransactionReceiptRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.TransactionReceipt(ctx, &r)
+		}
+	case RequestTypeTransactionPrepare:
+		var r ffcapi.TransactionPrepareRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.TransactionPrepare(ctx, &r)
+		}
+	case RequestTypeTransactionSend:
+		var r ffcapi.TransactionSendRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.TransactionSend(ctx, &r)
+		}
+	case RequestTypeTransactionSendRaw:
+		var r ffcapi.TransactionSendRawRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.TransactionSendRaw(ctx, &r)
+		}
+	case RequestTypeTransactionDecode:
+		var r ffcapi.TransactionDecodeRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.TransactionDecode(ctx, &r)
+		}
+	case RequestTypeDeployContractPrepare:
+		var r ffcapi.ContractDeployPrepareRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.DeployContractPrepare(ctx, &r)
+		}
+	case RequestTypeEventStreamStopped:
+		var r ffcapi.EventStreamStoppedRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			// The connector requires the stream context is cancelled before the stream is stopped
+			s.stopStream(r.ID)
+			res, reason, err = s.api.EventStreamStopped(ctx, &r)
+		}
+	case RequestTypeEventListenerVerifyOptions:
+		var r ffcapi.EventListenerVerifyOptionsRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.EventListenerVerifyOptions(ctx, &r)
+		}
+	case RequestTypeEventListenerAdd:
+		var r *ffcapi.EventListenerAddRequest
+		if r, reason, err = s.decodeListenerAdd(ctx, req.Payload); err == nil {
+			res, reason, err = s.api.EventListenerAdd(ctx, r)
+		}
+	case RequestTypeEventListenerRemove:
+		var r ffcapi.EventListenerRemoveRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.EventListenerRemove(ctx, &r)
+		}
+	case RequestTypeEventListenerHWM:
+		var r ffcapi.EventListenerHWMRequest
+		if reason, err = s.decode(ctx, req.Payload, &r); err == nil {
+			res, reason, err = s.api.EventListenerHWM(ctx, &r)
+		}
+	case RequestTypeIsLive:
+		res, reason, err = s.api.IsLive(ctx)
+	case RequestTypeIsReady:
+		res, reason, err = s.api.IsReady(ctx)
+	default:
+		return nil, ffcapi.ErrorReasonInvalidInputs, i18n.NewError(ctx, tmmsgs.MsgRemoteConnectorRequestTypeUnknown, req.Header.Type)
+	}
+	return res, reason, err
+}
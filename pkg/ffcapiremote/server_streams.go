@@ -0,0 +1,162 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// serveStream handles a WebSocket connection for a single event stream or block listener.
+// The first message is the request to start the stream, and the stream context is cancelled when the WebSocket closes.
+func (s *server) serveStream(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.L(s.ctx).Errorf("WebSocket upgrade failed: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	var req Request
+	if err := conn.ReadJSON(&req); err != nil {
+		log.L(s.ctx).Errorf("Failed to read stream start request: %s", err)
+		return
+	}
+	ctx := log.WithLogField(s.ctx, "requestId", req.Header.RequestID.String())
+	streamCtx, cancel := context.WithCancel(ctx)
+	events := make(chan *ffcapi.ListenerEvent)
+	blocks := make(chan *ffcapi.BlockHashEvent)
+	id, reason, err := s.startStream(streamCtx, &req, events, blocks)
+	if err != nil {
+		cancel()
+		log.L(ctx).Errorf("Failed to start %s (reason=%s): %s", req.Header.Type, reason, err)
+		_ = conn.WriteJSON(&StreamMessage{Type: StreamMessageTypeError, Error: err.Error(), Reason: reason})
+		return
+	}
+	log.L(ctx).Infof("Started %s %s", req.Header.Type, id)
+
+	ss := &serverStream{cancel: cancel, done: make(chan struct{})}
+	s.mux.Lock()
+	s.streams[*id] = ss
+	s.mux.Unlock()
+	defer func() {
+		cancel()
+		s.mux.Lock()
+		if s.streams[*id] == ss {
+			delete(s.streams, *id)
+		}
+		s.mux.Unlock()
+		close(ss.done)
+		log.L(ctx).Infof("Ended %s %s", req.Header.Type, id)
+	}()
+
+	// We do not expect any further messages, but need to read to detect the WebSocket closing
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				log.L(ctx).Debugf("WebSocket closed: %s", err)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	msg := &StreamMessage{Type: StreamMessageTypeStarted}
+	for {
+		if err := conn.WriteJSON(msg); err != nil {
+			log.L(ctx).Errorf("WebSocket send failed: %s", err)
+			return
+		}
+		select {
+		case event := <-events:
+			msg = &StreamMessage{Type: StreamMessageTypeEvent, Event: event}
+		case block := <-blocks:
+			msg = &StreamMessage{Type: StreamMessageTypeBlock, Block: block}
+		case <-streamCtx.Done():
+			return
+		}
+	}
+}
+
+func (s *server) startStream(ctx context.Context, req *Request, events chan *ffcapi.ListenerEvent, blocks chan *ffcapi.BlockHashEvent) (*fftypes.UUID, ffcapi.ErrorReason, error) {
+	switch req.Header.Type {
+	case RequestTypeEventStreamStart:
+		var payload struct {
+			ID               *fftypes.UUID     `json:"id"`
+			InitialListeners []json.RawMessage `json:"initialListeners"`
+		}
+		if reason, err := s.decode(ctx, req.Payload, &payload); err != nil {
+			return nil, reason, err
+		}
+		if payload.ID == nil {
+			return nil, ffcapi.ErrorReasonInvalidInputs, i18n.NewError(ctx, i18n.MsgMissingRequiredField, "id")
+		}
+		startReq := &ffcapi.EventStreamStartRequest{
+			ID:               payload.ID,
+			StreamContext:    ctx,
+			EventStream:      events,
+			BlockListener:    blocks,
+			InitialListeners: make([]*ffcapi.EventListenerAddRequest, len(payload.InitialListeners)),
+		}
+		for i, l := range payload.InitialListeners {
+			lr, reason, err := s.decodeListenerAdd(ctx, l)
+			if err != nil {
+				return nil, reason, err
+			}
+			startReq.InitialListeners[i] = lr
+		}
+		_, reason, err := s.api.EventStreamStart(ctx, startReq)
+		return payload.ID, reason, err
+	case RequestTypeNewBlockListener:
+		var payload NewBlockListenerPayload
+		if reason, err := s.decode(ctx, req.Payload, &payload); err != nil {
+			return nil, reason, err
+		}
+		if payload.ID == nil {
+			return nil, ffcapi.ErrorReasonInvalidInputs, i18n.NewError(ctx, i18n.MsgMissingRequiredField, "id")
+		}
+		_, reason, err := s.api.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{
+			ID:              payload.ID,
+			ListenerContext: ctx,
+			BlockListener:   blocks,
+		})
+		return payload.ID, reason, err
+	default:
+		return nil, ffcapi.ErrorReasonInvalidInputs, i18n.NewError(ctx, tmmsgs.MsgRemoteConnectorRequestTypeUnknown, req.Header.Type)
+	}
+}
+
+// stopStream cancels the stream with the given ID if it is still running, and waits for it to end
+func (s *server) stopStream(id *fftypes.UUID) {
+	if id == nil {
+		return
+	}
+	s.mux.Lock()
+	ss := s.streams[*id]
+	s.mux.Unlock()
+	if ss != nil {
+		ss.cancel()
+		<-ss.done
+	}
+}
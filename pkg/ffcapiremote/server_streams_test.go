@@ -0,0 +1,134 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func startTestStream(t *testing.T, url, request string) *StreamMessage {
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(url, "http:", "ws:", 1)+StreamPath, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	err = conn.WriteMessage(websocket.TextMessage, []byte(request))
+	assert.NoError(t, err)
+	var msg StreamMessage
+	err = conn.ReadJSON(&msg)
+	assert.NoError(t, err)
+	return &msg
+}
+
+func TestServeStreamStartErrors(t *testing.T) {
+	url, _, mapi := newTestServer(t)
+	mapi.On("EventStreamStart", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+
+	msg := startTestStream(t, url, `{"ffcapi":{"type":"is_live"}}`)
+	assert.Equal(t, StreamMessageTypeError, msg.Type)
+	assert.Regexp(t, "FF21109", msg.Error)
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, msg.Reason)
+
+	msg = startTestStream(t, url, `{"ffcapi":{"type":"event_stream_start"},"payload":[]}`)
+	assert.Regexp(t, "FF21108", msg.Error)
+
+	msg = startTestStream(t, url, `{"ffcapi":{"type":"event_stream_start"},"payload":{}}`)
+	assert.Regexp(t, "FF00112", msg.Error)
+
+	msg = startTestStream(t, url, fmt.Sprintf(`{"ffcapi":{"type":"event_stream_start"},"payload":{"id":"%s","initialListeners":[{"ListenerID":"!uuid"}]}}`, fftypes.NewUUID()))
+	assert.Regexp(t, "FF21108", msg.Error)
+
+	msg = startTestStream(t, url, fmt.Sprintf(`{"ffcapi":{"type":"event_stream_start"},"payload":{"id":"%s"}}`, fftypes.NewUUID()))
+	assert.Regexp(t, "pop", msg.Error)
+
+	msg = startTestStream(t, url, `{"ffcapi":{"type":"new_block_listener"},"payload":[]}`)
+	assert.Regexp(t, "FF21108", msg.Error)
+
+	msg = startTestStream(t, url, `{"ffcapi":{"type":"new_block_listener"},"payload":{}}`)
+	assert.Regexp(t, "FF00112", msg.Error)
+}
+
+func TestServeStreamBadRequest(t *testing.T) {
+	url, _, _ := newTestServer(t)
+
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(url, "http:", "ws:", 1)+StreamPath, nil)
+	assert.NoError(t, err)
+	err = conn.WriteMessage(websocket.TextMessage, []byte(`!!! not JSON`))
+	assert.NoError(t, err)
+	_, _, err = conn.ReadMessage()
+	assert.Error(t, err)
+}
+
+func TestServeStreamNotWebSocket(t *testing.T) {
+	url, _, _ := newTestServer(t)
+
+	res, err := http.Get(url + StreamPath)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestServeStreamClientClose(t *testing.T) {
+	url, s, mapi := newTestServer(t)
+	listenerID := fftypes.NewUUID()
+
+	started := make(chan *ffcapi.NewBlockListenerRequest, 1)
+	mapi.On("NewBlockListener", mock.Anything, mock.Anything).Return(&ffcapi.NewBlockListenerResponse{}, ffcapi.ErrorReason(""), nil).Run(func(args mock.Arguments) {
+		started <- args[1].(*ffcapi.NewBlockListenerRequest)
+	})
+
+	msg := startTestStream(t, url, fmt.Sprintf(`{"ffcapi":{"type":"new_block_listener"},"payload":{"id":"%s"}}`, listenerID))
+	assert.Equal(t, StreamMessageTypeStarted, msg.Type)
+	startReq := <-started
+
+	// The listener ends when the client closes the WebSocket
+	<-startReq.ListenerContext.Done()
+	s.stopStream(listenerID)
+	s.stopStream(nil)
+}
+
+func TestServeStreamSendFail(t *testing.T) {
+	url, _, mapi := newTestServer(t)
+	streamID := fftypes.NewUUID()
+
+	started := make(chan *ffcapi.EventStreamStartRequest, 1)
+	mapi.On("EventStreamStart", mock.Anything, mock.Anything).Return(&ffcapi.EventStreamStartResponse{}, ffcapi.ErrorReason(""), nil).Run(func(args mock.Arguments) {
+		started <- args[1].(*ffcapi.EventStreamStartRequest)
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(url, "http:", "ws:", 1)+StreamPath, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+	err = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"ffcapi":{"type":"event_stream_start"},"payload":{"id":"%s"}}`, streamID)))
+	assert.NoError(t, err)
+	var msg StreamMessage
+	err = conn.ReadJSON(&msg)
+	assert.NoError(t, err)
+	assert.Equal(t, StreamMessageTypeStarted, msg.Type)
+	startReq := <-started
+
+	// An event that cannot be serialized ends the stream
+	startReq.EventStream <- &ffcapi.ListenerEvent{Event: &ffcapi.Event{Data: fftypes.JSONAnyPtr("!not JSON")}}
+	<-startReq.StreamContext.Done()
+}
@@ -0,0 +1,100 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapiremote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestServer(t *testing.T) (string, *server, *ffcapimocks.API) {
+	mapi := &ffcapimocks.API{}
+	mapi.On("EventStreamNewCheckpointStruct").Return(NewCheckpoint()).Maybe()
+	s := NewServer(context.Background(), mapi).(*server)
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		s.Close()
+		ts.Close()
+		mapi.AssertExpectations(t)
+	})
+	return ts.URL, s, mapi
+}
+
+func postTestRequest(t *testing.T, url, body string) (int, *ErrorResponse) {
+	res, err := http.Post(url, "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	var errRes ErrorResponse
+	err = json.NewDecoder(res.Body).Decode(&errRes)
+	assert.NoError(t, err)
+	return res.StatusCode, &errRes
+}
+
+func TestServeRequestBadJSON(t *testing.T) {
+	url, _, _ := newTestServer(t)
+
+	status, errRes := postTestRequest(t, url, `!!! not JSON`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Regexp(t, "FF21108", errRes.Error)
+	assert.Equal(t, "invalid_inputs", string(errRes.Reason))
+}
+
+func TestServeRequestUnknownType(t *testing.T) {
+	url, _, _ := newTestServer(t)
+
+	status, errRes := postTestRequest(t, url, `{"ffcapi":{"type":"unknown"}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Regexp(t, "FF21109.*unknown", errRes.Error)
+}
+
+func TestServeRequestBadPayload(t *testing.T) {
+	url, _, _ := newTestServer(t)
+
+	status, errRes := postTestRequest(t, url, `{"ffcapi":{"type":"block_info_by_hash"},"payload":[]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Regexp(t, "FF21108", errRes.Error)
+
+	status, errRes = postTestRequest(t, url, `{"ffcapi":{"type":"event_listener_add"},"payload":{"ListenerID":"!uuid"}}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Regexp(t, "FF21108", errRes.Error)
+}
+
+func TestServeRequestNoPayload(t *testing.T) {
+	url, _, mapi := newTestServer(t)
+	mapi.On("GasPriceEstimate", mock.Anything, &ffcapi.GasPriceEstimateRequest{}).
+		Return(&ffcapi.GasPriceEstimateResponse{GasPrice: fftypes.JSONAnyPtr(`12345`)}, ffcapi.ErrorReason(""), nil)
+
+	res, err := http.Post(url, "application/json", strings.NewReader(`{"ffcapi":{"type":"gas_price_estimate"}}`))
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	var gper ffcapi.GasPriceEstimateResponse
+	err = json.NewDecoder(res.Body).Decode(&gper)
+	assert.NoError(t, err)
+	assert.Equal(t, `12345`, gper.GasPrice.String())
+}
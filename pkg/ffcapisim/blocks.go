@@ -0,0 +1,55 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// BlockInfoByHash only returns blocks on the canonical chain, so a block replaced by a reorg is not found
+func (s *simulator) BlockInfoByHash(ctx context.Context, req *ffcapi.BlockInfoByHashRequest) (*ffcapi.BlockInfoByHashResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodBlockInfoByHash); err != nil {
+		return nil, reason, err
+	}
+	b := s.chain.byHash[req.BlockHash]
+	if b == nil {
+		return nil, ffcapi.ErrorReasonNotFound, i18n.NewError(ctx, tmmsgs.MsgSimulatorBlockNotFound, req.BlockHash)
+	}
+	return &ffcapi.BlockInfoByHashResponse{BlockInfo: *b.info()}, "", nil
+}
+
+func (s *simulator) BlockInfoByNumber(ctx context.Context, req *ffcapi.BlockInfoByNumberRequest) (*ffcapi.BlockInfoByNumberResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodBlockInfoByNumber); err != nil {
+		return nil, reason, err
+	}
+	var b *simBlock
+	if req.BlockNumber != nil {
+		b = s.chain.blockByNumber(req.BlockNumber.Uint64())
+	}
+	if b == nil {
+		return nil, ffcapi.ErrorReasonNotFound, i18n.NewError(ctx, tmmsgs.MsgSimulatorBlockNotFound, req.BlockNumber)
+	}
+	return &ffcapi.BlockInfoByNumberResponse{BlockInfo: *b.info()}, "", nil
+}
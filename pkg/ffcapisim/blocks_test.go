@@ -0,0 +1,52 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockInfo(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{}`))
+	mined := s.MineBlock()
+
+	byNumber, _, err := s.BlockInfoByNumber(ctx, &ffcapi.BlockInfoByNumberRequest{BlockNumber: fftypes.NewFFBigInt(1)})
+	assert.NoError(t, err)
+	assert.Equal(t, *mined, byNumber.BlockInfo)
+	assert.Len(t, byNumber.TransactionHashes, 1)
+
+	byHash, _, err := s.BlockInfoByHash(ctx, &ffcapi.BlockInfoByHashRequest{BlockHash: mined.BlockHash})
+	assert.NoError(t, err)
+	assert.Equal(t, *mined, byHash.BlockInfo)
+
+	_, reason, err := s.BlockInfoByNumber(ctx, &ffcapi.BlockInfoByNumberRequest{BlockNumber: fftypes.NewFFBigInt(2)})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21120", err)
+
+	_, reason, err = s.BlockInfoByNumber(ctx, &ffcapi.BlockInfoByNumberRequest{})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21120", err)
+
+	_, reason, err = s.BlockInfoByHash(ctx, &ffcapi.BlockInfoByHashRequest{BlockHash: "0x12345"})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21120", err)
+}
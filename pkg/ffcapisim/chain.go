@@ -0,0 +1,292 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// SystemAddress is the sender of the transactions that carry the events emitted with EmitEvent
+const SystemAddress = "0x0000000000000000000000000000000000000000"
+
+type simLog struct {
+	address string
+	event   string
+	data    *fftypes.JSONAny
+}
+
+type simTransaction struct {
+	raw      *RawTransaction
+	hash     string
+	seq      int64
+	nonce    uint64
+	gas      *big.Int
+	gasPrice *big.Int
+	value    *big.Int
+	system   bool
+	logs     []*simLog
+}
+
+// simReceipt is the result of mining a transaction into a particular block. A transaction that is
+// mined again after a reorg has a new receipt, and the receipt in the replaced block is unchanged.
+type simReceipt struct {
+	tx              *simTransaction
+	block           *simBlock
+	index           int
+	success         bool
+	contractAddress string
+}
+
+type simBlock struct {
+	number     uint64
+	hash       string
+	parentHash string
+	timestamp  *fftypes.FFTime
+	receipts   []*simReceipt
+}
+
+type chain struct {
+	initialBalance *big.Int
+	blocks         []*simBlock
+	byHash         map[string]*simBlock
+	orphans        map[string]*simBlock
+	pool           map[string]*simTransaction
+	mined          map[string]*simReceipt
+	nonces         map[string]uint64
+	balances       map[string]*big.Int
+	pendingLogs    []*simLog
+	seq            int64
+	forks          int
+}
+
+func newChain(initialBalance *big.Int) *chain {
+	c := &chain{
+		initialBalance: initialBalance,
+		byHash:         make(map[string]*simBlock),
+		orphans:        make(map[string]*simBlock),
+		pool:           make(map[string]*simTransaction),
+		mined:          make(map[string]*simReceipt),
+		nonces:         make(map[string]uint64),
+		balances:       make(map[string]*big.Int),
+	}
+	genesis := &simBlock{
+		number:     0,
+		parentHash: hashOf("genesis"),
+		timestamp:  fftypes.Now(),
+	}
+	genesis.hash = hashOf(genesis.parentHash)
+	c.appendBlock(genesis)
+	return c
+}
+
+func hashOf(values ...interface{}) string {
+	h := sha256.New()
+	for _, v := range values {
+		fmt.Fprintf(h, "%v/", v)
+	}
+	return "0x" + hex.EncodeToString(h.Sum(nil))
+}
+
+func contractAddress(from string, nonce uint64) string {
+	return hashOf("contract", from, nonce)[0:42]
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (b *simBlock) info() *ffcapi.BlockInfo {
+	txHashes := make([]string, len(b.receipts))
+	for i, r := range b.receipts {
+		txHashes[i] = r.tx.hash
+	}
+	return &ffcapi.BlockInfo{
+		BlockNumber:       fftypes.NewFFBigInt(int64(b.number)),
+		BlockHash:         b.hash,
+		ParentHash:        b.parentHash,
+		TransactionHashes: txHashes,
+	}
+}
+
+func (tx *simTransaction) cost() *big.Int {
+	cost := new(big.Int).Mul(tx.gas, tx.gasPrice)
+	return cost.Add(cost, tx.value)
+}
+
+func (c *chain) head() *simBlock {
+	return c.blocks[len(c.blocks)-1]
+}
+
+func (c *chain) blockByNumber(number uint64) *simBlock {
+	if number >= uint64(len(c.blocks)) {
+		return nil
+	}
+	return c.blocks[number]
+}
+
+func (c *chain) balance(address string) *big.Int {
+	if b, ok := c.balances[address]; ok {
+		return b
+	}
+	return c.initialBalance
+}
+
+func (c *chain) addBalance(address string, delta *big.Int) {
+	c.balances[address] = new(big.Int).Add(c.balance(address), delta)
+}
+
+// pendingNonce is the next nonce for a signer, including the transactions in the pool with consecutive nonces
+func (c *chain) pendingNonce(signer string) uint64 {
+	nonce := c.nonces[signer]
+	for c.pooledTX(signer, nonce) != nil {
+		nonce++
+	}
+	return nonce
+}
+
+func (c *chain) pooledTX(signer string, nonce uint64) *simTransaction {
+	for _, tx := range c.pool {
+		if !tx.system && tx.raw.From == signer && tx.nonce == nonce {
+			return tx
+		}
+	}
+	return nil
+}
+
+func (c *chain) addToPool(tx *simTransaction) {
+	c.seq++
+	tx.seq = c.seq
+	c.pool[tx.hash] = tx
+}
+
+func (c *chain) appendBlock(b *simBlock) {
+	c.blocks = append(c.blocks, b)
+	c.byHash[b.hash] = b
+}
+
+func (c *chain) poolBySeq() []*simTransaction {
+	txs := make([]*simTransaction, 0, len(c.pool))
+	for _, tx := range c.pool {
+		txs = append(txs, tx)
+	}
+	sort.Slice(txs, func(i, j int) bool { return txs[i].seq < txs[j].seq })
+	return txs
+}
+
+// mineBlock includes every transaction from the pool that is next in nonce order for its signer, pays at least the
+// gas price, and can be afforded by its signer. Then the events emitted since the last block are included in a final
+// transaction from the SystemAddress.
+func (c *chain) mineBlock(gasPrice *big.Int, reverting map[string]bool) *simBlock {
+	parent := c.head()
+	b := &simBlock{
+		number:     parent.number + 1,
+		parentHash: parent.hash,
+		timestamp:  fftypes.Now(),
+	}
+	if len(c.pendingLogs) > 0 {
+		c.addToPool(&simTransaction{
+			raw:    &RawTransaction{From: SystemAddress},
+			hash:   hashOf("events", c.seq, len(c.pendingLogs)),
+			system: true,
+			logs:   c.pendingLogs,
+		})
+		c.pendingLogs = nil
+	}
+	for included := true; included; {
+		included = false
+		for _, tx := range c.poolBySeq() {
+			if tx.system ||
+				(tx.nonce == c.nonces[tx.raw.From] && tx.gasPrice.Cmp(gasPrice) >= 0 && c.balance(tx.raw.From).Cmp(tx.cost()) >= 0) {
+				c.execute(b, tx, reverting)
+				included = true
+			}
+		}
+	}
+	txHashes := make([]string, len(b.receipts))
+	for i, r := range b.receipts {
+		txHashes[i] = r.tx.hash
+	}
+	b.hash = hashOf(b.parentHash, b.number, c.forks, txHashes)
+	c.appendBlock(b)
+	return b
+}
+
+func (c *chain) execute(b *simBlock, tx *simTransaction, reverting map[string]bool) {
+	r := &simReceipt{
+		tx:      tx,
+		block:   b,
+		index:   len(b.receipts),
+		success: tx.system || !reverting[tx.raw.To],
+	}
+	if !tx.system {
+		to := tx.raw.To
+		if to == "" {
+			to = contractAddress(tx.raw.From, tx.nonce)
+			r.contractAddress = to
+		}
+		c.addBalance(tx.raw.From, new(big.Int).Neg(new(big.Int).Mul(tx.gas, tx.gasPrice)))
+		if r.success {
+			c.addBalance(tx.raw.From, new(big.Int).Neg(tx.value))
+			c.addBalance(to, tx.value)
+		}
+		c.nonces[tx.raw.From]++
+	}
+	b.receipts = append(b.receipts, r)
+	delete(c.pool, tx.hash)
+	c.mined[tx.hash] = r
+}
+
+// rewind removes the last depth blocks from the chain, returning their transactions to the pool
+func (c *chain) rewind(depth int) {
+	for i := 0; i < depth; i++ {
+		b := c.head()
+		c.blocks = c.blocks[0 : len(c.blocks)-1]
+		delete(c.byHash, b.hash)
+		c.orphans[b.hash] = b
+		for j := len(b.receipts) - 1; j >= 0; j-- {
+			r := b.receipts[j]
+			tx := r.tx
+			if !tx.system {
+				to := tx.raw.To
+				if r.contractAddress != "" {
+					to = r.contractAddress
+				}
+				c.addBalance(tx.raw.From, new(big.Int).Mul(tx.gas, tx.gasPrice))
+				if r.success {
+					c.addBalance(tx.raw.From, tx.value)
+					c.addBalance(to, new(big.Int).Neg(tx.value))
+				}
+				c.nonces[tx.raw.From]--
+			}
+			delete(c.mined, tx.hash)
+			c.pool[tx.hash] = tx
+		}
+	}
+	c.forks++
+}
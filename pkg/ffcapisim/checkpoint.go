@@ -0,0 +1,49 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// Checkpoint is the position of a listener on the simulated chain. The checkpoint of an event is the position
+// of the event, and the high water mark of a listener that has scanned a block is the start of the next block,
+// with a TransactionIndex and LogIndex of -1.
+type Checkpoint struct {
+	Block            uint64 `json:"block"`
+	TransactionIndex int64  `json:"transactionIndex"`
+	LogIndex         int64  `json:"logIndex"`
+}
+
+func (s *simulator) EventStreamNewCheckpointStruct() ffcapi.EventListenerCheckpoint {
+	return &Checkpoint{}
+}
+
+func blockStartCheckpoint(block uint64) *Checkpoint {
+	return &Checkpoint{Block: block, TransactionIndex: -1, LogIndex: -1}
+}
+
+func (cp *Checkpoint) LessThan(b ffcapi.EventListenerCheckpoint) bool {
+	bcp, ok := b.(*Checkpoint)
+	if !ok || bcp == nil {
+		return false
+	}
+	return cp.Block < bcp.Block ||
+		(cp.Block == bcp.Block &&
+			(cp.TransactionIndex < bcp.TransactionIndex ||
+				(cp.TransactionIndex == bcp.TransactionIndex && cp.LogIndex < bcp.LogIndex)))
+}
@@ -0,0 +1,102 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+)
+
+const (
+	BlockPeriod    = "blockPeriod"    // the interval at which blocks are mined, or zero to only mine blocks when MineBlock is called
+	GasPrice       = "gasPrice"       // the initial gas price - transactions submitted with a lower gas price stay in the pool until the gas price drops
+	GasEstimate    = "gasEstimate"    // the gas returned when estimating a transaction that was prepared without gas
+	InitialBalance = "initialBalance" // the balance every signer starts with
+)
+
+const (
+	defaultBlockPeriod    = "1s"
+	defaultGasPrice       = "0"
+	defaultGasEstimate    = "21000"
+	defaultInitialBalance = "1000000000000000000000000"
+)
+
+// Options configure a simulator created with NewSimulator. Any nil/zero field uses the default, except
+// for BlockPeriod where zero means blocks are only mined when MineBlock is called - which is usually what
+// is wanted from a Go test.
+type Options struct {
+	BlockPeriod    time.Duration
+	GasPrice       *big.Int
+	GasEstimate    *big.Int
+	InitialBalance *big.Int
+}
+
+// InitConfig initializes the configuration of a simulator run as a dev connector
+func InitConfig(conf config.Section) {
+	conf.AddKnownKey(BlockPeriod, defaultBlockPeriod)
+	conf.AddKnownKey(GasPrice, defaultGasPrice)
+	conf.AddKnownKey(GasEstimate, defaultGasEstimate)
+	conf.AddKnownKey(InitialBalance, defaultInitialBalance)
+}
+
+// OptionsFromConfig reads the options for a simulator from a configuration section initialized with InitConfig
+func OptionsFromConfig(ctx context.Context, conf config.Section) (options *Options, err error) {
+	options = &Options{
+		BlockPeriod: conf.GetDuration(BlockPeriod),
+	}
+	if options.GasPrice, err = parseBigIntConfig(ctx, conf, GasPrice); err != nil {
+		return nil, err
+	}
+	if options.GasEstimate, err = parseBigIntConfig(ctx, conf, GasEstimate); err != nil {
+		return nil, err
+	}
+	if options.InitialBalance, err = parseBigIntConfig(ctx, conf, InitialBalance); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+func parseBigIntConfig(ctx context.Context, conf config.Section, key string) (*big.Int, error) {
+	value := conf.GetString(key)
+	i, ok := new(big.Int).SetString(value, 0)
+	if !ok || i.Sign() < 0 {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgSimulatorConfigInvalid, value, key)
+	}
+	return i, nil
+}
+
+func (o *Options) withDefaults() *Options {
+	resolved := &Options{}
+	if o != nil {
+		*resolved = *o
+	}
+	if resolved.GasPrice == nil {
+		resolved.GasPrice, _ = new(big.Int).SetString(defaultGasPrice, 10)
+	}
+	if resolved.GasEstimate == nil {
+		resolved.GasEstimate, _ = new(big.Int).SetString(defaultGasEstimate, 10)
+	}
+	if resolved.InitialBalance == nil {
+		resolved.InitialBalance, _ = new(big.Int).SetString(defaultInitialBalance, 10)
+	}
+	return resolved
+}
@@ -0,0 +1,82 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestConfig() config.Section {
+	tmconfig.Reset()
+	conf := config.RootSection("unittest.simulator")
+	InitConfig(conf)
+	return conf
+}
+
+func TestOptionsFromConfigDefaults(t *testing.T) {
+	options, err := OptionsFromConfig(context.Background(), newTestConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, 1*time.Second, options.BlockPeriod)
+	assert.Equal(t, int64(0), options.GasPrice.Int64())
+	assert.Equal(t, int64(21000), options.GasEstimate.Int64())
+	assert.Equal(t, "1000000000000000000000000", options.InitialBalance.String())
+}
+
+func TestOptionsFromConfigCustom(t *testing.T) {
+	conf := newTestConfig()
+	conf.Set(BlockPeriod, "0")
+	conf.Set(GasPrice, "0x3b9aca00")
+	conf.Set(GasEstimate, "100000")
+	conf.Set(InitialBalance, "5")
+	options, err := OptionsFromConfig(context.Background(), conf)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), options.BlockPeriod)
+	assert.Equal(t, big.NewInt(1000000000), options.GasPrice)
+	assert.Equal(t, big.NewInt(100000), options.GasEstimate)
+	assert.Equal(t, big.NewInt(5), options.InitialBalance)
+}
+
+func TestOptionsFromConfigInvalid(t *testing.T) {
+	for _, key := range []string{GasPrice, GasEstimate, InitialBalance} {
+		conf := newTestConfig()
+		conf.Set(key, "-1")
+		_, err := OptionsFromConfig(context.Background(), conf)
+		assert.Regexp(t, "FF21113.*"+key, err)
+	}
+}
+
+func TestNewSimulatorFromConfig(t *testing.T) {
+	conf := newTestConfig()
+	conf.Set(BlockPeriod, "1ms")
+	s, err := NewSimulatorFromConfig(context.Background(), conf)
+	assert.NoError(t, err)
+	defer s.Close()
+	for s.BlockNumber() < 2 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	conf.Set(GasPrice, "wrong")
+	_, err = NewSimulatorFromConfig(context.Background(), conf)
+	assert.Regexp(t, "FF21113", err)
+}
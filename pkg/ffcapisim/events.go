@@ -0,0 +1,530 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// reorgTrackingDepth is how many of the most recent block hashes are kept for each listener, to detect reorgs
+const reorgTrackingDepth = 100
+
+// EventInfo is the connector specific information included with each event
+type EventInfo struct {
+	Address      string `json:"address"`
+	ListenerName string `json:"listenerName"`
+}
+
+type filter struct {
+	Address string `json:"address,omitempty"`
+	Event   string `json:"event,omitempty"`
+}
+
+// subscription tracks the blocks notified to a block listener, or the block listener of an event stream
+type subscription struct {
+	ctx      context.Context
+	cancel   func()
+	blocks   chan<- *ffcapi.BlockHashEvent
+	head     int64
+	hashes   map[uint64]string
+	gapEpoch int
+	notify   chan struct{}
+	done     chan struct{}
+}
+
+type listener struct {
+	id         *fftypes.UUID
+	name       string
+	filters    []*filter
+	head       int64
+	hashes     map[uint64]string
+	start      *Checkpoint
+	checkpoint *Checkpoint
+}
+
+type eventStream struct {
+	*subscription
+	id        *fftypes.UUID
+	events    chan<- *ffcapi.ListenerEvent
+	listeners []*listener
+}
+
+// newSubscription must be called with the lock held
+func (s *simulator) newSubscription(ctx context.Context, blocks chan<- *ffcapi.BlockHashEvent) *subscription {
+	head := s.chain.head()
+	sub := &subscription{
+		blocks:   blocks,
+		head:     int64(head.number),
+		hashes:   map[uint64]string{head.number: head.hash},
+		gapEpoch: s.gapEpoch,
+		notify:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	sub.ctx, sub.cancel = context.WithCancel(ctx)
+	return sub
+}
+
+// notifySubscriptions must be called with the lock held
+func (s *simulator) notifySubscriptions() {
+	for _, es := range s.streams {
+		es.wake()
+	}
+	for _, bs := range s.blockListeners {
+		bs.wake()
+	}
+}
+
+func (sub *subscription) wake() {
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *subscription) wait() bool {
+	select {
+	case <-sub.notify:
+		return true
+	case <-sub.ctx.Done():
+		return false
+	}
+}
+
+func trackBlock(hashes map[uint64]string, b *simBlock) {
+	hashes[b.number] = b.hash
+	if b.number >= reorgTrackingDepth {
+		delete(hashes, b.number-reorgTrackingDepth)
+	}
+}
+
+// forkPoint walks back from head through the block hashes that were recorded, to the last block that is still
+// on the canonical chain. The replaced blocks are returned in descending order.
+func (c *chain) forkPoint(head int64, hashes map[uint64]string) (int64, []*simBlock) {
+	var replaced []*simBlock
+	for head >= 0 {
+		hash, ok := hashes[uint64(head)]
+		if !ok {
+			break
+		}
+		if b := c.blockByNumber(uint64(head)); b != nil && b.hash == hash {
+			break
+		}
+		replaced = append(replaced, c.orphans[hash])
+		delete(hashes, uint64(head))
+		head--
+	}
+	return head, replaced
+}
+
+// nextBlockEvent must be called with the lock held, and returns the notification of the new blocks since the
+// last notification (if any)
+func (s *simulator) nextBlockEvent(sub *subscription) *ffcapi.BlockHashEvent {
+	if sub.blocks == nil {
+		return nil
+	}
+	head, _ := s.chain.forkPoint(sub.head, sub.hashes)
+	hashes := []string{}
+	for n := head + 1; n <= int64(s.chain.head().number); n++ {
+		b := s.chain.blocks[n]
+		hashes = append(hashes, b.hash)
+		trackBlock(sub.hashes, b)
+		head = n
+	}
+	sub.head = head
+	gapPotential := sub.gapEpoch != s.gapEpoch
+	sub.gapEpoch = s.gapEpoch
+	if len(hashes) == 0 && !gapPotential {
+		return nil
+	}
+	return &ffcapi.BlockHashEvent{BlockHashes: hashes, GapPotential: gapPotential}
+}
+
+func (l *listener) matches(lg *simLog) bool {
+	if len(l.filters) == 0 {
+		return true
+	}
+	for _, f := range l.filters {
+		if (f.Address == "" || f.Address == lg.address) && (f.Event == "" || f.Event == lg.event) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockEvents returns the events in a block that match the listener, with their checkpoints
+func (l *listener) blockEvents(b *simBlock) []*ffcapi.ListenerEvent {
+	var events []*ffcapi.ListenerEvent
+	for _, r := range b.receipts {
+		for i, lg := range r.tx.logs {
+			if !l.matches(lg) {
+				continue
+			}
+			cp := &Checkpoint{Block: b.number, TransactionIndex: int64(r.index), LogIndex: int64(i)}
+			if l.start != nil && !l.start.LessThan(cp) {
+				continue
+			}
+			events = append(events, &ffcapi.ListenerEvent{
+				Checkpoint: cp,
+				Event: &ffcapi.Event{
+					ID: ffcapi.EventID{
+						ListenerID:       l.id,
+						Signature:        lg.event,
+						BlockHash:        b.hash,
+						BlockNumber:      fftypes.FFuint64(b.number),
+						TransactionHash:  r.tx.hash,
+						TransactionIndex: fftypes.FFuint64(r.index),
+						LogIndex:         fftypes.FFuint64(i),
+						Timestamp:        b.timestamp,
+					},
+					Info: &EventInfo{
+						Address:      lg.address,
+						ListenerName: l.name,
+					},
+					Data: lg.data,
+				},
+			})
+		}
+	}
+	return events
+}
+
+// nextListenerEvents must be called with the lock held. It returns removed events for the events delivered
+// from blocks that have been replaced by a reorg, followed by the events from the blocks that have been mined
+// since the listener last scanned the chain.
+func (s *simulator) nextListenerEvents(es *eventStream) []*ffcapi.ListenerEvent {
+	var events []*ffcapi.ListenerEvent
+	for _, l := range es.listeners {
+		head, replaced := s.chain.forkPoint(l.head, l.hashes)
+		for _, b := range replaced {
+			blockEvents := l.blockEvents(b)
+			for i := len(blockEvents) - 1; i >= 0; i-- {
+				removed := blockEvents[i]
+				events = append(events, &ffcapi.ListenerEvent{Event: removed.Event, Removed: true})
+			}
+		}
+		if len(replaced) > 0 {
+			l.checkpoint = blockStartCheckpoint(uint64(head + 1))
+		}
+		l.head = head
+		for n := head + 1; n <= int64(s.chain.head().number); n++ {
+			b := s.chain.blocks[n]
+			for _, ev := range l.blockEvents(b) {
+				if l.checkpoint == nil || l.checkpoint.LessThan(ev.Checkpoint) {
+					events = append(events, ev)
+				}
+			}
+			trackBlock(l.hashes, b)
+			l.head = n
+			l.checkpoint = blockStartCheckpoint(b.number + 1)
+		}
+	}
+	return events
+}
+
+func (s *simulator) runEventStream(es *eventStream) {
+	defer close(es.done)
+	for {
+		s.mux.Lock()
+		blockEvent := s.nextBlockEvent(es.subscription)
+		events := s.nextListenerEvents(es)
+		s.mux.Unlock()
+		if blockEvent != nil {
+			select {
+			case es.blocks <- blockEvent:
+			case <-es.ctx.Done():
+				return
+			}
+		}
+		for _, ev := range events {
+			select {
+			case es.events <- ev:
+			case <-es.ctx.Done():
+				return
+			}
+		}
+		if blockEvent == nil && len(events) == 0 && !es.wait() {
+			log.L(s.ctx).Debugf("Event stream %s stopped", es.id)
+			return
+		}
+	}
+}
+
+func (s *simulator) runBlockListener(bs *subscription) {
+	defer func() {
+		s.mux.Lock()
+		for i, existing := range s.blockListeners {
+			if existing == bs {
+				s.blockListeners = append(s.blockListeners[0:i], s.blockListeners[i+1:]...)
+				break
+			}
+		}
+		s.mux.Unlock()
+		close(bs.done)
+	}()
+	for {
+		s.mux.Lock()
+		blockEvent := s.nextBlockEvent(bs)
+		s.mux.Unlock()
+		if blockEvent != nil {
+			select {
+			case bs.blocks <- blockEvent:
+			case <-bs.ctx.Done():
+				return
+			}
+		} else if !bs.wait() {
+			return
+		}
+	}
+}
+
+func (s *simulator) parseListenerOptions(ctx context.Context, options *ffcapi.EventListenerOptions) ([]*filter, error) {
+	filters := make([]*filter, len(options.Filters))
+	for i, f := range options.Filters {
+		if err := json.Unmarshal(f.Bytes(), &filters[i]); err != nil || filters[i] == nil {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgSimulatorListenerOptionsInvalid, f.String())
+		}
+	}
+	switch options.FromBlock {
+	case "", ffcapi.FromBlockEarliest, ffcapi.FromBlockLatest:
+	default:
+		if _, err := strconv.ParseUint(options.FromBlock, 0, 64); err != nil {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgSimulatorListenerOptionsInvalid, options.FromBlock)
+		}
+	}
+	return filters, nil
+}
+
+// newListener must be called with the lock held
+func (s *simulator) newListener(ctx context.Context, req *ffcapi.EventListenerAddRequest) (*listener, error) {
+	filters, err := s.parseListenerOptions(ctx, &req.EventListenerOptions)
+	if err != nil {
+		return nil, err
+	}
+	l := &listener{
+		id:      req.ListenerID,
+		name:    req.Name,
+		filters: filters,
+		hashes:  make(map[uint64]string),
+	}
+	if cp, ok := req.Checkpoint.(*Checkpoint); ok && cp != nil {
+		// Resume after the checkpoint
+		l.start = cp
+		l.head = int64(cp.Block) - 1
+	} else {
+		switch req.FromBlock {
+		case ffcapi.FromBlockEarliest:
+			l.head = -1
+		case "", ffcapi.FromBlockLatest:
+			head := s.chain.head()
+			l.head = int64(head.number)
+			trackBlock(l.hashes, head)
+		default:
+			fromBlock, _ := strconv.ParseUint(req.FromBlock, 0, 64)
+			l.head = int64(fromBlock) - 1
+		}
+	}
+	if l.head >= 0 {
+		l.checkpoint = blockStartCheckpoint(uint64(l.head + 1))
+	}
+	return l, nil
+}
+
+func (es *eventStream) listener(listenerID *fftypes.UUID) (int, *listener) {
+	for i, l := range es.listeners {
+		if l.id.Equals(listenerID) {
+			return i, l
+		}
+	}
+	return -1, nil
+}
+
+// getListener must be called with the lock held
+func (s *simulator) getListener(ctx context.Context, streamID, listenerID *fftypes.UUID) (*eventStream, int, *listener, error) {
+	var es *eventStream
+	if streamID != nil {
+		es = s.streams[*streamID]
+	}
+	if es == nil {
+		return nil, -1, nil, i18n.NewError(ctx, tmmsgs.MsgSimulatorStreamNotFound, streamID)
+	}
+	i, l := es.listener(listenerID)
+	if l == nil {
+		return es, -1, nil, i18n.NewError(ctx, tmmsgs.MsgSimulatorListenerNotFound, listenerID, streamID)
+	}
+	return es, i, l, nil
+}
+
+func (s *simulator) EventStreamStart(ctx context.Context, req *ffcapi.EventStreamStartRequest) (*ffcapi.EventStreamStartResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodEventStreamStart); err != nil {
+		return nil, reason, err
+	}
+	if req.ID == nil || s.streams[*req.ID] != nil {
+		return nil, ffcapi.ErrorReasonInvalidInputs, i18n.NewError(ctx, tmmsgs.MsgSimulatorStreamAlreadyStarted, req.ID)
+	}
+	es := &eventStream{
+		subscription: s.newSubscription(req.StreamContext, req.BlockListener),
+		id:           req.ID,
+		events:       req.EventStream,
+	}
+	for _, lReq := range req.InitialListeners {
+		l, err := s.newListener(ctx, lReq)
+		if err != nil {
+			es.cancel()
+			return nil, ffcapi.ErrorReasonInvalidInputs, err
+		}
+		es.listeners = append(es.listeners, l)
+	}
+	s.streams[*req.ID] = es
+	log.L(ctx).Infof("Started event stream %s with %d listeners", es.id, len(es.listeners))
+	go s.runEventStream(es)
+	return &ffcapi.EventStreamStartResponse{}, "", nil
+}
+
+func (s *simulator) EventStreamStopped(ctx context.Context, req *ffcapi.EventStreamStoppedRequest) (*ffcapi.EventStreamStoppedResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	if reason, err := s.checkInjectedError(ctx, MethodEventStreamStopped); err != nil {
+		s.mux.Unlock()
+		return nil, reason, err
+	}
+	var es *eventStream
+	if req.ID != nil {
+		es = s.streams[*req.ID]
+		delete(s.streams, *req.ID)
+	}
+	s.mux.Unlock()
+	if es != nil {
+		es.cancel()
+		<-es.done
+		log.L(ctx).Infof("Removed stopped event stream %s", es.id)
+	}
+	return &ffcapi.EventStreamStoppedResponse{}, "", nil
+}
+
+func (s *simulator) EventListenerVerifyOptions(ctx context.Context, req *ffcapi.EventListenerVerifyOptionsRequest) (*ffcapi.EventListenerVerifyOptionsResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodEventListenerVerifyOptions); err != nil {
+		return nil, reason, err
+	}
+	filters, err := s.parseListenerOptions(ctx, &req.EventListenerOptions)
+	if err != nil {
+		return nil, ffcapi.ErrorReasonInvalidInputs, err
+	}
+	events := make([]string, len(filters))
+	for i, f := range filters {
+		events[i] = f.Event
+		if f.Event == "" {
+			events[i] = "*"
+		}
+	}
+	signature := strings.Join(events, ",")
+	if signature == "" {
+		signature = "*"
+	}
+	resolvedOptions := fftypes.JSONAny("{}")
+	if !req.Options.IsNil() {
+		resolvedOptions = *req.Options
+	}
+	return &ffcapi.EventListenerVerifyOptionsResponse{
+		ResolvedSignature: signature,
+		ResolvedOptions:   resolvedOptions,
+	}, "", nil
+}
+
+func (s *simulator) EventListenerAdd(ctx context.Context, req *ffcapi.EventListenerAddRequest) (*ffcapi.EventListenerAddResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodEventListenerAdd); err != nil {
+		return nil, reason, err
+	}
+	var es *eventStream
+	if req.StreamID != nil {
+		es = s.streams[*req.StreamID]
+	}
+	if es == nil {
+		return nil, ffcapi.ErrorReasonNotFound, i18n.NewError(ctx, tmmsgs.MsgSimulatorStreamNotFound, req.StreamID)
+	}
+	l, err := s.newListener(ctx, req)
+	if err != nil {
+		return nil, ffcapi.ErrorReasonInvalidInputs, err
+	}
+	if i, existing := es.listener(req.ListenerID); existing != nil {
+		es.listeners[i] = l
+	} else {
+		es.listeners = append(es.listeners, l)
+	}
+	es.wake()
+	return &ffcapi.EventListenerAddResponse{}, "", nil
+}
+
+func (s *simulator) EventListenerRemove(ctx context.Context, req *ffcapi.EventListenerRemoveRequest) (*ffcapi.EventListenerRemoveResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodEventListenerRemove); err != nil {
+		return nil, reason, err
+	}
+	es, i, _, err := s.getListener(ctx, req.StreamID, req.ListenerID)
+	if err != nil {
+		return nil, ffcapi.ErrorReasonNotFound, err
+	}
+	es.listeners = append(es.listeners[0:i], es.listeners[i+1:]...)
+	return &ffcapi.EventListenerRemoveResponse{}, "", nil
+}
+
+func (s *simulator) EventListenerHWM(ctx context.Context, req *ffcapi.EventListenerHWMRequest) (*ffcapi.EventListenerHWMResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodEventListenerHWM); err != nil {
+		return nil, reason, err
+	}
+	_, _, l, err := s.getListener(ctx, req.StreamID, req.ListenerID)
+	if err != nil {
+		return nil, ffcapi.ErrorReasonNotFound, err
+	}
+	checkpoint := blockStartCheckpoint(0)
+	if l.checkpoint != nil {
+		cp := *l.checkpoint
+		checkpoint = &cp
+	}
+	return &ffcapi.EventListenerHWMResponse{
+		Checkpoint: checkpoint,
+		Catchup:    l.head < int64(s.chain.head().number),
+	}, "", nil
+}
+
+func (s *simulator) NewBlockListener(ctx context.Context, req *ffcapi.NewBlockListenerRequest) (*ffcapi.NewBlockListenerResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodNewBlockListener); err != nil {
+		return nil, reason, err
+	}
+	bs := s.newSubscription(req.ListenerContext, req.BlockListener)
+	s.blockListeners = append(s.blockListeners, bs)
+	go s.runBlockListener(bs)
+	return &ffcapi.NewBlockListenerResponse{}, "", nil
+}
@@ -0,0 +1,374 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+)
+
+type testStream struct {
+	id     *fftypes.UUID
+	events chan *ffcapi.ListenerEvent
+	blocks chan *ffcapi.BlockHashEvent
+	cancel func()
+}
+
+func startTestStream(t *testing.T, s *simulator, listeners ...*ffcapi.EventListenerAddRequest) *testStream {
+	ts := &testStream{
+		id:     fftypes.NewUUID(),
+		events: make(chan *ffcapi.ListenerEvent),
+		blocks: make(chan *ffcapi.BlockHashEvent),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ts.cancel = cancel
+	for _, l := range listeners {
+		l.StreamID = ts.id
+	}
+	_, _, err := s.EventStreamStart(context.Background(), &ffcapi.EventStreamStartRequest{
+		ID:               ts.id,
+		StreamContext:    ctx,
+		EventStream:      ts.events,
+		BlockListener:    ts.blocks,
+		InitialListeners: listeners,
+	})
+	assert.NoError(t, err)
+	return ts
+}
+
+func testListener(fromBlock string, filters ...string) *ffcapi.EventListenerAddRequest {
+	req := &ffcapi.EventListenerAddRequest{
+		ListenerID: fftypes.NewUUID(),
+		Name:       "listener1",
+		EventListenerOptions: ffcapi.EventListenerOptions{
+			FromBlock: fromBlock,
+		},
+	}
+	for _, f := range filters {
+		req.Filters = append(req.Filters, *fftypes.JSONAnyPtr(f))
+	}
+	return req
+}
+
+func TestEventStreamDeliversMatchingEvents(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":1}`))
+	s.EmitEvent("0xbbbb", "Changed", fftypes.JSONAnyPtr(`{"value":2}`))
+	s.EmitEvent("0xaaaa", "Other", fftypes.JSONAnyPtr(`{"value":3}`))
+	block1 := s.MineBlock()
+
+	l1 := testListener(ffcapi.FromBlockEarliest, `{"address":"0xaaaa"}`)
+	l2 := testListener("", `{"event":"Changed"}`)
+	ts := startTestStream(t, s, l1, l2)
+	defer ts.cancel()
+
+	// The earliest listener sees the historical events - the latest listener does not
+	ev := <-ts.events
+	assert.Equal(t, l1.ListenerID, ev.Event.ID.ListenerID)
+	assert.Equal(t, "Changed", ev.Event.ID.Signature)
+	assert.Equal(t, block1.BlockHash, ev.Event.ID.BlockHash)
+	assert.Equal(t, fftypes.FFuint64(1), ev.Event.ID.BlockNumber)
+	assert.Equal(t, block1.TransactionHashes[0], ev.Event.ID.TransactionHash)
+	assert.Equal(t, fftypes.FFuint64(0), ev.Event.ID.LogIndex)
+	assert.Equal(t, &EventInfo{Address: "0xaaaa", ListenerName: "listener1"}, ev.Event.Info)
+	assert.JSONEq(t, `{"value":1}`, ev.Event.Data.String())
+	assert.Equal(t, &Checkpoint{Block: 1, TransactionIndex: 0, LogIndex: 0}, ev.Checkpoint)
+	ev = <-ts.events
+	assert.Equal(t, "Other", ev.Event.ID.Signature)
+	assert.Equal(t, fftypes.FFuint64(2), ev.Event.ID.LogIndex)
+
+	s.EmitEvent("0xbbbb", "Changed", fftypes.JSONAnyPtr(`{"value":4}`))
+	block2 := s.MineBlock()
+	blocks := <-ts.blocks
+	assert.Equal(t, []string{block2.BlockHash}, blocks.BlockHashes)
+	assert.False(t, blocks.GapPotential)
+	ev = <-ts.events
+	assert.Equal(t, l2.ListenerID, ev.Event.ID.ListenerID)
+	assert.JSONEq(t, `{"value":4}`, ev.Event.Data.String())
+
+	hwm, _, err := s.EventListenerHWM(ctx, &ffcapi.EventListenerHWMRequest{StreamID: ts.id, ListenerID: l1.ListenerID})
+	assert.NoError(t, err)
+	assert.Equal(t, &Checkpoint{Block: 3, TransactionIndex: -1, LogIndex: -1}, hwm.Checkpoint)
+	assert.False(t, hwm.Catchup)
+}
+
+func TestEventStreamResumeFromCheckpoint(t *testing.T) {
+	s, _ := newTestSimulator(t)
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":1}`))
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":2}`))
+	s.MineBlock()
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":3}`))
+	s.MineBlock()
+
+	l := testListener(ffcapi.FromBlockEarliest)
+	l.Checkpoint = &Checkpoint{Block: 1, TransactionIndex: 0, LogIndex: 0}
+	ts := startTestStream(t, s, l)
+	defer ts.cancel()
+	assert.JSONEq(t, `{"value":2}`, (<-ts.events).Event.Data.String())
+	assert.JSONEq(t, `{"value":3}`, (<-ts.events).Event.Data.String())
+}
+
+func TestEventStreamFromBlockNumber(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":1}`))
+	s.MineBlock()
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":2}`))
+	s.MineBlock()
+
+	ts := startTestStream(t, s)
+	defer ts.cancel()
+	l := testListener("2")
+	l.StreamID = ts.id
+	_, _, err := s.EventListenerAdd(ctx, l)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"value":2}`, (<-ts.events).Event.Data.String())
+
+	// Re-adding the listener replaces it, and removing it stops delivery
+	_, _, err = s.EventListenerAdd(ctx, l)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"value":2}`, (<-ts.events).Event.Data.String())
+	_, _, err = s.EventListenerRemove(ctx, &ffcapi.EventListenerRemoveRequest{StreamID: ts.id, ListenerID: l.ListenerID})
+	assert.NoError(t, err)
+	_, reason, err := s.EventListenerRemove(ctx, &ffcapi.EventListenerRemoveRequest{StreamID: ts.id, ListenerID: l.ListenerID})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21124", err)
+}
+
+func TestEventStreamReorg(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	l := testListener(ffcapi.FromBlockEarliest)
+	ts := startTestStream(t, s, l)
+	defer ts.cancel()
+
+	s.MineBlock()
+	<-ts.blocks
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":1}`))
+	block2 := s.MineBlock()
+	<-ts.blocks
+	original := <-ts.events
+	assert.Equal(t, block2.BlockHash, original.Event.ID.BlockHash)
+
+	fork, err := s.Reorg(1)
+	assert.NoError(t, err)
+	blocks := <-ts.blocks
+	assert.Equal(t, []string{fork[0].BlockHash, fork[1].BlockHash}, blocks.BlockHashes)
+
+	removed := <-ts.events
+	assert.True(t, removed.Removed)
+	assert.Nil(t, removed.Checkpoint)
+	assert.Equal(t, original.Event.ID, removed.Event.ID)
+
+	redelivered := <-ts.events
+	assert.False(t, redelivered.Removed)
+	assert.Equal(t, fork[0].BlockHash, redelivered.Event.ID.BlockHash)
+	assert.Equal(t, original.Event.ID.TransactionHash, redelivered.Event.ID.TransactionHash)
+	assert.Equal(t, original.Checkpoint, redelivered.Checkpoint)
+
+	hwm, _, err := s.EventListenerHWM(ctx, &ffcapi.EventListenerHWMRequest{StreamID: ts.id, ListenerID: l.ListenerID})
+	assert.NoError(t, err)
+	assert.Equal(t, &Checkpoint{Block: 4, TransactionIndex: -1, LogIndex: -1}, hwm.Checkpoint)
+}
+
+func TestEventStreamWithoutBlockListener(t *testing.T) {
+	s, _ := newTestSimulator(t)
+	l := testListener(ffcapi.FromBlockEarliest)
+	l.StreamID = fftypes.NewUUID()
+	events := make(chan *ffcapi.ListenerEvent)
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, err := s.EventStreamStart(context.Background(), &ffcapi.EventStreamStartRequest{
+		ID:               l.StreamID,
+		StreamContext:    streamCtx,
+		EventStream:      events,
+		InitialListeners: []*ffcapi.EventListenerAddRequest{l},
+	})
+	assert.NoError(t, err)
+
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":1}`))
+	block1 := s.MineBlock()
+	assert.Equal(t, block1.BlockHash, (<-events).Event.ID.BlockHash)
+
+	// The stream stops while an event is waiting to be delivered
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":2}`))
+	block2 := s.MineBlock()
+	s.mux.Lock()
+	es := s.streams[*l.StreamID]
+	s.mux.Unlock()
+	for {
+		s.mux.Lock()
+		head := es.listeners[0].head
+		s.mux.Unlock()
+		if head == block2.BlockNumber.Int64() {
+			break
+		}
+	}
+	cancel()
+	<-es.done
+}
+
+func TestEventStreamStartStop(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	ts := startTestStream(t, s)
+
+	_, reason, err := s.EventStreamStart(ctx, &ffcapi.EventStreamStartRequest{ID: ts.id})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21123", err)
+
+	ts.cancel()
+	_, _, err = s.EventStreamStopped(ctx, &ffcapi.EventStreamStoppedRequest{ID: ts.id})
+	assert.NoError(t, err)
+
+	_, reason, err = s.EventListenerAdd(ctx, testListener(""))
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21122", err)
+	_, reason, err = s.EventListenerHWM(ctx, &ffcapi.EventListenerHWMRequest{StreamID: ts.id})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21122", err)
+
+	// A stream can be restarted once stopped
+	ts = startTestStream(t, s)
+	defer ts.cancel()
+}
+
+func TestEventStreamInvalidListener(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+
+	_, reason, err := s.EventStreamStart(ctx, &ffcapi.EventStreamStartRequest{
+		ID:               fftypes.NewUUID(),
+		StreamContext:    ctx,
+		InitialListeners: []*ffcapi.EventListenerAddRequest{testListener("", `"wrong"`)},
+	})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21125", err)
+
+	ts := startTestStream(t, s)
+	defer ts.cancel()
+	l := testListener("wrong")
+	l.StreamID = ts.id
+	_, reason, err = s.EventListenerAdd(ctx, l)
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21125", err)
+}
+
+func TestEventListenerVerifyOptions(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+
+	res, _, err := s.EventListenerVerifyOptions(ctx, &ffcapi.EventListenerVerifyOptionsRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "*", res.ResolvedSignature)
+	assert.Equal(t, "{}", res.ResolvedOptions.String())
+
+	l := testListener("latest", `{"event":"Changed"}`, `{"address":"0xaaaa"}`)
+	l.Options = fftypes.JSONAnyPtr(`{"custom":true}`)
+	res, _, err = s.EventListenerVerifyOptions(ctx, &ffcapi.EventListenerVerifyOptionsRequest{EventListenerOptions: l.EventListenerOptions})
+	assert.NoError(t, err)
+	assert.Equal(t, "Changed,*", res.ResolvedSignature)
+	assert.Equal(t, `{"custom":true}`, res.ResolvedOptions.String())
+
+	_, reason, err := s.EventListenerVerifyOptions(ctx, &ffcapi.EventListenerVerifyOptionsRequest{
+		EventListenerOptions: testListener("", `null`).EventListenerOptions,
+	})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21125", err)
+}
+
+func TestBlockListenerWithReconnect(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	blocks := make(chan *ffcapi.BlockHashEvent)
+	listenerCtx, cancel := context.WithCancel(ctx)
+	_, _, err := s.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{
+		ID:              fftypes.NewUUID(),
+		ListenerContext: listenerCtx,
+		BlockListener:   blocks,
+	})
+	assert.NoError(t, err)
+
+	block1 := s.MineBlock()
+	assert.Equal(t, &ffcapi.BlockHashEvent{BlockHashes: []string{block1.BlockHash}}, <-blocks)
+
+	s.SimulateReconnect()
+	assert.Equal(t, &ffcapi.BlockHashEvent{BlockHashes: []string{}, GapPotential: true}, <-blocks)
+
+	fork, err := s.Reorg(1)
+	assert.NoError(t, err)
+	assert.Equal(t, &ffcapi.BlockHashEvent{BlockHashes: []string{fork[0].BlockHash, fork[1].BlockHash}}, <-blocks)
+
+	cancel()
+	for {
+		s.mux.Lock()
+		remaining := len(s.blockListeners)
+		s.mux.Unlock()
+		if remaining == 0 {
+			break
+		}
+	}
+}
+
+func TestBlockListenerTracksRecentBlocks(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	blocks := make(chan *ffcapi.BlockHashEvent)
+	listenerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	_, _, err := s.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{
+		ID:              fftypes.NewUUID(),
+		ListenerContext: listenerCtx,
+		BlockListener:   blocks,
+	})
+	assert.NoError(t, err)
+
+	s.MineBlocks(reorgTrackingDepth + 1)
+	for notified := 0; notified < reorgTrackingDepth+1; {
+		notified += len((<-blocks).BlockHashes)
+	}
+	s.mux.Lock()
+	assert.Len(t, s.blockListeners[0].hashes, reorgTrackingDepth)
+	s.mux.Unlock()
+}
+
+func TestCloseStopsStreams(t *testing.T) {
+	s := NewSimulator(context.Background(), nil).(*simulator)
+	ts := startTestStream(t, s)
+	defer ts.cancel()
+	_, _, err := s.NewBlockListener(context.Background(), &ffcapi.NewBlockListenerRequest{
+		ListenerContext: context.Background(),
+		BlockListener:   make(chan *ffcapi.BlockHashEvent),
+	})
+	assert.NoError(t, err)
+	s.MineBlock()
+	s.Close()
+}
+
+func TestEventStreamNewCheckpointStruct(t *testing.T) {
+	s, _ := newTestSimulator(t)
+	assert.Equal(t, &Checkpoint{}, s.EventStreamNewCheckpointStruct())
+}
+
+func TestCheckpointLessThan(t *testing.T) {
+	cp1 := &Checkpoint{Block: 1, TransactionIndex: 2, LogIndex: 3}
+	assert.True(t, cp1.LessThan(&Checkpoint{Block: 2, TransactionIndex: -1, LogIndex: -1}))
+	assert.True(t, cp1.LessThan(&Checkpoint{Block: 1, TransactionIndex: 3, LogIndex: 0}))
+	assert.True(t, cp1.LessThan(&Checkpoint{Block: 1, TransactionIndex: 2, LogIndex: 4}))
+	assert.False(t, cp1.LessThan(cp1))
+	assert.False(t, cp1.LessThan(&Checkpoint{Block: 1, TransactionIndex: 2, LogIndex: 2}))
+	assert.False(t, cp1.LessThan(nil))
+	var nilCP *Checkpoint
+	assert.False(t, cp1.LessThan(nilCP))
+}
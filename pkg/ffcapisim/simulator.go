@@ -0,0 +1,328 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ffcapisim is a reference ffcapi.API implementation backed by an in-memory simulated chain.
+//
+// It can be used directly from Go tests of policy engines and event streams, in place of hand-written
+// mock expectations, and can be run as a dev connector by exposing it with ffcapiremote.NewServer.
+//
+// The simulated chain follows a simple account model: every signer has a balance and a nonce, transactions
+// are held in a pool until they are mined into a block, and the transactions and queries sent to an address
+// can be set to revert. Transactions are not really signed - the raw transaction format is the hex encoded
+// JSON of a RawTransaction.
+//
+// Events are emitted with EmitEvent, and are matched by listeners using filters of the form
+// {"address":"0x...","event":"Name"}, where either field can be omitted to match any value.
+package ffcapisim
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// Method identifies an ffcapi.API function, for injecting errors
+type Method string
+
+const (
+	MethodBlockInfoByHash            Method = "BlockInfoByHash"
+	MethodBlockInfoByNumber          Method = "BlockInfoByNumber"
+	MethodNextNonceForSigner         Method = "NextNonceForSigner"
+	MethodBalanceForSigner           Method = "BalanceForSigner"
+	MethodGasPriceEstimate           Method = "GasPriceEstimate"
+	MethodQueryInvoke                Method = "QueryInvoke"
+	MethodTransactionReceipt         Method = "TransactionReceipt"
+	MethodTransactionPrepare         Method = "TransactionPrepare"
+	MethodTransactionSend            Method = "TransactionSend"
+	MethodTransactionSendRaw         Method = "TransactionSendRaw"
+	MethodTransactionDecode          Method = "TransactionDecode"
+	MethodDeployContractPrepare      Method = "DeployContractPrepare"
+	MethodEventStreamStart           Method = "EventStreamStart"
+	MethodEventStreamStopped         Method = "EventStreamStopped"
+	MethodEventListenerVerifyOptions Method = "EventListenerVerifyOptions"
+	MethodEventListenerAdd           Method = "EventListenerAdd"
+	MethodEventListenerRemove        Method = "EventListenerRemove"
+	MethodEventListenerHWM           Method = "EventListenerHWM"
+	MethodNewBlockListener           Method = "NewBlockListener"
+	MethodIsLive                     Method = "IsLive"
+	MethodIsReady                    Method = "IsReady"
+)
+
+// Simulator is an ffcapi.API implementation backed by an in-memory chain, with functions to drive the chain
+type Simulator interface {
+	ffcapi.API
+
+	// MineBlock mines the transactions in the pool that are ready, along with any events emitted since the last block, into a new block
+	MineBlock() *ffcapi.BlockInfo
+	// MineBlocks mines the requested number of blocks
+	MineBlocks(count int) []*ffcapi.BlockInfo
+	// Reorg replaces the last depth blocks with a longer fork of depth+1 blocks. The transactions and events from the replaced blocks
+	// are mined again into the new fork, and the listeners that detected events from the replaced blocks are sent removed events
+	Reorg(depth int) ([]*ffcapi.BlockInfo, error)
+	// BlockNumber returns the number of the head block of the chain
+	BlockNumber() uint64
+
+	// SetGasPrice changes the gas price, which is returned as the estimate and is the minimum gas price for transactions to be mined
+	SetGasPrice(gasPrice *big.Int)
+	// SetBalance sets the balance of an address
+	SetBalance(address string, balance *big.Int)
+	// SetReverting sets whether transactions and queries sent to an address revert
+	SetReverting(address string, reverting bool)
+	// SetQueryOutput sets the outputs returned by queries sent to an address
+	SetQueryOutput(address string, outputs *fftypes.JSONAny)
+	// EmitEvent emits an event from an address, which is included in the next block
+	EmitEvent(address, event string, data *fftypes.JSONAny)
+
+	// InjectError makes the next count calls to a method fail with the supplied reason. A negative count fails every call until ClearErrors
+	InjectError(method Method, reason ffcapi.ErrorReason, count int)
+	// ClearErrors removes all injected errors
+	ClearErrors()
+	// SimulateReconnect marks the next notification to every block listener with GapPotential, as a connector does when it reconnects to its node
+	SimulateReconnect()
+
+	// Close stops block production, and all event streams and block listeners
+	Close()
+}
+
+type injectedError struct {
+	reason ffcapi.ErrorReason
+	count  int
+}
+
+type simulator struct {
+	ctx            context.Context
+	cancelCtx      func()
+	gasEstimate    *big.Int
+	mux            sync.Mutex
+	gasPrice       *big.Int
+	chain          *chain
+	reverting      map[string]bool
+	queryOutputs   map[string]*fftypes.JSONAny
+	injectedErrors map[Method]*injectedError
+	streams        map[fftypes.UUID]*eventStream
+	blockListeners []*subscription
+	gapEpoch       int
+	producerDone   chan struct{}
+}
+
+// NewSimulator creates a simulator, which produces blocks at the configured block period until the context
+// is cancelled or Close is called.
+func NewSimulator(ctx context.Context, options *Options) Simulator {
+	options = options.withDefaults()
+	s := &simulator{
+		gasEstimate:    options.GasEstimate,
+		gasPrice:       options.GasPrice,
+		reverting:      make(map[string]bool),
+		queryOutputs:   make(map[string]*fftypes.JSONAny),
+		injectedErrors: make(map[Method]*injectedError),
+		streams:        make(map[fftypes.UUID]*eventStream),
+		producerDone:   make(chan struct{}),
+	}
+	s.ctx, s.cancelCtx = context.WithCancel(log.WithLogField(ctx, "connector", "simulator"))
+	s.chain = newChain(options.InitialBalance)
+	if options.BlockPeriod > 0 {
+		go s.produceBlocks(options.BlockPeriod)
+	} else {
+		close(s.producerDone)
+	}
+	return s
+}
+
+// NewSimulatorFromConfig creates a simulator using a configuration section initialized with InitConfig
+func NewSimulatorFromConfig(ctx context.Context, conf config.Section) (Simulator, error) {
+	options, err := OptionsFromConfig(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	return NewSimulator(ctx, options), nil
+}
+
+func (s *simulator) produceBlocks(blockPeriod time.Duration) {
+	defer close(s.producerDone)
+	ticker := time.NewTicker(blockPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.MineBlock()
+		case <-s.ctx.Done():
+			log.L(s.ctx).Debugf("Block production stopped")
+			return
+		}
+	}
+}
+
+func (s *simulator) Close() {
+	s.cancelCtx()
+	<-s.producerDone
+	s.mux.Lock()
+	subscriptions := make([]chan struct{}, 0, len(s.streams)+len(s.blockListeners))
+	for _, es := range s.streams {
+		es.cancel()
+		subscriptions = append(subscriptions, es.done)
+	}
+	for _, bs := range s.blockListeners {
+		bs.cancel()
+		subscriptions = append(subscriptions, bs.done)
+	}
+	s.mux.Unlock()
+	for _, done := range subscriptions {
+		<-done
+	}
+}
+
+func (s *simulator) MineBlock() *ffcapi.BlockInfo {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	b := s.chain.mineBlock(s.gasPrice, s.reverting)
+	log.L(s.ctx).Debugf("Mined block %d / %s with %d transactions", b.number, b.hash, len(b.receipts))
+	s.notifySubscriptions()
+	return b.info()
+}
+
+func (s *simulator) MineBlocks(count int) []*ffcapi.BlockInfo {
+	blocks := make([]*ffcapi.BlockInfo, count)
+	for i := 0; i < count; i++ {
+		blocks[i] = s.MineBlock()
+	}
+	return blocks
+}
+
+func (s *simulator) Reorg(depth int) ([]*ffcapi.BlockInfo, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	head := s.chain.head().number
+	if depth < 1 || uint64(depth) > head {
+		return nil, i18n.NewError(s.ctx, tmmsgs.MsgSimulatorReorgDepthInvalid, depth, head)
+	}
+	s.chain.rewind(depth)
+	blocks := make([]*ffcapi.BlockInfo, depth+1)
+	for i := range blocks {
+		blocks[i] = s.chain.mineBlock(s.gasPrice, s.reverting).info()
+	}
+	log.L(s.ctx).Infof("Reorg replaced %d blocks from block %d with %d new blocks", depth, head-uint64(depth)+1, len(blocks))
+	s.notifySubscriptions()
+	return blocks, nil
+}
+
+func (s *simulator) BlockNumber() uint64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.chain.head().number
+}
+
+func (s *simulator) SetGasPrice(gasPrice *big.Int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.gasPrice = new(big.Int).Set(gasPrice)
+}
+
+func (s *simulator) SetBalance(address string, balance *big.Int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.chain.balances[address] = new(big.Int).Set(balance)
+}
+
+func (s *simulator) SetReverting(address string, reverting bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reverting {
+		s.reverting[address] = true
+	} else {
+		delete(s.reverting, address)
+	}
+}
+
+func (s *simulator) SetQueryOutput(address string, outputs *fftypes.JSONAny) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.queryOutputs[address] = outputs
+}
+
+func (s *simulator) EmitEvent(address, event string, data *fftypes.JSONAny) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.chain.pendingLogs = append(s.chain.pendingLogs, &simLog{
+		address: address,
+		event:   event,
+		data:    data,
+	})
+}
+
+func (s *simulator) InjectError(method Method, reason ffcapi.ErrorReason, count int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.injectedErrors[method] = &injectedError{reason: reason, count: count}
+}
+
+func (s *simulator) ClearErrors() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.injectedErrors = make(map[Method]*injectedError)
+}
+
+func (s *simulator) SimulateReconnect() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.gapEpoch++
+	s.notifySubscriptions()
+}
+
+// checkInjectedError must be called with the lock held, and returns the error injected for the method if any
+func (s *simulator) checkInjectedError(ctx context.Context, method Method) (ffcapi.ErrorReason, error) {
+	ie := s.injectedErrors[method]
+	if ie == nil {
+		return "", nil
+	}
+	if ie.count > 0 {
+		ie.count--
+		if ie.count == 0 {
+			delete(s.injectedErrors, method)
+		}
+	}
+	return ie.reason, i18n.NewError(ctx, tmmsgs.MsgSimulatorInjectedError, method, ie.reason)
+}
+
+func (s *simulator) IsLive(ctx context.Context) (*ffcapi.LiveResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodIsLive); err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.LiveResponse{Up: true}, "", nil
+}
+
+func (s *simulator) IsReady(ctx context.Context) (*ffcapi.ReadyResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodIsReady); err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.ReadyResponse{
+		Ready: true,
+		DownstreamDetails: fftypes.JSONAnyPtrBytes(mustMarshal(map[string]interface{}{
+			"blockNumber": s.chain.head().number,
+		})),
+	}, "", nil
+}
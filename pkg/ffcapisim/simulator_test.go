@@ -0,0 +1,289 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapiremote"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSimulator(t *testing.T) (*simulator, context.Context) {
+	s := NewSimulator(context.Background(), &Options{}).(*simulator)
+	t.Cleanup(s.Close)
+	return s, context.Background()
+}
+
+func TestMineBlocks(t *testing.T) {
+	s, _ := newTestSimulator(t)
+	assert.Equal(t, uint64(0), s.BlockNumber())
+	genesis := s.chain.head()
+
+	blocks := s.MineBlocks(2)
+	assert.Len(t, blocks, 2)
+	assert.Equal(t, int64(1), blocks[0].BlockNumber.Int64())
+	assert.Equal(t, genesis.hash, blocks[0].ParentHash)
+	assert.Equal(t, blocks[0].BlockHash, blocks[1].ParentHash)
+	assert.Empty(t, blocks[1].TransactionHashes)
+	assert.Equal(t, uint64(2), s.BlockNumber())
+}
+
+func TestReorgReplacesBlocks(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.EmitEvent("0xaaaa", "Changed", fftypes.JSONAnyPtr(`{"value":1}`))
+	original := s.MineBlocks(3)
+
+	_, err := s.Reorg(0)
+	assert.Regexp(t, "FF21126", err)
+	_, err = s.Reorg(4)
+	assert.Regexp(t, "FF21126", err)
+
+	fork, err := s.Reorg(2)
+	assert.NoError(t, err)
+	assert.Len(t, fork, 3)
+	assert.Equal(t, original[0].BlockHash, fork[0].ParentHash)
+	assert.NotEqual(t, original[1].BlockHash, fork[0].BlockHash)
+	assert.Equal(t, uint64(4), s.BlockNumber())
+	// The events of the first block are unaffected
+	assert.Equal(t, original[0].TransactionHashes, s.chain.blocks[1].info().TransactionHashes)
+
+	_, reason, err := s.BlockInfoByHash(ctx, &ffcapi.BlockInfoByHashRequest{BlockHash: original[2].BlockHash})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21120", err)
+}
+
+func TestReorgReplaysTransactions(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.SetReverting("0xcccc", true)
+
+	prepared, _, err := s.DeployContractPrepare(ctx, &ffcapi.ContractDeployPrepareRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa"},
+		Contract:           fftypes.JSONAnyPtr(`"0x1234"`),
+	})
+	assert.NoError(t, err)
+	deploy, _, err := s.TransactionSend(ctx, &ffcapi.TransactionSendRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  "0xaaaa",
+			Nonce: fftypes.NewFFBigInt(0),
+			Value: fftypes.NewFFBigInt(5),
+		},
+		TransactionData: prepared.TransactionData,
+	})
+	assert.NoError(t, err)
+	reverted, _, err := sendTestTX(t, s, "0xaaaa", 1, `1`)
+	assert.NoError(t, err)
+	original := s.MineBlock()
+	assert.Equal(t, []string{deploy.TransactionHash, reverted}, original.TransactionHashes)
+	signerBalance := new(big.Int).Set(s.chain.balance("0xaaaa"))
+	contractBalance := new(big.Int).Set(s.chain.balance(contractAddress("0xaaaa", 0)))
+
+	// The transactions are returned to the pool, and mined again with the same outcome
+	fork, err := s.Reorg(1)
+	assert.NoError(t, err)
+	assert.Equal(t, original.TransactionHashes, fork[0].TransactionHashes)
+	assert.Equal(t, signerBalance, s.chain.balance("0xaaaa"))
+	assert.Equal(t, contractBalance, s.chain.balance(contractAddress("0xaaaa", 0)))
+	nonce, _, err := s.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{Signer: "0xaaaa"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), nonce.Nonce.Int64())
+	receipt, _, err := s.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: reverted})
+	assert.NoError(t, err)
+	assert.False(t, receipt.Success)
+	assert.Equal(t, fork[0].BlockHash, receipt.BlockHash)
+}
+
+func TestMustMarshalPanics(t *testing.T) {
+	assert.Panics(t, func() {
+		mustMarshal(map[string]interface{}{"bad": make(chan struct{})})
+	})
+}
+
+func TestBlockProduction(t *testing.T) {
+	s := NewSimulator(context.Background(), &Options{BlockPeriod: 1 * time.Millisecond})
+	for s.BlockNumber() < 3 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	s.Close()
+}
+
+func TestInjectErrors(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+
+	s.InjectError(MethodIsLive, ffcapi.ErrorReasonDownstreamDown, 2)
+	for i := 0; i < 2; i++ {
+		_, reason, err := s.IsLive(ctx)
+		assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), reason)
+		assert.Regexp(t, "FF21112.*IsLive", err)
+	}
+	res, _, err := s.IsLive(ctx)
+	assert.NoError(t, err)
+	assert.True(t, res.Up)
+
+	s.InjectError(MethodIsReady, ffcapi.ErrorReasonDownstreamDown, -1)
+	for i := 0; i < 3; i++ {
+		_, _, err := s.IsReady(ctx)
+		assert.Regexp(t, "FF21112", err)
+	}
+	s.ClearErrors()
+	ready, _, err := s.IsReady(ctx)
+	assert.NoError(t, err)
+	assert.True(t, ready.Ready)
+	assert.JSONEq(t, `{"blockNumber":0}`, ready.DownstreamDetails.String())
+}
+
+func TestInjectErrorsEveryMethod(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	calls := map[Method]func() (ffcapi.ErrorReason, error){
+		MethodBlockInfoByHash: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.BlockInfoByHash(ctx, &ffcapi.BlockInfoByHashRequest{})
+			return r, err
+		},
+		MethodBlockInfoByNumber: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.BlockInfoByNumber(ctx, &ffcapi.BlockInfoByNumberRequest{})
+			return r, err
+		},
+		MethodNextNonceForSigner: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{})
+			return r, err
+		},
+		MethodBalanceForSigner: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{})
+			return r, err
+		},
+		MethodGasPriceEstimate: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
+			return r, err
+		},
+		MethodQueryInvoke: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{})
+			return r, err
+		},
+		MethodTransactionReceipt: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{})
+			return r, err
+		},
+		MethodTransactionPrepare: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.TransactionPrepare(ctx, &ffcapi.TransactionPrepareRequest{})
+			return r, err
+		},
+		MethodTransactionSend: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.TransactionSend(ctx, &ffcapi.TransactionSendRequest{})
+			return r, err
+		},
+		MethodTransactionSendRaw: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.TransactionSendRaw(ctx, &ffcapi.TransactionSendRawRequest{})
+			return r, err
+		},
+		MethodTransactionDecode: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.TransactionDecode(ctx, &ffcapi.TransactionDecodeRequest{})
+			return r, err
+		},
+		MethodDeployContractPrepare: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.DeployContractPrepare(ctx, &ffcapi.ContractDeployPrepareRequest{})
+			return r, err
+		},
+		MethodEventStreamStart: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.EventStreamStart(ctx, &ffcapi.EventStreamStartRequest{})
+			return r, err
+		},
+		MethodEventStreamStopped: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.EventStreamStopped(ctx, &ffcapi.EventStreamStoppedRequest{})
+			return r, err
+		},
+		MethodEventListenerVerifyOptions: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.EventListenerVerifyOptions(ctx, &ffcapi.EventListenerVerifyOptionsRequest{})
+			return r, err
+		},
+		MethodEventListenerAdd: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.EventListenerAdd(ctx, &ffcapi.EventListenerAddRequest{})
+			return r, err
+		},
+		MethodEventListenerRemove: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.EventListenerRemove(ctx, &ffcapi.EventListenerRemoveRequest{})
+			return r, err
+		},
+		MethodEventListenerHWM: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.EventListenerHWM(ctx, &ffcapi.EventListenerHWMRequest{})
+			return r, err
+		},
+		MethodNewBlockListener: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.NewBlockListener(ctx, &ffcapi.NewBlockListenerRequest{})
+			return r, err
+		},
+		MethodIsLive: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.IsLive(ctx)
+			return r, err
+		},
+		MethodIsReady: func() (ffcapi.ErrorReason, error) {
+			_, r, err := s.IsReady(ctx)
+			return r, err
+		},
+	}
+	reasons := []ffcapi.ErrorReason{
+		ffcapi.ErrorReasonInvalidInputs,
+		ffcapi.ErrorReasonTransactionReverted,
+		ffcapi.ErrorReasonNonceTooLow,
+		ffcapi.ErrorReasonTransactionUnderpriced,
+		ffcapi.ErrorReasonInsufficientFunds,
+		ffcapi.ErrorReasonNotFound,
+		ffcapi.ErrorKnownTransaction,
+		ffcapi.ErrorReasonDownstreamDown,
+	}
+	for method, call := range calls {
+		for _, reason := range reasons {
+			s.InjectError(method, reason, 1)
+			r, err := call()
+			assert.Equal(t, reason, r, method)
+			assert.Regexp(t, "FF21112", err, method)
+		}
+	}
+}
+
+func TestRunAsRemoteConnector(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	server := ffcapiremote.NewServer(ctx, s)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer server.Close()
+
+	config.RootConfigReset()
+	conf := config.RootSection("unittest.remote")
+	ffcapiremote.InitConfig(conf)
+	conf.Set(ffresty.HTTPConfigURL, ts.URL)
+	conf.Set(ffresty.HTTPConfigRetryEnabled, false)
+	c, err := ffcapiremote.NewClient(ctx, conf, s.EventStreamNewCheckpointStruct)
+	assert.NoError(t, err)
+
+	s.SetBalance("0x1111", big.NewInt(12345))
+	res, _, err := c.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{Signer: "0x1111"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12345), res.Balance.Int64())
+
+	s.InjectError(MethodBlockInfoByNumber, ffcapi.ErrorReasonNotFound, 1)
+	_, reason, err := c.BlockInfoByNumber(ctx, &ffcapi.BlockInfoByNumberRequest{BlockNumber: fftypes.NewFFBigInt(0)})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21112", err)
+}
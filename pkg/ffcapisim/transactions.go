@@ -0,0 +1,382 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// RawTransaction is the simulated form of a signed transaction. The raw transactions accepted by TransactionSendRaw
+// and TransactionDecode are the hex encoded JSON of this structure, as returned by Encode.
+type RawTransaction struct {
+	From     string            `json:"from"`
+	To       string            `json:"to,omitempty"`
+	Nonce    *fftypes.FFBigInt `json:"nonce"`
+	Gas      *fftypes.FFBigInt `json:"gas"`
+	GasPrice *fftypes.FFBigInt `json:"gasPrice,omitempty"`
+	Value    *fftypes.FFBigInt `json:"value,omitempty"`
+	Data     string            `json:"data,omitempty"`
+}
+
+// preparedData is the content of the transaction data returned by TransactionPrepare and DeployContractPrepare
+type preparedData struct {
+	Method     *fftypes.JSONAny   `json:"method,omitempty"`
+	Definition *fftypes.JSONAny   `json:"definition,omitempty"`
+	Contract   *fftypes.JSONAny   `json:"contract,omitempty"`
+	Params     []*fftypes.JSONAny `json:"params"`
+}
+
+func encodeHex(v interface{}) string {
+	return "0x" + hex.EncodeToString(mustMarshal(v))
+}
+
+func decodeHex(ctx context.Context, data string, v interface{}) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err == nil {
+		err = json.Unmarshal(b, v)
+	}
+	if err != nil {
+		return i18n.NewError(ctx, tmmsgs.MsgSimulatorInvalidTransaction, err)
+	}
+	return nil
+}
+
+// Encode returns the raw transaction string, as accepted by TransactionSendRaw
+func (rt *RawTransaction) Encode() string {
+	return encodeHex(rt)
+}
+
+// Hash returns the hash the transaction has once submitted
+func (rt *RawTransaction) Hash() string {
+	return hashOf(rt.Encode())
+}
+
+func decodeRawTransaction(ctx context.Context, raw string) (*RawTransaction, error) {
+	var rt RawTransaction
+	if err := decodeHex(ctx, raw, &rt); err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+func newTransaction(ctx context.Context, rt *RawTransaction) (*simTransaction, error) {
+	if rt.From == "" || rt.Nonce == nil || rt.Nonce.Int().Sign() < 0 || rt.Gas == nil {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgSimulatorInvalidTransaction, "from, nonce and gas must be set")
+	}
+	if rt.Data != "" {
+		if _, err := hex.DecodeString(strings.TrimPrefix(rt.Data, "0x")); err != nil {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgSimulatorInvalidTransaction, err)
+		}
+	}
+	tx := &simTransaction{
+		raw:      rt,
+		hash:     rt.Hash(),
+		nonce:    rt.Nonce.Int().Uint64(),
+		gas:      rt.Gas.Int(),
+		gasPrice: big.NewInt(0),
+		value:    big.NewInt(0),
+	}
+	if rt.GasPrice != nil {
+		tx.gasPrice = rt.GasPrice.Int()
+	}
+	if rt.Value != nil {
+		tx.value = rt.Value.Int()
+	}
+	return tx, nil
+}
+
+// parseGasPrice accepts a JSON number, a JSON string containing a decimal or 0x prefixed hex number, or an
+// object with a maxFeePerGas or gasPrice field in either form
+func parseGasPrice(ctx context.Context, raw *fftypes.JSONAny) (*fftypes.FFBigInt, error) {
+	if raw.IsNil() {
+		return nil, nil
+	}
+	var fields map[string]json.RawMessage
+	value := json.RawMessage(raw.String())
+	if err := json.Unmarshal(value, &fields); err == nil {
+		if value = fields["maxFeePerGas"]; value == nil {
+			value = fields["gasPrice"]
+		}
+	}
+	var gasPrice fftypes.FFBigInt
+	if err := json.Unmarshal(value, &gasPrice); err != nil {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgSimulatorInvalidTransaction, err)
+	}
+	return &gasPrice, nil
+}
+
+// submit adds a transaction to the pool, following the rules of a node with a transaction pool. Must be called with the lock held.
+func (s *simulator) submit(ctx context.Context, rt *RawTransaction) (string, ffcapi.ErrorReason, error) {
+	tx, err := newTransaction(ctx, rt)
+	if err != nil {
+		return "", ffcapi.ErrorReasonInvalidInputs, err
+	}
+	c := s.chain
+	if c.pool[tx.hash] != nil || c.mined[tx.hash] != nil {
+		return "", ffcapi.ErrorKnownTransaction, i18n.NewError(ctx, tmmsgs.MsgSimulatorKnownTransaction, tx.hash)
+	}
+	if next := c.nonces[rt.From]; tx.nonce < next {
+		return "", ffcapi.ErrorReasonNonceTooLow, i18n.NewError(ctx, tmmsgs.MsgSimulatorNonceTooLow, rt.Nonce, rt.From, next)
+	}
+	replaced := c.pooledTX(rt.From, tx.nonce)
+	if replaced != nil && tx.gasPrice.Cmp(replaced.gasPrice) <= 0 {
+		return "", ffcapi.ErrorReasonTransactionUnderpriced, i18n.NewError(ctx, tmmsgs.MsgSimulatorReplacementUnderpriced, rt.From, rt.Nonce, replaced.gasPrice)
+	}
+	if balance := c.balance(rt.From); balance.Cmp(tx.cost()) < 0 {
+		return "", ffcapi.ErrorReasonInsufficientFunds, i18n.NewError(ctx, tmmsgs.MsgSimulatorInsufficientFunds, rt.From, balance, tx.cost())
+	}
+	if replaced != nil {
+		log.L(ctx).Debugf("Transaction %s replaced by %s at nonce %s / %d", replaced.hash, tx.hash, rt.From, tx.nonce)
+		delete(c.pool, replaced.hash)
+	}
+	c.addToPool(tx)
+	log.L(ctx).Debugf("Transaction %s added to the pool at nonce %s / %d", tx.hash, rt.From, tx.nonce)
+	return tx.hash, "", nil
+}
+
+// estimateGas must be called with the lock held
+func (s *simulator) estimateGas(ctx context.Context, headers *ffcapi.TransactionHeaders) (*fftypes.FFBigInt, ffcapi.ErrorReason, error) {
+	if headers.From == "" {
+		return nil, ffcapi.ErrorReasonInvalidInputs, i18n.NewError(ctx, tmmsgs.MsgSimulatorInvalidTransaction, "from must be set")
+	}
+	if headers.Gas != nil {
+		return headers.Gas, "", nil
+	}
+	if s.reverting[headers.To] {
+		return nil, ffcapi.ErrorReasonTransactionReverted, i18n.NewError(ctx, tmmsgs.MsgSimulatorReverted, headers.To)
+	}
+	return (*fftypes.FFBigInt)(new(big.Int).Set(s.gasEstimate)), "", nil
+}
+
+func (s *simulator) TransactionPrepare(ctx context.Context, req *ffcapi.TransactionPrepareRequest) (*ffcapi.TransactionPrepareResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodTransactionPrepare); err != nil {
+		return nil, reason, err
+	}
+	gas, reason, err := s.estimateGas(ctx, &req.TransactionHeaders)
+	if err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.TransactionPrepareResponse{
+		Gas: gas,
+		TransactionData: encodeHex(&preparedData{
+			Method: req.Method,
+			Params: req.Params,
+		}),
+	}, "", nil
+}
+
+func (s *simulator) DeployContractPrepare(ctx context.Context, req *ffcapi.ContractDeployPrepareRequest) (*ffcapi.TransactionPrepareResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodDeployContractPrepare); err != nil {
+		return nil, reason, err
+	}
+	if req.Contract.IsNil() {
+		return nil, ffcapi.ErrorReasonInvalidInputs, i18n.NewError(ctx, tmmsgs.MsgSimulatorInvalidTransaction, "contract must be set")
+	}
+	gas, reason, err := s.estimateGas(ctx, &req.TransactionHeaders)
+	if err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.TransactionPrepareResponse{
+		Gas: gas,
+		TransactionData: encodeHex(&preparedData{
+			Definition: req.Definition,
+			Contract:   req.Contract,
+			Params:     req.Params,
+		}),
+	}, "", nil
+}
+
+func (s *simulator) TransactionSend(ctx context.Context, req *ffcapi.TransactionSendRequest) (*ffcapi.TransactionSendResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodTransactionSend); err != nil {
+		return nil, reason, err
+	}
+	gasPrice, err := parseGasPrice(ctx, req.GasPrice)
+	if err != nil {
+		return nil, ffcapi.ErrorReasonInvalidInputs, err
+	}
+	gas, reason, err := s.estimateGas(ctx, &req.TransactionHeaders)
+	if err != nil {
+		return nil, reason, err
+	}
+	txHash, reason, err := s.submit(ctx, &RawTransaction{
+		From:     req.From,
+		To:       req.To,
+		Nonce:    req.Nonce,
+		Gas:      gas,
+		GasPrice: gasPrice,
+		Value:    req.Value,
+		Data:     req.TransactionData,
+	})
+	if err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.TransactionSendResponse{TransactionHash: txHash}, "", nil
+}
+
+func (s *simulator) TransactionSendRaw(ctx context.Context, req *ffcapi.TransactionSendRawRequest) (*ffcapi.TransactionSendRawResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodTransactionSendRaw); err != nil {
+		return nil, reason, err
+	}
+	rt, err := decodeRawTransaction(ctx, req.RawTransaction)
+	if err != nil {
+		return nil, ffcapi.ErrorReasonInvalidInputs, err
+	}
+	txHash, reason, err := s.submit(ctx, rt)
+	if err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.TransactionSendRawResponse{TransactionHash: txHash}, "", nil
+}
+
+// gasPriceJSON returns the gas price of a raw transaction in the form returned by GasPriceEstimate, or nil if not set
+func gasPriceJSON(gasPrice *fftypes.FFBigInt) *fftypes.JSONAny {
+	if gasPrice == nil {
+		return nil
+	}
+	return fftypes.JSONAnyPtr(strconv.Quote(gasPrice.String()))
+}
+
+func (s *simulator) TransactionDecode(ctx context.Context, req *ffcapi.TransactionDecodeRequest) (*ffcapi.TransactionDecodeResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodTransactionDecode); err != nil {
+		return nil, reason, err
+	}
+	rt, err := decodeRawTransaction(ctx, req.RawTransaction)
+	if err != nil {
+		return nil, ffcapi.ErrorReasonInvalidInputs, err
+	}
+	return &ffcapi.TransactionDecodeResponse{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  rt.From,
+			To:    rt.To,
+			Nonce: rt.Nonce,
+			Gas:   rt.Gas,
+			Value: rt.Value,
+		},
+		GasPrice:        gasPriceJSON(rt.GasPrice),
+		TransactionData: rt.Data,
+		TransactionHash: rt.Hash(),
+	}, "", nil
+}
+
+func (s *simulator) TransactionReceipt(ctx context.Context, req *ffcapi.TransactionReceiptRequest) (*ffcapi.TransactionReceiptResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodTransactionReceipt); err != nil {
+		return nil, reason, err
+	}
+	r := s.chain.mined[req.TransactionHash]
+	if r == nil {
+		return nil, ffcapi.ErrorReasonNotFound, i18n.NewError(ctx, tmmsgs.MsgSimulatorReceiptNotFound, req.TransactionHash)
+	}
+	res := &ffcapi.TransactionReceiptResponse{
+		BlockNumber:      fftypes.NewFFBigInt(int64(r.block.number)),
+		TransactionIndex: fftypes.NewFFBigInt(int64(r.index)),
+		BlockHash:        r.block.hash,
+		Success:          r.success,
+		ExtraInfo: fftypes.JSONAnyPtrBytes(mustMarshal(map[string]interface{}{
+			"from":    r.tx.raw.From,
+			"to":      r.tx.raw.To,
+			"gasUsed": r.tx.raw.Gas,
+		})),
+	}
+	if r.contractAddress != "" {
+		res.ContractLocation = fftypes.JSONAnyPtrBytes(mustMarshal(map[string]string{
+			"address": r.contractAddress,
+		}))
+	}
+	return res, "", nil
+}
+
+func (s *simulator) NextNonceForSigner(ctx context.Context, req *ffcapi.NextNonceForSignerRequest) (*ffcapi.NextNonceForSignerResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodNextNonceForSigner); err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(int64(s.chain.pendingNonce(req.Signer))),
+	}, "", nil
+}
+
+func (s *simulator) BalanceForSigner(ctx context.Context, req *ffcapi.BalanceForSignerRequest) (*ffcapi.BalanceForSignerResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodBalanceForSigner); err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.BalanceForSignerResponse{
+		Balance: (*fftypes.FFBigInt)(new(big.Int).Set(s.chain.balance(req.Signer))),
+	}, "", nil
+}
+
+func (s *simulator) GasPriceEstimate(ctx context.Context, req *ffcapi.GasPriceEstimateRequest) (*ffcapi.GasPriceEstimateResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodGasPriceEstimate); err != nil {
+		return nil, reason, err
+	}
+	return &ffcapi.GasPriceEstimateResponse{
+		GasPrice: fftypes.JSONAnyPtr(strconv.Quote(s.gasPrice.String())),
+	}, "", nil
+}
+
+func (s *simulator) QueryInvoke(ctx context.Context, req *ffcapi.QueryInvokeRequest) (*ffcapi.QueryInvokeResponse, ffcapi.ErrorReason, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if reason, err := s.checkInjectedError(ctx, MethodQueryInvoke); err != nil {
+		return nil, reason, err
+	}
+	switch {
+	case req.BlockNumber != nil:
+		if s.chain.blockByNumber(req.BlockNumber.Uint64()) == nil {
+			return nil, ffcapi.ErrorReasonNotFound, i18n.NewError(ctx, tmmsgs.MsgSimulatorBlockNotFound, req.BlockNumber)
+		}
+	case req.BlockHash != "":
+		if s.chain.byHash[req.BlockHash] == nil {
+			return nil, ffcapi.ErrorReasonNotFound, i18n.NewError(ctx, tmmsgs.MsgSimulatorBlockNotFound, req.BlockHash)
+		}
+	}
+	if s.reverting[req.To] {
+		return nil, ffcapi.ErrorReasonTransactionReverted, i18n.NewError(ctx, tmmsgs.MsgSimulatorReverted, req.To)
+	}
+	outputs := s.queryOutputs[req.To]
+	if outputs == nil {
+		outputs = fftypes.JSONAnyPtr("[]")
+	}
+	return &ffcapi.QueryInvokeResponse{Outputs: outputs}, "", nil
+}
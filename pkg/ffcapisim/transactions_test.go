@@ -0,0 +1,353 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffcapisim
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendTestTX(t *testing.T, s *simulator, from string, nonce int64, gasPrice string) (string, ffcapi.ErrorReason, error) {
+	ctx := context.Background()
+	prepared, _, err := s.TransactionPrepare(ctx, &ffcapi.TransactionPrepareRequest{
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{From: from, To: "0xcccc", Gas: fftypes.NewFFBigInt(21000)},
+			Method:             fftypes.JSONAnyPtr(`{"name":"set"}`),
+			Params:             []*fftypes.JSONAny{fftypes.JSONAnyPtr("1")},
+		},
+	})
+	assert.NoError(t, err)
+	res, reason, err := s.TransactionSend(ctx, &ffcapi.TransactionSendRequest{
+		GasPrice: fftypes.JSONAnyPtr(gasPrice),
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  from,
+			To:    "0xcccc",
+			Nonce: fftypes.NewFFBigInt(nonce),
+			Gas:   prepared.Gas,
+		},
+		TransactionData: prepared.TransactionData,
+	})
+	if err != nil {
+		return "", reason, err
+	}
+	return res.TransactionHash, "", nil
+}
+
+func TestSendTransactionAndReceipt(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.SetBalance("0xaaaa", big.NewInt(1000000))
+
+	txHash, _, err := sendTestTX(t, s, "0xaaaa", 0, `"10"`)
+	assert.NoError(t, err)
+
+	nonce, _, err := s.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{Signer: "0xaaaa"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), nonce.Nonce.Int64())
+
+	_, reason, err := s.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: txHash})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21121", err)
+
+	block := s.MineBlock()
+	assert.Equal(t, []string{txHash}, block.TransactionHashes)
+
+	receipt, _, err := s.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: txHash})
+	assert.NoError(t, err)
+	assert.True(t, receipt.Success)
+	assert.Equal(t, block.BlockHash, receipt.BlockHash)
+	assert.Equal(t, int64(1), receipt.BlockNumber.Int64())
+	assert.Equal(t, int64(0), receipt.TransactionIndex.Int64())
+	assert.Nil(t, receipt.ContractLocation)
+	assert.JSONEq(t, `{"from":"0xaaaa","to":"0xcccc","gasUsed":"21000"}`, receipt.ExtraInfo.String())
+
+	balance, _, err := s.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{Signer: "0xaaaa"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000000-21000*10), balance.Balance.Int64())
+
+	// Resubmitting the same transaction is known, and a new one at the same nonce is too low
+	_, reason, err = sendTestTX(t, s, "0xaaaa", 0, `"10"`)
+	assert.Equal(t, ffcapi.ErrorKnownTransaction, reason)
+	assert.Regexp(t, "FF21116", err)
+	_, reason, err = sendTestTX(t, s, "0xaaaa", 0, `"20"`)
+	assert.Equal(t, ffcapi.ErrorReasonNonceTooLow, reason)
+	assert.Regexp(t, "FF21115", err)
+}
+
+func TestTransactionsMinedInNonceOrder(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+
+	tx2, _, err := sendTestTX(t, s, "0xaaaa", 2, `1`)
+	assert.NoError(t, err)
+	tx1, _, err := sendTestTX(t, s, "0xaaaa", 1, `1`)
+	assert.NoError(t, err)
+	// Gapped until nonce 0 arrives
+	nonce, _, err := s.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{Signer: "0xaaaa"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), nonce.Nonce.Int64())
+	assert.Empty(t, s.MineBlock().TransactionHashes)
+
+	tx0, _, err := sendTestTX(t, s, "0xaaaa", 0, `1`)
+	assert.NoError(t, err)
+	nonce, _, err = s.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{Signer: "0xaaaa"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), nonce.Nonce.Int64())
+	assert.Equal(t, []string{tx0, tx1, tx2}, s.MineBlock().TransactionHashes)
+}
+
+func TestGasPriceChanges(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.SetGasPrice(big.NewInt(100))
+
+	gasPrice, _, err := s.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, `"100"`, gasPrice.GasPrice.String())
+
+	// Underpriced transactions stay in the pool
+	tx1, _, err := sendTestTX(t, s, "0xaaaa", 0, `{"maxFeePerGas":"50"}`)
+	assert.NoError(t, err)
+	assert.Empty(t, s.MineBlock().TransactionHashes)
+
+	// A replacement must increase the gas price
+	_, reason, err := sendTestTX(t, s, "0xaaaa", 0, `{"maxFeePerGas":"40"}`)
+	assert.Equal(t, ffcapi.ErrorReasonTransactionUnderpriced, reason)
+	assert.Regexp(t, "FF21117", err)
+	tx2, _, err := sendTestTX(t, s, "0xaaaa", 0, `{"gasPrice":"0x64"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tx2}, s.MineBlock().TransactionHashes)
+	_, reason, _ = s.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: tx1})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+
+	// Dropping the fees allows a cheaper transaction to be mined
+	tx3, _, err := sendTestTX(t, s, "0xaaaa", 1, `50`)
+	assert.NoError(t, err)
+	assert.Empty(t, s.MineBlock().TransactionHashes)
+	s.SetGasPrice(big.NewInt(50))
+	assert.Equal(t, []string{tx3}, s.MineBlock().TransactionHashes)
+}
+
+func TestInsufficientFunds(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.SetBalance("0xaaaa", big.NewInt(21000))
+
+	_, reason, err := sendTestTX(t, s, "0xaaaa", 0, `2`)
+	assert.Equal(t, ffcapi.ErrorReasonInsufficientFunds, reason)
+	assert.Regexp(t, "FF21118", err)
+
+	// Two affordable transactions, only one of which can be mined with the balance
+	tx1, _, err := sendTestTX(t, s, "0xaaaa", 0, `1`)
+	assert.NoError(t, err)
+	tx2, _, err := sendTestTX(t, s, "0xaaaa", 1, `1`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{tx1}, s.MineBlock().TransactionHashes)
+	assert.Empty(t, s.MineBlock().TransactionHashes)
+
+	s.SetBalance("0xaaaa", big.NewInt(21000))
+	assert.Equal(t, []string{tx2}, s.MineBlock().TransactionHashes)
+	balance, _, err := s.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{Signer: "0xaaaa"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), balance.Balance.Int64())
+}
+
+func TestRevertingContract(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	s.SetReverting("0xcccc", true)
+
+	_, reason, err := s.TransactionPrepare(ctx, &ffcapi.TransactionPrepareRequest{
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa", To: "0xcccc"},
+		},
+	})
+	assert.Equal(t, ffcapi.ErrorReasonTransactionReverted, reason)
+	assert.Regexp(t, "FF21119", err)
+
+	_, reason, err = s.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{To: "0xcccc"},
+		},
+	})
+	assert.Equal(t, ffcapi.ErrorReasonTransactionReverted, reason)
+	assert.Regexp(t, "FF21119", err)
+
+	// With gas supplied, the transaction is mined and fails
+	txHash, _, err := sendTestTX(t, s, "0xaaaa", 0, `1`)
+	assert.NoError(t, err)
+	s.MineBlock()
+	receipt, _, err := s.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: txHash})
+	assert.NoError(t, err)
+	assert.False(t, receipt.Success)
+
+	s.SetReverting("0xcccc", false)
+	_, _, err = s.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{To: "0xcccc"},
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func TestDeployContract(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+
+	_, reason, err := s.DeployContractPrepare(ctx, &ffcapi.ContractDeployPrepareRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa"},
+	})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+	_, reason, err = s.DeployContractPrepare(ctx, &ffcapi.ContractDeployPrepareRequest{
+		Contract: fftypes.JSONAnyPtr(`"0x1234"`),
+	})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+
+	prepared, _, err := s.DeployContractPrepare(ctx, &ffcapi.ContractDeployPrepareRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa"},
+		Definition:         fftypes.JSONAnyPtr(`[]`),
+		Contract:           fftypes.JSONAnyPtr(`"0x1234"`),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(21000), prepared.Gas.Int64())
+
+	sent, _, err := s.TransactionSend(ctx, &ffcapi.TransactionSendRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  "0xaaaa",
+			Nonce: fftypes.NewFFBigInt(0),
+			Value: fftypes.NewFFBigInt(5),
+		},
+		TransactionData: prepared.TransactionData,
+	})
+	assert.NoError(t, err)
+	s.MineBlock()
+	receipt, _, err := s.TransactionReceipt(ctx, &ffcapi.TransactionReceiptRequest{TransactionHash: sent.TransactionHash})
+	assert.NoError(t, err)
+	address := contractAddress("0xaaaa", 0)
+	assert.JSONEq(t, `{"address":"`+address+`"}`, receipt.ContractLocation.String())
+
+	balance, _, err := s.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{Signer: address})
+	assert.NoError(t, err)
+	assert.Equal(t, new(big.Int).Add(s.chain.initialBalance, big.NewInt(5)), balance.Balance.Int())
+}
+
+func TestSendRawTransaction(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+
+	rt := &RawTransaction{
+		From:     "0xaaaa",
+		To:       "0xcccc",
+		Nonce:    fftypes.NewFFBigInt(0),
+		Gas:      fftypes.NewFFBigInt(21000),
+		GasPrice: fftypes.NewFFBigInt(1),
+		Data:     "0x1234",
+	}
+	decoded, _, err := s.TransactionDecode(ctx, &ffcapi.TransactionDecodeRequest{RawTransaction: rt.Encode()})
+	assert.NoError(t, err)
+	assert.Equal(t, "0xaaaa", decoded.From)
+	assert.Equal(t, "0xcccc", decoded.To)
+	assert.Equal(t, int64(0), decoded.Nonce.Int64())
+	assert.Equal(t, `"1"`, decoded.GasPrice.String())
+	assert.Equal(t, "0x1234", decoded.TransactionData)
+	assert.Equal(t, rt.Hash(), decoded.TransactionHash)
+
+	sent, _, err := s.TransactionSendRaw(ctx, &ffcapi.TransactionSendRawRequest{RawTransaction: rt.Encode()})
+	assert.NoError(t, err)
+	assert.Equal(t, rt.Hash(), sent.TransactionHash)
+	assert.Equal(t, []string{rt.Hash()}, s.MineBlock().TransactionHashes)
+	_, reason, err := s.TransactionSendRaw(ctx, &ffcapi.TransactionSendRawRequest{RawTransaction: rt.Encode()})
+	assert.Equal(t, ffcapi.ErrorKnownTransaction, reason)
+	assert.Regexp(t, "FF21116", err)
+
+	// The gas price is optional in a raw transaction
+	rt.GasPrice = nil
+	decoded, _, err = s.TransactionDecode(ctx, &ffcapi.TransactionDecodeRequest{RawTransaction: rt.Encode()})
+	assert.NoError(t, err)
+	assert.Nil(t, decoded.GasPrice)
+
+	_, reason, err = s.TransactionSendRaw(ctx, &ffcapi.TransactionSendRawRequest{RawTransaction: "0xwrong"})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+	_, reason, err = s.TransactionDecode(ctx, &ffcapi.TransactionDecodeRequest{RawTransaction: "0xwrong"})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+}
+
+func TestSendInvalidInputs(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+
+	_, reason, err := s.TransactionPrepare(ctx, &ffcapi.TransactionPrepareRequest{})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+
+	_, reason, err = s.TransactionSend(ctx, &ffcapi.TransactionSendRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa"},
+	})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+
+	_, reason, err = s.TransactionSend(ctx, &ffcapi.TransactionSendRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa", Nonce: fftypes.NewFFBigInt(0)},
+		TransactionData:    "not hex",
+	})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+
+	_, reason, err = s.TransactionSend(ctx, &ffcapi.TransactionSendRequest{
+		GasPrice:           fftypes.JSONAnyPtr(`{"maxPriorityFeePerGas":1}`),
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaa", Nonce: fftypes.NewFFBigInt(0)},
+	})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+
+	_, reason, err = s.TransactionSend(ctx, &ffcapi.TransactionSendRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{},
+	})
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, reason)
+	assert.Regexp(t, "FF21114", err)
+}
+
+func TestQueryInvoke(t *testing.T) {
+	s, ctx := newTestSimulator(t)
+	block := s.MineBlock()
+
+	res, _, err := s.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "[]", res.Outputs.String())
+
+	s.SetQueryOutput("0xcccc", fftypes.JSONAnyPtr(`{"value":1}`))
+	res, _, err = s.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{To: "0xcccc"},
+		},
+		BlockNumber: fftypes.NewFFBigInt(1),
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"value":1}`, res.Outputs.String())
+
+	_, _, err = s.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{BlockHash: block.BlockHash})
+	assert.NoError(t, err)
+
+	_, reason, err := s.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{BlockNumber: fftypes.NewFFBigInt(2)})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21120", err)
+
+	_, reason, err = s.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{BlockHash: "0x12345"})
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	assert.Regexp(t, "FF21120", err)
+}
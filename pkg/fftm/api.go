@@ -32,6 +32,15 @@ import (
 	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
 )
 
+// followerRoutes do not use persistence, so are served before this instance is the leader
+var followerRoutes = map[string]bool{
+	"getStatus":       true,
+	"getLiveStatus":   true,
+	"getReadyStatus":  true,
+	"getStatusLeader": true,
+	"postDrain":       true,
+}
+
 func (m *manager) router() *mux.Router {
 	mux := mux.NewRouter()
 	hf := ffapi.HandlerFactory{
@@ -40,7 +49,20 @@ func (m *manager) router() *mux.Router {
 	}
 	routes := m.routes()
 	for _, r := range routes {
-		mux.Path(r.Path).Methods(r.Method).Handler(hf.RouteHandler(r))
+		// Followers serve requests for the status of this instance, or that only affect this instance, and
+		// forward read-only requests to the leader
+		var handler http.Handler
+		switch {
+		case followerRoutes[r.Name]:
+			handler = hf.RouteHandler(r)
+		case r.Method == http.MethodGet:
+			r.JSONHandler = m.leaderOnly(r.JSONHandler)
+			handler = m.forwardToLeader(hf.RouteHandler(r))
+		default:
+			r.JSONHandler = m.leaderOnly(r.JSONHandler)
+			handler = hf.RouteHandler(r)
+		}
+		mux.Path(r.Path).Methods(r.Method).Handler(handler)
 	}
 	mux.Path("/api").Methods(http.MethodGet).Handler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 		url := req.URL.String() + "/spec.yaml"
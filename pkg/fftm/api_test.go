@@ -259,6 +259,95 @@ func TestSendInvalidDeployBadTXType(t *testing.T) {
 	assert.Regexp(t, "FF21022", errRes.Error)
 }
 
+func TestPrepareInvalidRequestBadTXType(t *testing.T) {
+
+	url, m, cancel := newTestManager(t)
+	defer cancel()
+	m.Start()
+
+	req := strings.NewReader(`{
+		"headers": {
+			"type": "PrepareTransaction"
+		},
+		"from": {
+			"Not": "a string"
+		}
+	}`)
+	var errRes fftypes.RESTError
+	res, err := resty.New().R().
+		SetBody(req).
+		SetError(&errRes).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode())
+	assert.Regexp(t, "FF21022", errRes.Error)
+}
+
+func TestSendRawTransaction(t *testing.T) {
+
+	url, m, cancel := newTestManager(t)
+	defer cancel()
+	noopPolicyEngine(m)
+	m.idempotentResubmit = true
+	mockTransactionDecode(m, "0xaaaaa", 100, "0x12345")
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("TransactionSendRaw", mock.Anything, mock.Anything).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: "0x12345",
+	}, ffcapi.ErrorReason(""), nil).Maybe()
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil).Maybe()
+	m.Start()
+
+	reqBody := `{
+		"headers": {
+			"id": "ns1:` + fftypes.NewUUID().String() + `",
+			"type": "SendRawTransaction"
+		},
+		"rawTransaction": "0xfeedbeef"
+	}`
+	var mtx apitypes.ManagedTX
+	res, err := resty.New().R().
+		SetBody(reqBody).
+		SetHeader("content-type", "application/json").
+		SetResult(&mtx).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, res.StatusCode())
+	assert.Equal(t, "0x12345", mtx.TransactionHash)
+	assert.Equal(t, int64(100), mtx.Nonce.Int64())
+
+	res, err = resty.New().R().
+		SetBody(reqBody).
+		SetHeader("content-type", "application/json").
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+}
+
+func TestSendRawTransactionBadRequest(t *testing.T) {
+
+	url, m, cancel := newTestManager(t)
+	defer cancel()
+	m.Start()
+
+	req := strings.NewReader(`{
+		"headers": {
+			"type": "SendRawTransaction"
+		},
+		"rawTransaction": {
+			"Not": "a string"
+		}
+	}`)
+	var errRes fftypes.RESTError
+	res, err := resty.New().R().
+		SetBody(req).
+		SetError(&errRes).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode())
+	assert.Regexp(t, "FF21022", errRes.Error)
+}
+
 func TestSwaggerEndpoints(t *testing.T) {
 
 	url, m, cancel := newTestManager(t)
@@ -326,6 +415,91 @@ func TestSendTransactionPrepareFail(t *testing.T) {
 
 }
 
+func TestSendTransactionIdempotentResubmit(t *testing.T) {
+
+	url, m, cancel := newTestManager(t)
+	defer cancel()
+	m.idempotentResubmit = true
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(12345),
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mFFC.On("TransactionPrepare", mock.Anything, mock.Anything).Return(&ffcapi.TransactionPrepareResponse{
+		TransactionData: "RAW_UNSIGNED_BYTES",
+		Gas:             fftypes.NewFFBigInt(2000000),
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mFFC.On("TransactionSend", mock.Anything, mock.Anything).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x106215b9c0c9372e3f541beff0cdc3cd061a26f69f3808e28fd139a1abc9d345",
+	}, ffcapi.ErrorReason(""), nil).Maybe()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil).Maybe()
+
+	m.Start()
+
+	var tx1, tx2 apitypes.ManagedTX
+	res, err := resty.New().R().
+		SetBody(strings.NewReader(sampleSendTX)).
+		SetResult(&tx1).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, res.StatusCode())
+
+	res, err = resty.New().R().
+		SetBody(strings.NewReader(sampleSendTX)).
+		SetResult(&tx2).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Equal(t, tx1.ID, tx2.ID)
+	assert.Equal(t, tx1.SequenceID, tx2.SequenceID)
+
+	mFFC.AssertExpectations(t)
+}
+
+func TestDeployTransactionIdempotentResubmit(t *testing.T) {
+
+	url, m, cancel := newTestManager(t)
+	defer cancel()
+	m.idempotentResubmit = true
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(12345),
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mFFC.On("DeployContractPrepare", mock.Anything, mock.Anything).Return(&ffcapi.TransactionPrepareResponse{
+		TransactionData: "RAW_UNSIGNED_BYTES",
+		Gas:             fftypes.NewFFBigInt(2000000),
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mFFC.On("TransactionSend", mock.Anything, mock.Anything).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x106215b9c0c9372e3f541beff0cdc3cd061a26f69f3808e28fd139a1abc9d345",
+	}, ffcapi.ErrorReason(""), nil).Maybe()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil).Maybe()
+
+	m.Start()
+
+	var tx1, tx2 apitypes.ManagedTX
+	res, err := resty.New().R().
+		SetBody(strings.NewReader(sampleDeployTX)).
+		SetResult(&tx1).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, res.StatusCode())
+
+	res, err = resty.New().R().
+		SetBody(strings.NewReader(sampleDeployTX)).
+		SetResult(&tx2).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Equal(t, tx1.ID, tx2.ID)
+
+	mFFC.AssertExpectations(t)
+}
+
 func TestDeployContractPrepareFail(t *testing.T) {
 
 	url, m, cancel := newTestManager(t)
@@ -387,6 +561,42 @@ func TestQueryOK(t *testing.T) {
 
 }
 
+func TestQueryPinnedBlockOK(t *testing.T) {
+
+	url, m, cancel := newTestManager(t)
+	defer cancel()
+	m.Start()
+
+	mca := m.connector.(*ffcapimocks.API)
+	mca.On("QueryInvoke", mock.Anything, mock.MatchedBy(func(req *ffcapi.QueryInvokeRequest) bool {
+		return req.BlockNumber.Int64() == 12345 && req.BlockHash == "" && req.BlockTag == ""
+	})).Return(&ffcapi.QueryInvokeResponse{
+		Outputs: fftypes.JSONAnyPtr(`"some output data"`),
+	}, ffcapi.ErrorReason(""), nil)
+
+	var queryRes string
+	res, err := resty.New().R().
+		SetBody(`{
+				"headers": {
+					"id": "`+fftypes.NewUUID().String()+`",
+					"type": "Query"
+				},
+				"method": "some method details",
+				"blockNumber": "12345"
+			}`,
+		).
+		SetHeader("content-type", "application/json").
+		SetResult(&queryRes).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, res.StatusCode())
+
+	assert.Equal(t, `some output data`, queryRes)
+
+	mca.AssertExpectations(t)
+
+}
+
 func TestQueryFail(t *testing.T) {
 
 	url, m, cancel := newTestManager(t)
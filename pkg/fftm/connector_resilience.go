@@ -0,0 +1,405 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/retry"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// callPolicy is how calls to one connector method are made
+type callPolicy struct {
+	timeout    time.Duration
+	retryCount int
+	breaker    bool // the call is rejected while the circuit breaker is open, and its outcome counts towards the breaker
+}
+
+// The connector methods, each with whether it is subject to the timeout, to the circuit breaker, and to retries.
+// The contexts of calls that start an event stream or block listener can be used by the connector for
+// the lifetime of the stream, and the status probes must reach the connector to report on it.
+// Calls that submit a transaction are never retried here, as a submission that timed out might have reached
+// the node - so a retry could fail as a known transaction without returning the hash. The failure is returned
+// to the policy engine, which decides whether and when to submit again.
+var resilienceMethods = map[string]struct{ timeout, breaker, retry bool }{
+	"BlockInfoByHash":            {true, true, true},
+	"BlockInfoByNumber":          {true, true, true},
+	"NextNonceForSigner":         {true, true, true},
+	"BalanceForSigner":           {true, true, true},
+	"GasPriceEstimate":           {true, true, true},
+	"QueryInvoke":                {true, true, true},
+	"TransactionReceipt":         {true, true, true},
+	"TransactionPrepare":         {true, true, true},
+	"TransactionSend":            {true, true, false},
+	"TransactionSendRaw":         {true, true, false},
+	"TransactionDecode":          {true, true, true},
+	"DeployContractPrepare":      {true, true, true},
+	"EventStreamStart":           {false, true, true},
+	"EventStreamStopped":         {true, true, true},
+	"EventListenerVerifyOptions": {true, true, true},
+	"EventListenerAdd":           {true, true, true},
+	"EventListenerRemove":        {true, true, true},
+	"EventListenerHWM":           {true, true, true},
+	"NewBlockListener":           {false, true, true},
+	"IsLive":                     {true, false, true},
+	"IsReady":                    {true, false, true},
+}
+
+// resilientConnector is used by the manager, and everything it passes the connector to, in place of the
+// connector when resilience is configured. Each call has a timeout, is retried when it fails with one of
+// the retry reasons, and is rejected with reason downstream_down while the circuit breaker is open - so
+// a node that is down or flapping is handled the same way by every caller.
+type resilientConnector struct {
+	ffcapi.API
+	retry        *retry.Retry
+	retryReasons map[ffcapi.ErrorReason]bool
+	policies     map[string]*callPolicy
+	breaker      *circuitBreaker
+}
+
+type circuitBreaker struct {
+	mux          sync.Mutex
+	failures     int
+	resetTimeout time.Duration
+	reasons      map[ffcapi.ErrorReason]bool
+	status       apitypes.CircuitBreakerStatus
+}
+
+func reasonSet(reasons []string) map[ffcapi.ErrorReason]bool {
+	set := make(map[ffcapi.ErrorReason]bool)
+	for _, reason := range reasons {
+		set[ffcapi.ErrorReason(reason)] = true
+	}
+	return set
+}
+
+// newResilientConnector returns nil if no timeouts, retries or circuit breaker are configured, in
+// which case the connector is called directly
+func newResilientConnector(ctx context.Context, connector ffcapi.API) (*resilientConnector, error) {
+	timeout := config.GetDuration(tmconfig.ResilienceTimeout)
+	retryCount := config.GetInt(tmconfig.ResilienceRetryCount)
+	failures := config.GetInt(tmconfig.ResilienceCircuitBreakerFailures)
+	overrideCount := tmconfig.ResilienceMethodsConfig.ArraySize()
+	if timeout <= 0 && retryCount <= 0 && failures <= 0 && overrideCount == 0 {
+		return nil, nil
+	}
+
+	rc := &resilientConnector{
+		API: connector,
+		retry: &retry.Retry{
+			InitialDelay: config.GetDuration(tmconfig.ResilienceRetryInitDelay),
+			MaximumDelay: config.GetDuration(tmconfig.ResilienceRetryMaxDelay),
+			Factor:       config.GetFloat64(tmconfig.ResilienceRetryFactor),
+		},
+		retryReasons: reasonSet(config.GetStringSlice(tmconfig.ResilienceRetryReasons)),
+		policies:     make(map[string]*callPolicy),
+	}
+	for method, applies := range resilienceMethods {
+		policy := &callPolicy{breaker: applies.breaker && failures > 0}
+		if applies.timeout {
+			policy.timeout = timeout
+		}
+		if applies.retry {
+			policy.retryCount = retryCount
+		}
+		rc.policies[method] = policy
+	}
+	for i := 0; i < overrideCount; i++ {
+		overrideConfig := tmconfig.ResilienceMethodsConfig.ArrayEntry(i)
+		method := overrideConfig.GetString(tmconfig.ResilienceMethodName)
+		policy, ok := rc.policies[method]
+		if !ok {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgResilienceMethodUnknown, method, i)
+		}
+		if overrideConfig.GetString(tmconfig.ResilienceMethodTimeout) != "" && resilienceMethods[method].timeout {
+			policy.timeout = overrideConfig.GetDuration(tmconfig.ResilienceMethodTimeout)
+		}
+		if overrideConfig.GetString(tmconfig.ResilienceMethodRetryCount) != "" && resilienceMethods[method].retry {
+			policy.retryCount = overrideConfig.GetInt(tmconfig.ResilienceMethodRetryCount)
+		}
+	}
+	if failures > 0 {
+		rc.breaker = &circuitBreaker{
+			failures:     failures,
+			resetTimeout: config.GetDuration(tmconfig.ResilienceCircuitBreakerResetTimeout),
+			reasons:      reasonSet(config.GetStringSlice(tmconfig.ResilienceCircuitBreakerReasons)),
+			status:       apitypes.CircuitBreakerStatus{State: apitypes.CircuitBreakerStateClosed},
+		}
+	}
+	log.L(ctx).Infof("Connector resilience enabled: timeout=%s retries=%d circuitBreakerFailures=%d", timeout, retryCount, failures)
+	return rc, nil
+}
+
+// call makes a call to the connector under the policy for the method
+func (rc *resilientConnector) call(ctx context.Context, method string, fn func(ctx context.Context) (ffcapi.ErrorReason, error)) (reason ffcapi.ErrorReason, err error) {
+	policy := rc.policies[method]
+	err = rc.retry.Do(ctx, "", func(attempt int) (bool, error) {
+		if policy.breaker {
+			if err := rc.breaker.allow(ctx); err != nil {
+				reason = ffcapi.ErrorReasonDownstreamDown
+				return false, err
+			}
+		}
+		callCtx, cancelCtx := ctx, func() {}
+		if policy.timeout > 0 {
+			callCtx, cancelCtx = context.WithTimeout(ctx, policy.timeout)
+		}
+		reason, err = fn(callCtx)
+		if err != nil && callCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			log.L(ctx).Warnf("Connector call %s timed out: %s", method, err)
+			reason, err = ffcapi.ErrorReasonDownstreamDown, i18n.NewError(ctx, tmmsgs.MsgConnectorCallTimeout, method, policy.timeout)
+		}
+		cancelCtx()
+		if policy.breaker {
+			rc.breaker.record(ctx, reason, err)
+		}
+		retry := err != nil && attempt <= policy.retryCount && rc.retryReasons[reason]
+		if retry {
+			log.L(ctx).Warnf("Connector call %s failed (reason=%s) on attempt %d - retrying: %s", method, reason, attempt, err)
+		}
+		return retry, err
+	})
+	return reason, err
+}
+
+// allow returns an error if the call must be rejected, as the circuit breaker is open
+func (cb *circuitBreaker) allow(ctx context.Context) error {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	switch cb.status.State {
+	case apitypes.CircuitBreakerStateOpen:
+		remaining := cb.resetTimeout - time.Since(*cb.status.OpenedAt.Time())
+		if remaining > 0 {
+			return i18n.NewError(ctx, tmmsgs.MsgConnectorCircuitOpen, cb.status.ConsecutiveFailures, cb.status.LastFailureReason, remaining.Round(time.Millisecond))
+		}
+		log.L(ctx).Infof("Circuit breaker half open - testing the connector")
+		cb.status.State = apitypes.CircuitBreakerStateHalfOpen
+	case apitypes.CircuitBreakerStateHalfOpen:
+		// Only one call at a time tests the connector - its outcome is recorded before any other call is allowed
+		return i18n.NewError(ctx, tmmsgs.MsgConnectorCircuitOpen, cb.status.ConsecutiveFailures, cb.status.LastFailureReason, 0)
+	}
+	return nil
+}
+
+// record counts a call that failed with one of the breaker reasons towards opening the circuit breaker,
+// and closes the circuit breaker on any other outcome
+func (cb *circuitBreaker) record(ctx context.Context, reason ffcapi.ErrorReason, err error) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	if err == nil || !cb.reasons[reason] {
+		if cb.status.State != apitypes.CircuitBreakerStateClosed {
+			log.L(ctx).Infof("Circuit breaker closed after %d consecutive failures", cb.status.ConsecutiveFailures)
+		}
+		cb.status = apitypes.CircuitBreakerStatus{State: apitypes.CircuitBreakerStateClosed}
+		return
+	}
+	cb.status.ConsecutiveFailures++
+	cb.status.LastFailureReason = reason
+	cb.status.LastFailure = err.Error()
+	if cb.status.State == apitypes.CircuitBreakerStateHalfOpen || cb.status.ConsecutiveFailures >= cb.failures {
+		if cb.status.State != apitypes.CircuitBreakerStateOpen {
+			log.L(ctx).Errorf("Circuit breaker opened after %d consecutive failures (reason=%s): %s", cb.status.ConsecutiveFailures, reason, err)
+		}
+		cb.status.State = apitypes.CircuitBreakerStateOpen
+		cb.status.OpenedAt = fftypes.Now()
+	}
+}
+
+func (cb *circuitBreaker) getStatus() *apitypes.CircuitBreakerStatus {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	status := cb.status
+	return &status
+}
+
+func (rc *resilientConnector) BlockInfoByHash(ctx context.Context, req *ffcapi.BlockInfoByHashRequest) (res *ffcapi.BlockInfoByHashResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "BlockInfoByHash", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.BlockInfoByHash(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) BlockInfoByNumber(ctx context.Context, req *ffcapi.BlockInfoByNumberRequest) (res *ffcapi.BlockInfoByNumberResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "BlockInfoByNumber", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.BlockInfoByNumber(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) NextNonceForSigner(ctx context.Context, req *ffcapi.NextNonceForSignerRequest) (res *ffcapi.NextNonceForSignerResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "NextNonceForSigner", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.NextNonceForSigner(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) BalanceForSigner(ctx context.Context, req *ffcapi.BalanceForSignerRequest) (res *ffcapi.BalanceForSignerResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "BalanceForSigner", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.BalanceForSigner(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) GasPriceEstimate(ctx context.Context, req *ffcapi.GasPriceEstimateRequest) (res *ffcapi.GasPriceEstimateResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "GasPriceEstimate", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.GasPriceEstimate(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) QueryInvoke(ctx context.Context, req *ffcapi.QueryInvokeRequest) (res *ffcapi.QueryInvokeResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "QueryInvoke", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.QueryInvoke(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) TransactionReceipt(ctx context.Context, req *ffcapi.TransactionReceiptRequest) (res *ffcapi.TransactionReceiptResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "TransactionReceipt", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.TransactionReceipt(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) TransactionPrepare(ctx context.Context, req *ffcapi.TransactionPrepareRequest) (res *ffcapi.TransactionPrepareResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "TransactionPrepare", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.TransactionPrepare(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) TransactionSend(ctx context.Context, req *ffcapi.TransactionSendRequest) (res *ffcapi.TransactionSendResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "TransactionSend", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.TransactionSend(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) TransactionSendRaw(ctx context.Context, req *ffcapi.TransactionSendRawRequest) (res *ffcapi.TransactionSendRawResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "TransactionSendRaw", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.TransactionSendRaw(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) TransactionDecode(ctx context.Context, req *ffcapi.TransactionDecodeRequest) (res *ffcapi.TransactionDecodeResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "TransactionDecode", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.TransactionDecode(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) DeployContractPrepare(ctx context.Context, req *ffcapi.ContractDeployPrepareRequest) (res *ffcapi.TransactionPrepareResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "DeployContractPrepare", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.DeployContractPrepare(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) EventStreamStart(ctx context.Context, req *ffcapi.EventStreamStartRequest) (res *ffcapi.EventStreamStartResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "EventStreamStart", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.EventStreamStart(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) EventStreamStopped(ctx context.Context, req *ffcapi.EventStreamStoppedRequest) (res *ffcapi.EventStreamStoppedResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "EventStreamStopped", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.EventStreamStopped(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) EventListenerVerifyOptions(ctx context.Context, req *ffcapi.EventListenerVerifyOptionsRequest) (res *ffcapi.EventListenerVerifyOptionsResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "EventListenerVerifyOptions", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.EventListenerVerifyOptions(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) EventListenerAdd(ctx context.Context, req *ffcapi.EventListenerAddRequest) (res *ffcapi.EventListenerAddResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "EventListenerAdd", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.EventListenerAdd(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) EventListenerRemove(ctx context.Context, req *ffcapi.EventListenerRemoveRequest) (res *ffcapi.EventListenerRemoveResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "EventListenerRemove", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.EventListenerRemove(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) EventListenerHWM(ctx context.Context, req *ffcapi.EventListenerHWMRequest) (res *ffcapi.EventListenerHWMResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "EventListenerHWM", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.EventListenerHWM(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) NewBlockListener(ctx context.Context, req *ffcapi.NewBlockListenerRequest) (res *ffcapi.NewBlockListenerResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "NewBlockListener", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.NewBlockListener(ctx, req)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) IsLive(ctx context.Context) (res *ffcapi.LiveResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "IsLive", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.IsLive(ctx)
+		return reason, err
+	})
+	return res, reason, err
+}
+
+func (rc *resilientConnector) IsReady(ctx context.Context) (res *ffcapi.ReadyResponse, reason ffcapi.ErrorReason, err error) {
+	reason, err = rc.call(ctx, "IsReady", func(ctx context.Context) (ffcapi.ErrorReason, error) {
+		res, reason, err = rc.API.IsReady(ctx)
+		return reason, err
+	})
+	return res, reason, err
+}
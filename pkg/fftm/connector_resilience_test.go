@@ -0,0 +1,354 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestResilientConnector(t *testing.T, yaml string) (*resilientConnector, *ffcapimocks.API) {
+	InitConfig()
+	config.Set(tmconfig.ResilienceRetryInitDelay, "1ms")
+	readTestPolicyEngineInstances(t, yaml)
+	mca := &ffcapimocks.API{}
+	rc, err := newResilientConnector(context.Background(), mca)
+	assert.NoError(t, err)
+	return rc, mca
+}
+
+func TestNewResilientConnectorDisabledByDefault(t *testing.T) {
+	InitConfig()
+	rc, err := newResilientConnector(context.Background(), &ffcapimocks.API{})
+	assert.NoError(t, err)
+	assert.Nil(t, rc)
+}
+
+func TestNewResilientConnectorMethodOverrides(t *testing.T) {
+	rc, _ := newTestResilientConnector(t, `
+resilience:
+  timeout: 10s
+  retry:
+    count: 3
+  methods:
+  - name: TransactionPrepare
+    retryCount: 0
+  - name: TransactionSend
+    retryCount: 5
+  - name: BlockInfoByNumber
+    timeout: 1s
+  - name: EventStreamStart
+    timeout: 5s
+`)
+	assert.Nil(t, rc.breaker)
+	assert.Equal(t, &callPolicy{timeout: 10 * time.Second, retryCount: 0}, rc.policies["TransactionPrepare"])
+	assert.Equal(t, &callPolicy{timeout: 10 * time.Second, retryCount: 0}, rc.policies["TransactionSend"])
+	assert.Equal(t, &callPolicy{timeout: 10 * time.Second, retryCount: 0}, rc.policies["TransactionSendRaw"])
+	assert.Equal(t, &callPolicy{timeout: 10 * time.Second, retryCount: 3}, rc.policies["DeployContractPrepare"])
+	assert.Equal(t, &callPolicy{timeout: 1 * time.Second, retryCount: 3}, rc.policies["BlockInfoByNumber"])
+	assert.Equal(t, &callPolicy{timeout: 0, retryCount: 3}, rc.policies["EventStreamStart"])
+	assert.Equal(t, &callPolicy{timeout: 0, retryCount: 3}, rc.policies["NewBlockListener"])
+	assert.Equal(t, &callPolicy{timeout: 10 * time.Second, retryCount: 3}, rc.policies["IsReady"])
+	assert.True(t, rc.retryReasons[ffcapi.ErrorReasonDownstreamDown])
+}
+
+func TestNewResilientConnectorUnknownMethod(t *testing.T) {
+	InitConfig()
+	readTestPolicyEngineInstances(t, `
+resilience:
+  methods:
+  - name: SendTransaction
+    retryCount: 1
+`)
+	_, err := newResilientConnector(context.Background(), &ffcapimocks.API{})
+	assert.Regexp(t, "FF21127.*SendTransaction", err)
+}
+
+func TestNewManagerResilienceConfigFail(t *testing.T) {
+	testManagerCommonInit(t)
+	readTestPolicyEngineInstances(t, `
+resilience:
+  methods:
+  - name: wrong
+`)
+	m := newManager(context.Background(), &ffcapimocks.API{})
+	err := m.initServices(context.Background())
+	assert.Regexp(t, "FF21127", err)
+}
+
+func TestResilientConnectorRetriesDownstreamDown(t *testing.T) {
+	rc, mca := newTestResilientConnector(t, `
+resilience:
+  retry:
+    count: 2
+`)
+	mca.On("BlockInfoByNumber", mock.Anything, mock.Anything).
+		Return(nil, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), fmt.Errorf("pop")).Once()
+	mca.On("BlockInfoByNumber", mock.Anything, mock.Anything).
+		Return(&ffcapi.BlockInfoByNumberResponse{BlockInfo: ffcapi.BlockInfo{BlockHash: "0x12345"}}, ffcapi.ErrorReason(""), nil).Once()
+
+	res, reason, err := rc.BlockInfoByNumber(context.Background(), &ffcapi.BlockInfoByNumberRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	assert.Equal(t, "0x12345", res.BlockHash)
+	mca.AssertExpectations(t)
+}
+
+func TestResilientConnectorRetriesExhausted(t *testing.T) {
+	rc, mca := newTestResilientConnector(t, `
+resilience:
+  retry:
+    count: 2
+`)
+	mca.On("TransactionReceipt", mock.Anything, mock.Anything).
+		Return(nil, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), fmt.Errorf("pop")).Times(3)
+
+	_, reason, err := rc.TransactionReceipt(context.Background(), &ffcapi.TransactionReceiptRequest{})
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), reason)
+	mca.AssertExpectations(t)
+}
+
+func TestResilientConnectorNoRetrySend(t *testing.T) {
+	rc, mca := newTestResilientConnector(t, `
+resilience:
+  retry:
+    count: 2
+`)
+	// A send that timed out might have reached the node, so it is not retried
+	mca.On("TransactionSend", mock.Anything, mock.Anything).
+		Return(nil, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), fmt.Errorf("pop")).Once()
+
+	_, reason, err := rc.TransactionSend(context.Background(), &ffcapi.TransactionSendRequest{})
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), reason)
+	mca.AssertExpectations(t)
+}
+
+func TestResilientConnectorNoRetryOtherReason(t *testing.T) {
+	rc, mca := newTestResilientConnector(t, `
+resilience:
+  retry:
+    count: 2
+`)
+	mca.On("TransactionReceipt", mock.Anything, mock.Anything).
+		Return(nil, ffcapi.ErrorReasonNotFound, fmt.Errorf("pop")).Once()
+
+	_, reason, err := rc.TransactionReceipt(context.Background(), &ffcapi.TransactionReceiptRequest{})
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, ffcapi.ErrorReasonNotFound, reason)
+	mca.AssertExpectations(t)
+}
+
+func TestResilientConnectorTimeout(t *testing.T) {
+	rc, mca := newTestResilientConnector(t, `
+resilience:
+  timeout: 1ms
+`)
+	mca.On("BlockInfoByHash", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			<-args[0].(context.Context).Done()
+		}).
+		Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("context deadline exceeded")).Once()
+
+	_, reason, err := rc.BlockInfoByHash(context.Background(), &ffcapi.BlockInfoByHashRequest{})
+	assert.Regexp(t, "FF21129.*BlockInfoByHash", err)
+	assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), reason)
+	mca.AssertExpectations(t)
+}
+
+func TestResilientConnectorCircuitBreaker(t *testing.T) {
+	rc, mca := newTestResilientConnector(t, `
+resilience:
+  circuitBreaker:
+    failures: 2
+    resetTimeout: 1h
+`)
+	ctx := context.Background()
+	mca.On("NextNonceForSigner", mock.Anything, mock.Anything).
+		Return(nil, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), fmt.Errorf("pop")).Times(2)
+	mca.On("IsLive", mock.Anything).Return(&ffcapi.LiveResponse{Up: true}, ffcapi.ErrorReason(""), nil)
+
+	// A failure with another reason does not count
+	mca.On("BalanceForSigner", mock.Anything, mock.Anything).
+		Return(nil, ffcapi.ErrorReasonInvalidInputs, fmt.Errorf("pop")).Once()
+	_, _, err := rc.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{})
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, 0, rc.breaker.getStatus().ConsecutiveFailures)
+
+	for i := 0; i < 2; i++ {
+		_, _, err = rc.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{})
+		assert.Regexp(t, "pop", err)
+	}
+	status := rc.breaker.getStatus()
+	assert.Equal(t, apitypes.CircuitBreakerStateOpen, status.State)
+	assert.Equal(t, 2, status.ConsecutiveFailures)
+	assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), status.LastFailureReason)
+	assert.Equal(t, "pop", status.LastFailure)
+	assert.NotNil(t, status.OpenedAt)
+
+	// Calls fail without reaching the connector, apart from the status probes
+	_, reason, err := rc.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{})
+	assert.Regexp(t, "FF21128", err)
+	assert.Equal(t, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), reason)
+	live, _, err := rc.IsLive(ctx)
+	assert.NoError(t, err)
+	assert.True(t, live.Up)
+
+	mca.AssertExpectations(t)
+}
+
+func TestResilientConnectorCircuitBreakerHalfOpen(t *testing.T) {
+	rc, mca := newTestResilientConnector(t, `
+resilience:
+  circuitBreaker:
+    failures: 1
+    resetTimeout: 1ms
+`)
+	ctx := context.Background()
+	mca.On("GasPriceEstimate", mock.Anything, mock.Anything).
+		Return(nil, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), fmt.Errorf("pop")).Times(2)
+	mca.On("GasPriceEstimate", mock.Anything, mock.Anything).
+		Return(&ffcapi.GasPriceEstimateResponse{}, ffcapi.ErrorReason(""), nil).Once()
+
+	_, _, err := rc.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, apitypes.CircuitBreakerStateOpen, rc.breaker.getStatus().State)
+
+	// The test call after the reset timeout fails, so the breaker opens again
+	time.Sleep(2 * time.Millisecond)
+	_, _, err = rc.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, apitypes.CircuitBreakerStateOpen, rc.breaker.getStatus().State)
+	assert.Equal(t, 2, rc.breaker.getStatus().ConsecutiveFailures)
+
+	// Only one call at a time tests the connector
+	time.Sleep(2 * time.Millisecond)
+	assert.NoError(t, rc.breaker.allow(ctx))
+	assert.Equal(t, apitypes.CircuitBreakerStateHalfOpen, rc.breaker.getStatus().State)
+	assert.Regexp(t, "FF21128", rc.breaker.allow(ctx))
+	rc.breaker.record(ctx, ffcapi.ErrorReasonDownstreamDown, fmt.Errorf("pop"))
+	time.Sleep(2 * time.Millisecond)
+
+	// The test call succeeds, so the breaker closes
+	_, _, err = rc.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, &apitypes.CircuitBreakerStatus{State: apitypes.CircuitBreakerStateClosed}, rc.breaker.getStatus())
+	assert.NoError(t, rc.breaker.allow(ctx))
+
+	mca.AssertExpectations(t)
+}
+
+func TestResilientConnectorPassesThroughEveryMethod(t *testing.T) {
+	rc, mca := newTestResilientConnector(t, `
+resilience:
+  timeout: 1m
+  retry:
+    count: 1
+  circuitBreaker:
+    failures: 1
+`)
+	ctx := context.Background()
+	for method := range resilienceMethods {
+		if method == "IsLive" || method == "IsReady" {
+			mca.On(method, mock.Anything).Return(nil, ffcapi.ErrorReason(""), nil).Once()
+		} else {
+			mca.On(method, mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), nil).Once()
+		}
+	}
+	calls := map[string]func() error{
+		"BlockInfoByHash":   func() error { _, _, err := rc.BlockInfoByHash(ctx, nil); return err },
+		"BlockInfoByNumber": func() error { _, _, err := rc.BlockInfoByNumber(ctx, nil); return err },
+		"NextNonceForSigner": func() error {
+			_, _, err := rc.NextNonceForSigner(ctx, nil)
+			return err
+		},
+		"BalanceForSigner":   func() error { _, _, err := rc.BalanceForSigner(ctx, nil); return err },
+		"GasPriceEstimate":   func() error { _, _, err := rc.GasPriceEstimate(ctx, nil); return err },
+		"QueryInvoke":        func() error { _, _, err := rc.QueryInvoke(ctx, nil); return err },
+		"TransactionReceipt": func() error { _, _, err := rc.TransactionReceipt(ctx, nil); return err },
+		"TransactionPrepare": func() error { _, _, err := rc.TransactionPrepare(ctx, nil); return err },
+		"TransactionSend":    func() error { _, _, err := rc.TransactionSend(ctx, nil); return err },
+		"TransactionSendRaw": func() error { _, _, err := rc.TransactionSendRaw(ctx, nil); return err },
+		"TransactionDecode":  func() error { _, _, err := rc.TransactionDecode(ctx, nil); return err },
+		"DeployContractPrepare": func() error {
+			_, _, err := rc.DeployContractPrepare(ctx, nil)
+			return err
+		},
+		"EventStreamStart":   func() error { _, _, err := rc.EventStreamStart(ctx, nil); return err },
+		"EventStreamStopped": func() error { _, _, err := rc.EventStreamStopped(ctx, nil); return err },
+		"EventListenerVerifyOptions": func() error {
+			_, _, err := rc.EventListenerVerifyOptions(ctx, nil)
+			return err
+		},
+		"EventListenerAdd":    func() error { _, _, err := rc.EventListenerAdd(ctx, nil); return err },
+		"EventListenerRemove": func() error { _, _, err := rc.EventListenerRemove(ctx, nil); return err },
+		"EventListenerHWM":    func() error { _, _, err := rc.EventListenerHWM(ctx, nil); return err },
+		"NewBlockListener":    func() error { _, _, err := rc.NewBlockListener(ctx, nil); return err },
+		"IsLive":              func() error { _, _, err := rc.IsLive(ctx); return err },
+		"IsReady":             func() error { _, _, err := rc.IsReady(ctx); return err },
+	}
+	assert.Len(t, calls, len(resilienceMethods))
+	for method, call := range calls {
+		assert.NoError(t, call(), method)
+	}
+	mca.AssertExpectations(t)
+}
+
+func TestGetReadyStatusCircuitBreakerOpen(t *testing.T) {
+	testManagerCommonInit(t)
+	config.Set(tmconfig.ResilienceCircuitBreakerFailures, 1)
+	mca := &ffcapimocks.API{}
+	m := newManager(context.Background(), mca)
+	mp := &persistencemocks.Persistence{}
+	mp.On("Close", mock.Anything).Return(nil).Maybe()
+	m.persistence = mp
+	err := m.initServices(context.Background())
+	assert.NoError(t, err)
+	defer m.Close()
+
+	mca.On("IsReady", mock.Anything).Return(&ffcapi.ReadyResponse{Ready: true}, ffcapi.ErrorReason(""), nil)
+	mca.On("BlockInfoByNumber", mock.Anything, mock.Anything).
+		Return(nil, ffcapi.ErrorReason(ffcapi.ErrorReasonDownstreamDown), fmt.Errorf("pop")).Once()
+
+	status, err := m.getReadyStatus(m.ctx)
+	assert.NoError(t, err)
+	assert.True(t, status.Ready)
+	assert.Equal(t, apitypes.CircuitBreakerStateClosed, status.CircuitBreaker.State)
+
+	_, _, err = m.connector.BlockInfoByNumber(m.ctx, &ffcapi.BlockInfoByNumberRequest{})
+	assert.Regexp(t, "pop", err)
+
+	status, err = m.getReadyStatus(m.ctx)
+	assert.NoError(t, err)
+	assert.False(t, status.Ready)
+	assert.Equal(t, apitypes.CircuitBreakerStateOpen, status.CircuitBreaker.State)
+	assert.Equal(t, 1, status.CircuitBreaker.ConsecutiveFailures)
+
+	mca.AssertExpectations(t)
+}
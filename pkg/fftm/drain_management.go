@@ -0,0 +1,163 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/events"
+	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+)
+
+const drainPollInterval = 100 * time.Millisecond
+
+// Drain stops accepting new transactions, waits for pending transactions to be submitted, and for
+// all event streams to deliver their in-flight batches and write final checkpoints, then closes
+// the manager. The whole operation is bounded by the configured drain timeout.
+func (m *manager) Drain() {
+	m.startDrain()
+	<-m.closed
+}
+
+// Done returns a channel that is closed once the manager has closed, including after a drain
+// triggered via the API or a signal
+func (m *manager) Done() <-chan struct{} {
+	return m.closed
+}
+
+func (m *manager) isDraining() bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.drainStarted != nil
+}
+
+func (m *manager) startDrain() *apitypes.DrainStatus {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.drainStarted == nil {
+		m.drainStarted = fftypes.Now()
+		go m.drainAndClose()
+	}
+	return &apitypes.DrainStatus{
+		Draining: true,
+		Started:  m.drainStarted,
+	}
+}
+
+func (m *manager) drainOnSignal() {
+	select {
+	case sig := <-m.signals:
+		log.L(m.ctx).Infof("Received %s signal - draining", sig)
+		m.startDrain()
+	case <-m.closed:
+	}
+}
+
+func (m *manager) drainAndClose() {
+	ctx, cancelCtx := context.WithTimeout(m.ctx, m.drainTimeout)
+	defer cancelCtx()
+
+	log.L(ctx).Infof("Draining transaction manager (timeout=%s)", m.drainTimeout)
+	m.waitPendingSubmissions(ctx)
+	m.drainStreams(ctx)
+	log.L(ctx).Infof("Drain complete")
+
+	m.close()
+}
+
+func (m *manager) waitPendingSubmissions(ctx context.Context) {
+	for {
+		pending, err := m.hasPendingSubmissions(ctx)
+		if err == nil && !pending {
+			return
+		}
+		if err != nil {
+			log.L(ctx).Warnf("Failed to check pending transactions during drain: %s", err)
+		}
+		// Prompt the policy loop to act on anything pending, rather than waiting for the next cycle
+		m.markInflightUpdate()
+		select {
+		case <-time.After(drainPollInterval):
+		case <-ctx.Done():
+			log.L(ctx).Warnf("Drain timed out waiting for pending transactions to be submitted")
+			return
+		}
+	}
+}
+
+func (m *manager) hasPendingSubmissions(ctx context.Context) (bool, error) {
+
+	// A locked nonce means a transaction is in the process of being accepted via the API.
+	// As the drain flag is checked under the nonce lock, no new locks are taken once we are draining.
+	m.mux.Lock()
+	p := m.persistence
+	lockedNonces := len(m.lockedNonces)
+	m.mux.Unlock()
+	// A follower that has not opened persistence has no transactions to submit
+	if p == nil {
+		return false, nil
+	}
+	if lockedNonces > 0 {
+		return true, nil
+	}
+
+	// Transactions for paused signers will not be submitted until they are resumed, and transactions prepared
+	// for external signing will not be submitted until they are supplied signed, so we do not wait for those
+	var after *fftypes.UUID
+	for {
+		pending, err := p.ListTransactionsPending(ctx, after, pendingCountPageSize, persistence.SortDirectionAscending)
+		if err != nil {
+			return false, err
+		}
+		for _, mtx := range pending {
+			awaitingSignature := mtx.SignExternally && mtx.RawTransaction == ""
+			if mtx.FirstSubmit == nil && !awaitingSignature && !m.isSignerPaused(mtx.TransactionHeaders.From) {
+				return true, nil
+			}
+		}
+		if len(pending) < pendingCountPageSize {
+			return false, nil
+		}
+		after = pending[len(pending)-1].SequenceID
+	}
+}
+
+func (m *manager) drainStreams(ctx context.Context) {
+	streams := []events.Stream{}
+	m.mux.Lock()
+	for _, s := range m.eventStreams {
+		streams = append(streams, s)
+	}
+	m.mux.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range streams {
+		wg.Add(1)
+		go func(s events.Stream) {
+			defer wg.Done()
+			if err := s.Drain(ctx); err != nil {
+				log.L(ctx).Debugf("Stream not drained: %s", err)
+			}
+		}(s)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,209 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/events"
+	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/eventsmocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDrainRejectsNewTransactions(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	err := m.Start()
+	assert.NoError(t, err)
+
+	status := m.startDrain()
+	assert.True(t, status.Draining)
+	assert.NotNil(t, status.Started)
+	assert.Equal(t, status.Started, m.startDrain().Started)
+
+	_, err = m.assignAndLockNonce(m.ctx, "ns1:"+fftypes.NewUUID().String(), "0xaaaaa")
+	assert.Regexp(t, "FF21086", err)
+
+	_, err = m.getReadyStatus(m.ctx)
+	assert.Regexp(t, "FF21086", err)
+
+	m.Drain()
+	<-m.Done()
+	m.Close()
+
+}
+
+func TestDrainWaitsForPendingSubmissions(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+
+	// Transactions for paused signers are not waited for
+	paused := sendSampleTX(t, m, "0xbbbbb", 12345)
+	m.pausedSigners[paused.TransactionHeaders.From] = &apitypes.SignerState{Signer: paused.TransactionHeaders.From, Paused: true}
+
+	// A nonce being assigned holds up the drain
+	locked := m.lockNonce(m.ctx, "ns1:"+fftypes.NewUUID().String(), "0xccccc")
+
+	m.startDrain()
+
+	pending, err := m.hasPendingSubmissions(m.ctx)
+	assert.NoError(t, err)
+	assert.True(t, pending)
+	locked.complete(m.ctx)
+
+	pending, err = m.hasPendingSubmissions(m.ctx)
+	assert.NoError(t, err)
+	assert.True(t, pending)
+
+	mtx.FirstSubmit = fftypes.Now()
+	err = m.persistence.WriteTransaction(m.ctx, mtx, false)
+	assert.NoError(t, err)
+
+	<-m.Done()
+
+}
+
+func TestDrainTimeout(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	sendSampleTX(t, m, "0xaaaaa", 12345)
+
+	m.drainTimeout = 1 * time.Millisecond
+	m.Drain()
+
+}
+
+func TestHasPendingSubmissionsPaging(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	page := make([]*apitypes.ManagedTX, pendingCountPageSize)
+	for i := range page {
+		page[i] = &apitypes.ManagedTX{SequenceID: apitypes.NewULID(), FirstSubmit: fftypes.Now()}
+	}
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsPending", m.ctx, (*fftypes.UUID)(nil), pendingCountPageSize, persistence.SortDirectionAscending).Return(page, nil)
+	mp.On("ListTransactionsPending", m.ctx, page[pendingCountPageSize-1].SequenceID, pendingCountPageSize, persistence.SortDirectionAscending).Return([]*apitypes.ManagedTX{}, nil)
+
+	pending, err := m.hasPendingSubmissions(m.ctx)
+	assert.NoError(t, err)
+	assert.False(t, pending)
+
+	mp.AssertExpectations(t)
+}
+
+func TestHasPendingSubmissionsLockedNonce(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	ln := m.lockNonce(m.ctx, "ns1:tx1", "0xaaaaa")
+	pending, err := m.hasPendingSubmissions(m.ctx)
+	assert.NoError(t, err)
+	assert.True(t, pending)
+	ln.complete(m.ctx)
+
+	// A follower that has not opened persistence has nothing to submit
+	m.persistence = nil
+	pending, err = m.hasPendingSubmissions(m.ctx)
+	assert.NoError(t, err)
+	assert.False(t, pending)
+
+}
+
+func TestDrainPendingListFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsPending", mock.Anything, (*fftypes.UUID)(nil), pendingCountPageSize, persistence.SortDirectionAscending).Return(nil, fmt.Errorf("pop"))
+
+	m.drainTimeout = 1 * time.Millisecond
+	m.Drain()
+
+	mp.AssertExpectations(t)
+}
+
+func TestDrainStreams(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsPending", mock.Anything, (*fftypes.UUID)(nil), pendingCountPageSize, persistence.SortDirectionAscending).Return([]*apitypes.ManagedTX{}, nil)
+
+	mes1 := &eventsmocks.Stream{}
+	mes1.On("Drain", mock.Anything).Return(nil)
+	mes2 := &eventsmocks.Stream{}
+	mes2.On("Drain", mock.Anything).Return(fmt.Errorf("pop"))
+	m.eventStreams = map[fftypes.UUID]events.Stream{
+		*fftypes.NewUUID(): mes1,
+		*fftypes.NewUUID(): mes2,
+	}
+
+	m.Drain()
+
+	mes1.AssertExpectations(t)
+	mes2.AssertExpectations(t)
+	mp.AssertExpectations(t)
+}
+
+func TestDrainOnSignal(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	err := m.Start()
+	assert.NoError(t, err)
+	assert.NotNil(t, m.signals)
+
+	m.signals <- syscall.SIGTERM
+	<-m.Done()
+	assert.True(t, m.isDraining())
+
+}
+
+func TestCloseStopsSignalHandler(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	err := m.Start()
+	assert.NoError(t, err)
+
+	m.Close()
+	<-m.Done()
+	assert.False(t, m.isDraining())
+
+}
@@ -0,0 +1,135 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+type failureAction string
+
+const (
+	failureActionFail  failureAction = "fail"
+	failureActionPark  failureAction = "park"
+	failureActionRetry failureAction = "retry"
+)
+
+// failureRule maps repeated errors returned by the policy engine for a transaction, to an outcome.
+// The rule is triggered once both the consecutive error count and the duration are reached.
+type failureRule struct {
+	reasons  map[ffcapi.ErrorReason]bool // empty matches any reason
+	failures int
+	duration time.Duration
+	action   failureAction
+}
+
+func newFailureRules(ctx context.Context) ([]*failureRule, error) {
+	ruleCount := tmconfig.TransactionsFailureRulesConfig.ArraySize()
+	rules := make([]*failureRule, ruleCount)
+	for i := 0; i < ruleCount; i++ {
+		ruleConfig := tmconfig.TransactionsFailureRulesConfig.ArrayEntry(i)
+		rule := &failureRule{
+			reasons:  make(map[ffcapi.ErrorReason]bool),
+			failures: ruleConfig.GetInt(tmconfig.FailureRuleFailures),
+			duration: ruleConfig.GetDuration(tmconfig.FailureRuleDuration),
+			action:   failureAction(ruleConfig.GetString(tmconfig.FailureRuleAction)),
+		}
+		for _, reason := range ruleConfig.GetStringSlice(tmconfig.FailureRuleReasons) {
+			rule.reasons[ffcapi.ErrorReason(reason)] = true
+		}
+		switch rule.action {
+		case failureActionFail, failureActionPark:
+			if rule.failures <= 0 && rule.duration <= 0 {
+				return nil, i18n.NewError(ctx, tmmsgs.MsgFailureRuleThresholdMissing, i)
+			}
+		case failureActionRetry:
+		default:
+			return nil, i18n.NewError(ctx, tmmsgs.MsgFailureRuleActionInvalid, rule.action, i)
+		}
+		rules[i] = rule
+	}
+	return rules, nil
+}
+
+// matchFailureRule returns the first rule that applies to the reason, if any
+func (m *manager) matchFailureRule(reason ffcapi.ErrorReason) *failureRule {
+	for _, rule := range m.failureRules {
+		if len(rule.reasons) == 0 || rule.reasons[reason] {
+			return rule
+		}
+	}
+	return nil
+}
+
+// triggered returns true if the consecutive errors for the transaction have reached the thresholds of the rule
+func (rule *failureRule) triggered(mtx *apitypes.ManagedTX) bool {
+	return rule.action != failureActionRetry &&
+		mtx.ConsecutiveErrors >= rule.failures &&
+		time.Since(*mtx.ErrorsSince.Time()) >= rule.duration
+}
+
+// applyFailureRule returns true if the transaction is now complete
+func (m *manager) applyFailureRule(ctx context.Context, mtx *apitypes.ManagedTX, rule *failureRule, reason ffcapi.ErrorReason) bool {
+	signer := mtx.TransactionHeaders.From
+	if rule.action == failureActionPark {
+		log.L(ctx).Errorf("Parking signer '%s' after %d consecutive errors for transaction %s (reason=%s)", signer, mtx.ConsecutiveErrors, mtx.ID, reason)
+		// The count restarts, so the rule is not triggered by the first error after the signer resumes
+		mtx.ConsecutiveErrors = 0
+		mtx.ErrorsSince = nil
+		m.parkSigner(ctx, mtx, reason)
+		return false
+	}
+
+	log.L(ctx).Errorf("Transaction %s failed after %d consecutive errors (reason=%s)", mtx.ID, mtx.ConsecutiveErrors, reason)
+	mtx.Status = apitypes.TxStatusFailed
+	if mtx.FirstSubmit == nil {
+		m.releaseUnsubmittedNonce(ctx, mtx)
+	}
+	return true
+}
+
+// releaseUnsubmittedNonce handles the nonce of a transaction that failed before it was ever submitted,
+// so the nonce is unused on chain. If no later nonce has been assigned to the signer, the nonce is re-used
+// for the next transaction. Otherwise the later transactions cannot be mined until the gap is filled,
+// so the signer is paused for an operator to resolve the gap - such as by setting the next nonce to the
+// unused nonce, submitting a transaction to fill it, then resuming the signer.
+func (m *manager) releaseUnsubmittedNonce(ctx context.Context, mtx *apitypes.ManagedTX) {
+	signer := mtx.TransactionHeaders.From
+	locked := m.lockNonce(ctx, "", signer)
+	later, err := m.persistence.ListTransactionsByNonce(ctx, signer, mtx.Nonce, 1, persistence.SortDirectionAscending)
+	if err == nil && len(later) == 0 {
+		log.L(ctx).Infof("Unused nonce %s of failed transaction %s will be assigned to the next transaction for signer '%s'", mtx.Nonce, mtx.ID, signer)
+		err = m.setNonceOverride(ctx, signer, mtx.Nonce.Uint64())
+	}
+	locked.complete(ctx)
+
+	if err != nil || len(later) > 0 {
+		log.L(ctx).Errorf("Failed transaction %s leaves unused nonce %s for signer '%s' before later transactions - pausing signer (err=%v)", mtx.ID, mtx.Nonce, signer, err)
+		if _, err := m.pauseSigner(ctx, signer); err != nil {
+			log.L(ctx).Errorf("Failed to pause signer '%s': %s", signer, err)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/policyenginemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func mockPolicyEngineError(m *manager, reason ffcapi.ErrorReason) *policyenginemocks.PolicyEngine {
+	mpe := &policyenginemocks.PolicyEngine{}
+	mpe.On("Execute", mock.Anything, mock.Anything, mock.Anything).
+		Return(policyengine.UpdateNo, reason, fmt.Errorf("pop"))
+	m.policyEngine = mpe
+	return mpe
+}
+
+func TestNewFailureRulesOK(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+transactions:
+  failureRules:
+  - reasons: [downstream_down]
+    action: retry
+  - reasons: [insufficient_funds]
+    failures: 3
+    action: park
+  - duration: 10m
+`)
+
+	rules, err := newFailureRules(m.ctx)
+	assert.NoError(t, err)
+	assert.Len(t, rules, 3)
+	assert.True(t, rules[0].reasons[ffcapi.ErrorReasonDownstreamDown])
+	assert.Equal(t, failureActionRetry, rules[0].action)
+	assert.Equal(t, 3, rules[1].failures)
+	assert.Equal(t, failureActionPark, rules[1].action)
+	assert.Empty(t, rules[2].reasons)
+	assert.Equal(t, 10*time.Minute, rules[2].duration)
+	assert.Equal(t, failureActionFail, rules[2].action)
+
+}
+
+func TestNewFailureRulesBadAction(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+transactions:
+  failureRules:
+  - failures: 3
+    action: explode
+`)
+
+	err := m.initServices(m.ctx)
+	assert.Regexp(t, "FF21092.*explode", err)
+
+}
+
+func TestNewFailureRulesMissingThreshold(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+transactions:
+  failureRules:
+  - reasons: [invalid_inputs]
+`)
+
+	_, err := newFailureRules(m.ctx)
+	assert.Regexp(t, "FF21093", err)
+
+}
+
+func TestMatchFailureRuleTriggered(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	m.failureRules = []*failureRule{
+		{reasons: map[ffcapi.ErrorReason]bool{ffcapi.ErrorReasonDownstreamDown: true}, action: failureActionRetry},
+		{reasons: map[ffcapi.ErrorReason]bool{ffcapi.ErrorReasonInvalidInputs: true}, failures: 2, action: failureActionFail},
+		{reasons: map[ffcapi.ErrorReason]bool{}, duration: 1 * time.Hour, action: failureActionPark},
+	}
+	assert.Equal(t, m.failureRules[0], m.matchFailureRule(ffcapi.ErrorReasonDownstreamDown))
+	assert.Equal(t, m.failureRules[1], m.matchFailureRule(ffcapi.ErrorReasonInvalidInputs))
+	assert.Equal(t, m.failureRules[2], m.matchFailureRule(""))
+
+	mtx := &apitypes.ManagedTX{
+		ConsecutiveErrors: 1,
+		ErrorsSince:       fftypes.Now(),
+	}
+	assert.False(t, m.failureRules[0].triggered(mtx))
+	assert.False(t, m.failureRules[1].triggered(mtx))
+	assert.False(t, m.failureRules[2].triggered(mtx))
+
+	mtx.ConsecutiveErrors = 2
+	assert.False(t, m.failureRules[0].triggered(mtx))
+	assert.True(t, m.failureRules[1].triggered(mtx))
+	assert.False(t, m.failureRules[2].triggered(mtx))
+
+	errorsSince := fftypes.FFTime(time.Now().Add(-2 * time.Hour))
+	mtx.ErrorsSince = &errorsSince
+	assert.False(t, m.failureRules[0].triggered(mtx))
+	assert.True(t, m.failureRules[2].triggered(mtx))
+
+	m.failureRules = m.failureRules[0:2]
+	assert.Nil(t, m.matchFailureRule(""))
+
+}
+
+func TestFailureRuleFailReusesNonce(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.failureRules = []*failureRule{
+		{reasons: map[ffcapi.ErrorReason]bool{}, failures: 2, action: failureActionFail},
+	}
+	mpe := mockPolicyEngineError(m, ffcapi.ErrorReasonInvalidInputs)
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	pending := &pendingState{mtx: mtx}
+
+	err := m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusPending, mtx.Status)
+	assert.Equal(t, 1, mtx.ConsecutiveErrors)
+	assert.False(t, pending.remove)
+
+	err = m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusFailed, mtx.Status)
+	assert.True(t, pending.remove)
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+	assert.Equal(t, uint64(12345), m.nonceOverrides["0xaaaaa"])
+
+	persisted, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusFailed, persisted.Status)
+	assert.Equal(t, 2, persisted.ConsecutiveErrors)
+
+	mpe.AssertExpectations(t)
+
+}
+
+func TestFailureRuleFailNonceGapPausesSigner(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.failureRules = []*failureRule{
+		{reasons: map[ffcapi.ErrorReason]bool{}, failures: 1, action: failureActionFail},
+	}
+	mockPolicyEngineError(m, ffcapi.ErrorReasonInvalidInputs)
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	sendSampleTX(t, m, "0xaaaaa", 12346)
+
+	pending := &pendingState{mtx: mtx}
+	err := m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusFailed, mtx.Status)
+	assert.True(t, m.isSignerPaused("0xaaaaa"))
+	_, overridden := m.nonceOverrides["0xaaaaa"]
+	assert.False(t, overridden)
+
+}
+
+func TestFailureRuleFailSubmittedKeepsNonce(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.failureRules = []*failureRule{
+		{reasons: map[ffcapi.ErrorReason]bool{}, failures: 1, action: failureActionFail},
+	}
+
+	mtx := &apitypes.ManagedTX{
+		ID:                 "ns1:" + fftypes.NewUUID().String(),
+		Nonce:              fftypes.NewFFBigInt(12345),
+		FirstSubmit:        fftypes.Now(),
+		ConsecutiveErrors:  1,
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaaa"},
+	}
+	completed := m.applyFailureRule(m.ctx, mtx, m.failureRules[0], ffcapi.ErrorReasonInvalidInputs)
+	assert.True(t, completed)
+	assert.Equal(t, apitypes.TxStatusFailed, mtx.Status)
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+	_, overridden := m.nonceOverrides["0xaaaaa"]
+	assert.False(t, overridden)
+
+}
+
+func TestFailureRuleParkSigner(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.failureRules = []*failureRule{
+		{reasons: map[ffcapi.ErrorReason]bool{ffcapi.ErrorReasonInsufficientFunds: true}, failures: 1, action: failureActionPark},
+	}
+	mockPolicyEngineError(m, ffcapi.ErrorReasonInsufficientFunds)
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	mtx.GasPrice = fftypes.JSONAnyPtr(`"10"`)
+	pending := &pendingState{mtx: mtx}
+
+	err := m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusPending, mtx.Status)
+	assert.Zero(t, mtx.ConsecutiveErrors)
+	assert.Nil(t, mtx.ErrorsSince)
+	assert.False(t, pending.remove)
+	assert.True(t, m.isSignerParked("0xaaaaa"))
+	assert.Equal(t, int64(1000000), m.pausedSigners["0xaaaaa"].RequiredBalance.Int64())
+
+}
+
+func TestFailureRuleRetryReason(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.failureRules = []*failureRule{
+		{reasons: map[ffcapi.ErrorReason]bool{ffcapi.ErrorReasonDownstreamDown: true}, action: failureActionRetry},
+		{reasons: map[ffcapi.ErrorReason]bool{}, failures: 1, action: failureActionFail},
+	}
+	mockPolicyEngineError(m, ffcapi.ErrorReasonDownstreamDown)
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	pending := &pendingState{mtx: mtx}
+
+	err := m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusPending, mtx.Status)
+	assert.Equal(t, 1, mtx.ConsecutiveErrors)
+	assert.False(t, pending.remove)
+
+}
+
+func TestFailureRuleCountResetOnSuccess(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	mpe := &policyenginemocks.PolicyEngine{}
+	mpe.On("Execute", mock.Anything, mock.Anything, mock.Anything).
+		Return(policyengine.UpdateNo, ffcapi.ErrorReasonInvalidInputs, fmt.Errorf("pop")).Once()
+	mpe.On("Execute", mock.Anything, mock.Anything, mock.Anything).
+		Return(policyengine.UpdateNo, ffcapi.ErrorReason(""), nil).Once()
+	m.policyEngine = mpe
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	pending := &pendingState{mtx: mtx}
+
+	err := m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mtx.ConsecutiveErrors)
+	assert.NotNil(t, mtx.ErrorsSince)
+
+	err = m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Zero(t, mtx.ConsecutiveErrors)
+	assert.Nil(t, mtx.ErrorsSince)
+
+	persisted, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Zero(t, persisted.ConsecutiveErrors)
+
+	mpe.AssertExpectations(t)
+
+}
+
+func TestFailureRuleParkFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("WriteSignerState", m.ctx, mock.Anything).Return(fmt.Errorf("pop"))
+
+	mtx := genTestTxn("0xaaaaa", 12345, apitypes.TxStatusPending)
+	mtx.ConsecutiveErrors = 1
+	completed := m.applyFailureRule(m.ctx, mtx, &failureRule{action: failureActionPark}, ffcapi.ErrorReasonInsufficientFunds)
+	assert.False(t, completed)
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+
+	mp.AssertExpectations(t)
+
+}
+
+func TestReleaseUnsubmittedNonceListFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mtx := genTestTxn("0xaaaaa", 12345, apitypes.TxStatusPending)
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", m.ctx, "0xaaaaa", mtx.Nonce, 1, mock.Anything).Return(nil, fmt.Errorf("pop"))
+	mp.On("WriteSignerState", m.ctx, mock.Anything).Return(fmt.Errorf("pop"))
+
+	m.releaseUnsubmittedNonce(m.ctx, mtx)
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+	_, overridden := m.nonceOverrides["0xaaaaa"]
+	assert.False(t, overridden)
+
+	mp.AssertExpectations(t)
+
+}
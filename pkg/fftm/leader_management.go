@@ -0,0 +1,206 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/leader"
+	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+)
+
+func (m *manager) initLeaderElection(ctx context.Context) error {
+	m.leaderMode = config.GetString(tmconfig.LeaderMode)
+	m.leaseDuration = config.GetDuration(tmconfig.LeaderLeaseDuration)
+	m.renewInterval = config.GetDuration(tmconfig.LeaderRenewInterval)
+
+	var store leader.LeaseStore
+	switch m.leaderMode {
+	case leader.ModeNone:
+		return nil
+	case leader.ModePersistence:
+		var err error
+		if store, err = persistence.NewLeaseStore(ctx, m.leaseDuration); err != nil {
+			return err
+		}
+	case leader.ModeFile:
+		var err error
+		if store, err = leader.NewFileLeaseStore(ctx, config.GetString(tmconfig.LeaderFilePath), m.leaseDuration); err != nil {
+			return err
+		}
+	default:
+		return i18n.NewError(ctx, tmmsgs.MsgLeaderModeUnknown, m.leaderMode)
+	}
+
+	// The leader steps down a renewal interval before its lease expires, so it must renew more often than that
+	if m.renewInterval <= 0 || m.renewInterval >= m.leaseDuration {
+		return i18n.NewError(ctx, tmmsgs.MsgLeaderRenewInterval, m.renewInterval, m.leaseDuration)
+	}
+
+	id := config.GetString(tmconfig.LeaderID)
+	if id == "" {
+		hostname, _ := os.Hostname()
+		id = fmt.Sprintf("%s/%s", hostname, fftypes.NewUUID())
+	}
+	m.elector = leader.NewLeaseElector(store, config.GetString(tmconfig.LeaderLeaseName), id, config.GetString(tmconfig.LeaderURL), m.leaseDuration)
+	return nil
+}
+
+func (m *manager) isLeader() bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.leading
+}
+
+func (m *manager) getLeaderStatus() *apitypes.LeaderStatus {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	status := &apitypes.LeaderStatus{
+		Mode:   m.leaderMode,
+		Leader: m.leading,
+		Lease:  m.leaderLease,
+	}
+	if m.elector != nil {
+		status.ID = m.elector.ID()
+	}
+	return status
+}
+
+// leaderOnly wraps the handler of a route, so it is only served by the leader, as a follower has not opened
+// persistence. Read-only requests are forwarded to the leader by forwardToLeader before reaching this check.
+func (m *manager) leaderOnly(handler func(r *ffapi.APIRequest) (output interface{}, err error)) func(r *ffapi.APIRequest) (output interface{}, err error) {
+	return func(r *ffapi.APIRequest) (output interface{}, err error) {
+		if !m.isLeader() {
+			holder := ""
+			if lease := m.getLeaderStatus().Lease; lease != nil {
+				holder = lease.Holder
+			}
+			return nil, i18n.NewError(r.Req.Context(), tmmsgs.MsgNotLeader, holder)
+		}
+		return handler(r)
+	}
+}
+
+// forwardedHeader marks a request forwarded by a follower, so it is never forwarded again - such as when
+// the lease has moved, and the instance it was forwarded to has not yet seen the change
+const forwardedHeader = "X-FFTM-Forwarded-By"
+
+// forwardToLeader wraps the handler of a read-only route, so that a follower serves it by forwarding the request
+// to the leader recorded in the lease. Followers do not open persistence, so cannot serve it themselves.
+// Without a current lease with a URL for the leader, the request is left to the handler to reject.
+func (m *manager) forwardToLeader(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		status := m.getLeaderStatus()
+		lease := status.Lease
+		if status.Leader || lease == nil || lease.URL == "" || lease.Holder == status.ID ||
+			lease.Expires == nil || time.Now().After(*lease.Expires.Time()) || req.Header.Get(forwardedHeader) != "" {
+			handler.ServeHTTP(res, req)
+			return
+		}
+		target, err := url.Parse(lease.URL)
+		if err != nil {
+			log.L(req.Context()).Errorf("Invalid URL '%s' for leader '%s': %s", lease.URL, lease.Holder, err)
+			handler.ServeHTTP(res, req)
+			return
+		}
+		log.L(req.Context()).Debugf("Forwarding %s %s to leader '%s' at %s", req.Method, req.URL.Path, lease.Holder, lease.URL)
+		req.Header.Set(forwardedHeader, status.ID)
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(res, req)
+	})
+}
+
+// leaderLoop periodically acquires or renews the leader lease. Once leadership is acquired the
+// leader services are started. If leadership is lost, the manager closes - as the leader services
+// cannot be safely restarted in-process, the instance must be restarted to rejoin as a follower.
+//
+// The leader steps down once a renewal interval before its lease could expire, measured from before
+// each renewal, so it has stopped before a follower can acquire the lease.
+func (m *manager) leaderLoop() {
+	defer close(m.leaderLoopDone)
+
+	var lastRenewed time.Time
+	for {
+		attempted := time.Now()
+		lease, err := m.elector.Acquire(m.ctx)
+		wasLeader := m.isLeader()
+		switch {
+		case err != nil:
+			log.L(m.ctx).Warnf("Failed to acquire leader lease: %s", err)
+		case lease.Holder == m.elector.ID():
+			lastRenewed = attempted
+			if !wasLeader {
+				log.L(m.ctx).Infof("Acquired leader lease '%s' as '%s'", lease.Name, lease.Holder)
+			}
+		default:
+			log.L(m.ctx).Debugf("Leader lease '%s' held by '%s' until %s", lease.Name, lease.Holder, lease.Expires)
+			lastRenewed = time.Time{}
+		}
+		if lease != nil {
+			m.mux.Lock()
+			m.leaderLease = lease
+			m.mux.Unlock()
+		}
+
+		stepDown := lastRenewed.Add(m.leaseDuration - m.renewInterval)
+		isLeader := !lastRenewed.IsZero() && time.Now().Before(stepDown)
+		if wasLeader && !isLeader {
+			log.L(m.ctx).Errorf("Lost leader lease - closing")
+			go m.close()
+			return
+		}
+		if !wasLeader && isLeader {
+			if err := m.startLeaderServices(); err != nil {
+				log.L(m.ctx).Errorf("Failed to start as leader - closing: %s", err)
+				go m.close()
+				return
+			}
+		}
+
+		// Try again to renew before we must step down, if that is sooner than the renewal interval
+		wait := m.renewInterval
+		if untilStepDown := time.Until(stepDown); isLeader && untilStepDown < wait {
+			wait = untilStepDown
+		}
+		select {
+		case <-time.After(wait):
+		case <-m.ctx.Done():
+			log.L(m.ctx).Debugf("Leader loop exiting")
+			return
+		}
+	}
+}
+
+func (m *manager) releaseLeadership() {
+	// We use a background context, as the manager context is cancelled by this point
+	if err := m.elector.Release(context.Background()); err != nil {
+		log.L(m.ctx).Warnf("Failed to release leader lease: %s", err)
+	}
+}
@@ -0,0 +1,415 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/leader"
+	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/confirmationsmocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testElector struct {
+	acquire    func() (*apitypes.LeaderLease, error)
+	releaseErr error
+}
+
+func (e *testElector) ID() string {
+	return "instance1"
+}
+
+func (e *testElector) Acquire(ctx context.Context) (*apitypes.LeaderLease, error) {
+	return e.acquire()
+}
+
+func (e *testElector) Release(ctx context.Context) error {
+	return e.releaseErr
+}
+
+func testLeaderLease(holder string) *apitypes.LeaderLease {
+	return &apitypes.LeaderLease{Name: "fftm", Holder: holder, Renewed: fftypes.Now()}
+}
+
+func newTestFileLeaderManager(t *testing.T, dbDir, leaseFile, id string) (string, *manager) {
+	return newTestLeaderManager(t, leader.ModeFile, dbDir, leaseFile, id)
+}
+
+func newTestLeaderManager(t *testing.T, mode, dbDir, leaseFile, id string) (string, *manager) {
+
+	url := testManagerCommonInit(t)
+	config.Set(tmconfig.PersistenceLevelDBPath, dbDir)
+	config.Set(tmconfig.LeaderMode, mode)
+	config.Set(tmconfig.LeaderFilePath, leaseFile)
+	config.Set(tmconfig.LeaderID, id)
+	config.Set(tmconfig.LeaderURL, url)
+	config.Set(tmconfig.LeaderRenewInterval, "10ms")
+
+	mca := &ffcapimocks.API{}
+	mca.On("NewBlockListener", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), nil).Maybe()
+	mm, err := NewManager(context.Background(), mca)
+	assert.NoError(t, err)
+
+	m := mm.(*manager)
+	mcm := &confirmationsmocks.Manager{}
+	mcm.On("Start").Return().Maybe()
+	m.confirmations = mcm
+
+	// Persistence is not opened until this instance is the leader
+	assert.Nil(t, m.persistence)
+	return url, m
+}
+
+func TestLeaderFailover(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "leader_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dbDir := path.Join(dir, "ldb")
+	leaseFile := path.Join(dir, "leader.json")
+
+	// Both instances share the same LevelDB path
+	url1, m1 := newTestFileLeaderManager(t, dbDir, leaseFile, "instance1")
+	defer m1.Close()
+	err = m1.Start()
+	assert.NoError(t, err)
+	assert.Eventually(t, m1.isLeader, 5*time.Second, time.Millisecond)
+
+	res, err := resty.New().R().
+		SetBody(struct{}{}).
+		Post(url1 + "/signers/0xaaaaa/pause")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+
+	url2, m2 := newTestFileLeaderManager(t, dbDir, leaseFile, "instance2")
+	defer m2.Close()
+	err = m2.Start()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return m2.getLeaderStatus().Lease != nil }, 5*time.Second, time.Millisecond)
+	assert.False(t, m2.isLeader())
+	assert.Nil(t, m2.persistence)
+
+	// The follower serves status requests
+	var status apitypes.LeaderStatus
+	res, err = resty.New().R().
+		SetResult(&status).
+		Get(url2 + "/status/leader")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.False(t, status.Leader)
+	assert.Equal(t, "instance2", status.ID)
+	assert.Equal(t, "instance1", status.Lease.Holder)
+
+	// ... and read-only requests, by forwarding them to the leader
+	var txns []*apitypes.ManagedTX
+	res, err = resty.New().R().
+		SetResult(&txns).
+		Get(url2 + "/transactions?limit=10")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Empty(t, txns)
+
+	// ... but never forwards a request that was already forwarded
+	var errRes fftypes.RESTError
+	res, err = resty.New().R().
+		SetHeader(forwardedHeader, "instance3").
+		SetError(&errRes).
+		Get(url2 + "/transactions")
+	assert.NoError(t, err)
+	assert.Equal(t, 503, res.StatusCode())
+	assert.Regexp(t, "FF21087.*instance1", errRes.Error)
+
+	// ... and rejects requests that change state
+	res, err = resty.New().R().
+		SetBody(struct{}{}).
+		SetError(&errRes).
+		Post(url2 + "/signers/0xaaaaa/pause")
+	assert.NoError(t, err)
+	assert.Equal(t, 503, res.StatusCode())
+	assert.Regexp(t, "FF21087.*instance1", errRes.Error)
+
+	// The leader closes persistence and releases the lease on close, and the follower takes over
+	// with the state persisted by the leader
+	m1.Close()
+	assert.Eventually(t, m2.isLeader, 5*time.Second, time.Millisecond)
+	assert.True(t, m2.isSignerPaused("0xaaaaa"))
+
+	res, err = resty.New().R().
+		Get(url2 + "/transactions")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+
+}
+
+func TestLeaderFailoverPersistenceLease(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "leader_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dbDir := path.Join(dir, "ldb")
+
+	// The lease is kept in the shared LevelDB directory, alongside the database the leader opens
+	_, m1 := newTestLeaderManager(t, leader.ModePersistence, dbDir, "", "instance1")
+	defer m1.Close()
+	err = m1.Start()
+	assert.NoError(t, err)
+	assert.Eventually(t, m1.isLeader, 5*time.Second, time.Millisecond)
+	_, err = m1.pauseSigner(m1.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+
+	_, m2 := newTestLeaderManager(t, leader.ModePersistence, dbDir, "", "instance2")
+	defer m2.Close()
+	err = m2.Start()
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return m2.getLeaderStatus().Lease != nil }, 5*time.Second, time.Millisecond)
+	assert.False(t, m2.isLeader())
+	assert.Equal(t, "instance1", m2.getLeaderStatus().Lease.Holder)
+
+	m1.Close()
+	assert.Eventually(t, m2.isLeader, 5*time.Second, time.Millisecond)
+	assert.True(t, m2.isSignerPaused("0xaaaaa"))
+
+}
+
+func TestForwardToLeaderNoLeader(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	handled := 0
+	handler := m.forwardToLeader(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		handled++
+	}))
+	expires := fftypes.FFTime(time.Now().Add(time.Minute))
+	expired := fftypes.FFTime(time.Now().Add(-time.Minute))
+	for _, lease := range []*apitypes.LeaderLease{
+		nil,
+		{Holder: "instance2", Expires: &expires}, // no URL for the leader
+		{Holder: "instance2", Expires: &expired, URL: "http://instance2"}, // expired
+		{Holder: "instance2", Expires: &expires, URL: "://instance2"},     // invalid URL
+		{Holder: "instance1", Expires: &expires, URL: "http://instance1"}, // this instance
+	} {
+		m.leaderLease = lease
+		m.elector = &testElector{}
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/transactions", nil))
+	}
+	assert.Equal(t, 5, handled)
+
+}
+
+func TestLeaderStartPersistenceFailCloses(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "leader_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tmpFile := path.Join(dir, "notadir")
+	err = ioutil.WriteFile(tmpFile, []byte{}, 0664)
+	assert.NoError(t, err)
+
+	_, m := newTestFileLeaderManager(t, tmpFile, path.Join(dir, "leader.json"), "instance1")
+	defer m.Close()
+
+	err = m.Start()
+	assert.NoError(t, err)
+	<-m.Done()
+	assert.False(t, m.isLeader())
+
+}
+
+func TestLeaderLostCloses(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	acquired := false
+	m.leaderMode = leader.ModeFile
+	m.leaseDuration = 1 * time.Minute
+	m.renewInterval = 1 * time.Millisecond
+	m.elector = &testElector{
+		acquire: func() (*apitypes.LeaderLease, error) {
+			if !acquired {
+				acquired = true
+				return testLeaderLease("instance1"), nil
+			}
+			return testLeaderLease("instance2"), nil
+		},
+	}
+
+	err := m.Start()
+	assert.NoError(t, err)
+	<-m.Done()
+
+}
+
+func TestLeaderLeaseExpiresOnRenewalFailure(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	var acquired time.Time
+	m.leaderMode = leader.ModeFile
+	m.leaseDuration = 1 * time.Second
+	m.renewInterval = 400 * time.Millisecond
+	m.elector = &testElector{
+		acquire: func() (*apitypes.LeaderLease, error) {
+			if acquired.IsZero() {
+				acquired = time.Now()
+				return testLeaderLease("instance1"), nil
+			}
+			return nil, fmt.Errorf("pop")
+		},
+	}
+
+	err := m.Start()
+	assert.NoError(t, err)
+	<-m.leaderLoopDone
+
+	// Stepped down a renewal interval before the lease expires, rather than after the next renewal interval
+	assert.Less(t, int64(time.Since(acquired)), int64(m.leaseDuration))
+	<-m.Done()
+
+}
+
+func TestLeaderStartFailCloses(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListStreams", mock.Anything, (*fftypes.UUID)(nil), startupPaginationLimit, persistence.SortDirectionAscending).Return(nil, fmt.Errorf("pop"))
+
+	m.leaderMode = leader.ModeFile
+	m.leaseDuration = 1 * time.Minute
+	m.renewInterval = 1 * time.Millisecond
+	m.elector = &testElector{
+		acquire: func() (*apitypes.LeaderLease, error) {
+			return testLeaderLease("instance1"), nil
+		},
+	}
+
+	err := m.Start()
+	assert.NoError(t, err)
+	<-m.Done()
+	assert.False(t, m.isLeader())
+
+}
+
+func TestLeaderReleaseFail(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.leaderMode = leader.ModeFile
+	m.leaseDuration = 1 * time.Minute
+	m.renewInterval = 30 * time.Second
+	m.elector = &testElector{
+		acquire: func() (*apitypes.LeaderLease, error) {
+			return testLeaderLease("instance1"), nil
+		},
+		releaseErr: fmt.Errorf("pop"),
+	}
+
+	err := m.Start()
+	assert.NoError(t, err)
+	assert.Eventually(t, m.isLeader, 5*time.Second, time.Millisecond)
+
+	m.Close()
+
+}
+
+func TestInitLeaderElection(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	err := m.initLeaderElection(m.ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, m.elector)
+	assert.True(t, m.isLeader() == false)
+
+	config.Set(tmconfig.LeaderMode, "file")
+	config.Set(tmconfig.LeaderFilePath, "/tmp/leader.json")
+	err = m.initLeaderElection(m.ctx)
+	assert.NoError(t, err)
+	hostname, _ := os.Hostname()
+	assert.Regexp(t, "^"+hostname+"/", m.elector.ID())
+
+	config.Set(tmconfig.LeaderID, "instance1")
+	err = m.initLeaderElection(m.ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "instance1", m.getLeaderStatus().ID)
+
+	config.Set(tmconfig.LeaderRenewInterval, "15s")
+	err = m.initLeaderElection(m.ctx)
+	assert.Regexp(t, "FF21132", err)
+	config.Set(tmconfig.LeaderRenewInterval, "5s")
+
+	config.Set(tmconfig.LeaderFilePath, "")
+	err = m.initLeaderElection(m.ctx)
+	assert.Regexp(t, "FF21089", err)
+
+	config.Set(tmconfig.LeaderMode, "wrong")
+	err = m.initLeaderElection(m.ctx)
+	assert.Regexp(t, "FF21088", err)
+
+	// The lease is kept with persistence, without opening it
+	dir, err := ioutil.TempDir("", "ldb_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config.Set(tmconfig.PersistenceLevelDBPath, dir)
+	config.Set(tmconfig.LeaderMode, "persistence")
+	err = m.initLeaderElection(m.ctx)
+	assert.NoError(t, err)
+	assert.NotNil(t, m.elector)
+
+	config.Set(tmconfig.PersistenceLevelDBPath, "")
+	err = m.initLeaderElection(m.ctx)
+	assert.Regexp(t, "FF21050", err)
+
+}
+
+func TestNewManagerBadLeaderMode(t *testing.T) {
+
+	testManagerCommonInit(t)
+	dir, err := ioutil.TempDir("", "ldb_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config.Set(tmconfig.PersistenceLevelDBPath, dir)
+	config.Set(tmconfig.LeaderMode, "wrong")
+
+	_, err = NewManager(context.Background(), nil)
+	assert.Regexp(t, "FF21088", err)
+
+}
@@ -19,7 +19,10 @@ package fftm
 import (
 	"context"
 	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/config"
@@ -30,6 +33,7 @@ import (
 	"github.com/hyperledger/firefly-transaction-manager/internal/blocklistener"
 	"github.com/hyperledger/firefly-transaction-manager/internal/confirmations"
 	"github.com/hyperledger/firefly-transaction-manager/internal/events"
+	"github.com/hyperledger/firefly-transaction-manager/internal/leader"
 	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
 	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
 	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
@@ -42,6 +46,8 @@ import (
 
 type Manager interface {
 	Start() error
+	Drain()
+	Done() <-chan struct{}
 	Close()
 }
 
@@ -49,14 +55,20 @@ type policyEngineAPIRequestType int
 
 const (
 	policyEngineAPIRequestTypeDelete policyEngineAPIRequestType = iota
+	policyEngineAPIRequestTypeReconfigure
+	policyEngineAPIRequestTypeSubmitSigned
 )
 
-// policyEngineAPIRequest requests are queued to the policy engine thread for processing against a given Transaction
+// policyEngineAPIRequest requests are queued to the policy engine thread for processing against a given Transaction,
+// or to swap in a newly configured policy engine between policy loop cycles
 type policyEngineAPIRequest struct {
-	requestType policyEngineAPIRequestType
-	txID        string
-	startTime   time.Time
-	response    chan policyEngineAPIResponse
+	requestType        policyEngineAPIRequestType
+	txID               string
+	policyEngine       policyengine.PolicyEngine
+	policyEngineConfig *apitypes.PolicyEngineConfig
+	rawTransaction     string
+	startTime          time.Time
+	response           chan policyEngineAPIResponse
 }
 
 type policyEngineAPIResponse struct {
@@ -66,22 +78,29 @@ type policyEngineAPIResponse struct {
 }
 
 type manager struct {
-	ctx            context.Context
-	cancelCtx      func()
-	retry          *retry.Retry
-	connector      ffcapi.API
-	confirmations  confirmations.Manager
-	policyEngine   policyengine.PolicyEngine
-	apiServer      httpserver.HTTPServer
-	wsServer       ws.WebSocketServer
-	persistence    persistence.Persistence
-	inflightStale  chan bool
-	inflightUpdate chan bool
-	inflight       []*pendingState
+	ctx                 context.Context
+	cancelCtx           func()
+	retry               *retry.Retry
+	connector           ffcapi.API
+	confirmations       confirmations.Manager
+	policyEngine        policyengine.PolicyEngine
+	policyEngineName    string
+	policyEngines       map[string]policyengine.PolicyEngine
+	policyEngineConfigs map[string]config.Section
+	apiServer           httpserver.HTTPServer
+	wsServer            ws.WebSocketServer
+	persistence         persistence.Persistence
+	inflightStale       chan bool
+	inflightUpdate      chan bool
+	inflight            []*pendingState
 
 	mux                     sync.Mutex
 	policyEngineAPIRequests []*policyEngineAPIRequest
 	lockedNonces            map[string]*lockedNonce
+	nonceOverrides          map[string]uint64
+	nonceCache              map[string]*spentNonce
+	nonceCacheEpoch         uint64
+	pausedSigners           map[string]*apitypes.SignerState
 	eventStreams            map[fftypes.UUID]events.Stream
 	streamsByName           map[string]*fftypes.UUID
 	policyLoopDone          chan struct{}
@@ -90,11 +109,35 @@ type manager struct {
 	apiServerDone           chan error
 	debugServer             *http.Server
 	debugServerDone         chan struct{}
+	drainStarted            *fftypes.FFTime
+	signals                 chan os.Signal
+	closeOnce               sync.Once
+	closed                  chan struct{}
+	elector                 leader.Elector
+	leaderMode              string
+	leading                 bool
+	leaderLease             *apitypes.LeaderLease
+	leaderLoopDone          chan struct{}
 
-	policyLoopInterval time.Duration
-	nonceStateTimeout  time.Duration
-	errorHistoryCount  int
-	maxInFlight        int
+	policyLoopInterval  time.Duration
+	policyLoopWorkers   int
+	workerStatus        []*apitypes.PolicyLoopWorkerStatus
+	nonceStateTimeout   time.Duration
+	errorHistoryCount   int
+	historyCount        int
+	maxInFlight         int
+	idempotentResubmit  bool
+	rawResubmitInterval time.Duration
+	rateLimiter         *signerRateLimiter
+	spendLimiter        *signerSpendLimiter
+	failureRules        []*failureRule
+	signerParking       *signerParking
+	signerPolicies      map[string]*signerPolicy
+	resilience          *resilientConnector
+	drainTimeout        time.Duration
+	drainSignal         bool
+	leaseDuration       time.Duration
+	renewInterval       time.Duration
 }
 
 func InitConfig() {
@@ -108,32 +151,72 @@ func NewManager(ctx context.Context, connector ffcapi.API) (Manager, error) {
 	if err = m.initServices(ctx); err != nil {
 		return nil, err
 	}
-	if err = m.initPersistence(ctx); err != nil {
+	if err = m.initLeaderElection(ctx); err != nil {
 		return nil, err
 	}
+	// With leader election, persistence is opened once this instance becomes the leader
+	if m.elector == nil {
+		if err = m.openPersistence(ctx); err != nil {
+			return nil, err
+		}
+	}
 	return m, nil
 }
 
+// openPersistence opens persistence, and restores the state persisted in a previous run. Only the leader
+// opens persistence, so it can be on storage shared by all the instances in an election - a LevelDB
+// database can only be opened by one process at a time.
+func (m *manager) openPersistence(ctx context.Context) (err error) {
+	if err = m.initPersistence(ctx); err != nil {
+		return err
+	}
+	if err = m.restorePolicyEngineConfig(ctx); err != nil {
+		return err
+	}
+	if err = m.restoreSignerStates(ctx); err != nil {
+		return err
+	}
+	return m.restoreSpendLimits(ctx)
+}
+
 func newManager(ctx context.Context, connector ffcapi.API) *manager {
 	m := &manager{
-		connector:     connector,
-		lockedNonces:  make(map[string]*lockedNonce),
-		apiServerDone: make(chan error),
-		eventStreams:  make(map[fftypes.UUID]events.Stream),
-		streamsByName: make(map[string]*fftypes.UUID),
-
-		policyLoopInterval: config.GetDuration(tmconfig.PolicyLoopInterval),
-		errorHistoryCount:  config.GetInt(tmconfig.TransactionsErrorHistoryCount),
-		maxInFlight:        config.GetInt(tmconfig.TransactionsMaxInFlight),
-		nonceStateTimeout:  config.GetDuration(tmconfig.TransactionsNonceStateTimeout),
-		inflightStale:      make(chan bool, 1),
-		inflightUpdate:     make(chan bool, 1),
+		connector:      connector,
+		lockedNonces:   make(map[string]*lockedNonce),
+		nonceOverrides: make(map[string]uint64),
+		nonceCache:     make(map[string]*spentNonce),
+		pausedSigners:  make(map[string]*apitypes.SignerState),
+		apiServerDone:  make(chan error),
+		eventStreams:   make(map[fftypes.UUID]events.Stream),
+		streamsByName:  make(map[string]*fftypes.UUID),
+
+		policyLoopInterval:  config.GetDuration(tmconfig.PolicyLoopInterval),
+		policyLoopWorkers:   config.GetInt(tmconfig.PolicyLoopWorkers),
+		errorHistoryCount:   config.GetInt(tmconfig.TransactionsErrorHistoryCount),
+		historyCount:        config.GetInt(tmconfig.TransactionsHistoryCount),
+		maxInFlight:         config.GetInt(tmconfig.TransactionsMaxInFlight),
+		nonceStateTimeout:   config.GetDuration(tmconfig.TransactionsNonceStateTimeout),
+		idempotentResubmit:  config.GetBool(tmconfig.TransactionsIdempotentResubmit),
+		rawResubmitInterval: config.GetDuration(tmconfig.TransactionsRawResubmitInterval),
+		drainTimeout:        config.GetDuration(tmconfig.DrainTimeout),
+		drainSignal:         config.GetBool(tmconfig.DrainSignal),
+		closed:              make(chan struct{}),
+		rateLimiter:         newSignerRateLimiter(),
+		inflightStale:       make(chan bool, 1),
+		inflightUpdate:      make(chan bool, 1),
 		retry: &retry.Retry{
 			InitialDelay: config.GetDuration(tmconfig.PolicyLoopRetryInitDelay),
 			MaximumDelay: config.GetDuration(tmconfig.PolicyLoopRetryMaxDelay),
 			Factor:       config.GetFloat64(tmconfig.PolicyLoopRetryFactor),
 		},
 	}
+	if m.policyLoopWorkers < 1 {
+		m.policyLoopWorkers = 1
+	}
+	m.workerStatus = make([]*apitypes.PolicyLoopWorkerStatus, m.policyLoopWorkers)
+	for i := range m.workerStatus {
+		m.workerStatus[i] = &apitypes.PolicyLoopWorkerStatus{Worker: i}
+	}
 	m.ctx, m.cancelCtx = context.WithCancel(ctx)
 	return m
 }
@@ -144,11 +227,39 @@ type pendingState struct {
 	confirmed               bool
 	remove                  bool
 	trackingTransactionHash string
+	history                 []*apitypes.ManagedTXHistoryEntry // actions from confirmation callbacks, added to the transaction by the policy loop
 }
 
 func (m *manager) initServices(ctx context.Context) (err error) {
+	m.resilience, err = newResilientConnector(ctx, m.connector)
+	if err != nil {
+		return err
+	}
+	if m.resilience != nil {
+		m.connector = m.resilience
+	}
 	m.confirmations = confirmations.NewBlockConfirmationManager(ctx, m.connector, "receipts")
-	m.policyEngine, err = policyengines.NewPolicyEngine(ctx, tmconfig.PolicyEngineBaseConfig, config.GetString(tmconfig.PolicyEngineName))
+	m.policyEngineName = config.GetString(tmconfig.PolicyEngineName)
+	m.policyEngine, err = policyengines.NewPolicyEngine(ctx, tmconfig.PolicyEngineBaseConfig, m.policyEngineName)
+	if err != nil {
+		return err
+	}
+	if err = m.initPolicyEngineInstances(ctx); err != nil {
+		return err
+	}
+	m.spendLimiter, err = newSignerSpendLimiter(ctx)
+	if err != nil {
+		return err
+	}
+	m.failureRules, err = newFailureRules(ctx)
+	if err != nil {
+		return err
+	}
+	m.signerParking, err = newSignerParking(ctx)
+	if err != nil {
+		return err
+	}
+	m.signerPolicies, err = newSignerPolicies(ctx)
 	if err != nil {
 		return err
 	}
@@ -164,9 +275,14 @@ func (m *manager) initPersistence(ctx context.Context) (err error) {
 	pType := config.GetString(tmconfig.PersistenceType)
 	switch pType {
 	case "leveldb":
-		if m.persistence, err = persistence.NewLevelDBPersistence(ctx); err != nil {
+		p, err := persistence.NewLevelDBPersistence(ctx)
+		if err != nil {
 			return i18n.NewError(ctx, tmmsgs.MsgPersistenceInitFail, pType, err)
 		}
+		// Set under the lock, as a drain can check for pending transactions while this instance is a follower
+		m.mux.Lock()
+		m.persistence = p
+		m.mux.Unlock()
 		return nil
 	default:
 		return i18n.NewError(ctx, tmmsgs.MsgUnknownPersistence, pType)
@@ -174,6 +290,39 @@ func (m *manager) initPersistence(ctx context.Context) (err error) {
 }
 
 func (m *manager) Start() error {
+	// Without leader election we are always the leader, and fail to start if the leader services fail
+	if m.elector == nil {
+		if err := m.startLeaderServices(); err != nil {
+			return err
+		}
+	}
+
+	m.debugServerDone = make(chan struct{})
+	go m.runDebugServer()
+	go m.runAPIServer()
+
+	if m.drainSignal {
+		m.signals = make(chan os.Signal, 1)
+		signal.Notify(m.signals, syscall.SIGTERM)
+		go m.drainOnSignal()
+	}
+
+	m.started = true
+	if m.elector != nil {
+		m.leaderLoopDone = make(chan struct{})
+		go m.leaderLoop()
+	}
+	return nil
+}
+
+// startLeaderServices starts the processing that must only run on one instance against a given set
+// of signers and event streams
+func (m *manager) startLeaderServices() error {
+	if m.persistence == nil {
+		if err := m.openPersistence(m.ctx); err != nil {
+			return err
+		}
+	}
 	if err := m.restoreStreams(); err != nil {
 		return err
 	}
@@ -185,19 +334,35 @@ func (m *manager) Start() error {
 		return err
 	}
 
-	m.debugServerDone = make(chan struct{})
-	go m.runDebugServer()
-	go m.runAPIServer()
 	m.policyLoopDone = make(chan struct{})
 	m.markInflightStale()
 	go m.policyLoop()
 	go m.confirmations.Start()
 
-	m.started = true
+	m.mux.Lock()
+	m.leading = true
+	m.mux.Unlock()
 	return nil
 }
 
 func (m *manager) Close() {
+	if m.isDraining() {
+		// The drain closes the manager once complete, or on timeout
+		<-m.closed
+		return
+	}
+	m.close()
+}
+
+func (m *manager) close() {
+	m.closeOnce.Do(m.doClose)
+}
+
+func (m *manager) doClose() {
+	defer close(m.closed)
+	if m.signals != nil {
+		signal.Stop(m.signals)
+	}
 	m.cancelCtx()
 	if m.started {
 		m.started = false
@@ -205,8 +370,14 @@ func (m *manager) Close() {
 			m.debugServer.Close()
 		}
 		<-m.apiServerDone
-		<-m.policyLoopDone
-		<-m.blockListenerDone
+		if m.leaderLoopDone != nil {
+			<-m.leaderLoopDone
+		}
+		leading := m.isLeader()
+		if leading {
+			<-m.policyLoopDone
+			<-m.blockListenerDone
+		}
 		<-m.debugServerDone
 
 		streams := []events.Stream{}
@@ -218,6 +389,14 @@ func (m *manager) Close() {
 		for _, s := range streams {
 			_ = s.Stop(m.ctx)
 		}
+		if m.persistence != nil {
+			m.persistence.Close(m.ctx)
+		}
+		// Persistence is closed before the lease is released, so the next leader can open it
+		if leading && m.elector != nil {
+			m.releaseLeadership()
+		}
+	} else if m.persistence != nil {
+		m.persistence.Close(m.ctx)
 	}
-	m.persistence.Close(m.ctx)
 }
@@ -26,6 +26,7 @@ import (
 	"testing"
 
 	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/httpserver"
 	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
 	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
@@ -35,9 +36,11 @@ import (
 	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengines"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengines/remote"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengines/simple"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
 const testManagerName = "unittest"
@@ -47,6 +50,7 @@ func strPtr(s string) *string { return &s }
 func testManagerCommonInit(t *testing.T) string {
 	InitConfig()
 	policyengines.RegisterEngine(&simple.PolicyEngineFactory{})
+	policyengines.RegisterEngine(&remote.PolicyEngineFactory{})
 	tmconfig.PolicyEngineBaseConfig.SubSection("simple").SubSection(simple.GasOracleConfig).Set(simple.GasOracleMode, simple.GasOracleModeDisabled)
 
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
@@ -161,6 +165,59 @@ func TestNewManagerBadPolicyEngine(t *testing.T) {
 
 }
 
+func TestNewManagerBadPersistedPolicyEngineConfig(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "ldb_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tmconfig.Reset()
+	config.Set(tmconfig.PersistenceLevelDBPath, dir)
+	tmconfig.APIConfig.Set(httpserver.HTTPConfPort, "0")
+
+	policyengines.RegisterEngine(&simple.PolicyEngineFactory{})
+	tmconfig.PolicyEngineBaseConfig.SubSection("simple").Set(simple.FixedGasPrice, "223344556677")
+
+	p, err := persistence.NewLevelDBPersistence(context.Background())
+	assert.NoError(t, err)
+	err = p.WritePolicyEngineConfig(context.Background(), &apitypes.PolicyEngineConfig{
+		Name: "simple",
+		Config: fftypes.JSONObject{
+			"gasOracle": map[string]interface{}{"mode": "restapi"},
+		},
+	})
+	assert.NoError(t, err)
+	p.Close(context.Background())
+
+	_, err = NewManager(context.Background(), nil)
+	assert.Regexp(t, "FF21071", err)
+
+}
+
+func TestNewManagerBadPersistedSignerState(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "ldb_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tmconfig.Reset()
+	config.Set(tmconfig.PersistenceLevelDBPath, dir)
+	tmconfig.APIConfig.Set(httpserver.HTTPConfPort, "0")
+
+	policyengines.RegisterEngine(&simple.PolicyEngineFactory{})
+	tmconfig.PolicyEngineBaseConfig.SubSection("simple").Set(simple.FixedGasPrice, "223344556677")
+
+	db, err := leveldb.OpenFile(dir, nil)
+	assert.NoError(t, err)
+	err = db.Put([]byte("signer_state_0/0xaaaaa"), []byte("!json"), nil)
+	assert.NoError(t, err)
+	db.Close()
+
+	_, err = NewManager(context.Background(), nil)
+	assert.Regexp(t, "FF21054", err)
+
+}
+
 func TestAddErrorMessageMax(t *testing.T) {
 
 	_, m, close := newTestManagerMockPersistence(t)
@@ -0,0 +1,208 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+const pendingCountPageSize = 100
+
+// getSignerNonceStatus reports the nonce state for a signer. The nonce lock is held while we
+// query, so the next nonce is the one the next submission for the signer would be assigned.
+func (m *manager) getSignerNonceStatus(ctx context.Context, signer string) (*apitypes.SignerNonceStatus, error) {
+	locked := m.lockNonce(ctx, "", signer)
+	status, err := m.buildSignerNonceStatus(ctx, signer)
+	locked.complete(ctx)
+	return m.completeSignerNonceStatus(ctx, status, err)
+}
+
+// setSignerNonce sets an override for the nonce of the next transaction submitted for the signer.
+// Re-issuing a nonce held by a pending transaction must be forced, as only one of the transactions
+// with that nonce can be mined.
+func (m *manager) setSignerNonce(ctx context.Context, signer string, req *apitypes.SignerNonceRequest) (*apitypes.SignerNonceStatus, error) {
+	if req.Nonce == nil || req.Nonce.Int().Sign() < 0 {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgNonceRequired)
+	}
+	locked := m.lockNonce(ctx, "", signer)
+	err := m.checkNonceNotPending(ctx, signer, req)
+	if err == nil {
+		err = m.setNonceOverride(ctx, signer, req.Nonce.Uint64())
+	}
+	var status *apitypes.SignerNonceStatus
+	if err == nil {
+		status, err = m.buildSignerNonceStatus(ctx, signer)
+	}
+	locked.complete(ctx)
+	return m.completeSignerNonceStatus(ctx, status, err)
+}
+
+// checkNonceNotPending returns an error if a pending transaction for the signer has the requested nonce, or
+// a later one, unless the request is forced. Must be called holding the nonce lock for the signer.
+func (m *manager) checkNonceNotPending(ctx context.Context, signer string, req *apitypes.SignerNonceRequest) error {
+	if req.Force {
+		return nil
+	}
+	var after *fftypes.FFBigInt
+	for {
+		txns, err := m.persistence.ListTransactionsByNonce(ctx, signer, after, pendingCountPageSize, persistence.SortDirectionDescending)
+		if err != nil {
+			return err
+		}
+		for _, mtx := range txns {
+			if mtx.Nonce.Int().Cmp(req.Nonce.Int()) < 0 {
+				return nil
+			}
+			if mtx.Status == apitypes.TxStatusPending {
+				return i18n.NewError(ctx, tmmsgs.MsgNonceHeldByPending, signer, req.Nonce, mtx.Nonce, mtx.ID)
+			}
+		}
+		if len(txns) < pendingCountPageSize {
+			return nil
+		}
+		after = txns[len(txns)-1].Nonce
+	}
+}
+
+// resyncSignerNonce sets an override for the nonce of the next transaction submitted for the signer,
+// to the next nonce reported by the node
+func (m *manager) resyncSignerNonce(ctx context.Context, signer string) (*apitypes.SignerNonceStatus, error) {
+	locked := m.lockNonce(ctx, "", signer)
+	nodeNextNonce, err := m.nodeNextNonce(ctx, signer)
+	if err == nil {
+		err = m.setNonceOverride(ctx, signer, nodeNextNonce.Uint64())
+	}
+	var status *apitypes.SignerNonceStatus
+	if err == nil {
+		if status, err = m.buildSignerNonceStatus(ctx, signer); err == nil {
+			status.NodeNextNonce = nodeNextNonce
+		}
+	}
+	locked.complete(ctx)
+	return m.completeSignerNonceStatus(ctx, status, err)
+}
+
+// setNonceOverride persists the override in the signer state, so it survives a restart.
+// Must be called holding the nonce lock for the signer.
+func (m *manager) setNonceOverride(ctx context.Context, signer string, nonce uint64) error {
+	m.mux.Lock()
+	previous, hadPrevious := m.nonceOverrides[signer]
+	m.nonceOverrides[signer] = nonce
+	m.mux.Unlock()
+	if err := m.writeNonceOverride(ctx, signer); err != nil {
+		m.mux.Lock()
+		if hadPrevious {
+			m.nonceOverrides[signer] = previous
+		} else {
+			delete(m.nonceOverrides, signer)
+		}
+		m.mux.Unlock()
+		return err
+	}
+	log.L(ctx).Infof("Next nonce for signer %s set to %d", signer, nonce)
+	return nil
+}
+
+// clearNonceOverride removes the override once a transaction has been assigned the nonce.
+// Must be called holding the nonce lock for the signer.
+func (m *manager) clearNonceOverride(ctx context.Context, signer string) {
+	m.mux.Lock()
+	delete(m.nonceOverrides, signer)
+	m.mux.Unlock()
+	if err := m.writeNonceOverride(ctx, signer); err != nil {
+		// On restart the override is discarded, as a transaction was created with it after it was set
+		log.L(ctx).Errorf("Failed to clear the next nonce override for signer %s: %s", signer, err)
+	}
+}
+
+func (m *manager) nodeNextNonce(ctx context.Context, signer string) (*fftypes.FFBigInt, error) {
+	res, _, err := m.connector.NextNonceForSigner(ctx, &ffcapi.NextNonceForSignerRequest{
+		Signer: signer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Nonce, nil
+}
+
+// buildSignerNonceStatus must be called holding the nonce lock for the signer
+func (m *manager) buildSignerNonceStatus(ctx context.Context, signer string) (*apitypes.SignerNonceStatus, error) {
+	status := &apitypes.SignerNonceStatus{
+		Signer: signer,
+		Paused: m.isSignerPaused(signer),
+	}
+
+	nextNonce, err := m.calcNextNonce(ctx, signer)
+	if err != nil {
+		return nil, err
+	}
+	status.NextNonce = fftypes.NewFFBigInt(int64(nextNonce))
+
+	txns, err := m.persistence.ListTransactionsByNonce(ctx, signer, nil, 1, persistence.SortDirectionDescending)
+	if err != nil {
+		return nil, err
+	}
+	if len(txns) > 0 {
+		status.HighestPersistedNonce = txns[0].Nonce
+	}
+
+	m.mux.Lock()
+	_, status.Override = m.nonceOverrides[signer]
+	m.mux.Unlock()
+
+	return status, nil
+}
+
+// completeSignerNonceStatus adds the parts of the status that do not depend on the nonce lock, once it
+// has been released, so that querying the node and the pending index does not hold up submissions
+func (m *manager) completeSignerNonceStatus(ctx context.Context, status *apitypes.SignerNonceStatus, err error) (*apitypes.SignerNonceStatus, error) {
+	if err != nil {
+		return nil, err
+	}
+	if status.NodeNextNonce == nil {
+		if status.NodeNextNonce, err = m.nodeNextNonce(ctx, status.Signer); err != nil {
+			return nil, err
+		}
+	}
+
+	// The pending index is not partitioned by signer, so we page through it
+	var after *fftypes.UUID
+	for {
+		pending, err := m.persistence.ListTransactionsPending(ctx, after, pendingCountPageSize, persistence.SortDirectionAscending)
+		if err != nil {
+			return nil, err
+		}
+		for _, mtx := range pending {
+			if mtx.TransactionHeaders.From == status.Signer {
+				status.Pending++
+			}
+		}
+		if len(pending) < pendingCountPageSize {
+			break
+		}
+		after = pending[len(pending)-1].SequenceID
+	}
+	return status, nil
+}
@@ -0,0 +1,359 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func writeNonceTestTX(t *testing.T, m *manager, signer string, nonce int64, status apitypes.TxStatus) {
+	err := m.persistence.WriteTransaction(m.ctx, &apitypes.ManagedTX{
+		ID:         fmt.Sprintf("ns1:%s", fftypes.NewUUID()),
+		Created:    fftypes.Now(),
+		Status:     status,
+		SequenceID: apitypes.NewULID(),
+		Nonce:      fftypes.NewFFBigInt(nonce),
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From: signer,
+		},
+	}, true)
+	assert.NoError(t, err)
+}
+
+func TestSignerNonceOverrideLifecycle(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	writeNonceTestTX(t, m, "0xaaaaa", 9, apitypes.TxStatusSucceeded)
+	writeNonceTestTX(t, m, "0xaaaaa", 10, apitypes.TxStatusPending)
+	writeNonceTestTX(t, m, "0xbbbbb", 50, apitypes.TxStatusPending)
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, &ffcapi.NextNonceForSignerRequest{
+		Signer: "0xaaaaa",
+	}).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(20),
+	}, ffcapi.ErrorReason(""), nil)
+
+	status, err := m.getSignerNonceStatus(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, "0xaaaaa", status.Signer)
+	assert.Equal(t, int64(11), status.NextNonce.Int64())
+	assert.Equal(t, int64(20), status.NodeNextNonce.Int64())
+	assert.Equal(t, int64(10), status.HighestPersistedNonce.Int64())
+	assert.Equal(t, 1, status.Pending)
+	assert.False(t, status.Override)
+
+	// Re-issuing a nonce at or below that of a pending transaction must be forced
+	_, err = m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{Nonce: fftypes.NewFFBigInt(10)})
+	assert.Regexp(t, "FF21130.*10", err)
+	_, err = m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{Nonce: fftypes.NewFFBigInt(5)})
+	assert.Regexp(t, "FF21130.*5", err)
+	assert.Empty(t, m.nonceOverrides)
+
+	status, err = m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{Nonce: fftypes.NewFFBigInt(5), Force: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), status.NextNonce.Int64())
+	assert.True(t, status.Override)
+
+	// The override is persisted with the signer state
+	states, err := m.persistence.ListSignerStates(m.ctx)
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.Equal(t, int64(5), states[0].NextNonce.Int64())
+	assert.False(t, states[0].Paused)
+
+	// An unspent nonce leaves the override in place
+	ln, err := m.assignAndLockNonce(m.ctx, "ns1:unspent", "0xaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), ln.nonce)
+	ln.complete(m.ctx)
+
+	// Spending the nonce uses up the override
+	ln, err = m.assignAndLockNonce(m.ctx, "ns1:spent", "0xaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), ln.nonce)
+	ln.spent = &apitypes.ManagedTX{ID: "ns1:spent", Created: fftypes.Now()}
+	ln.complete(m.ctx)
+
+	status, err = m.getSignerNonceStatus(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), status.NextNonce.Int64())
+	assert.False(t, status.Override)
+	states, err = m.persistence.ListSignerStates(m.ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, states[0].NextNonce)
+
+	status, err = m.resyncSignerNonce(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), status.NextNonce.Int64())
+	assert.True(t, status.Override)
+
+}
+
+func TestSetSignerNonceAfterPending(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	writeNonceTestTX(t, m, "0xaaaaa", 10, apitypes.TxStatusPending)
+	for i := int64(11); i < 11+pendingCountPageSize; i++ {
+		writeNonceTestTX(t, m, "0xaaaaa", i, apitypes.TxStatusFailed)
+	}
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(20),
+	}, ffcapi.ErrorReason(""), nil)
+
+	// Transactions that are no longer pending do not prevent the nonce being re-issued
+	status, err := m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{Nonce: fftypes.NewFFBigInt(11)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), status.NextNonce.Int64())
+
+	// But the pending transaction on the second page does
+	_, err = m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{Nonce: fftypes.NewFFBigInt(10)})
+	assert.Regexp(t, "FF21130", err)
+	assert.Equal(t, uint64(11), m.nonceOverrides["0xaaaaa"])
+
+}
+
+func TestSetSignerNonceCheckFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0xaaaaa", mock.Anything, pendingCountPageSize, mock.Anything).Return(nil, fmt.Errorf("pop"))
+
+	_, err := m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{Nonce: fftypes.NewFFBigInt(5)})
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestSetSignerNonceWriteFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	m.nonceOverrides["0xaaaaa"] = 3
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("WriteSignerState", mock.Anything, mock.Anything).Return(fmt.Errorf("pop"))
+
+	_, err := m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{Nonce: fftypes.NewFFBigInt(5), Force: true})
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, uint64(3), m.nonceOverrides["0xaaaaa"])
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(20),
+	}, ffcapi.ErrorReason(""), nil)
+	_, err = m.resyncSignerNonce(m.ctx, "0xbbbbb")
+	assert.Regexp(t, "pop", err)
+	assert.NotContains(t, m.nonceOverrides, "0xbbbbb")
+
+}
+
+func TestSetSignerNonceKeepsPausedState(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	m.pausedSigners["0xaaaaa"] = &apitypes.SignerState{Signer: "0xaaaaa", Paused: true, Reason: "maintenance"}
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("WriteSignerState", mock.Anything, mock.MatchedBy(func(state *apitypes.SignerState) bool {
+		return state.Signer == "0xaaaaa" && state.Paused && state.Reason == "maintenance" && state.NextNonce.Int64() == 5
+	})).Return(nil)
+
+	err := m.setNonceOverride(m.ctx, "0xaaaaa", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(5), m.nonceOverrides["0xaaaaa"])
+	assert.True(t, m.isSignerPaused("0xaaaaa"))
+
+	mp.AssertExpectations(t)
+}
+
+func TestClearNonceOverrideWriteFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	m.nonceOverrides["0xaaaaa"] = 5
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("WriteSignerState", mock.Anything, mock.Anything).Return(fmt.Errorf("pop"))
+
+	ln := m.lockNonce(m.ctx, "ns1:spent", "0xaaaaa")
+	ln.nonce = 5
+	ln.spent = &apitypes.ManagedTX{ID: "ns1:spent", Created: fftypes.Now()}
+	ln.complete(m.ctx)
+	assert.Empty(t, m.nonceOverrides)
+
+}
+
+func TestRestoreNonceOverride(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	setAt := fftypes.Now()
+	writeNonceTestTX(t, m, "0xaaaaa", 5, apitypes.TxStatusPending)
+	for _, state := range []*apitypes.SignerState{
+		// Set before the transaction with the nonce was created, so used
+		{Signer: "0xaaaaa", NextNonce: fftypes.NewFFBigInt(5), Updated: setAt},
+		// Not yet used
+		{Signer: "0xbbbbb", NextNonce: fftypes.NewFFBigInt(7), Updated: setAt, Paused: true},
+	} {
+		err := m.persistence.WriteSignerState(m.ctx, state)
+		assert.NoError(t, err)
+	}
+
+	err := m.restoreSignerStates(m.ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"0xbbbbb": 7}, m.nonceOverrides)
+	assert.True(t, m.isSignerPaused("0xbbbbb"))
+
+}
+
+func TestRestoreNonceOverrideFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListSignerStates", mock.Anything).Return([]*apitypes.SignerState{
+		{Signer: "0xaaaaa", NextNonce: fftypes.NewFFBigInt(5)},
+	}, nil)
+	mp.On("GetTransactionByNonce", mock.Anything, "0xaaaaa", mock.Anything).Return(nil, fmt.Errorf("pop"))
+
+	err := m.restoreSignerStates(m.ctx)
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestSetSignerNonceMissing(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	_, err := m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{})
+	assert.Regexp(t, "FF21078", err)
+
+	_, err = m.setSignerNonce(m.ctx, "0xaaaaa", &apitypes.SignerNonceRequest{Nonce: fftypes.NewFFBigInt(-1)})
+	assert.Regexp(t, "FF21078", err)
+
+}
+
+func TestResyncSignerNonceNodeFail(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+
+	_, err := m.resyncSignerNonce(m.ctx, "0xaaaaa")
+	assert.Regexp(t, "pop", err)
+	assert.Empty(t, m.nonceOverrides)
+
+}
+
+func TestSignerNonceStatusCalcFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0xaaaaa", mock.Anything, 1, mock.Anything).Return(nil, fmt.Errorf("pop"))
+
+	_, err := m.getSignerNonceStatus(context.Background(), "0xaaaaa")
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestSignerNonceStatusNodeFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0xaaaaa", mock.Anything, 1, mock.Anything).Return([]*apitypes.ManagedTX{}, nil)
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(20),
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+
+	_, err := m.getSignerNonceStatus(context.Background(), "0xaaaaa")
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestSignerNonceStatusHighestNonceFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	m.nonceOverrides["0xaaaaa"] = 5
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0xaaaaa", mock.Anything, 1, mock.Anything).Return(nil, fmt.Errorf("pop"))
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(20),
+	}, ffcapi.ErrorReason(""), nil)
+
+	_, err := m.getSignerNonceStatus(context.Background(), "0xaaaaa")
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestSignerNonceStatusPendingPagingAndFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	m.nonceOverrides["0xaaaaa"] = 5
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0xaaaaa", mock.Anything, 1, mock.Anything).Return([]*apitypes.ManagedTX{}, nil)
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(20),
+	}, ffcapi.ErrorReason(""), nil)
+	page := make([]*apitypes.ManagedTX, pendingCountPageSize)
+	for i := range page {
+		page[i] = &apitypes.ManagedTX{SequenceID: apitypes.NewULID()}
+		page[i].TransactionHeaders.From = "0xaaaaa"
+	}
+	mp.On("ListTransactionsPending", mock.Anything, (*fftypes.UUID)(nil), pendingCountPageSize, mock.Anything).Return(page, nil)
+	mp.On("ListTransactionsPending", mock.Anything, page[pendingCountPageSize-1].SequenceID, pendingCountPageSize, mock.Anything).Return(nil, fmt.Errorf("pop"))
+
+	_, err := m.getSignerNonceStatus(context.Background(), "0xaaaaa")
+	assert.Regexp(t, "pop", err)
+
+	mp.AssertExpectations(t)
+
+}
@@ -20,12 +20,21 @@ import (
 	"context"
 	"time"
 
+	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
 	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
 )
 
+// spentNonce is the cached summary of the highest nonce persisted for a signer
+type spentNonce struct {
+	txID    string
+	nonce   uint64
+	created time.Time
+}
+
 type lockedNonce struct {
 	m        *manager
 	nsOpID   string
@@ -42,18 +51,39 @@ func (ln *lockedNonce) complete(ctx context.Context) {
 	} else {
 		log.L(ctx).Debugf("Returning next nonce %d for signer %s unspent", ln.nonce, ln.signer)
 	}
+	if ln.spent != nil {
+		// An operator override has now been used, if this transaction was assigned it. A signed transaction
+		// recorded with a nonce of its own leaves the override in place for the next nonce assigned.
+		ln.m.mux.Lock()
+		override, hasOverride := ln.m.nonceOverrides[ln.signer]
+		ln.m.mux.Unlock()
+		if hasOverride && override == ln.nonce {
+			ln.m.clearNonceOverride(ctx, ln.signer)
+		}
+	}
 	ln.m.mux.Lock()
+	if ln.spent != nil {
+		// Keep a warm cache up to date with the nonce we have just persisted
+		if cached, isCached := ln.m.nonceCache[ln.signer]; isCached && (cached == nil || ln.nonce >= cached.nonce) {
+			ln.m.nonceCache[ln.signer] = &spentNonce{
+				txID:    ln.spent.ID,
+				nonce:   ln.nonce,
+				created: *ln.spent.Created.Time(),
+			}
+		}
+	}
 	delete(ln.m.lockedNonces, ln.signer)
 	close(ln.unlocked)
 	ln.m.mux.Unlock()
 }
 
-func (m *manager) assignAndLockNonce(ctx context.Context, nsOpID, signer string) (*lockedNonce, error) {
+// lockNonce blocks until the caller holds the nonce lock for the signer. The returned lockedNonce
+// must be completed, and is used both for assigning nonces and for operator changes to the nonce state.
+func (m *manager) lockNonce(ctx context.Context, nsOpID, signer string) *lockedNonce {
 
 	for {
-		// Take the lock to query our nonce cache, and check if we are already locked
+		// Take the lock to check if we are already locked
 		m.mux.Lock()
-		doLookup := false
 		locked, isLocked := m.lockedNonces[signer]
 		if !isLocked {
 			locked = &lockedNonce{
@@ -63,26 +93,55 @@ func (m *manager) assignAndLockNonce(ctx context.Context, nsOpID, signer string)
 				unlocked: make(chan struct{}),
 			}
 			m.lockedNonces[signer] = locked
-			doLookup = true
 		}
 		m.mux.Unlock()
 
-		// If we're locked, then wait
-		if isLocked {
-			log.L(ctx).Debugf("Contention for next nonce for signer %s", signer)
-			<-locked.unlocked
-		} else if doLookup {
-			// We have to ensure we either successfully return a nonce,
-			// or otherwise we unlock when we send the error
-			nextNonce, err := m.calcNextNonce(ctx, signer)
-			if err != nil {
-				locked.complete(ctx)
-				return nil, err
-			}
-			locked.nonce = nextNonce
-			return locked, nil
+		if !isLocked {
+			return locked
 		}
+
+		// If we're locked, then wait
+		log.L(ctx).Debugf("Contention for next nonce for signer %s", signer)
+		<-locked.unlocked
+	}
+
+}
+
+// lockNonceForSubmission takes the nonce lock for a signer to record a new transaction, once it has checked
+// new transactions can be accepted for the signer. The returned lockedNonce must be completed.
+func (m *manager) lockNonceForSubmission(ctx context.Context, nsOpID, signer string) (*lockedNonce, error) {
+
+	// We have to ensure we either successfully return the lock,
+	// or otherwise we unlock when we send the error
+	locked := m.lockNonce(ctx, nsOpID, signer)
+	if m.isDraining() {
+		// Checked under the nonce lock, so a drain can wait for all locked nonces to be released
+		locked.complete(ctx)
+		return nil, i18n.NewError(ctx, tmmsgs.MsgDraining)
+	}
+	if m.isSignerPaused(signer) && !m.isSignerParked(signer) {
+		// Checked under the nonce lock, so no nonce is assigned once a pause request has returned.
+		// A parked signer continues to accept new transactions, which are queued until it resumes.
+		locked.complete(ctx)
+		return nil, i18n.NewError(ctx, tmmsgs.MsgSignerPaused, signer)
+	}
+	return locked, nil
+
+}
+
+func (m *manager) assignAndLockNonce(ctx context.Context, nsOpID, signer string) (*lockedNonce, error) {
+
+	locked, err := m.lockNonceForSubmission(ctx, nsOpID, signer)
+	if err != nil {
+		return nil, err
 	}
+	nextNonce, err := m.calcNextNonce(ctx, signer)
+	if err != nil {
+		locked.complete(ctx)
+		return nil, err
+	}
+	locked.nonce = nextNonce
+	return locked, nil
 
 }
 
@@ -91,18 +150,24 @@ func (m *manager) calcNextNonce(ctx context.Context, signer string) (uint64, err
 	// First we check our DB to find the last nonce we used for this address.
 	// Note we are within the nonce-lock in assignAndLockNonce for this signer, so we can be sure we're the
 	// only routine attempting this right now.
-	var lastTxn *apitypes.ManagedTX
-	txns, err := m.persistence.ListTransactionsByNonce(ctx, signer, nil, 1, persistence.SortDirectionDescending)
+
+	// An operator override takes precedence, until a transaction is submitted with it
+	m.mux.Lock()
+	override, hasOverride := m.nonceOverrides[signer]
+	m.mux.Unlock()
+	if hasOverride {
+		log.L(ctx).Debugf("Allocating next nonce '%s' / '%d' from operator override", signer, override)
+		return override, nil
+	}
+
+	lastTxn, err := m.lastSpentNonce(ctx, signer)
 	if err != nil {
 		return 0, err
 	}
-	if len(txns) > 0 {
-		lastTxn = txns[0]
-		if time.Since(*lastTxn.Created.Time()) < m.nonceStateTimeout {
-			nextNonce := lastTxn.Nonce.Uint64() + 1
-			log.L(ctx).Debugf("Allocating next nonce '%s' / '%d' after TX '%s' (status=%s)", signer, nextNonce, lastTxn.ID, lastTxn.Status)
-			return nextNonce, nil
-		}
+	if lastTxn != nil && time.Since(lastTxn.created) < m.nonceStateTimeout {
+		nextNonce := lastTxn.nonce + 1
+		log.L(ctx).Debugf("Allocating next nonce '%s' / '%d' after TX '%s'", signer, nextNonce, lastTxn.txID)
+		return nextNonce, nil
 	}
 
 	// If we don't have a fresh answer in our state store, then ask the node.
@@ -117,11 +182,52 @@ func (m *manager) calcNextNonce(ctx context.Context, signer string) (uint64, err
 	// If we had a stale answer in our state store, make sure this isn't re-used.
 	// This is important in case we have transactions that have expired from the TX pool of nodes, but we still have them
 	// in our state store. So basically whichever is further forwards of our state store and the node answer wins.
-	if lastTxn != nil && nextNonce <= lastTxn.Nonce.Uint64() {
-		log.L(ctx).Debugf("Node TX pool next nonce '%s' / '%d' is not ahead of '%d' in TX '%s' (status=%s)", signer, nextNonce, lastTxn.Nonce.Uint64(), lastTxn.ID, lastTxn.Status)
-		nextNonce = lastTxn.Nonce.Uint64() + 1
+	if lastTxn != nil && nextNonce <= lastTxn.nonce {
+		log.L(ctx).Debugf("Node TX pool next nonce '%s' / '%d' is not ahead of '%d' in TX '%s'", signer, nextNonce, lastTxn.nonce, lastTxn.txID)
+		nextNonce = lastTxn.nonce + 1
 	}
 
 	return nextNonce, nil
 
 }
+
+// lastSpentNonce returns the highest nonce persisted for the signer, or nil if there are no transactions.
+// Once the cache is warmed for a signer, this is served from memory. It is kept up to date as nonces
+// are spent, and invalidated when transactions are deleted.
+func (m *manager) lastSpentNonce(ctx context.Context, signer string) (*spentNonce, error) {
+	m.mux.Lock()
+	cached, isCached := m.nonceCache[signer]
+	epoch := m.nonceCacheEpoch
+	m.mux.Unlock()
+	if isCached {
+		return cached, nil
+	}
+
+	txns, err := m.persistence.ListTransactionsByNonce(ctx, signer, nil, 1, persistence.SortDirectionDescending)
+	if err != nil {
+		return nil, err
+	}
+	var lastTxn *spentNonce
+	if len(txns) > 0 {
+		lastTxn = &spentNonce{
+			txID:    txns[0].ID,
+			nonce:   txns[0].Nonce.Uint64(),
+			created: *txns[0].Created.Time(),
+		}
+	}
+
+	// We do not warm the cache if it was invalidated while we were reading from persistence
+	m.mux.Lock()
+	if m.nonceCacheEpoch == epoch {
+		m.nonceCache[signer] = lastTxn
+	}
+	m.mux.Unlock()
+	return lastTxn, nil
+}
+
+func (m *manager) invalidateNonceCache(signer string) {
+	m.mux.Lock()
+	delete(m.nonceCache, signer)
+	m.nonceCacheEpoch++
+	m.mux.Unlock()
+}
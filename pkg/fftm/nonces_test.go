@@ -119,7 +119,7 @@ func TestNonceListError(t *testing.T) {
 	mp.On("ListTransactionsByNonce", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 		Return(nil, fmt.Errorf("pop"))
 
-	_, err := m.sendManagedTransaction(context.Background(), &apitypes.TransactionRequest{
+	_, _, err := m.sendManagedTransaction(context.Background(), &apitypes.TransactionRequest{
 		TransactionInput: ffcapi.TransactionInput{
 			TransactionHeaders: ffcapi.TransactionHeaders{
 				From: "0x12345",
@@ -152,7 +152,7 @@ func TestNonceListStaleThenQueryFail(t *testing.T) {
 	}, ffcapi.ErrorReason(""), nil)
 	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
 
-	_, err := m.sendManagedTransaction(context.Background(), &apitypes.TransactionRequest{
+	_, _, err := m.sendManagedTransaction(context.Background(), &apitypes.TransactionRequest{
 		TransactionInput: ffcapi.TransactionInput{
 			TransactionHeaders: ffcapi.TransactionHeaders{
 				From: "0x12345",
@@ -184,3 +184,109 @@ func TestNonceListNotStale(t *testing.T) {
 	assert.Equal(t, uint64(1001), n)
 
 }
+
+func TestNonceCacheServesSubmissions(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+	m.nonceStateTimeout = 1 * time.Hour
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0x12345", mock.Anything, 1, mock.Anything).
+		Return([]*apitypes.ManagedTX{
+			{ID: "id12345", Created: fftypes.Now(), Status: apitypes.TxStatusSucceeded, Nonce: fftypes.NewFFBigInt(1000)},
+		}, nil).Once()
+
+	for i := 1; i <= 3; i++ {
+		ln, err := m.assignAndLockNonce(context.Background(), "ns1:"+fftypes.NewUUID().String(), "0x12345")
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1000+i), ln.nonce)
+		ln.spent = &apitypes.ManagedTX{ID: "tx", Created: fftypes.Now()}
+		ln.complete(context.Background())
+	}
+
+	mp.AssertExpectations(t)
+
+}
+
+func TestNonceCacheWarmEmptyThenSpent(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+	m.nonceStateTimeout = 1 * time.Hour
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0x12345", mock.Anything, 1, mock.Anything).
+		Return([]*apitypes.ManagedTX{}, nil).Once()
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(10),
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	ln, err := m.assignAndLockNonce(context.Background(), "ns1:"+fftypes.NewUUID().String(), "0x12345")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(10), ln.nonce)
+	ln.spent = &apitypes.ManagedTX{ID: "tx", Created: fftypes.Now()}
+	ln.complete(context.Background())
+
+	n, err := m.calcNextNonce(context.Background(), "0x12345")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(11), n)
+
+	mp.AssertExpectations(t)
+	mFFC.AssertExpectations(t)
+
+}
+
+func TestNonceCacheInvalidated(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+	m.nonceStateTimeout = 1 * time.Hour
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0x12345", mock.Anything, 1, mock.Anything).
+		Return([]*apitypes.ManagedTX{
+			{ID: "id12345", Created: fftypes.Now(), Status: apitypes.TxStatusSucceeded, Nonce: fftypes.NewFFBigInt(1000)},
+		}, nil).Once()
+	mp.On("ListTransactionsByNonce", mock.Anything, "0x12345", mock.Anything, 1, mock.Anything).
+		Return([]*apitypes.ManagedTX{
+			{ID: "id12344", Created: fftypes.Now(), Status: apitypes.TxStatusSucceeded, Nonce: fftypes.NewFFBigInt(999)},
+		}, nil).Once()
+
+	n, err := m.calcNextNonce(context.Background(), "0x12345")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1001), n)
+
+	m.invalidateNonceCache("0x12345")
+
+	n, err = m.calcNextNonce(context.Background(), "0x12345")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1000), n)
+
+	mp.AssertExpectations(t)
+
+}
+
+func TestNonceCacheNotWarmedWhenInvalidatedDuringRead(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+	m.nonceStateTimeout = 1 * time.Hour
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsByNonce", mock.Anything, "0x12345", mock.Anything, 1, mock.Anything).
+		Run(func(args mock.Arguments) {
+			m.invalidateNonceCache("0x12345")
+		}).
+		Return([]*apitypes.ManagedTX{
+			{ID: "id12345", Created: fftypes.Now(), Status: apitypes.TxStatusSucceeded, Nonce: fftypes.NewFFBigInt(1000)},
+		}, nil)
+
+	n, err := m.calcNextNonce(context.Background(), "0x12345")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1001), n)
+	assert.Empty(t, m.nonceCache)
+
+}
@@ -0,0 +1,216 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"sort"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengine"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengines"
+)
+
+// initPolicyEngineInstances builds the additional named policy engine instances, which can be selected
+// for individual transactions in place of the default policy engine
+func (m *manager) initPolicyEngineInstances(ctx context.Context) error {
+	m.policyEngines = make(map[string]policyengine.PolicyEngine)
+	m.policyEngineConfigs = make(map[string]config.Section)
+	instanceCount := tmconfig.PolicyEngineInstancesConfig.ArraySize()
+	for i := 0; i < instanceCount; i++ {
+		instanceConfig := tmconfig.PolicyEngineInstancesConfig.ArrayEntry(i)
+		name := instanceConfig.GetString(tmconfig.PolicyEngineInstanceName)
+		if _, exists := m.policyEngines[name]; exists || name == "" || name == m.policyEngineName {
+			return i18n.NewError(ctx, tmmsgs.MsgPolicyEngineInstanceInvalid, i, m.policyEngineName, name)
+		}
+		pe, err := policyengines.NewPolicyEngine(ctx, instanceConfig, instanceConfig.GetString(tmconfig.PolicyEngineInstanceType))
+		if err != nil {
+			return err
+		}
+		log.L(ctx).Infof("Initialized policy engine instance '%s'", name)
+		m.policyEngines[name] = pe
+		m.policyEngineConfigs[name] = instanceConfig
+	}
+	return nil
+}
+
+// resolvePolicyEngineName validates the policy engine requested for a transaction, returning the default if none was specified
+func (m *manager) resolvePolicyEngineName(ctx context.Context, name string) (string, error) {
+	if name == "" || name == m.policyEngineName {
+		return m.policyEngineName, nil
+	}
+	if _, ok := m.policyEngineConfigs[name]; !ok {
+		return "", i18n.NewError(ctx, tmmsgs.MsgPolicyEngineNotFound, name)
+	}
+	return name, nil
+}
+
+// policyEngineBaseConfig returns the static configuration, and the type, of the default policy engine or a
+// named instance - on top of which any runtime configuration overrides for that policy engine are applied
+func (m *manager) policyEngineBaseConfig(ctx context.Context, name string) (string, config.Section, string, error) {
+	name, err := m.resolvePolicyEngineName(ctx, name)
+	if err != nil {
+		return "", nil, "", err
+	}
+	if name == m.policyEngineName {
+		return name, tmconfig.PolicyEngineBaseConfig, m.policyEngineName, nil
+	}
+	instanceConfig := m.policyEngineConfigs[name]
+	return name, instanceConfig, instanceConfig.GetString(tmconfig.PolicyEngineInstanceType), nil
+}
+
+// setPolicyEngine swaps in a reconfigured policy engine, which is the default or a named instance
+func (m *manager) setPolicyEngine(name string, pe policyengine.PolicyEngine) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if name == m.policyEngineName {
+		m.policyEngine = pe
+	} else {
+		m.policyEngines[name] = pe
+	}
+}
+
+// policyEngineForTX returns the policy engine instance managing a transaction
+func (m *manager) policyEngineForTX(ctx context.Context, mtx *apitypes.ManagedTX) (policyengine.PolicyEngine, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if mtx.PolicyEngine == "" || mtx.PolicyEngine == m.policyEngineName {
+		return m.policyEngine, nil
+	}
+	pe, ok := m.policyEngines[mtx.PolicyEngine]
+	if !ok {
+		// The instance has been removed from the configuration since the transaction was submitted
+		return nil, i18n.NewError(ctx, tmmsgs.MsgPolicyEngineNotFound, mtx.PolicyEngine)
+	}
+	return pe, nil
+}
+
+// restorePolicyEngineConfig applies any runtime configuration overrides persisted via the API in a previous run,
+// to the default policy engine and each of the named instances
+func (m *manager) restorePolicyEngineConfig(ctx context.Context) error {
+	names := make([]string, 0, len(m.policyEngineConfigs)+1)
+	for name := range m.policyEngineConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range append([]string{m.policyEngineName}, names...) {
+		if err := m.restorePolicyEngineInstanceConfig(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *manager) restorePolicyEngineInstanceConfig(ctx context.Context, name string) error {
+	peConfig, err := m.persistence.GetPolicyEngineConfig(ctx, name)
+	if err != nil || peConfig == nil {
+		return err
+	}
+	log.L(ctx).Infof("Restoring runtime configuration for policy engine '%s' (updated=%s)", name, peConfig.Updated)
+	_, baseConfig, engineType, _ := m.policyEngineBaseConfig(ctx, name)
+	pe, err := policyengines.NewPolicyEngineWithOverrides(ctx, baseConfig, engineType, peConfig.Config)
+	if err != nil {
+		return i18n.NewError(ctx, tmmsgs.MsgPolicyEngineConfigRestoreFail, name, err)
+	}
+	m.setPolicyEngine(name, pe)
+	return nil
+}
+
+func (m *manager) getPolicyEngineConfig(ctx context.Context, name string) (*apitypes.PolicyEngineConfig, error) {
+	name, err := m.resolvePolicyEngineName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	peConfig, err := m.persistence.GetPolicyEngineConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if peConfig == nil {
+		// No runtime overrides - the static configuration is in use
+		peConfig = &apitypes.PolicyEngineConfig{
+			Name:   name,
+			Config: fftypes.JSONObject{},
+		}
+	}
+	return peConfig, nil
+}
+
+func (m *manager) updatePolicyEngineConfig(ctx context.Context, name string, peConfig *apitypes.PolicyEngineConfig) (*apitypes.PolicyEngineConfig, error) {
+	name, baseConfig, engineType, err := m.policyEngineBaseConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	peConfig.Name = name
+	if peConfig.Config == nil {
+		peConfig.Config = fftypes.JSONObject{}
+	}
+
+	// Construct the new policy engine first, so the factory can validate the configuration
+	pe, err := policyengines.NewPolicyEngineWithOverrides(ctx, baseConfig, engineType, peConfig.Config)
+	if err != nil {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgPolicyEngineConfigInvalid, name, err)
+	}
+
+	// The policy loop persists the configuration and swaps in the new policy engine between cycles. Both
+	// happen there, so the stored configuration always matches the running one - even if this request
+	// times out before the policy loop gets to it
+	peConfig.Updated = fftypes.Now()
+	res := m.policyEngineAPIRequest(ctx, &policyEngineAPIRequest{
+		requestType:        policyEngineAPIRequestTypeReconfigure,
+		policyEngine:       pe,
+		policyEngineConfig: peConfig,
+	})
+	if res.err != nil {
+		return nil, res.err
+	}
+	return peConfig, nil
+}
+
+// getGasOracleStatus reports the gas oracle status of the default policy engine, and each of the named
+// instances, for those policy engines that support it
+func (m *manager) getGasOracleStatus(ctx context.Context) []*apitypes.GasOracleStatus {
+	m.mux.Lock()
+	defaultEngine := m.policyEngine
+	instances := make(map[string]policyengine.PolicyEngine, len(m.policyEngines))
+	names := make([]string, 0, len(m.policyEngines))
+	for name, pe := range m.policyEngines {
+		instances[name] = pe
+		names = append(names, name)
+	}
+	m.mux.Unlock()
+	sort.Strings(names)
+
+	statuses := []*apitypes.GasOracleStatus{}
+	addStatus := func(name string, pe policyengine.PolicyEngine) {
+		if gp, ok := pe.(policyengine.GasOracleStatusProvider); ok {
+			status := gp.GasOracleStatus(ctx)
+			status.PolicyEngine = name
+			statuses = append(statuses, status)
+		}
+	}
+	addStatus(m.policyEngineName, defaultEngine)
+	for _, name := range names {
+		addStatus(name, instances[name])
+	}
+	return statuses
+}
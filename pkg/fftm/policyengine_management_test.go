@@ -0,0 +1,371 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/policyenginemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func readTestPolicyEngineInstances(t *testing.T, yaml string) {
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+}
+
+func TestInitPolicyEngineInstancesOK(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: bulk
+    type: simple
+    simple:
+      fixedGasPrice: 1000
+      gasOracle:
+        mode: disabled
+  - name: fast
+    type: simple
+    simple:
+      fixedGasPrice: 2000
+      gasOracle:
+        mode: disabled
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.NoError(t, err)
+	assert.Len(t, m.policyEngines, 2)
+
+	name, err := m.resolvePolicyEngineName(m.ctx, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "simple", name)
+	name, err = m.resolvePolicyEngineName(m.ctx, "bulk")
+	assert.NoError(t, err)
+	assert.Equal(t, "bulk", name)
+	_, err = m.resolvePolicyEngineName(m.ctx, "wrong")
+	assert.Regexp(t, "FF21077", err)
+
+	pe, err := m.policyEngineForTX(m.ctx, &apitypes.ManagedTX{})
+	assert.NoError(t, err)
+	assert.Equal(t, m.policyEngine, pe)
+	pe, err = m.policyEngineForTX(m.ctx, &apitypes.ManagedTX{PolicyEngine: "simple"})
+	assert.NoError(t, err)
+	assert.Equal(t, m.policyEngine, pe)
+	pe, err = m.policyEngineForTX(m.ctx, &apitypes.ManagedTX{PolicyEngine: "fast"})
+	assert.NoError(t, err)
+	assert.Equal(t, m.policyEngines["fast"], pe)
+	_, err = m.policyEngineForTX(m.ctx, &apitypes.ManagedTX{PolicyEngine: "removed"})
+	assert.Regexp(t, "FF21077", err)
+}
+
+func TestInitPolicyEngineInstancesDuplicateName(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: bulk
+    type: simple
+    simple:
+      fixedGasPrice: 1000
+  - name: bulk
+    type: simple
+    simple:
+      fixedGasPrice: 1000
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.Regexp(t, "FF21076.*1", err)
+}
+
+func TestInitPolicyEngineInstancesDefaultName(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: simple
+    type: simple
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.Regexp(t, "FF21076", err)
+}
+
+func TestInitPolicyEngineInstancesBadType(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: bulk
+    type: wrong
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.Regexp(t, "FF21019", err)
+}
+
+func TestNewManagerBadPolicyEngineInstance(t *testing.T) {
+
+	_ = testManagerCommonInit(t)
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - type: simple
+`)
+
+	_, err := NewManager(context.Background(), nil)
+	assert.Regexp(t, "FF21076", err)
+
+}
+
+func TestRestorePolicyEngineConfigOK(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	origEngine := m.policyEngine
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetPolicyEngineConfig", m.ctx, "simple").Return(&apitypes.PolicyEngineConfig{
+		Name:   "simple",
+		Config: fftypes.JSONObject{"fixedGasPrice": "12345"},
+	}, nil)
+
+	err := m.restorePolicyEngineConfig(m.ctx)
+	assert.NoError(t, err)
+	assert.NotEqual(t, origEngine, m.policyEngine)
+
+	mp.AssertExpectations(t)
+}
+
+func TestRestorePolicyEngineConfigInstances(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: bulk
+    type: simple
+    simple:
+      fixedGasPrice: 1000
+  - name: fast
+    type: simple
+    simple:
+      fixedGasPrice: 2000
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.NoError(t, err)
+	origDefault := m.policyEngine
+	origBulk := m.policyEngines["bulk"]
+	origFast := m.policyEngines["fast"]
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetPolicyEngineConfig", m.ctx, "simple").Return(nil, nil)
+	mp.On("GetPolicyEngineConfig", m.ctx, "bulk").Return(nil, nil)
+	mp.On("GetPolicyEngineConfig", m.ctx, "fast").Return(&apitypes.PolicyEngineConfig{
+		Name:   "fast",
+		Config: fftypes.JSONObject{"fixedGasPrice": "3000"},
+	}, nil)
+
+	err = m.restorePolicyEngineConfig(m.ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, origDefault, m.policyEngine)
+	assert.Equal(t, origBulk, m.policyEngines["bulk"])
+	assert.NotEqual(t, origFast, m.policyEngines["fast"])
+
+	mp.AssertExpectations(t)
+}
+
+func TestRestorePolicyEngineConfigInstanceInvalid(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: bulk
+    type: simple
+    simple:
+      fixedGasPrice: 1000
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.NoError(t, err)
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetPolicyEngineConfig", m.ctx, "simple").Return(nil, nil)
+	mp.On("GetPolicyEngineConfig", m.ctx, "bulk").Return(&apitypes.PolicyEngineConfig{
+		Name: "bulk",
+		Config: fftypes.JSONObject{
+			"gasOracle": map[string]interface{}{"mode": "restapi"},
+		},
+	}, nil)
+
+	err = m.restorePolicyEngineConfig(m.ctx)
+	assert.Regexp(t, "FF21071.*bulk", err)
+
+	mp.AssertExpectations(t)
+}
+
+func TestRestorePolicyEngineConfigInvalid(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetPolicyEngineConfig", m.ctx, "simple").Return(&apitypes.PolicyEngineConfig{
+		Name: "simple",
+		Config: fftypes.JSONObject{
+			"gasOracle": map[string]interface{}{"mode": "restapi"},
+		},
+	}, nil)
+
+	err := m.restorePolicyEngineConfig(m.ctx)
+	assert.Regexp(t, "FF21071", err)
+
+	mp.AssertExpectations(t)
+}
+
+func TestRestorePolicyEngineConfigFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetPolicyEngineConfig", m.ctx, "simple").Return(nil, fmt.Errorf("pop"))
+
+	err := m.restorePolicyEngineConfig(m.ctx)
+	assert.Regexp(t, "pop", err)
+
+	mp.AssertExpectations(t)
+}
+
+func TestGetPolicyEngineConfigFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetPolicyEngineConfig", m.ctx, "simple").Return(nil, fmt.Errorf("pop"))
+
+	_, err := m.getPolicyEngineConfig(m.ctx, "")
+	assert.Regexp(t, "pop", err)
+
+	mp.AssertExpectations(t)
+}
+
+func TestPolicyEngineConfigUnknownInstance(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	_, err := m.getPolicyEngineConfig(m.ctx, "wrong")
+	assert.Regexp(t, "FF21077", err)
+
+	_, err = m.updatePolicyEngineConfig(m.ctx, "wrong", &apitypes.PolicyEngineConfig{})
+	assert.Regexp(t, "FF21077", err)
+}
+
+func TestUpdatePolicyEngineConfigWriteFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	origEngine := m.policyEngine
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("WritePolicyEngineConfig", m.ctx, mock.Anything).Return(fmt.Errorf("pop"))
+
+	req := &policyEngineAPIRequest{
+		requestType:        policyEngineAPIRequestTypeReconfigure,
+		policyEngine:       &policyenginemocks.PolicyEngine{},
+		policyEngineConfig: &apitypes.PolicyEngineConfig{Name: "simple"},
+		response:           make(chan policyEngineAPIResponse, 1),
+	}
+	m.policyEngineAPIRequests = append(m.policyEngineAPIRequests, req)
+	m.processPolicyAPIRequests(m.ctx)
+	res := <-req.response
+	assert.Regexp(t, "pop", res.err)
+
+	// The running policy engine is unchanged, as the configuration was not stored
+	assert.Equal(t, origEngine, m.policyEngine)
+
+	mp.AssertExpectations(t)
+}
+
+func TestUpdatePolicyEngineConfigRequestFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+
+	// Policy loop is not running, so the request will time out on a cancelled context - without storing
+	// a configuration that is not running
+	m.cancelCtx()
+	_, err := m.updatePolicyEngineConfig(m.ctx, "", &apitypes.PolicyEngineConfig{})
+	assert.Error(t, err)
+
+	mp.AssertNotCalled(t, "WritePolicyEngineConfig", mock.Anything, mock.Anything)
+}
+
+func TestGetGasOracleStatusInstances(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: fast
+    type: simple
+    simple:
+      gasOracle:
+        aggregation: max
+        sources:
+        - name: node
+          type: connector
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.NoError(t, err)
+	m.policyEngines["bulk"] = &policyenginemocks.PolicyEngine{}
+
+	statuses := m.getGasOracleStatus(m.ctx)
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "simple", statuses[0].PolicyEngine)
+	assert.Equal(t, "fast", statuses[1].PolicyEngine)
+	assert.Equal(t, "max", statuses[1].Aggregation)
+	assert.Len(t, statuses[1].Sources, 1)
+	assert.Equal(t, "node", statuses[1].Sources[0].Name)
+}
@@ -18,7 +18,10 @@ package fftm
 
 import (
 	"context"
+	"hash/fnv"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
@@ -43,6 +46,7 @@ func (m *manager) policyLoop() {
 		case <-m.inflightUpdate:
 		case <-timer.C:
 		case <-ctx.Done():
+			m.waitParkedSignersCheck()
 			log.L(ctx).Infof("Receipt poller exiting")
 			return
 		}
@@ -120,20 +124,63 @@ func (m *manager) policyLoopCycle(ctx context.Context, inflightStale bool) {
 	// Process any synchronous commands first - these might not be in our inflight set
 	m.processPolicyAPIRequests(ctx)
 
+	// Resume any signers parked for insufficient funds, that have been funded
+	m.checkParkedSigners(ctx)
+
 	if inflightStale {
 		if !m.updateInflightSet(ctx) {
 			return
 		}
 	}
 
-	// Go through executing the policy engine against them
+	// Go through executing the policy engine against them, with the transactions partitioned by signer
+	// across the workers. API requests have all been processed above, so are never concurrent with the workers.
+	partitions := m.partitionInflight()
+	var wg sync.WaitGroup
+	for worker, partition := range partitions {
+		wg.Add(1)
+		go func(worker int, partition []*pendingState) {
+			defer wg.Done()
+			m.policyLoopWorkerCycle(ctx, worker, partition)
+		}(worker, partition)
+	}
+	wg.Wait()
+
+}
+
+// partitionInflight splits the in-flight set across the workers, by a hash of the signer, retaining
+// the order of the transactions for each signer
+func (m *manager) partitionInflight() [][]*pendingState {
+	partitions := make([][]*pendingState, m.policyLoopWorkers)
 	for _, pending := range m.inflight {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(pending.mtx.TransactionHeaders.From))
+		worker := int(h.Sum32() % uint32(m.policyLoopWorkers))
+		partitions[worker] = append(partitions[worker], pending)
+	}
+	return partitions
+}
+
+func (m *manager) policyLoopWorkerCycle(ctx context.Context, worker int, partition []*pendingState) {
+	if m.policyLoopWorkers > 1 {
+		ctx = log.WithLogField(ctx, "worker", strconv.Itoa(worker))
+	}
+	start := time.Now()
+	for _, pending := range partition {
 		err := m.execPolicy(ctx, pending, false)
 		if err != nil {
 			log.L(ctx).Errorf("Failed policy cycle transaction=%s operation=%s: %s", pending.mtx.TransactionHash, pending.mtx.ID, err)
 		}
 	}
-
+	lastCycleStart := fftypes.FFTime(start)
+	m.mux.Lock()
+	m.workerStatus[worker] = &apitypes.PolicyLoopWorkerStatus{
+		Worker:            worker,
+		Transactions:      len(partition),
+		LastCycleStart:    &lastCycleStart,
+		LastCycleDuration: fftypes.FFDuration(time.Since(start)),
+	}
+	m.mux.Unlock()
 }
 
 // processPolicyAPIRequests executes any API calls requested that require policy engine involvement - such as transaction deletions
@@ -147,6 +194,19 @@ func (m *manager) processPolicyAPIRequests(ctx context.Context) {
 	m.mux.Unlock()
 
 	for _, request := range requests {
+		if request.requestType == policyEngineAPIRequestTypeReconfigure {
+			// Swapped in between cycles, so all transactions in a cycle are processed by the same policy engine.
+			// Persisted first, so the effective configuration survives a restart
+			if err := m.persistence.WritePolicyEngineConfig(ctx, request.policyEngineConfig); err != nil {
+				request.response <- policyEngineAPIResponse{err: err}
+				continue
+			}
+			log.L(ctx).Infof("Applying updated configuration for policy engine '%s'", request.policyEngineConfig.Name)
+			m.setPolicyEngine(request.policyEngineConfig.Name, request.policyEngine)
+			request.response <- policyEngineAPIResponse{status: http.StatusOK}
+			continue
+		}
+
 		var pending *pendingState
 		// If this transaction is in-flight, we use that record
 		for _, inflight := range m.inflight {
@@ -177,6 +237,12 @@ func (m *manager) processPolicyAPIRequests(ctx context.Context) {
 				}
 				request.response <- res
 			}
+		case policyEngineAPIRequestTypeSubmitSigned:
+			if err := m.submitSignedTransaction(ctx, pending, request.rawTransaction); err != nil {
+				request.response <- policyEngineAPIResponse{err: err}
+			} else {
+				request.response <- policyEngineAPIResponse{tx: pending.mtx, status: http.StatusAccepted}
+			}
 		default:
 			request.response <- policyEngineAPIResponse{
 				err: i18n.NewError(ctx, tmmsgs.MsgPolicyEngineRequestInvalid, request.requestType),
@@ -199,10 +265,72 @@ func (m *manager) addError(mtx *apitypes.ManagedTX, reason ffcapi.ErrorReason, e
 		Error:  err.Error(),
 	}
 	mtx.ErrorMessage = latestError.Error
+	mtx.ConsecutiveErrors++
+	if mtx.ErrorsSince == nil {
+		mtx.ErrorsSince = latestError.Time
+	}
 	mtx.ErrorHistory[0] = latestError
 	for i := 1; i < newLen; i++ {
 		mtx.ErrorHistory[i] = oldHistory[i-1]
 	}
+	mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+		Time:   latestError.Time,
+		Action: apitypes.TxActionError,
+		Error:  latestError.Error,
+		Mapped: reason,
+	})
+}
+
+// applyErrorHandling applies the failure rule matching the reason for an error just recorded against the
+// transaction, or otherwise parks the signer on insufficient funds if configured. Returns whether a failure
+// rule was applied, and whether the transaction is now complete (failed).
+func (m *manager) applyErrorHandling(ctx context.Context, mtx *apitypes.ManagedTX, reason ffcapi.ErrorReason) (applied, completed bool) {
+	rule := m.matchFailureRule(reason)
+	switch {
+	case rule != nil && rule.triggered(mtx):
+		return true, m.applyFailureRule(ctx, mtx, rule, reason)
+	case rule == nil && reason == ffcapi.ErrorReasonInsufficientFunds && m.signerParking.parkOnInsufficientFunds:
+		// A configured failure rule for the reason takes precedence over parking
+		m.parkSigner(ctx, mtx, reason)
+	}
+	return false, false
+}
+
+// trimHistory discards the oldest actions in the history of the transaction, beyond the configured limits.
+// Errors are first capped to the error history count, so that a transaction failing repeatedly does not
+// fill the history with them, and submissions are never discarded - so every hash submitted is retained.
+func (m *manager) trimHistory(mtx *apitypes.ManagedTX) {
+	if m.historyCount <= 0 {
+		mtx.History = nil
+		return
+	}
+	excessErrors := -m.errorHistoryCount
+	for _, h := range mtx.History {
+		if h.Action == apitypes.TxActionError {
+			excessErrors++
+		}
+	}
+	excess := len(mtx.History) - m.historyCount
+	if excess <= 0 && excessErrors <= 0 {
+		return
+	}
+	trimmed := make([]*apitypes.ManagedTXHistoryEntry, 0, len(mtx.History))
+	for _, h := range mtx.History {
+		if h.Action == apitypes.TxActionError && excessErrors > 0 {
+			excessErrors--
+			excess--
+			continue
+		}
+		trimmed = append(trimmed, h)
+	}
+	mtx.History = trimmed[:0]
+	for _, h := range trimmed {
+		if excess > 0 && h.Action != apitypes.TxActionSubmitted && h.Action != apitypes.TxActionResubmitted {
+			excess--
+			continue
+		}
+		mtx.History = append(mtx.History, h)
+	}
 }
 
 func (m *manager) execPolicy(ctx context.Context, pending *pendingState, syncDeleteRequest bool) (err error) {
@@ -216,7 +344,15 @@ func (m *manager) execPolicy(ctx context.Context, pending *pendingState, syncDel
 	confirmed := pending.confirmed
 	if syncDeleteRequest && mtx.DeleteRequested == nil {
 		mtx.DeleteRequested = fftypes.Now()
+		mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+			Time:   mtx.DeleteRequested,
+			Action: apitypes.TxActionDeleteRequested,
+		})
 	}
+	for _, entry := range pending.history {
+		mtx.AddHistory(entry)
+	}
+	pending.history = nil
 	m.mux.Unlock()
 
 	switch {
@@ -226,32 +362,77 @@ func (m *manager) execPolicy(ctx context.Context, pending *pendingState, syncDel
 		if mtx.Receipt.Success {
 			mtx.Status = apitypes.TxStatusSucceeded
 			mtx.ErrorMessage = ""
+			if mtx.ContractDeploy {
+				mtx.ContractLocation = mtx.Receipt.ContractLocation
+			}
 		} else {
 			mtx.Status = apitypes.TxStatusFailed
 			mtx.ErrorMessage = i18n.NewError(ctx, tmmsgs.MsgTransactionFailed).Error()
 		}
 
+	case mtx.SignExternally && !syncDeleteRequest:
+		// The policy engine does not submit a transaction signed outside of the connector
+		var rejected error
+		if update, completed, rejected = m.execSignedTransaction(ctx, pending); rejected != nil {
+			m.rejectTransaction(ctx, mtx, rejected)
+			completed = true
+		} else if update == policyengine.UpdateNo {
+			return nil
+		}
+
 	default:
 		// We get woken for lots of reasons to go through the policy loop, but we only want
 		// to drive the policy engine at regular intervals.
 		// So we track the last time we ran the policy engine against each pending item.
 		// We always call the policy engine on every loop, when deletion has been requested.
+		if !syncDeleteRequest && m.isSignerPaused(mtx.TransactionHeaders.From) {
+			// Nothing is submitted for a paused signer, but we still track receipts for anything
+			// submitted before the pause (including after a restart)
+			if mtx.FirstSubmit != nil && pending.trackingTransactionHash != mtx.TransactionHash {
+				m.trackSubmittedTransaction(ctx, pending)
+			}
+			return nil
+		}
 		if syncDeleteRequest || time.Since(pending.lastPolicyCycle) > m.policyLoopInterval {
 			// Pass the state to the pluggable policy engine to potentially perform more actions against it,
 			// such as submitting for the first time, or raising the gas etc.
 			var reason ffcapi.ErrorReason
-			update, reason, err = m.policyEngine.Execute(ctx, m.connector, pending.mtx)
-			if err != nil {
+			var pe policyengine.PolicyEngine
+			cAPI, guard := m.guardConnector(mtx)
+			if pe, err = m.policyEngineForTX(ctx, mtx); err == nil {
+				update, reason, err = pe.Execute(ctx, cAPI, pending.mtx)
+			}
+			switch {
+			case guard != nil && guard.deferred:
+				// The transaction waits for the rate/spend limit to allow it, so we do not record an error
+				// or persist any update. It will be re-evaluated on a subsequent policy loop cycle.
+				return nil
+			case guard != nil && guard.rejected != nil:
+				m.rejectTransaction(ctx, mtx, guard.rejected)
+				update = policyengine.UpdateYes
+				completed = true
+				err = nil
+			case err != nil:
 				log.L(ctx).Errorf("Policy engine returned error for transaction %s reason=%s: %s", mtx.ID, reason, err)
 				m.addError(mtx, reason, err)
 				update = policyengine.UpdateYes
-			} else {
+				var applied bool
+				if applied, completed = m.applyErrorHandling(ctx, mtx, reason); applied {
+					err = nil // so the outcome is persisted
+				}
+			default:
 				log.L(ctx).Debugf("Policy engine executed for tx %s (update=%d,status=%s,hash=%s)", mtx.ID, update, mtx.Status, mtx.TransactionHash)
 				if mtx.FirstSubmit != nil && pending.trackingTransactionHash != mtx.TransactionHash {
 					// If now submitted, add to confirmations manager for receipt checking
 					m.trackSubmittedTransaction(ctx, pending)
 				}
 				pending.lastPolicyCycle = time.Now()
+				if mtx.ConsecutiveErrors > 0 && update == policyengine.UpdateNo {
+					// Persist that the transaction is no longer failing
+					update = policyengine.UpdateYes
+				}
+				mtx.ConsecutiveErrors = 0
+				mtx.ErrorsSince = nil
 			}
 		}
 	}
@@ -260,6 +441,7 @@ func (m *manager) execPolicy(ctx context.Context, pending *pendingState, syncDel
 		switch update {
 		case policyengine.UpdateYes:
 			mtx.Updated = fftypes.Now()
+			m.trimHistory(mtx)
 			err := m.persistence.WriteTransaction(ctx, mtx, false)
 			if err != nil {
 				log.L(ctx).Errorf("Failed to update transaction %s (status=%s): %s", mtx.ID, mtx.Status, err)
@@ -272,6 +454,9 @@ func (m *manager) execPolicy(ctx context.Context, pending *pendingState, syncDel
 			}
 		case policyengine.UpdateDelete:
 			err := m.persistence.DeleteTransaction(ctx, mtx.ID)
+			// The deleted transaction might have been the highest nonce for the signer, and the
+			// delete might be partial on error, so we re-read the nonce state from persistence next time
+			m.invalidateNonceCache(mtx.TransactionHeaders.From)
 			if err != nil {
 				log.L(ctx).Errorf("Failed to delete transaction %s (status=%s): %s", mtx.ID, mtx.Status, err)
 				return err
@@ -327,6 +512,12 @@ func (m *manager) trackSubmittedTransaction(ctx context.Context, pending *pendin
 					// Will be picked up on the next policy loop cycle - guaranteed to occur before Confirmed
 					m.mux.Lock()
 					pending.mtx.Receipt = receipt
+					pending.history = append(pending.history, &apitypes.ManagedTXHistoryEntry{
+						Time:            fftypes.Now(),
+						Action:          apitypes.TxActionReceipt,
+						TransactionHash: pending.mtx.TransactionHash,
+						BlockNumber:     receipt.BlockNumber,
+					})
 					m.mux.Unlock()
 					log.L(m.ctx).Debugf("Receipt received for transaction %s at nonce %s / %d - hash: %s", pending.mtx.ID, pending.mtx.TransactionHeaders.From, pending.mtx.Nonce.Int64(), pending.mtx.TransactionHash)
 					m.markInflightUpdate()
@@ -336,6 +527,11 @@ func (m *manager) trackSubmittedTransaction(ctx context.Context, pending *pendin
 					m.mux.Lock()
 					pending.confirmed = true
 					pending.mtx.Confirmations = confirmations
+					pending.history = append(pending.history, &apitypes.ManagedTXHistoryEntry{
+						Time:            fftypes.Now(),
+						Action:          apitypes.TxActionConfirmed,
+						TransactionHash: pending.mtx.TransactionHash,
+					})
 					m.mux.Unlock()
 					log.L(m.ctx).Debugf("Confirmed transaction %s at nonce %s / %d - hash: %s", pending.mtx.ID, pending.mtx.TransactionHeaders.From, pending.mtx.Nonce.Int64(), pending.mtx.TransactionHash)
 					m.markInflightUpdate()
@@ -353,12 +549,13 @@ func (m *manager) trackSubmittedTransaction(ctx context.Context, pending *pendin
 }
 
 func (m *manager) policyEngineAPIRequest(ctx context.Context, req *policyEngineAPIRequest) policyEngineAPIResponse {
+	// The response channel must exist before the request is visible to the policy loop
+	req.response = make(chan policyEngineAPIResponse, 1)
+	req.startTime = time.Now()
 	m.mux.Lock()
 	m.policyEngineAPIRequests = append(m.policyEngineAPIRequests, req)
 	m.mux.Unlock()
 	m.markInflightUpdate()
-	req.response = make(chan policyEngineAPIResponse, 1)
-	req.startTime = time.Now()
 	select {
 	case res := <-req.response:
 		return res
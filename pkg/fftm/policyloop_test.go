@@ -20,12 +20,15 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-transaction-manager/internal/confirmations"
 	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
 	"github.com/hyperledger/firefly-transaction-manager/mocks/confirmationsmocks"
 	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
 	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
@@ -58,7 +61,7 @@ func sendSampleTX(t *testing.T, m *manager, signer string, nonce int64) *apitype
 		TransactionData: "0xabce1234",
 	}, ffcapi.ErrorReason(""), nil).Once()
 
-	mtx, err := m.sendManagedTransaction(m.ctx, &apitypes.TransactionRequest{
+	mtx, _, err := m.sendManagedTransaction(m.ctx, &apitypes.TransactionRequest{
 		TransactionInput: txInput,
 	})
 	assert.NoError(t, err)
@@ -112,10 +115,460 @@ func TestPolicyLoopE2EOk(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, apitypes.TxStatusSucceeded, rtx.Status)
 
+	// Check the full lifecycle is recorded in the history
+	actions := make([]apitypes.TxAction, len(rtx.History))
+	for i, h := range rtx.History {
+		actions[i] = h.Action
+	}
+	assert.Equal(t, []apitypes.TxAction{
+		apitypes.TxActionPrepared,
+		apitypes.TxActionNonceAssigned,
+		apitypes.TxActionSubmitted,
+		apitypes.TxActionReceipt,
+		apitypes.TxActionConfirmed,
+	}, actions)
+	assert.Equal(t, int64(12345), rtx.History[1].Nonce.Int64())
+	assert.Equal(t, txHash, rtx.History[2].TransactionHash)
+	assert.Equal(t, int64(12345), rtx.History[3].BlockNumber.Int64())
+
+	mc.AssertExpectations(t)
+	mfc.AssertExpectations(t)
+}
+
+func TestPolicyLoopE2EContractDeploy(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	mtx.ContractDeploy = true
+	err := m.persistence.WriteTransaction(m.ctx, mtx, false)
+	assert.NoError(t, err)
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSend", m.ctx, mock.Anything).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x" + fftypes.NewRandB32().String(),
+	}, ffcapi.ErrorReason(""), nil)
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.MatchedBy(func(n *confirmations.Notification) bool {
+		return n.NotificationType == confirmations.NewTransaction
+	})).Run(func(args mock.Arguments) {
+		n := args[0].(*confirmations.Notification)
+		n.Transaction.Receipt(context.Background(), &ffcapi.TransactionReceiptResponse{
+			BlockNumber:      fftypes.NewFFBigInt(12345),
+			TransactionIndex: fftypes.NewFFBigInt(10),
+			BlockHash:        fftypes.NewRandB32().String(),
+			Success:          true,
+			ContractLocation: fftypes.JSONAnyPtr(`{"address":"0x12345"}`),
+		})
+		n.Transaction.Confirmed(context.Background(), []confirmations.BlockInfo{})
+	}).Return(nil)
+
+	<-m.inflightStale // from sending the TX
+	m.policyLoopCycle(m.ctx, true)
+	m.policyLoopCycle(m.ctx, false)
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Empty(t, m.inflight)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusSucceeded, rtx.Status)
+	assert.JSONEq(t, `{"address":"0x12345"}`, rtx.ContractLocation.String())
+
+	mc.AssertExpectations(t)
+	mfc.AssertExpectations(t)
+}
+
+func TestPolicyLoopHistoryCapped(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+	m.historyCount = 1
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	assert.Len(t, mtx.History, 1)
+	assert.Equal(t, apitypes.TxActionNonceAssigned, mtx.History[0].Action)
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSend", m.ctx, mock.Anything).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x12345",
+	}, ffcapi.ErrorReason(""), nil)
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil)
+
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Len(t, rtx.History, 1)
+	assert.Equal(t, apitypes.TxActionSubmitted, rtx.History[0].Action)
+	assert.Equal(t, "0x12345", rtx.History[0].TransactionHash)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestTrimHistoryKeepsSubmissions(t *testing.T) {
+
+	m := &manager{historyCount: 4, errorHistoryCount: 1}
+	mtx := &apitypes.ManagedTX{}
+	for _, action := range []apitypes.TxAction{
+		apitypes.TxActionPrepared,
+		apitypes.TxActionNonceAssigned,
+		apitypes.TxActionSubmitted,
+		apitypes.TxActionError,
+		apitypes.TxActionResubmitted,
+		apitypes.TxActionError,
+		apitypes.TxActionResubmitted,
+		apitypes.TxActionError,
+		apitypes.TxActionReceipt,
+	} {
+		mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{Action: action})
+	}
+
+	m.trimHistory(mtx)
+	actions := make([]apitypes.TxAction, len(mtx.History))
+	for i, h := range mtx.History {
+		actions[i] = h.Action
+	}
+	assert.Equal(t, []apitypes.TxAction{
+		apitypes.TxActionSubmitted,
+		apitypes.TxActionResubmitted,
+		apitypes.TxActionResubmitted,
+		apitypes.TxActionReceipt,
+	}, actions)
+
+	// Submissions are retained even when they alone exceed the limit
+	m.historyCount = 2
+	m.trimHistory(mtx)
+	assert.Len(t, mtx.History, 3)
+	assert.Equal(t, apitypes.TxActionResubmitted, mtx.History[2].Action)
+
+	// Within the limits nothing is discarded
+	m.historyCount = 5
+	m.trimHistory(mtx)
+	assert.Len(t, mtx.History, 3)
+
+	m.historyCount = 0
+	m.trimHistory(mtx)
+	assert.Nil(t, mtx.History)
+}
+
+func TestPolicyLoopRateLimited(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	config.Set(tmconfig.TransactionsRateLimitCount, 1)
+	config.Set(tmconfig.TransactionsRateLimitInterval, "1h")
+	m.rateLimiter = newSignerRateLimiter()
+
+	mtx1 := sendSampleTX(t, m, "0xaaaaa", 12345)
+	mtx2 := sendSampleTX(t, m, "0xaaaaa", 12346)
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSend", m.ctx, mock.MatchedBy(func(r *ffcapi.TransactionSendRequest) bool {
+		return r.Nonce.Equals(fftypes.NewFFBigInt(12345))
+	})).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x" + fftypes.NewRandB32().String(),
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil)
+
+	// Only the first transaction is submitted
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Len(t, m.inflight, 2)
+	assert.NotNil(t, m.inflight[0].mtx.FirstSubmit)
+	assert.Nil(t, m.inflight[1].mtx.FirstSubmit)
+	assert.Empty(t, m.inflight[1].mtx.ErrorHistory)
+
+	// The deferred transaction has no error persisted
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx2.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, rtx.FirstSubmit)
+	assert.Empty(t, rtx.ErrorMessage)
+
+	rtx, err = m.persistence.GetTransactionByID(m.ctx, mtx1.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, rtx.FirstSubmit)
+
+	rls := m.getRateLimits()
+	assert.Len(t, rls, 1)
+	assert.Equal(t, "0xaaaaa", rls[0].Signer)
+	assert.Less(t, rls[0].Tokens, float64(1))
+
+	mfc.AssertNumberOfCalls(t, "TransactionSend", 1)
+}
+
+func TestPolicyLoopSignerPausedResumed(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	_, err := m.pauseSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+
+	// Nothing is submitted while paused
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Len(t, m.inflight, 1)
+	assert.Nil(t, m.inflight[0].mtx.FirstSubmit)
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSend", m.ctx, mock.Anything).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x" + fftypes.NewRandB32().String(),
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil)
+
+	// Once resumed the transaction is submitted
+	_, err = m.resumeSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	<-m.inflightUpdate
+	m.policyLoopCycle(m.ctx, false)
+	assert.NotNil(t, m.inflight[0].mtx.FirstSubmit)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, rtx.FirstSubmit)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestPolicyLoopSignerPausedTracksReceipts(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	_, err := m.pauseSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+
+	// Simulate the transaction having been submitted before the pause
+	mtx.FirstSubmit = fftypes.Now()
+	mtx.TransactionHash = "0x12345"
+	err = m.persistence.WriteTransaction(m.ctx, mtx, false)
+	assert.NoError(t, err)
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.MatchedBy(func(n *confirmations.Notification) bool {
+		return n.NotificationType == confirmations.NewTransaction && n.Transaction.TransactionHash == "0x12345"
+	})).Run(func(args mock.Arguments) {
+		n := args[0].(*confirmations.Notification)
+		n.Transaction.Receipt(context.Background(), &ffcapi.TransactionReceiptResponse{
+			BlockNumber: fftypes.NewFFBigInt(12345),
+			Success:     true,
+		})
+		n.Transaction.Confirmed(context.Background(), []confirmations.BlockInfo{})
+	}).Return(nil).Once()
+
+	// The receipt is tracked, and the transaction completes, while still paused
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	m.policyLoopCycle(m.ctx, false)
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Empty(t, m.inflight)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusSucceeded, rtx.Status)
+
 	mc.AssertExpectations(t)
+}
+
+func TestPolicyLoopSpendLimitRejected(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	config.Set(tmconfig.TransactionsSpendLimitAction, "reject")
+	sl, err := newSignerSpendLimiter(m.ctx)
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+
+	// Gas of 100000 at the fixed gas price from the test config exceeds the limit
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.True(t, m.inflight[0].remove)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusFailed, rtx.Status)
+	assert.Equal(t, ffcapi.ErrorReasonSpendLimitExceeded, rtx.ErrorHistory[0].Mapped)
+	assert.Regexp(t, "FF21073", rtx.ErrorMessage)
+	lastAction := rtx.History[len(rtx.History)-1]
+	assert.Equal(t, apitypes.TxActionError, lastAction.Action)
+	assert.Equal(t, ffcapi.ErrorReasonSpendLimitExceeded, lastAction.Mapped)
+
+	// The nonce was never used on chain, so it is assigned to the next transaction for the signer
+	assert.Equal(t, uint64(12345), m.nonceOverrides["0xaaaaa"])
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.AssertNotCalled(t, "TransactionSend", mock.Anything, mock.Anything)
+}
+
+func TestPolicyLoopPolicyEngineInstance(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: fast
+    type: simple
+    simple:
+      fixedGasPrice: 999
+      gasOracle:
+        mode: disabled
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.NoError(t, err)
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("NextNonceForSigner", m.ctx, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(12345),
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mfc.On("TransactionPrepare", m.ctx, mock.Anything).Return(&ffcapi.TransactionPrepareResponse{
+		Gas:             fftypes.NewFFBigInt(100000),
+		TransactionData: "0xabce1234",
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mfc.On("TransactionSend", m.ctx, mock.MatchedBy(func(r *ffcapi.TransactionSendRequest) bool {
+		return r.GasPrice.String() == "999"
+	})).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x" + fftypes.NewRandB32().String(),
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil)
+
+	mtx, _, err := m.sendManagedTransaction(m.ctx, &apitypes.TransactionRequest{
+		Headers: apitypes.RequestHeaders{
+			PolicyEngine: "fast",
+		},
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{
+				From: "0xaaaaa",
+			},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", mtx.PolicyEngine)
+
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", rtx.PolicyEngine)
+	assert.NotNil(t, rtx.FirstSubmit)
+
 	mfc.AssertExpectations(t)
 }
 
+func TestPolicyLoopPolicyEngineInstanceRemoved(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	mtx.PolicyEngine = "removed"
+	err := m.persistence.WriteTransaction(m.ctx, mtx, false)
+	assert.NoError(t, err)
+
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+
+	assert.Regexp(t, "FF21077", m.inflight[0].mtx.ErrorMessage)
+}
+
+func TestPolicyLoopParallelWorkersPerSignerOrdering(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	m.policyLoopWorkers = 4
+	m.workerStatus = make([]*apitypes.PolicyLoopWorkerStatus, 4)
+	for i := range m.workerStatus {
+		m.workerStatus[i] = &apitypes.PolicyLoopWorkerStatus{Worker: i}
+	}
+
+	sendSampleTX(t, m, "0xaaaaa", 1000)
+	sendSampleTX(t, m, "0xbbbbb", 2000)
+	sendSampleTX(t, m, "0xaaaaa", 1001)
+	sendSampleTX(t, m, "0xbbbbb", 2001)
+
+	var sentMux sync.Mutex
+	sent := map[string][]int64{}
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSend", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		r := args[1].(*ffcapi.TransactionSendRequest)
+		sentMux.Lock()
+		defer sentMux.Unlock()
+		sent[r.From] = append(sent[r.From], r.Nonce.Int64())
+	}).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x" + fftypes.NewRandB32().String(),
+	}, ffcapi.ErrorReason(""), nil)
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil)
+
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Len(t, m.inflight, 4)
+	for _, p := range m.inflight {
+		assert.NotNil(t, p.mtx.FirstSubmit)
+	}
+	assert.Equal(t, []int64{1000, 1001}, sent["0xaaaaa"])
+	assert.Equal(t, []int64{2000, 2001}, sent["0xbbbbb"])
+
+	// Each signer is handled by exactly one worker
+	partitions := m.partitionInflight()
+	assert.Len(t, partitions, 4)
+	signerWorker := map[string]int{}
+	for worker, partition := range partitions {
+		for _, p := range partition {
+			if w, ok := signerWorker[p.mtx.TransactionHeaders.From]; ok {
+				assert.Equal(t, w, worker)
+			}
+			signerWorker[p.mtx.TransactionHeaders.From] = worker
+		}
+	}
+	assert.Len(t, signerWorker, 2)
+
+	status := m.getPolicyLoopStatus()
+	assert.Len(t, status.Workers, 4)
+	total := 0
+	for i, ws := range status.Workers {
+		assert.Equal(t, i, ws.Worker)
+		assert.NotNil(t, ws.LastCycleStart)
+		total += ws.Transactions
+	}
+	assert.Equal(t, 4, total)
+
+	mfc.AssertNumberOfCalls(t, "TransactionSend", 4)
+}
+
+func TestPolicyLoopWorkersMinimumOne(t *testing.T) {
+	testManagerCommonInit(t)
+	config.Set(tmconfig.PolicyLoopWorkers, 0)
+
+	m := newManager(context.Background(), &ffcapimocks.API{})
+	assert.Equal(t, 1, m.policyLoopWorkers)
+	assert.Len(t, m.getPolicyLoopStatus().Workers, 1)
+}
+
 func TestPolicyLoopE2EReverted(t *testing.T) {
 
 	_, m, cancel := newTestManager(t)
@@ -343,6 +796,10 @@ func TestPolicyEngineFailStaleThenUpdated(t *testing.T) {
 
 	<-done2
 
+	// Wait for the policy loop to finish with the transaction, before the mock compares the arguments
+	cancel()
+	<-m.policyLoopDone
+
 	mpe.AssertExpectations(t)
 
 }
@@ -409,6 +866,7 @@ func TestExecPolicyDeleteInflightSync(t *testing.T) {
 
 	tx := genTestTxn("0xabcd1234", 12345, apitypes.TxStatusPending)
 	m.inflight = []*pendingState{{mtx: tx}}
+	m.nonceCache["0xabcd1234"] = &spentNonce{txID: tx.ID, nonce: 12345}
 
 	mp := m.persistence.(*persistencemocks.Persistence)
 	mp.On("DeleteTransaction", m.ctx, tx.ID).Return(nil)
@@ -426,6 +884,8 @@ func TestExecPolicyDeleteInflightSync(t *testing.T) {
 	assert.NoError(t, res.err)
 	assert.Equal(t, http.StatusOK, res.status)
 	assert.True(t, m.inflight[0].remove)
+	assert.Empty(t, m.nonceCache)
+	assert.Equal(t, apitypes.TxActionDeleteRequested, res.tx.History[len(res.tx.History)-1].Action)
 
 	mp.AssertExpectations(t)
 
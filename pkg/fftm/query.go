@@ -0,0 +1,61 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+func (m *manager) queryInvoke(ctx context.Context, request *apitypes.QueryRequest) (*fftypes.JSONAny, error) {
+
+	// A query can be pinned to at most one block, so that repeated reads are consistent
+	pins := 0
+	if request.BlockNumber != nil {
+		pins++
+	}
+	if request.BlockHash != "" {
+		pins++
+	}
+	if request.BlockTag != "" {
+		pins++
+		switch request.BlockTag {
+		case ffcapi.BlockTagLatest, ffcapi.BlockTagSafe, ffcapi.BlockTagFinalized:
+		default:
+			return nil, i18n.NewError(ctx, tmmsgs.MsgQueryBlockTagInvalid, request.BlockTag)
+		}
+	}
+	if pins > 1 {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgQueryBlockConflict)
+	}
+
+	res, _, err := m.connector.QueryInvoke(ctx, &ffcapi.QueryInvokeRequest{
+		TransactionInput: request.TransactionInput,
+		BlockNumber:      request.BlockNumber,
+		BlockHash:        request.BlockHash,
+		BlockTag:         request.BlockTag,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.Outputs, nil
+}
@@ -0,0 +1,96 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestQueryInvokeBlockTags(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	mca := m.connector.(*ffcapimocks.API)
+	for _, tag := range []ffcapi.BlockTag{ffcapi.BlockTagLatest, ffcapi.BlockTagSafe, ffcapi.BlockTagFinalized} {
+		tag := tag
+		mca.On("QueryInvoke", m.ctx, mock.MatchedBy(func(req *ffcapi.QueryInvokeRequest) bool {
+			return req.BlockTag == tag
+		})).Return(&ffcapi.QueryInvokeResponse{
+			Outputs: fftypes.JSONAnyPtr(`"` + string(tag) + `"`),
+		}, ffcapi.ErrorReason(""), nil).Once()
+
+		res, err := m.queryInvoke(m.ctx, &apitypes.QueryRequest{BlockTag: tag})
+		assert.NoError(t, err)
+		assert.Equal(t, `"`+string(tag)+`"`, res.String())
+	}
+
+	mca.AssertExpectations(t)
+}
+
+func TestQueryInvokeBlockHash(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	mca := m.connector.(*ffcapimocks.API)
+	mca.On("QueryInvoke", m.ctx, mock.MatchedBy(func(req *ffcapi.QueryInvokeRequest) bool {
+		return req.BlockHash == "0x12345" && req.BlockNumber == nil
+	})).Return(&ffcapi.QueryInvokeResponse{
+		Outputs: fftypes.JSONAnyPtr(`"pinned"`),
+	}, ffcapi.ErrorReason(""), nil)
+
+	res, err := m.queryInvoke(m.ctx, &apitypes.QueryRequest{BlockHash: "0x12345"})
+	assert.NoError(t, err)
+	assert.Equal(t, `"pinned"`, res.String())
+
+	mca.AssertExpectations(t)
+}
+
+func TestQueryInvokeBlockTagInvalid(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	_, err := m.queryInvoke(m.ctx, &apitypes.QueryRequest{BlockTag: "pending"})
+	assert.Regexp(t, "FF21096", err)
+}
+
+func TestQueryInvokeBlockConflict(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	_, err := m.queryInvoke(m.ctx, &apitypes.QueryRequest{
+		BlockNumber: fftypes.NewFFBigInt(12345),
+		BlockHash:   "0x12345",
+	})
+	assert.Regexp(t, "FF21095", err)
+
+	_, err = m.queryInvoke(m.ctx, &apitypes.QueryRequest{
+		BlockHash: "0x12345",
+		BlockTag:  ffcapi.BlockTagFinalized,
+	})
+	assert.Regexp(t, "FF21095", err)
+}
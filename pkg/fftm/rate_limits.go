@@ -0,0 +1,138 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/spf13/cast"
+)
+
+// signerRateLimiter maintains a token bucket for each signer, limiting the rate at which
+// transactions are submitted to the blockchain via TransactionSend.
+//
+// Each bucket holds up to the configured count of tokens, and is refilled continuously such
+// that the full count is replenished over the configured interval.
+type signerRateLimiter struct {
+	mux          sync.Mutex
+	defaultLimit int
+	interval     time.Duration
+	signerLimits map[string]int
+	buckets      map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	limit      int
+	tokens     float64
+	lastRefill time.Time
+}
+
+// newSignerRateLimiter returns nil if rate limiting is not configured
+func newSignerRateLimiter() *signerRateLimiter {
+	rl := &signerRateLimiter{
+		defaultLimit: config.GetInt(tmconfig.TransactionsRateLimitCount),
+		interval:     config.GetDuration(tmconfig.TransactionsRateLimitInterval),
+		signerLimits: make(map[string]int),
+		buckets:      make(map[string]*tokenBucket),
+	}
+	for signer, limit := range config.GetObject(tmconfig.TransactionsRateLimitSigners) {
+		rl.signerLimits[strings.ToLower(signer)] = cast.ToInt(limit)
+	}
+	if rl.interval <= 0 || (rl.defaultLimit <= 0 && len(rl.signerLimits) == 0) {
+		return nil
+	}
+	return rl
+}
+
+func (rl *signerRateLimiter) limitForSigner(signer string) int {
+	if limit, ok := rl.signerLimits[strings.ToLower(signer)]; ok {
+		return limit
+	}
+	return rl.defaultLimit
+}
+
+// refill must be called with the mutex held
+func (rl *signerRateLimiter) refill(b *tokenBucket, now time.Time) {
+	elapsed := now.Sub(b.lastRefill)
+	b.tokens += float64(b.limit) * float64(elapsed) / float64(rl.interval)
+	if b.tokens > float64(b.limit) {
+		b.tokens = float64(b.limit)
+	}
+	b.lastRefill = now
+}
+
+// take consumes a token for the signer if one is available, returning false if the submission must wait
+func (rl *signerRateLimiter) take(signer string) bool {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	limit := rl.limitForSigner(signer)
+	if limit <= 0 {
+		return true // rate limiting is disabled for this signer
+	}
+	// Keyed as the limits are, so the same address in a different case shares its bucket
+	key := strings.ToLower(signer)
+	now := time.Now()
+	b := rl.buckets[key]
+	if b == nil {
+		b = &tokenBucket{limit: limit, tokens: float64(limit), lastRefill: now}
+		rl.buckets[key] = b
+	} else {
+		rl.refill(b, now)
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// status returns the state of every signer bucket, refilled to the current time, sorted by signer
+func (rl *signerRateLimiter) status() []*apitypes.RateLimitStatus {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	now := time.Now()
+	statuses := make([]*apitypes.RateLimitStatus, 0, len(rl.buckets))
+	for signer, b := range rl.buckets {
+		rl.refill(b, now)
+		lastRefill := fftypes.FFTime(b.lastRefill)
+		statuses = append(statuses, &apitypes.RateLimitStatus{
+			Signer:     signer,
+			Limit:      b.limit,
+			Interval:   fftypes.FFDuration(rl.interval),
+			Tokens:     b.tokens,
+			LastRefill: &lastRefill,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Signer < statuses[j].Signer })
+	return statuses
+}
+
+func (m *manager) getRateLimits() []*apitypes.RateLimitStatus {
+	if m.rateLimiter == nil {
+		return []*apitypes.RateLimitStatus{}
+	}
+	return m.rateLimiter.status()
+}
@@ -0,0 +1,94 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterDisabledByDefault(t *testing.T) {
+	tmconfig.Reset()
+	assert.Nil(t, newSignerRateLimiter())
+}
+
+func TestRateLimiterSignerOverrides(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsRateLimitSigners, map[string]interface{}{
+		"0xAAAAA": 2,
+		"0xbbbbb": 0,
+	})
+
+	rl := newSignerRateLimiter()
+	assert.NotNil(t, rl)
+
+	// Override matched case-insensitively, with one bucket whatever the case of the signer
+	assert.True(t, rl.take("0xaaaaa"))
+	assert.True(t, rl.take("0xAAAAA"))
+	assert.False(t, rl.take("0xaaaaa"))
+	assert.False(t, rl.take("0xAaAaA"))
+
+	// No limit for signers with a zero override, or without an override (as the default is zero)
+	for i := 0; i < 10; i++ {
+		assert.True(t, rl.take("0xbbbbb"))
+		assert.True(t, rl.take("0xccccc"))
+	}
+
+	statuses := rl.status()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "0xaaaaa", statuses[0].Signer)
+	assert.Equal(t, 2, statuses[0].Limit)
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsRateLimitCount, 10)
+	config.Set(tmconfig.TransactionsRateLimitInterval, "1s")
+
+	rl := newSignerRateLimiter()
+	for i := 0; i < 10; i++ {
+		assert.True(t, rl.take("0xaaaaa"))
+	}
+	assert.False(t, rl.take("0xaaaaa"))
+	assert.True(t, rl.take("0xbbbbb"))
+
+	// Wind back the clock on the bucket by half the interval
+	rl.buckets["0xaaaaa"].lastRefill = time.Now().Add(-500 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		assert.True(t, rl.take("0xaaaaa"))
+	}
+	assert.False(t, rl.take("0xaaaaa"))
+
+	// The bucket never fills beyond the limit
+	rl.buckets["0xaaaaa"].lastRefill = time.Now().Add(-1 * time.Hour)
+	statuses := rl.status()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "0xaaaaa", statuses[0].Signer)
+	assert.Equal(t, float64(10), statuses[0].Tokens)
+	assert.Equal(t, "0xbbbbb", statuses[1].Signer)
+}
+
+func TestGetRateLimitsDisabled(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	assert.Empty(t, m.getRateLimits())
+}
@@ -25,7 +25,6 @@ import (
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
-	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
 )
 
 var postRootCommand = func(m *manager) *ffapi.Route {
@@ -47,6 +46,10 @@ var postRootCommand = func(m *manager) *ffapi.Route {
 			if err == nil {
 				schemas = append(schemas, deployRequest)
 			}
+			rawRequest, err := schemaGen(&apitypes.RawTransactionRequest{})
+			if err == nil {
+				schemas = append(schemas, rawRequest)
+			}
 			queryRequest, err := schemaGen(&apitypes.QueryRequest{})
 			if err == nil {
 				schemas = append(schemas, queryRequest)
@@ -70,7 +73,7 @@ var postRootCommand = func(m *manager) *ffapi.Route {
 				},
 			}, nil
 		},
-		JSONOutputCodes: []int{http.StatusAccepted},
+		JSONOutputCodes: []int{http.StatusAccepted, http.StatusOK},
 		JSONHandler: func(r *ffapi.APIRequest) (output interface{}, err error) {
 			baseReq := r.Input.(*apitypes.BaseRequest)
 			switch baseReq.Headers.Type {
@@ -79,25 +82,47 @@ var postRootCommand = func(m *manager) *ffapi.Route {
 				if err = baseReq.UnmarshalTo(&tReq); err != nil {
 					return nil, i18n.NewError(r.Req.Context(), tmmsgs.MsgInvalidRequestErr, baseReq.Headers.Type, err)
 				}
-				return m.sendManagedTransaction(r.Req.Context(), &tReq)
+				mtx, existing, err := m.sendManagedTransaction(r.Req.Context(), &tReq)
+				if existing {
+					r.SuccessStatus = http.StatusOK // idempotent resubmission of a request we already accepted
+				}
+				return mtx, err
+			case apitypes.RequestTypePrepareTransaction:
+				var tReq apitypes.TransactionRequest
+				if err = baseReq.UnmarshalTo(&tReq); err != nil {
+					return nil, i18n.NewError(r.Req.Context(), tmmsgs.MsgInvalidRequestErr, baseReq.Headers.Type, err)
+				}
+				mtx, existing, err := m.prepareManagedTransaction(r.Req.Context(), &tReq)
+				if existing {
+					r.SuccessStatus = http.StatusOK // idempotent resubmission of a request we already accepted
+				}
+				return mtx, err
+			case apitypes.RequestTypeSendRawTransaction:
+				var tReq apitypes.RawTransactionRequest
+				if err = baseReq.UnmarshalTo(&tReq); err != nil {
+					return nil, i18n.NewError(r.Req.Context(), tmmsgs.MsgInvalidRequestErr, baseReq.Headers.Type, err)
+				}
+				mtx, existing, err := m.submitRawTransaction(r.Req.Context(), &tReq)
+				if existing {
+					r.SuccessStatus = http.StatusOK // idempotent resubmission of a request we already accepted
+				}
+				return mtx, err
 			case apitypes.RequestTypeDeploy:
 				var tReq apitypes.ContractDeployRequest
 				if err = baseReq.UnmarshalTo(&tReq); err != nil {
 					return nil, i18n.NewError(r.Req.Context(), tmmsgs.MsgInvalidRequestErr, baseReq.Headers.Type, err)
 				}
-				return m.sendManagedContractDeployment(r.Req.Context(), &tReq)
+				mtx, existing, err := m.sendManagedContractDeployment(r.Req.Context(), &tReq)
+				if existing {
+					r.SuccessStatus = http.StatusOK // idempotent resubmission of a request we already accepted
+				}
+				return mtx, err
 			case apitypes.RequestTypeQuery:
 				var tReq apitypes.QueryRequest
 				if err = baseReq.UnmarshalTo(&tReq); err != nil {
 					return nil, i18n.NewError(r.Req.Context(), tmmsgs.MsgInvalidRequestErr, baseReq.Headers.Type, err)
 				}
-				res, _, err := m.connector.QueryInvoke(r.Req.Context(), &ffcapi.QueryInvokeRequest{
-					TransactionInput: tReq.TransactionInput,
-				})
-				if err != nil {
-					return nil, err
-				}
-				return res.Outputs, nil
+				return m.queryInvoke(r.Req.Context(), &tReq)
 			default:
 				return nil, i18n.NewError(r.Req.Context(), tmmsgs.MsgUnsupportedRequestType, baseReq.Headers.Type)
 			}
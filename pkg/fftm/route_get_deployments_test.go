@@ -0,0 +1,68 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDeployment(t *testing.T, m *manager, signer string, nonce int64, status apitypes.TxStatus) *apitypes.ManagedTX {
+	tx := genTestTxn(signer, nonce, status)
+	tx.ContractDeploy = true
+	err := m.persistence.WriteTransaction(context.Background(), tx, true)
+	assert.NoError(t, err)
+	return tx
+}
+
+func TestGetDeployments(t *testing.T) {
+
+	url, m, done := newTestManager(t)
+	defer done()
+	noopPolicyEngine(m)
+
+	err := m.Start()
+	assert.NoError(t, err)
+
+	d1 := newTestDeployment(t, m, "0xaaaaa", 10001, apitypes.TxStatusSucceeded)
+	_ = newTestTxn(t, m, "0xaaaaa", 10002, apitypes.TxStatusSucceeded)
+	d2 := newTestDeployment(t, m, "0xaaaaa", 10003, apitypes.TxStatusPending)
+
+	var deployments []*apitypes.ManagedTX
+	res, err := resty.New().R().
+		SetResult(&deployments).
+		Get(url + "/deployments?direction=asc")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Len(t, deployments, 2)
+	assert.Equal(t, d1.ID, deployments[0].ID)
+	assert.Equal(t, d2.ID, deployments[1].ID)
+
+	// Default sort is newest first
+	res, err = resty.New().R().
+		SetResult(&deployments).
+		Get(url + "/deployments?limit=1&after=" + d2.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Len(t, deployments, 1)
+	assert.Equal(t, d1.ID, deployments[0].ID)
+
+}
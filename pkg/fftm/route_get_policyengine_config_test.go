@@ -0,0 +1,61 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPolicyEngineConfig(t *testing.T) {
+
+	url, m, done := newTestManager(t)
+	defer done()
+
+	err := m.Start()
+	assert.NoError(t, err)
+
+	var peConfig apitypes.PolicyEngineConfig
+	res, err := resty.New().R().
+		SetResult(&peConfig).
+		Get(url + "/policyengine/config")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Equal(t, "simple", peConfig.Name)
+	assert.Nil(t, peConfig.Updated)
+	assert.Empty(t, peConfig.Config)
+
+	err = m.persistence.WritePolicyEngineConfig(m.ctx, &apitypes.PolicyEngineConfig{
+		Name:    "simple",
+		Updated: fftypes.Now(),
+		Config:  fftypes.JSONObject{"fixedGasPrice": "12345"},
+	})
+	assert.NoError(t, err)
+
+	res, err = resty.New().R().
+		SetResult(&peConfig).
+		Get(url + "/policyengine/config")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.NotNil(t, peConfig.Updated)
+	assert.Equal(t, "12345", peConfig.Config.GetString("fixedGasPrice"))
+
+}
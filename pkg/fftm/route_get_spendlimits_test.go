@@ -0,0 +1,54 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSpendLimits(t *testing.T) {
+
+	url, m, done := newTestManager(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	sl, err := newSignerSpendLimiter(m.ctx)
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+	sl.record("tx1", sampleSpendTX("0xaaaaa", 100, 10, "5"))
+
+	err = m.Start()
+	assert.NoError(t, err)
+
+	var sls []*apitypes.SpendLimitStatus
+	res, err := resty.New().R().
+		SetResult(&sls).
+		Get(url + "/spendlimits")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Len(t, sls, 1)
+	assert.Equal(t, "0xaaaaa", sls[0].Signer)
+	assert.Equal(t, int64(150), sls[0].Spent.Int64())
+	assert.Equal(t, int64(1000), sls[0].Limit.Int64())
+
+}
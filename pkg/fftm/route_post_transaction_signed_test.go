@@ -0,0 +1,110 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/confirmationsmocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPostTransactionSigned(t *testing.T) {
+
+	url, m, done := newTestManager(t)
+	defer done()
+	noopPolicyEngine(m)
+	m.idempotentResubmit = true
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(12345),
+	}, ffcapi.ErrorReason(""), nil)
+	mfc.On("TransactionPrepare", mock.Anything, mock.Anything).Return(&ffcapi.TransactionPrepareResponse{
+		TransactionData: "RAW_UNSIGNED_BYTES",
+		Gas:             fftypes.NewFFBigInt(2000000),
+	}, ffcapi.ErrorReason(""), nil)
+	mfc.On("TransactionDecode", mock.Anything, &ffcapi.TransactionDecodeRequest{RawTransaction: "RAW_SIGNED_BYTES"}).Return(&ffcapi.TransactionDecodeResponse{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  "0xb480F96c0a3d6E9e9a263e4665a39bFa6c4d01E8",
+			To:    "0xe1a078b9e2b145d0a7387f09277c6ae1d9470771",
+			Nonce: fftypes.NewFFBigInt(12345),
+			Gas:   fftypes.NewFFBigInt(2000000),
+		},
+		TransactionData: "RAW_UNSIGNED_BYTES",
+		TransactionHash: "0x106215b9c0c9372e3f541beff0cdc3cd061a26f69f3808e28fd139a1abc9d345",
+	}, ffcapi.ErrorReason(""), nil)
+	mfc.On("TransactionSendRaw", mock.Anything, mock.MatchedBy(func(req *ffcapi.TransactionSendRawRequest) bool {
+		return req.RawTransaction == "RAW_SIGNED_BYTES" && req.Nonce.Int64() == 12345
+	})).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: "0x106215b9c0c9372e3f541beff0cdc3cd061a26f69f3808e28fd139a1abc9d345",
+	}, ffcapi.ErrorReason(""), nil)
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.Anything).Return(nil).Maybe()
+
+	err := m.Start()
+	assert.NoError(t, err)
+
+	var prepared *apitypes.ManagedTX
+	res, err := resty.New().R().
+		SetBody(strings.Replace(sampleSendTX, `"SendTransaction"`, `"PrepareTransaction"`, 1)).
+		SetHeader("content-type", "application/json").
+		SetResult(&prepared).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 202, res.StatusCode())
+	assert.True(t, prepared.SignExternally)
+	assert.Equal(t, "RAW_UNSIGNED_BYTES", prepared.TransactionData)
+	assert.Equal(t, int64(12345), prepared.Nonce.Int64())
+
+	// A retry of the same request returns the same unsigned transaction
+	res, err = resty.New().R().
+		SetBody(strings.Replace(sampleSendTX, `"SendTransaction"`, `"PrepareTransaction"`, 1)).
+		SetHeader("content-type", "application/json").
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+
+	var submitted *apitypes.ManagedTX
+	res, err = resty.New().R().
+		SetBody(&apitypes.SignedTransactionRequest{RawTransaction: "RAW_SIGNED_BYTES"}).
+		SetResult(&submitted).
+		Post(fmt.Sprintf("%s/transactions/%s/signed", url, prepared.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, 202, res.StatusCode())
+	assert.Equal(t, prepared.ID, submitted.ID)
+	assert.Equal(t, "0x106215b9c0c9372e3f541beff0cdc3cd061a26f69f3808e28fd139a1abc9d345", submitted.TransactionHash)
+
+	var errRes fftypes.RESTError
+	res, err = resty.New().R().
+		SetBody(&apitypes.SignedTransactionRequest{RawTransaction: "RAW_SIGNED_BYTES"}).
+		SetError(&errRes).
+		Post(fmt.Sprintf("%s/transactions/%s/signed", url, prepared.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, 409, res.StatusCode())
+	assert.Regexp(t, "FF21105", errRes.Error)
+
+}
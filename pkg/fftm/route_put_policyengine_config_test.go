@@ -0,0 +1,129 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutPolicyEngineConfig(t *testing.T) {
+
+	url, m, done := newTestManager(t)
+	defer done()
+
+	err := m.Start()
+	assert.NoError(t, err)
+	origEngine := m.policyEngine
+
+	var peConfig apitypes.PolicyEngineConfig
+	res, err := resty.New().R().
+		SetBody(&apitypes.PolicyEngineConfig{
+			Config: fftypes.JSONObject{
+				"fixedGasPrice": "12345",
+			},
+		}).
+		SetResult(&peConfig).
+		Put(url + "/policyengine/config")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Equal(t, "simple", peConfig.Name)
+	assert.NotNil(t, peConfig.Updated)
+	assert.NotEqual(t, origEngine, m.policyEngine)
+
+	stored, err := m.persistence.GetPolicyEngineConfig(m.ctx, "simple")
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", stored.Config.GetString("fixedGasPrice"))
+
+	res, err = resty.New().R().
+		SetBody(&apitypes.PolicyEngineConfig{
+			Config: fftypes.JSONObject{
+				"gasOracle": map[string]interface{}{
+					"mode": "restapi",
+				},
+			},
+		}).
+		Put(url + "/policyengine/config")
+	assert.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode())
+	assert.Regexp(t, "FF21070", res.String())
+
+}
+
+func TestPutPolicyEngineConfigInstance(t *testing.T) {
+
+	url, m, done := newTestManager(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+policyengine:
+  instances:
+  - name: bulk
+    type: simple
+    simple:
+      fixedGasPrice: 1000
+`)
+	err := m.initPolicyEngineInstances(m.ctx)
+	assert.NoError(t, err)
+
+	err = m.Start()
+	assert.NoError(t, err)
+	origDefault := m.policyEngine
+	origBulk := m.policyEngines["bulk"]
+
+	var peConfig apitypes.PolicyEngineConfig
+	res, err := resty.New().R().
+		SetBody(&apitypes.PolicyEngineConfig{
+			Config: fftypes.JSONObject{
+				"fixedGasPrice": "12345",
+			},
+		}).
+		SetQueryParam("policyEngine", "bulk").
+		SetResult(&peConfig).
+		Put(url + "/policyengine/config")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Equal(t, "bulk", peConfig.Name)
+	assert.Equal(t, origDefault, m.policyEngine)
+	assert.NotEqual(t, origBulk, m.policyEngines["bulk"])
+
+	stored, err := m.persistence.GetPolicyEngineConfig(m.ctx, "bulk")
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", stored.Config.GetString("fixedGasPrice"))
+
+	res, err = resty.New().R().
+		SetResult(&peConfig).
+		SetQueryParam("policyEngine", "bulk").
+		Get(url + "/policyengine/config")
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+	assert.Equal(t, "bulk", peConfig.Name)
+	assert.Equal(t, "12345", peConfig.Config.GetString("fixedGasPrice"))
+
+	res, err = resty.New().R().
+		SetBody(&apitypes.PolicyEngineConfig{}).
+		SetQueryParam("policyEngine", "wrong").
+		Put(url + "/policyengine/config")
+	assert.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode())
+	assert.Regexp(t, "FF21077", res.String())
+
+}
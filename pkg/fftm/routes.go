@@ -24,12 +24,20 @@ func (m *manager) routes() []*ffapi.Route {
 		deleteEventStreamListener(m),
 		deleteSubscription(m),
 		deleteTransaction(m),
+		getDeployments(m),
 		getEventStream(m),
 		getEventStreamListener(m),
 		getEventStreamListeners(m),
 		getEventStreams(m),
+		getGasOracleStatus(m),
 		getLiveStatus(m),
+		getPolicyEngineConfig(m),
+		getRateLimits(m),
+		getSignerNonce(m),
+		getSpendLimits(m),
 		getStatus(m),
+		getStatusLeader(m),
+		getPolicyLoopStatus(m),
 		getSubscription(m),
 		getSubscriptions(m),
 		getReadyStatus(m),
@@ -38,13 +46,21 @@ func (m *manager) routes() []*ffapi.Route {
 		patchEventStream(m),
 		patchEventStreamListener(m),
 		patchSubscription(m),
+		postDrain(m),
 		postEventStream(m),
 		postEventStreamListenerReset(m),
 		postEventStreamListeners(m),
 		postEventStreamResume(m),
 		postEventStreamSuspend(m),
 		postRootCommand(m),
+		postSignerNonceResync(m),
+		postSignerPause(m),
+		postSignerResume(m),
+		postSpendLimitReset(m),
 		postSubscriptionReset(m),
 		postSubscriptions(m),
+		postTransactionSigned(m),
+		putPolicyEngineConfig(m),
+		putSignerNonce(m),
 	}
 }
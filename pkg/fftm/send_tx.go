@@ -17,15 +17,43 @@
 package fftm
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
 )
 
-func (m *manager) sendManagedTransaction(ctx context.Context, request *apitypes.TransactionRequest) (*apitypes.ManagedTX, error) {
+func (m *manager) sendManagedTransaction(ctx context.Context, request *apitypes.TransactionRequest) (*apitypes.ManagedTX, bool, error) {
+	return m.newManagedTransaction(ctx, request, false)
+}
+
+// prepareManagedTransaction assigns a nonce to a transaction that is signed outside of the connector, and returns
+// the unsigned transaction. It is submitted once the signed transaction is supplied with submitSignedTransaction.
+func (m *manager) prepareManagedTransaction(ctx context.Context, request *apitypes.TransactionRequest) (*apitypes.ManagedTX, bool, error) {
+	return m.newManagedTransaction(ctx, request, true)
+}
+
+func (m *manager) newManagedTransaction(ctx context.Context, request *apitypes.TransactionRequest, signExternally bool) (*apitypes.ManagedTX, bool, error) {
+
+	// Check if this is a retry of a request we have already accepted
+	requestHash := requestContentHash(request)
+	if existing, err := m.checkIdempotentResubmit(ctx, request.Headers.ID, requestHash); err != nil || existing != nil {
+		return existing, existing != nil, err
+	}
+
+	policyEngineName, err := m.resolvePolicyEngineName(ctx, request.Headers.PolicyEngine)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := m.checkSignerPolicy(ctx, request.Headers.ID, &request.TransactionHeaders, false); err != nil {
+		return nil, false, err
+	}
 
 	// Prepare the transaction, which will mean we have a transaction that should be submittable.
 	// If we fail at this stage, we don't need to write any state as we are sure we haven't submitted
@@ -34,26 +62,78 @@ func (m *manager) sendManagedTransaction(ctx context.Context, request *apitypes.
 		TransactionInput: request.TransactionInput,
 	})
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return m.submitPreparedTX(ctx, request.Headers.ID, &request.TransactionHeaders, prepared.Gas, prepared.TransactionData)
+	return m.submitPreparedTX(ctx, request.Headers.ID, requestHash, policyEngineName, &request.TransactionHeaders, prepared.Gas, prepared.TransactionData, false, signExternally)
 }
 
-func (m *manager) sendManagedContractDeployment(ctx context.Context, request *apitypes.ContractDeployRequest) (*apitypes.ManagedTX, error) {
+func (m *manager) sendManagedContractDeployment(ctx context.Context, request *apitypes.ContractDeployRequest) (*apitypes.ManagedTX, bool, error) {
+
+	// Check if this is a retry of a request we have already accepted
+	requestHash := requestContentHash(request)
+	if existing, err := m.checkIdempotentResubmit(ctx, request.Headers.ID, requestHash); err != nil || existing != nil {
+		return existing, existing != nil, err
+	}
+
+	policyEngineName, err := m.resolvePolicyEngineName(ctx, request.Headers.PolicyEngine)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := m.checkSignerPolicy(ctx, request.Headers.ID, &request.TransactionHeaders, true); err != nil {
+		return nil, false, err
+	}
 
 	// Prepare the transaction, which will mean we have a transaction that should be submittable.
 	// If we fail at this stage, we don't need to write any state as we are sure we haven't submitted
 	// anything to the blockchain itself.
 	prepared, _, err := m.connector.DeployContractPrepare(ctx, &request.ContractDeployPrepareRequest)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return m.submitPreparedTX(ctx, request.Headers.ID, &request.TransactionHeaders, prepared.Gas, prepared.TransactionData)
+	return m.submitPreparedTX(ctx, request.Headers.ID, requestHash, policyEngineName, &request.TransactionHeaders, prepared.Gas, prepared.TransactionData, true, false)
 }
 
-func (m *manager) submitPreparedTX(ctx context.Context, txID string, txHeaders *ffcapi.TransactionHeaders, gas *fftypes.FFBigInt, transactionData string) (*apitypes.ManagedTX, error) {
+// requestContentHash is stored on the transaction, so a retry of the same request can be distinguished
+// from a different request that re-uses the same ID
+// from a different request that re-uses the same ID. The JSON is canonicalised before it is hashed, with the
+// keys of objects within the parameters sorted, so a retry that serializes the same parameters differently matches.
+func requestContentHash(request interface{}) *fftypes.Bytes32 {
+	b, _ := json.Marshal(request)
+	var canonical interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber() // so numbers are hashed exactly as supplied
+	_ = decoder.Decode(&canonical)
+	b, _ = json.Marshal(canonical)
+	return fftypes.HashString(string(b))
+}
+
+// checkIdempotentResubmit returns the existing transaction, if idempotent resubmission is enabled
+// and the ID supplied matches a transaction created from an identical request.
+// A different request using the same ID is rejected with a conflict.
+// It is checked again if storing a new transaction conflicts, as an identical request might have been
+// stored concurrently since the first check.
+func (m *manager) checkIdempotentResubmit(ctx context.Context, txID string, requestHash *fftypes.Bytes32) (*apitypes.ManagedTX, error) {
+	if !m.idempotentResubmit || txID == "" {
+		return nil, nil
+	}
+	existing, err := m.persistence.GetTransactionByID(ctx, txID)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	if !existing.RequestHash.Equals(requestHash) {
+		log.L(ctx).Warnf("Request ID '%s' re-used with different content (existing=%s new=%s)", txID, existing.RequestHash, requestHash)
+		return nil, i18n.NewError(ctx, tmmsgs.MsgDuplicateID, txID)
+	}
+	log.L(ctx).Infof("Returning existing transaction %s for idempotent resubmission (status=%s)", txID, existing.Status)
+	return existing, nil
+}
+
+func (m *manager) submitPreparedTX(ctx context.Context, txID string, requestHash *fftypes.Bytes32, policyEngineName string, txHeaders *ffcapi.TransactionHeaders, gas *fftypes.FFBigInt, transactionData string, contractDeploy, signExternally bool) (*apitypes.ManagedTX, bool, error) {
+
+	// The connector has prepared the transaction before we are called
+	prepared := fftypes.Now()
 
 	// The request ID is the primary ID, and should be supplied by the user for idempotence
 	if txID == "" {
@@ -65,7 +145,7 @@ func (m *manager) submitPreparedTX(ctx context.Context, txID string, txHeaders *
 	// fail deterministically in a way that allows us to return it.
 	lockedNonce, err := m.assignAndLockNonce(ctx, txID, txHeaders.From)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	// We will call markSpent() once we reach the point the nonce has been used
 	defer lockedNonce.complete(ctx)
@@ -89,11 +169,28 @@ func (m *manager) submitPreparedTX(ctx context.Context, txID string, txHeaders *
 		Gas:                gas,
 		TransactionHeaders: *txHeaders,
 		TransactionData:    transactionData,
+		RequestHash:        requestHash,
+		PolicyEngine:       policyEngineName,
+		ContractDeploy:     contractDeploy,
+		SignExternally:     signExternally,
 		Status:             apitypes.TxStatusPending,
 	}
+	mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+		Time:   prepared,
+		Action: apitypes.TxActionPrepared,
+	})
+	mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+		Time:   now,
+		Action: apitypes.TxActionNonceAssigned,
+		Nonce:  mtx.Nonce,
+	})
+	m.trimHistory(mtx)
 
 	if err = m.persistence.WriteTransaction(m.ctx, mtx, true); err != nil {
-		return nil, err
+		if existing, checkErr := m.checkIdempotentResubmit(ctx, txID, requestHash); checkErr != nil || existing != nil {
+			return existing, existing != nil, checkErr
+		}
+		return nil, false, err
 	}
 	log.L(m.ctx).Infof("Tracking transaction %s at nonce %s / %d", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64())
 	m.markInflightStale()
@@ -102,5 +199,5 @@ func (m *manager) submitPreparedTX(ctx context.Context, txID string, txHeaders *
 	// completion adding this transaction to the pool (and/or the change event that comes in from
 	// FireFly core from the update to the transaction)
 	lockedNonce.spent = mtx
-	return mtx, nil
+	return mtx, false, nil
 }
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
 	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
@@ -45,7 +46,229 @@ func TestSendTXPersistFail(t *testing.T) {
 	err := json.Unmarshal([]byte(sampleSendTX), &txReq)
 	assert.NoError(t, err)
 
-	_, err = m.submitPreparedTX(m.ctx, "id1", &txReq.TransactionHeaders, fftypes.NewFFBigInt(12345), "0x123456")
+	_, _, err = m.submitPreparedTX(m.ctx, "id1", nil, "simple", &txReq.TransactionHeaders, fftypes.NewFFBigInt(12345), "0x123456", false, false)
 	assert.Regexp(t, "pop", err)
 
 }
+
+func TestSendTXIdempotentResubmit(t *testing.T) {
+
+	_, m, close := newTestManager(t)
+	defer close()
+	m.idempotentResubmit = true
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(12345),
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mFFC.On("TransactionPrepare", mock.Anything, mock.Anything).Return(&ffcapi.TransactionPrepareResponse{
+		TransactionData: "RAW_UNSIGNED_BYTES",
+		Gas:             fftypes.NewFFBigInt(2000000),
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	var txReq *apitypes.TransactionRequest
+	err := json.Unmarshal([]byte(sampleSendTX), &txReq)
+	assert.NoError(t, err)
+
+	mtx1, existing, err := m.sendManagedTransaction(m.ctx, txReq)
+	assert.NoError(t, err)
+	assert.False(t, existing)
+	assert.NotNil(t, mtx1.RequestHash)
+
+	// Identical retry returns the existing transaction, without preparing again
+	mtx2, existing, err := m.sendManagedTransaction(m.ctx, txReq)
+	assert.NoError(t, err)
+	assert.True(t, existing)
+	assert.Equal(t, mtx1.ID, mtx2.ID)
+	assert.Equal(t, mtx1.SequenceID, mtx2.SequenceID)
+
+	// Same ID with different content is a conflict
+	txReq.To = "0x2222"
+	_, _, err = m.sendManagedTransaction(m.ctx, txReq)
+	assert.Regexp(t, "FF21065", err)
+
+	mFFC.AssertExpectations(t)
+
+}
+
+func TestSendTXIdempotentResubmitConcurrent(t *testing.T) {
+
+	_, m, close := newTestManager(t)
+	defer close()
+	m.idempotentResubmit = true
+
+	var txReq *apitypes.TransactionRequest
+	err := json.Unmarshal([]byte(sampleSendTX), &txReq)
+	assert.NoError(t, err)
+
+	// An identical request is stored while this one is being prepared
+	concurrent := genTestTxn("0xaaaaa", 10000, apitypes.TxStatusPending)
+	concurrent.ID = txReq.Headers.ID
+	concurrent.RequestHash = requestContentHash(txReq)
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(12345),
+	}, ffcapi.ErrorReason(""), nil)
+	mFFC.On("TransactionPrepare", mock.Anything, mock.Anything).Return(&ffcapi.TransactionPrepareResponse{
+		TransactionData: "RAW_UNSIGNED_BYTES",
+		Gas:             fftypes.NewFFBigInt(2000000),
+	}, ffcapi.ErrorReason(""), nil).Run(func(args mock.Arguments) {
+		err := m.persistence.WriteTransaction(m.ctx, concurrent, true)
+		assert.NoError(t, err)
+	}).Once()
+
+	mtx, existing, err := m.sendManagedTransaction(m.ctx, txReq)
+	assert.NoError(t, err)
+	assert.True(t, existing)
+	assert.Equal(t, concurrent.SequenceID, mtx.SequenceID)
+
+	// The nonce assigned to this request was not used, so is assigned again
+	locked, err := m.assignAndLockNonce(m.ctx, "ns1:"+fftypes.NewUUID().String(), txReq.From)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(12345), locked.nonce)
+	locked.complete(m.ctx)
+
+	mFFC.AssertExpectations(t)
+
+}
+
+func TestSendTXIdempotentResubmitConcurrentConflict(t *testing.T) {
+
+	_, m, close := newTestManager(t)
+	defer close()
+	m.idempotentResubmit = true
+
+	var txReq *apitypes.TransactionRequest
+	err := json.Unmarshal([]byte(sampleSendTX), &txReq)
+	assert.NoError(t, err)
+
+	// A different request with the same ID is stored while this one is being prepared
+	concurrent := genTestTxn("0xaaaaa", 10000, apitypes.TxStatusPending)
+	concurrent.ID = txReq.Headers.ID
+	concurrent.RequestHash = fftypes.NewRandB32()
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("NextNonceForSigner", mock.Anything, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(12345),
+	}, ffcapi.ErrorReason(""), nil)
+	mFFC.On("TransactionPrepare", mock.Anything, mock.Anything).Return(&ffcapi.TransactionPrepareResponse{
+		TransactionData: "RAW_UNSIGNED_BYTES",
+		Gas:             fftypes.NewFFBigInt(2000000),
+	}, ffcapi.ErrorReason(""), nil).Run(func(args mock.Arguments) {
+		err := m.persistence.WriteTransaction(m.ctx, concurrent, true)
+		assert.NoError(t, err)
+	}).Once()
+
+	_, existing, err := m.sendManagedTransaction(m.ctx, txReq)
+	assert.Regexp(t, "FF21065", err)
+	assert.False(t, existing)
+
+}
+
+func TestRequestContentHashCanonical(t *testing.T) {
+
+	hashParams := func(params ...string) *fftypes.Bytes32 {
+		req := &apitypes.TransactionRequest{}
+		req.Headers.ID = "id1"
+		for _, p := range params {
+			req.Params = append(req.Params, fftypes.JSONAnyPtr(p))
+		}
+		return requestContentHash(req)
+	}
+
+	// Whitespace and the order of the keys in objects do not matter
+	assert.Equal(t, hashParams(`{"a":1,"b":[{"c":"d","e":2}]}`), hashParams(`{ "b": [ { "e": 2, "c": "d" } ],
+		"a": 1 }`))
+
+	// Large numbers are compared exactly
+	assert.NotEqual(t, hashParams(`123456789012345678901234567890`), hashParams(`123456789012345678901234567891`))
+	assert.NotEqual(t, hashParams(`{"a":1}`), hashParams(`{"a":"1"}`))
+	assert.NotEqual(t, hashParams(`1`, `2`), hashParams(`2`, `1`))
+
+}
+
+func TestSendTXIdempotentResubmitDisabled(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	mFFC := m.connector.(*ffcapimocks.API)
+	mFFC.On("DeployContractPrepare", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop"))
+
+	// No persistence lookup is performed when disabled
+	_, existing, err := m.sendManagedContractDeployment(m.ctx, &apitypes.ContractDeployRequest{
+		Headers: apitypes.RequestHeaders{ID: "id1"},
+	})
+	assert.Regexp(t, "pop", err)
+	assert.False(t, existing)
+
+}
+
+func TestSendTXIdempotentResubmitLookupFail(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+	m.idempotentResubmit = true
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetTransactionByID", m.ctx, "id1").Return(nil, fmt.Errorf("pop"))
+
+	_, _, err := m.sendManagedContractDeployment(m.ctx, &apitypes.ContractDeployRequest{
+		Headers: apitypes.RequestHeaders{ID: "id1"},
+	})
+	assert.Regexp(t, "pop", err)
+
+}
+
+func TestSendTXIdempotentResubmitDeploy(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+	m.idempotentResubmit = true
+
+	deployReq := &apitypes.ContractDeployRequest{
+		Headers: apitypes.RequestHeaders{ID: "id1"},
+	}
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetTransactionByID", m.ctx, "id1").Return(&apitypes.ManagedTX{
+		ID:          "id1",
+		RequestHash: requestContentHash(deployReq),
+	}, nil)
+
+	mtx, existing, err := m.sendManagedContractDeployment(m.ctx, deployReq)
+	assert.NoError(t, err)
+	assert.True(t, existing)
+	assert.Equal(t, "id1", mtx.ID)
+
+}
+
+func TestSendTXUnknownPolicyEngine(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	var txReq *apitypes.TransactionRequest
+	err := json.Unmarshal([]byte(sampleSendTX), &txReq)
+	assert.NoError(t, err)
+	txReq.Headers.PolicyEngine = "wrong"
+
+	_, _, err = m.sendManagedTransaction(m.ctx, txReq)
+	assert.Regexp(t, "FF21077", err)
+
+}
+
+func TestDeployUnknownPolicyEngine(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	var deployReq *apitypes.ContractDeployRequest
+	err := json.Unmarshal([]byte(sampleDeployTX), &deployReq)
+	assert.NoError(t, err)
+	deployReq.Headers.PolicyEngine = "wrong"
+
+	_, _, err = m.sendManagedContractDeployment(m.ctx, deployReq)
+	assert.Regexp(t, "FF21077", err)
+
+}
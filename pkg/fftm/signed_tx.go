@@ -0,0 +1,310 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengine"
+)
+
+func (m *manager) requestSignedTransactionSubmit(ctx context.Context, txID string, request *apitypes.SignedTransactionRequest) (*apitypes.ManagedTX, error) {
+	res := m.policyEngineAPIRequest(ctx, &policyEngineAPIRequest{
+		requestType:    policyEngineAPIRequestTypeSubmitSigned,
+		txID:           txID,
+		rawTransaction: request.RawTransaction,
+	})
+	return res.tx, res.err
+}
+
+// submitSignedTransaction is called on the policy loop, to submit a transaction prepared for external signing
+// once it is supplied signed. The policy engine is not involved, as the gas price is set by the signer.
+// If the signed transaction does not match the prepared transaction, or its submission is rejected by the connector
+// or the spend limit, nothing is recorded, so the caller can supply it again. If the submission is held by the
+// spend limit or rate limit, the signed transaction is recorded and broadcast by the policy loop once allowed.
+func (m *manager) submitSignedTransaction(ctx context.Context, pending *pendingState, rawTransaction string) error {
+	mtx := pending.mtx
+	switch {
+	case rawTransaction == "":
+		return i18n.NewError(ctx, tmmsgs.MsgMissingRawTransaction)
+	case !mtx.SignExternally:
+		return i18n.NewError(ctx, tmmsgs.MsgTransactionNotSignExternally, mtx.ID)
+	case mtx.FirstSubmit != nil || mtx.Status != apitypes.TxStatusPending || mtx.DeleteRequested != nil:
+		return i18n.NewError(ctx, tmmsgs.MsgTransactionAlreadySubmitted, mtx.ID)
+	case m.isSignerPaused(mtx.TransactionHeaders.From):
+		return i18n.NewError(ctx, tmmsgs.MsgSignerPaused, mtx.TransactionHeaders.From)
+	}
+
+	decoded, _, err := m.connector.TransactionDecode(ctx, &ffcapi.TransactionDecodeRequest{
+		RawTransaction: rawTransaction,
+	})
+	if err != nil {
+		return err
+	}
+	if err := checkSignedTransaction(ctx, mtx, decoded); err != nil {
+		return err
+	}
+
+	historyLen := len(mtx.History)
+	gas, gasPrice := mtx.Gas, mtx.GasPrice
+	mtx.RawTransaction = rawTransaction
+	if decoded.Gas != nil {
+		mtx.Gas = decoded.Gas
+	}
+	mtx.GasPrice = decoded.GasPrice
+	mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+		Action: apitypes.TxActionSigned,
+	})
+	guard, _, err := m.sendRawTransaction(ctx, mtx)
+	switch {
+	case guard != nil && guard.deferred:
+		log.L(ctx).Infof("Signed transaction %s recorded, and held until it can be submitted: %s", mtx.ID, err)
+	case err != nil:
+		mtx.RawTransaction = ""
+		mtx.Gas, mtx.GasPrice = gas, gasPrice
+		mtx.History = mtx.History[:historyLen]
+		return err
+	}
+
+	mtx.Updated = fftypes.Now()
+	m.trimHistory(mtx)
+	if err := m.persistence.WriteTransaction(ctx, mtx, false); err != nil {
+		log.L(ctx).Errorf("Failed to update transaction %s after submitting signed transaction %s: %s", mtx.ID, mtx.TransactionHash, err)
+		return err
+	}
+	m.sendWSReply(mtx)
+
+	// Receipt tracking starts on the next policy loop cycle
+	m.markInflightUpdate()
+	return nil
+}
+
+// checkSignedTransaction returns an error unless a transaction supplied signed is the transaction prepared for
+// signing, so that the signature of a transaction cannot be used to submit a different transaction in its place
+func checkSignedTransaction(ctx context.Context, mtx *apitypes.ManagedTX, decoded *ffcapi.TransactionDecodeResponse) error {
+	if decoded.From == "" || decoded.Nonce == nil {
+		return i18n.NewError(ctx, tmmsgs.MsgRawTransactionDecodeIncomplete)
+	}
+	mismatch := func(field string, signed, prepared interface{}) error {
+		return i18n.NewError(ctx, tmmsgs.MsgSignedTransactionMismatch, mtx.ID, field, signed, prepared)
+	}
+	switch {
+	case !strings.EqualFold(decoded.From, mtx.TransactionHeaders.From):
+		return mismatch("from", decoded.From, mtx.TransactionHeaders.From)
+	case decoded.Nonce.Int().Cmp(mtx.Nonce.Int()) != 0:
+		return mismatch("nonce", decoded.Nonce, mtx.Nonce)
+	case !strings.EqualFold(decoded.To, mtx.TransactionHeaders.To):
+		return mismatch("to", decoded.To, mtx.TransactionHeaders.To)
+	case valueOrZero(decoded.Value).Cmp(valueOrZero(mtx.TransactionHeaders.Value)) != 0:
+		return mismatch("value", valueOrZero(decoded.Value), valueOrZero(mtx.TransactionHeaders.Value))
+	case !strings.EqualFold(decoded.TransactionData, mtx.TransactionData):
+		return mismatch("transactionData", decoded.TransactionData, mtx.TransactionData)
+	}
+	return nil
+}
+
+func valueOrZero(v *fftypes.FFBigInt) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return v.Int()
+}
+
+// sendRawTransaction broadcasts (or re-broadcasts) a transaction signed outside of the connector, subject to the
+// spend limit and rate limit for the signer - the returned guard is non-nil if they are configured.
+// On success the transaction hash and submit times are updated, and the submission is recorded in the history.
+func (m *manager) sendRawTransaction(ctx context.Context, mtx *apitypes.ManagedTX) (*guardedConnector, ffcapi.ErrorReason, error) {
+	cAPI, guard := m.guardConnector(mtx)
+	sendTX := &ffcapi.TransactionSendRawRequest{
+		TransactionHeaders: mtx.TransactionHeaders,
+		RawTransaction:     mtx.RawTransaction,
+	}
+	sendTX.TransactionHeaders.Nonce = (*fftypes.FFBigInt)(mtx.Nonce.Int())
+	sendTX.TransactionHeaders.Gas = (*fftypes.FFBigInt)(mtx.Gas.Int())
+	res, reason, err := cAPI.TransactionSendRaw(ctx, sendTX)
+	if err != nil {
+		if (reason == ffcapi.ErrorKnownTransaction || reason == ffcapi.ErrorReasonNonceTooLow) && mtx.TransactionHash != "" {
+			// Already in the transaction pool, or mined - so we only need to wait for the receipt
+			log.L(ctx).Debugf("Signed transaction %s at nonce %s / %d known with hash: %s (%s)", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.TransactionHash, err)
+			mtx.LastSubmit = fftypes.Now()
+			if mtx.FirstSubmit == nil {
+				// Broadcast by the signer, or by a previous attempt, so we track it from here
+				mtx.FirstSubmit = mtx.LastSubmit
+				mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+					Time:            mtx.LastSubmit,
+					Action:          apitypes.TxActionSubmitted,
+					TransactionHash: mtx.TransactionHash,
+				})
+			}
+			return guard, "", nil
+		}
+		log.L(ctx).Errorf("Failed to submit signed transaction %s reason=%s: %s", mtx.ID, reason, err)
+		return guard, reason, err
+	}
+	action := apitypes.TxActionSubmitted
+	if mtx.FirstSubmit != nil {
+		action = apitypes.TxActionResubmitted
+	}
+	mtx.TransactionHash = res.TransactionHash
+	mtx.LastSubmit = fftypes.Now()
+	if mtx.FirstSubmit == nil {
+		mtx.FirstSubmit = mtx.LastSubmit
+	}
+	mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+		Time:            mtx.LastSubmit,
+		Action:          action,
+		TransactionHash: mtx.TransactionHash,
+	})
+	log.L(ctx).Infof("Signed transaction %s at nonce %s / %d submitted. Hash: %s", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.TransactionHash)
+	return guard, "", nil
+}
+
+// execSignedTransaction is called on the policy loop in place of the policy engine, for a transaction signed
+// outside of the connector. Nothing is submitted until the signed transaction has been supplied, then it is
+// broadcast again at the configured interval until it is confirmed. Returns whether the transaction was updated,
+// whether a failure rule has completed it as failed, and the error if the spend limit rejected the submission
+// so the transaction must be failed.
+func (m *manager) execSignedTransaction(ctx context.Context, pending *pendingState) (update policyengine.UpdateType, completed bool, rejected error) {
+	mtx := pending.mtx
+	update = policyengine.UpdateNo
+	dueForSubmit := mtx.LastSubmit == nil || time.Since(*mtx.LastSubmit.Time()) > m.rawResubmitInterval
+	if mtx.RawTransaction != "" && dueForSubmit && time.Since(pending.lastPolicyCycle) > m.policyLoopInterval &&
+		!m.isSignerPaused(mtx.TransactionHeaders.From) {
+		pending.lastPolicyCycle = time.Now()
+		guard, reason, err := m.sendRawTransaction(ctx, mtx)
+		switch {
+		case guard != nil && guard.rejected != nil:
+			return policyengine.UpdateYes, true, guard.rejected
+		case guard != nil && guard.deferred:
+			// The broadcast waits for the rate/spend limit to allow it, so we do not record an error
+		case err != nil:
+			// The failure rules and parking apply as for an error submitting any other transaction
+			update = policyengine.UpdateYes
+			m.addError(mtx, reason, err)
+			if _, completed = m.applyErrorHandling(ctx, mtx, reason); completed {
+				return update, true, nil
+			}
+		default:
+			update = policyengine.UpdateYes
+			mtx.ConsecutiveErrors = 0
+			mtx.ErrorsSince = nil
+		}
+	}
+	if mtx.FirstSubmit != nil && pending.trackingTransactionHash != mtx.TransactionHash {
+		// If now submitted, add to confirmations manager for receipt checking
+		m.trackSubmittedTransaction(ctx, pending)
+	}
+	return update, false, nil
+}
+
+// submitRawTransaction records a transaction that was signed outside of the transaction manager, such as by a
+// partner, so that it is broadcast and tracked through to confirmation. The nonce is decoded from the signed
+// transaction, rather than being assigned, so it must not conflict with a transaction we already hold.
+// The signer policy is checked against the decoded transaction, and the spend and rate limits are applied
+// to each broadcast from the policy loop, as for any other transaction.
+func (m *manager) submitRawTransaction(ctx context.Context, request *apitypes.RawTransactionRequest) (*apitypes.ManagedTX, bool, error) {
+
+	// Check if this is a retry of a request we have already accepted
+	requestHash := requestContentHash(request)
+	if existing, err := m.checkIdempotentResubmit(ctx, request.Headers.ID, requestHash); err != nil || existing != nil {
+		return existing, existing != nil, err
+	}
+
+	if request.RawTransaction == "" {
+		return nil, false, i18n.NewError(ctx, tmmsgs.MsgMissingRawTransaction)
+	}
+	decoded, _, err := m.connector.TransactionDecode(ctx, &ffcapi.TransactionDecodeRequest{
+		RawTransaction: request.RawTransaction,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if decoded.From == "" || decoded.Nonce == nil {
+		return nil, false, i18n.NewError(ctx, tmmsgs.MsgRawTransactionDecodeIncomplete)
+	}
+
+	txID := request.Headers.ID
+	if txID == "" {
+		txID = fftypes.NewUUID().String()
+	}
+	if err := m.checkSignerPolicy(ctx, txID, &decoded.TransactionHeaders, decoded.To == ""); err != nil {
+		return nil, false, err
+	}
+
+	// We hold the nonce lock for the signer while we record the transaction, so it cannot race with a nonce being assigned
+	lockedNonce, err := m.lockNonceForSubmission(ctx, txID, decoded.From)
+	if err != nil {
+		return nil, false, err
+	}
+	defer lockedNonce.complete(ctx)
+	lockedNonce.nonce = decoded.Nonce.Uint64()
+
+	conflict, err := m.persistence.GetTransactionByNonce(ctx, decoded.From, decoded.Nonce)
+	if err != nil {
+		return nil, false, err
+	}
+	if conflict != nil {
+		return nil, false, i18n.NewError(ctx, tmmsgs.MsgNonceAlreadyAssigned, decoded.From, decoded.Nonce, conflict.ID)
+	}
+
+	now := fftypes.Now()
+	mtx := &apitypes.ManagedTX{
+		ID:                 txID,
+		Created:            now,
+		Updated:            now,
+		SequenceID:         apitypes.NewULID(),
+		Nonce:              decoded.Nonce,
+		Gas:                decoded.Gas,
+		GasPrice:           decoded.GasPrice,
+		TransactionHeaders: decoded.TransactionHeaders,
+		TransactionHash:    decoded.TransactionHash,
+		RequestHash:        requestHash,
+		ContractDeploy:     decoded.To == "",
+		SignExternally:     true,
+		RawTransaction:     request.RawTransaction,
+		Status:             apitypes.TxStatusPending,
+	}
+	mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+		Time:            now,
+		Action:          apitypes.TxActionSigned,
+		Nonce:           mtx.Nonce,
+		TransactionHash: mtx.TransactionHash,
+	})
+	m.trimHistory(mtx)
+
+	if err = m.persistence.WriteTransaction(m.ctx, mtx, true); err != nil {
+		if existing, checkErr := m.checkIdempotentResubmit(ctx, request.Headers.ID, requestHash); checkErr != nil || existing != nil {
+			return existing, existing != nil, checkErr
+		}
+		return nil, false, err
+	}
+	log.L(m.ctx).Infof("Tracking signed transaction %s at nonce %s / %d - hash: %s", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.TransactionHash)
+	m.markInflightStale()
+
+	// The nonce is now spent, so the next nonce assigned to the signer follows it if it is the highest
+	lockedNonce.spent = mtx
+	return mtx, false, nil
+}
@@ -0,0 +1,1017 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/confirmations"
+	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/confirmationsmocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/policyenginemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func genTestSignExternallyTxn(signer string, nonce int64) *apitypes.ManagedTX {
+	tx := genTestTxn(signer, nonce, apitypes.TxStatusPending)
+	tx.SignExternally = true
+	return tx
+}
+
+// mockSignedTransactionDecode decodes any raw transaction as the signed form of the prepared transaction
+func mockSignedTransactionDecode(m *manager, mtx *apitypes.ManagedTX) *mock.Call {
+	mfc := m.connector.(*ffcapimocks.API)
+	return mfc.On("TransactionDecode", m.ctx, mock.Anything).Return(&ffcapi.TransactionDecodeResponse{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  mtx.TransactionHeaders.From,
+			To:    mtx.TransactionHeaders.To,
+			Nonce: mtx.Nonce,
+			Gas:   mtx.Gas,
+			Value: mtx.TransactionHeaders.Value,
+		},
+		GasPrice:        fftypes.JSONAnyPtr(`"10"`),
+		TransactionData: mtx.TransactionData,
+		TransactionHash: "0x12345",
+	}, ffcapi.ErrorReason(""), nil)
+}
+
+func submitSignedTestRequest(m *manager, txID, rawTransaction string) policyEngineAPIResponse {
+	req := &policyEngineAPIRequest{
+		requestType:    policyEngineAPIRequestTypeSubmitSigned,
+		txID:           txID,
+		rawTransaction: rawTransaction,
+		response:       make(chan policyEngineAPIResponse, 1),
+	}
+	m.policyEngineAPIRequests = append(m.policyEngineAPIRequests, req)
+	m.processPolicyAPIRequests(m.ctx)
+	return <-req.response
+}
+
+func TestSignExternallyE2EOk(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	// The policy engine must never be called for a transaction signed externally
+	m.policyEngine = &policyenginemocks.PolicyEngine{}
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("NextNonceForSigner", m.ctx, mock.Anything).Return(&ffcapi.NextNonceForSignerResponse{
+		Nonce: fftypes.NewFFBigInt(12345),
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mfc.On("TransactionPrepare", m.ctx, mock.Anything).Return(&ffcapi.TransactionPrepareResponse{
+		Gas:             fftypes.NewFFBigInt(100000),
+		TransactionData: "0xabce1234",
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	mtx, _, err := m.prepareManagedTransaction(m.ctx, &apitypes.TransactionRequest{
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaaa", To: "0xbbbbb"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, mtx.SignExternally)
+	assert.Equal(t, int64(12345), mtx.Nonce.Int64())
+	assert.Equal(t, "0xabce1234", mtx.TransactionData)
+
+	// Nothing happens until the signed transaction is supplied
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Len(t, m.inflight, 1)
+	assert.Nil(t, m.inflight[0].mtx.FirstSubmit)
+
+	mockSignedTransactionDecode(m, mtx).Once()
+	txHash := "0x" + fftypes.NewRandB32().String()
+	mfc.On("TransactionSendRaw", m.ctx, mock.MatchedBy(func(req *ffcapi.TransactionSendRawRequest) bool {
+		return req.RawTransaction == "0xfeedbeef" &&
+			req.From == "0xaaaaa" && req.To == "0xbbbbb" &&
+			req.Nonce.Int64() == 12345 && req.Gas.Int64() == 100000
+	})).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: txHash,
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.MatchedBy(func(n *confirmations.Notification) bool {
+		return n.NotificationType == confirmations.NewTransaction && n.Transaction.TransactionHash == txHash
+	})).Run(func(args mock.Arguments) {
+		n := args[0].(*confirmations.Notification)
+		n.Transaction.Receipt(context.Background(), &ffcapi.TransactionReceiptResponse{
+			BlockNumber:      fftypes.NewFFBigInt(12345),
+			TransactionIndex: fftypes.NewFFBigInt(10),
+			BlockHash:        fftypes.NewRandB32().String(),
+			Success:          true,
+		})
+		n.Transaction.Confirmed(context.Background(), []confirmations.BlockInfo{})
+	}).Return(nil).Once()
+
+	res := submitSignedTestRequest(m, mtx.ID, "0xfeedbeef")
+	assert.NoError(t, res.err)
+	assert.Equal(t, http.StatusAccepted, res.status)
+	assert.Equal(t, txHash, res.tx.TransactionHash)
+	assert.NotNil(t, res.tx.FirstSubmit)
+	assert.Equal(t, `"10"`, res.tx.GasPrice.String())
+
+	// Supplying it again is rejected
+	res = submitSignedTestRequest(m, mtx.ID, "0xfeedbeef")
+	assert.Regexp(t, "FF21105", res.err)
+
+	// Tracked for a receipt on the next cycle, then confirmed
+	m.policyLoopCycle(m.ctx, false)
+	m.policyLoopCycle(m.ctx, false)
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Empty(t, m.inflight)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusSucceeded, rtx.Status)
+	assert.Equal(t, "0xfeedbeef", rtx.RawTransaction)
+	actions := make([]apitypes.TxAction, len(rtx.History))
+	for i, h := range rtx.History {
+		actions[i] = h.Action
+	}
+	assert.Equal(t, []apitypes.TxAction{
+		apitypes.TxActionPrepared,
+		apitypes.TxActionNonceAssigned,
+		apitypes.TxActionSigned,
+		apitypes.TxActionSubmitted,
+		apitypes.TxActionReceipt,
+		apitypes.TxActionConfirmed,
+	}, actions)
+
+	mc.AssertExpectations(t)
+	mfc.AssertExpectations(t)
+}
+
+func TestSubmitSignedTransactionInvalid(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	notExternal := genTestTxn("0xaaaaa", 12346, apitypes.TxStatusPending)
+	m.inflight = []*pendingState{{mtx: tx}, {mtx: notExternal}}
+
+	res := submitSignedTestRequest(m, tx.ID, "")
+	assert.Regexp(t, "FF21103", res.err)
+
+	res = submitSignedTestRequest(m, notExternal.ID, "0xfeedbeef")
+	assert.Regexp(t, "FF21104", res.err)
+
+	m.pausedSigners["0xaaaaa"] = &apitypes.SignerState{Signer: "0xaaaaa"}
+	res = submitSignedTestRequest(m, tx.ID, "0xfeedbeef")
+	assert.Regexp(t, "FF21082", res.err)
+
+}
+
+func TestSubmitSignedTransactionConnectorFail(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	m.inflight = []*pendingState{{mtx: tx}}
+
+	mockSignedTransactionDecode(m, tx)
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(nil, ffcapi.ErrorReasonInvalidInputs, fmt.Errorf("pop"))
+
+	res := submitSignedTestRequest(m, tx.ID, "0xfeedbeef")
+	assert.Regexp(t, "pop", res.err)
+	assert.Nil(t, tx.FirstSubmit)
+	assert.Empty(t, tx.RawTransaction)
+	assert.Nil(t, tx.GasPrice)
+
+	mfc.AssertExpectations(t)
+
+}
+
+func TestSubmitSignedTransactionPersistFail(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetTransactionByID", m.ctx, tx.ID).Return(tx, nil)
+	mp.On("WriteTransaction", m.ctx, tx, false).Return(fmt.Errorf("pop"))
+
+	mockSignedTransactionDecode(m, tx)
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: "0x12345",
+	}, ffcapi.ErrorReason(""), nil)
+
+	res := submitSignedTestRequest(m, tx.ID, "0xfeedbeef")
+	assert.Regexp(t, "pop", res.err)
+
+	mp.AssertExpectations(t)
+	mfc.AssertExpectations(t)
+
+}
+
+func TestSubmitSignedTransactionMismatch(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	tx.TransactionHeaders.To = "0xbbbbb"
+	tx.TransactionHeaders.Value = fftypes.NewFFBigInt(100)
+	tx.TransactionData = "0xabce1234"
+	m.inflight = []*pendingState{{mtx: tx}}
+
+	decoded := &ffcapi.TransactionDecodeResponse{}
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionDecode", m.ctx, &ffcapi.TransactionDecodeRequest{RawTransaction: "0xfeedbeef"}).Return(decoded, ffcapi.ErrorReason(""), nil)
+	resetDecoded := func() {
+		*decoded = ffcapi.TransactionDecodeResponse{
+			TransactionHeaders: ffcapi.TransactionHeaders{
+				From:  "0xAAAAA",
+				To:    "0xBBBBB",
+				Nonce: fftypes.NewFFBigInt(12345),
+				Value: fftypes.NewFFBigInt(100),
+			},
+			TransactionData: "0xABCE1234",
+		}
+	}
+
+	for _, c := range []struct {
+		change func()
+		err    string
+	}{
+		{func() { decoded.From = "" }, "FF21106"},
+		{func() { decoded.From = "0xccccc" }, "FF21131.*from.*0xccccc.*0xaaaaa"},
+		{func() { decoded.Nonce = fftypes.NewFFBigInt(12346) }, "FF21131.*nonce.*12346.*12345"},
+		{func() { decoded.To = "0xccccc" }, "FF21131.*to.*0xccccc.*0xbbbbb"},
+		{func() { decoded.Value = nil }, "FF21131.*value.*'0'.*'100'"},
+		{func() { decoded.TransactionData = "0x" }, "FF21131.*transactionData"},
+	} {
+		resetDecoded()
+		c.change()
+		res := submitSignedTestRequest(m, tx.ID, "0xfeedbeef")
+		assert.Regexp(t, c.err, res.err)
+		assert.Empty(t, tx.RawTransaction)
+	}
+
+	// Nothing is broadcast for a mismatched transaction
+	mfc.AssertNotCalled(t, "TransactionSendRaw", mock.Anything, mock.Anything)
+
+}
+
+func TestSubmitSignedTransactionDecodeFail(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	m.inflight = []*pendingState{{mtx: tx}}
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionDecode", m.ctx, mock.Anything).Return(nil, ffcapi.ErrorReasonInvalidInputs, fmt.Errorf("pop"))
+
+	res := submitSignedTestRequest(m, tx.ID, "0xfeedbeef")
+	assert.Regexp(t, "pop", res.err)
+	assert.Empty(t, tx.RawTransaction)
+
+	mfc.AssertExpectations(t)
+
+}
+
+func TestSubmitSignedTransactionSpendLimit(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	// The prepared transaction costs 100000 gas at the signed gas price of 10
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1500000")
+	config.Set(tmconfig.TransactionsSpendLimitAction, "reject")
+	sl, err := newSignerSpendLimiter(m.ctx)
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+
+	mtx1 := genTestSignExternallyTxn("0xaaaaa", 12345)
+	mtx1.Gas = fftypes.NewFFBigInt(100000)
+	mtx2 := genTestSignExternallyTxn("0xaaaaa", 12346)
+	mtx2.Gas = fftypes.NewFFBigInt(100000)
+	m.inflight = []*pendingState{{mtx: mtx1}, {mtx: mtx2}}
+	for _, mtx := range []*apitypes.ManagedTX{mtx1, mtx2} {
+		err = m.persistence.WriteTransaction(m.ctx, mtx, true)
+		assert.NoError(t, err)
+	}
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mockSignedTransactionDecode(m, mtx1).Once()
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: "0x12345",
+	}, ffcapi.ErrorReason(""), nil).Once()
+	res := submitSignedTestRequest(m, mtx1.ID, "0xfeedbeef")
+	assert.NoError(t, res.err)
+	assert.Equal(t, int64(1000000), sl.status()[0].Spent.Int64())
+
+	// A rejected submission is not recorded, so it can be signed again at a lower gas price
+	mockSignedTransactionDecode(m, mtx2).Once()
+	res = submitSignedTestRequest(m, mtx2.ID, "0xfeedbeef")
+	assert.Regexp(t, "FF21073", res.err)
+	assert.Empty(t, mtx2.RawTransaction)
+	assert.Equal(t, apitypes.TxStatusPending, mtx2.Status)
+
+	// A held submission is recorded, and broadcast by the policy loop once the limit allows
+	sl.action = spendLimitActionHold
+	mockSignedTransactionDecode(m, mtx2).Once()
+	res = submitSignedTestRequest(m, mtx2.ID, "0xfeedbeef")
+	assert.NoError(t, res.err)
+	assert.Equal(t, "0xfeedbeef", mtx2.RawTransaction)
+	assert.Nil(t, mtx2.FirstSubmit)
+
+	mfc.AssertExpectations(t)
+
+}
+
+func TestExecSignedTransactionGuards(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "100")
+	sl, err := newSignerSpendLimiter(m.ctx)
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	tx.RawTransaction = "0xfeedbeef"
+	tx.TransactionHeaders.Value = fftypes.NewFFBigInt(101)
+	err = m.persistence.WriteTransaction(m.ctx, tx, true)
+	assert.NoError(t, err)
+	pending := &pendingState{mtx: tx}
+
+	// Held until the limit allows, without recording an error
+	update, _, rejected := m.execSignedTransaction(m.ctx, pending)
+	assert.Equal(t, policyengine.UpdateNo, update)
+	assert.NoError(t, rejected)
+	assert.Zero(t, tx.ConsecutiveErrors)
+
+	// Failed if the limit rejects the transaction, and the unused nonce is released
+	sl.action = spendLimitActionReject
+	pending.lastPolicyCycle = time.Time{}
+	err = m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusFailed, tx.Status)
+	assert.Equal(t, ffcapi.ErrorReasonSpendLimitExceeded, tx.ErrorHistory[0].Mapped)
+	assert.Equal(t, uint64(12345), m.nonceOverrides["0xaaaaa"])
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, tx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusFailed, rtx.Status)
+
+}
+
+func TestHasPendingSubmissionsSignExternally(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	// A transaction waiting to be signed externally does not hold up a drain
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsPending", m.ctx, (*fftypes.UUID)(nil), pendingCountPageSize, mock.Anything).
+		Return([]*apitypes.ManagedTX{genTestSignExternallyTxn("0xaaaaa", 12345)}, nil)
+
+	pending, err := m.hasPendingSubmissions(m.ctx)
+	assert.NoError(t, err)
+	assert.False(t, pending)
+
+}
+
+func mockTransactionDecode(m *manager, signer string, nonce int64, txHash string) {
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionDecode", mock.Anything, mock.Anything).Return(&ffcapi.TransactionDecodeResponse{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  signer,
+			To:    "0xbbbbb",
+			Nonce: fftypes.NewFFBigInt(nonce),
+			Gas:   fftypes.NewFFBigInt(100000),
+		},
+		TransactionHash: txHash,
+	}, ffcapi.ErrorReason(""), nil)
+}
+
+func TestSendRawTransactionE2EOk(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+	m.policyEngine = &policyenginemocks.PolicyEngine{}
+
+	txHash := "0x" + fftypes.NewRandB32().String()
+	mockTransactionDecode(m, "0xaaaaa", 100, txHash)
+
+	mtx, existing, err := m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	})
+	assert.NoError(t, err)
+	assert.False(t, existing)
+	assert.Equal(t, int64(100), mtx.Nonce.Int64())
+	assert.Equal(t, txHash, mtx.TransactionHash)
+	assert.True(t, mtx.SignExternally)
+
+	// The next nonce assigned to the signer follows the nonce of the signed transaction
+	nextNonce, err := m.calcNextNonce(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(101), nextNonce)
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", m.ctx, mock.MatchedBy(func(req *ffcapi.TransactionSendRawRequest) bool {
+		return req.RawTransaction == "0xfeedbeef" && req.Nonce.Int64() == 100
+	})).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: txHash,
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.MatchedBy(func(n *confirmations.Notification) bool {
+		return n.NotificationType == confirmations.NewTransaction && n.Transaction.TransactionHash == txHash
+	})).Run(func(args mock.Arguments) {
+		n := args[0].(*confirmations.Notification)
+		n.Transaction.Receipt(context.Background(), &ffcapi.TransactionReceiptResponse{
+			BlockNumber:      fftypes.NewFFBigInt(12345),
+			TransactionIndex: fftypes.NewFFBigInt(10),
+			BlockHash:        fftypes.NewRandB32().String(),
+			Success:          true,
+		})
+		n.Transaction.Confirmed(context.Background(), []confirmations.BlockInfo{})
+	}).Return(nil).Once()
+
+	// Broadcast and tracked on the first cycle, then confirmed
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	m.policyLoopCycle(m.ctx, false)
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Empty(t, m.inflight)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusSucceeded, rtx.Status)
+	actions := make([]apitypes.TxAction, len(rtx.History))
+	for i, h := range rtx.History {
+		actions[i] = h.Action
+	}
+	assert.Equal(t, []apitypes.TxAction{
+		apitypes.TxActionSigned,
+		apitypes.TxActionSubmitted,
+		apitypes.TxActionReceipt,
+		apitypes.TxActionConfirmed,
+	}, actions)
+
+	mc.AssertExpectations(t)
+	mfc.AssertExpectations(t)
+}
+
+func TestSendRawTransactionContractDeploy(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+	m.policyEngine = &policyenginemocks.PolicyEngine{}
+
+	txHash := "0x" + fftypes.NewRandB32().String()
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionDecode", mock.Anything, mock.Anything).Return(&ffcapi.TransactionDecodeResponse{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  "0xaaaaa",
+			Nonce: fftypes.NewFFBigInt(100),
+			Gas:   fftypes.NewFFBigInt(100000),
+		},
+		TransactionHash: txHash,
+	}, ffcapi.ErrorReason(""), nil)
+
+	mtx, _, err := m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, mtx.ContractDeploy)
+
+	deployments, err := m.persistence.ListDeployments(m.ctx, nil, 10, persistence.SortDirectionDescending)
+	assert.NoError(t, err)
+	assert.Len(t, deployments, 1)
+	assert.Equal(t, mtx.ID, deployments[0].ID)
+
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: txHash,
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.MatchedBy(func(n *confirmations.Notification) bool {
+		return n.NotificationType == confirmations.NewTransaction
+	})).Run(func(args mock.Arguments) {
+		n := args[0].(*confirmations.Notification)
+		n.Transaction.Receipt(context.Background(), &ffcapi.TransactionReceiptResponse{
+			BlockNumber:      fftypes.NewFFBigInt(12345),
+			TransactionIndex: fftypes.NewFFBigInt(10),
+			BlockHash:        fftypes.NewRandB32().String(),
+			Success:          true,
+			ContractLocation: fftypes.JSONAnyPtr(`{"address":"0x12345"}`),
+		})
+		n.Transaction.Confirmed(context.Background(), []confirmations.BlockInfo{})
+	}).Return(nil).Once()
+
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	m.policyLoopCycle(m.ctx, false)
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Empty(t, m.inflight)
+
+	// The contract location from the receipt is recorded for the deployment
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusSucceeded, rtx.Status)
+	assert.JSONEq(t, `{"address":"0x12345"}`, rtx.ContractLocation.String())
+
+	mc.AssertExpectations(t)
+	mfc.AssertExpectations(t)
+}
+
+func TestSendRawTransactionKnownTracked(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+	m.policyEngine = &policyenginemocks.PolicyEngine{}
+
+	txHash := "0x" + fftypes.NewRandB32().String()
+	mockTransactionDecode(m, "0xaaaaa", 100, txHash)
+
+	mtx, _, err := m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	})
+	assert.NoError(t, err)
+
+	// Already broadcast by the partner that signed it
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(nil, ffcapi.ErrorKnownTransaction, fmt.Errorf("known")).Once()
+
+	mc := m.confirmations.(*confirmationsmocks.Manager)
+	mc.On("Notify", mock.MatchedBy(func(n *confirmations.Notification) bool {
+		return n.NotificationType == confirmations.NewTransaction && n.Transaction.TransactionHash == txHash
+	})).Run(func(args mock.Arguments) {
+		n := args[0].(*confirmations.Notification)
+		n.Transaction.Receipt(context.Background(), &ffcapi.TransactionReceiptResponse{
+			BlockNumber:      fftypes.NewFFBigInt(12345),
+			TransactionIndex: fftypes.NewFFBigInt(10),
+			BlockHash:        fftypes.NewRandB32().String(),
+			Success:          true,
+		})
+		n.Transaction.Confirmed(context.Background(), []confirmations.BlockInfo{})
+	}).Return(nil).Once()
+
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	m.policyLoopCycle(m.ctx, false)
+	<-m.inflightStale
+	m.policyLoopCycle(m.ctx, true)
+	assert.Empty(t, m.inflight)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, mtx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusSucceeded, rtx.Status)
+	assert.NotNil(t, rtx.FirstSubmit)
+	assert.Equal(t, apitypes.TxActionSubmitted, rtx.History[1].Action)
+
+	mc.AssertExpectations(t)
+	mfc.AssertExpectations(t)
+}
+
+func TestExecSignedTransactionResubmit(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+	m.rawResubmitInterval = 0
+	m.policyLoopInterval = 1 * time.Hour
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	tx.RawTransaction = "0xfeedbeef"
+	tx.TransactionHash = "0x12345"
+	pending := &pendingState{mtx: tx}
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop")).Once()
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: "0x12345",
+	}, ffcapi.ErrorReason(""), nil).Once()
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(nil, ffcapi.ErrorKnownTransaction, fmt.Errorf("known")).Once()
+
+	mc := &confirmationsmocks.Manager{}
+	m.confirmations = mc
+	mc.On("Notify", mock.Anything).Return(nil).Once()
+
+	// Failure is recorded
+	update, _, rejected := m.execSignedTransaction(m.ctx, pending)
+	assert.Equal(t, policyengine.UpdateYes, update)
+	assert.NoError(t, rejected)
+	assert.Equal(t, 1, tx.ConsecutiveErrors)
+	assert.Nil(t, tx.FirstSubmit)
+
+	// Throttled to the policy loop interval
+	update, _, _ = m.execSignedTransaction(m.ctx, pending)
+	assert.Equal(t, policyengine.UpdateNo, update)
+
+	// Submitted, and tracked
+	pending.lastPolicyCycle = time.Time{}
+	update, _, _ = m.execSignedTransaction(m.ctx, pending)
+	assert.Equal(t, policyengine.UpdateYes, update)
+	assert.Equal(t, 0, tx.ConsecutiveErrors)
+	assert.NotNil(t, tx.FirstSubmit)
+	assert.Equal(t, "0x12345", pending.trackingTransactionHash)
+	assert.Equal(t, apitypes.TxActionSubmitted, tx.History[len(tx.History)-1].Action)
+
+	// Already known to the node is fine
+	pending.lastPolicyCycle = time.Time{}
+	lastSubmit := tx.LastSubmit
+	update, _, _ = m.execSignedTransaction(m.ctx, pending)
+	assert.Equal(t, policyengine.UpdateYes, update)
+	assert.Equal(t, 0, tx.ConsecutiveErrors)
+	assert.NotSame(t, lastSubmit, tx.LastSubmit)
+	assert.Equal(t, apitypes.TxActionSubmitted, tx.History[len(tx.History)-1].Action)
+
+	// Not submitted for a paused signer
+	pending.lastPolicyCycle = time.Time{}
+	m.pausedSigners["0xaaaaa"] = &apitypes.SignerState{Signer: "0xaaaaa"}
+	update, _, _ = m.execSignedTransaction(m.ctx, pending)
+	assert.Equal(t, policyengine.UpdateNo, update)
+
+	mfc.AssertExpectations(t)
+	mc.AssertExpectations(t)
+}
+
+func TestExecSignedTransactionFailureRule(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+	m.failureRules = []*failureRule{
+		{reasons: map[ffcapi.ErrorReason]bool{ffcapi.ErrorReasonInvalidInputs: true}, failures: 1, action: failureActionFail},
+	}
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	tx.RawTransaction = "0xfeedbeef"
+	err := m.persistence.WriteTransaction(m.ctx, tx, true)
+	assert.NoError(t, err)
+	pending := &pendingState{mtx: tx}
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(nil, ffcapi.ErrorReasonInvalidInputs, fmt.Errorf("pop")).Once()
+
+	err = m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.True(t, pending.remove)
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, tx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusFailed, rtx.Status)
+	assert.Equal(t, ffcapi.ErrorReasonInvalidInputs, rtx.ErrorHistory[0].Mapped)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestExecSignedTransactionInsufficientFundsParks(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	tx.RawTransaction = "0xfeedbeef"
+	err := m.persistence.WriteTransaction(m.ctx, tx, true)
+	assert.NoError(t, err)
+	pending := &pendingState{mtx: tx}
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(nil, ffcapi.ErrorReasonInsufficientFunds, fmt.Errorf("pop")).Once()
+
+	err = m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.False(t, pending.remove)
+	assert.True(t, m.isSignerParked("0xaaaaa"))
+
+	rtx, err := m.persistence.GetTransactionByID(m.ctx, tx.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusPending, rtx.Status)
+	assert.Equal(t, 1, rtx.ConsecutiveErrors)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestExecSignedTransactionResubmitted(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+	m.rawResubmitInterval = 0
+
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	tx.RawTransaction = "0xfeedbeef"
+	tx.TransactionHash = "0x12345"
+	tx.FirstSubmit = fftypes.Now()
+	tx.LastSubmit = tx.FirstSubmit
+	pending := &pendingState{mtx: tx, trackingTransactionHash: "0x12345"}
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", m.ctx, mock.Anything).Return(&ffcapi.TransactionSendRawResponse{
+		TransactionHash: "0x12345",
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	update, _, _ := m.execSignedTransaction(m.ctx, pending)
+	assert.Equal(t, policyengine.UpdateYes, update)
+	assert.Equal(t, apitypes.TxActionResubmitted, tx.History[len(tx.History)-1].Action)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestSubmitRawTransactionIdempotent(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+	m.idempotentResubmit = true
+
+	req := &apitypes.RawTransactionRequest{
+		Headers:                  apitypes.RequestHeaders{ID: "id1"},
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	}
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetTransactionByID", m.ctx, "id1").Return(&apitypes.ManagedTX{
+		ID:          "id1",
+		RequestHash: requestContentHash(req),
+	}, nil)
+
+	mtx, existing, err := m.submitRawTransaction(m.ctx, req)
+	assert.NoError(t, err)
+	assert.True(t, existing)
+	assert.Equal(t, "id1", mtx.ID)
+
+}
+
+func TestSubmitRawTransactionIdempotentConcurrent(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+	m.idempotentResubmit = true
+
+	req := &apitypes.RawTransactionRequest{
+		Headers:                  apitypes.RequestHeaders{ID: "id1"},
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	}
+
+	// An identical request is stored while this one is being decoded
+	concurrent := genTestSignExternallyTxn("0xaaaaa", 100)
+	concurrent.ID = "id1"
+	concurrent.RequestHash = requestContentHash(req)
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionDecode", m.ctx, mock.Anything).Return(&ffcapi.TransactionDecodeResponse{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  "0xaaaaa",
+			To:    "0xbbbbb",
+			Nonce: fftypes.NewFFBigInt(101),
+		},
+		TransactionHash: "0x12345",
+	}, ffcapi.ErrorReason(""), nil).Run(func(args mock.Arguments) {
+		err := m.persistence.WriteTransaction(m.ctx, concurrent, true)
+		assert.NoError(t, err)
+	}).Once()
+
+	mtx, existing, err := m.submitRawTransaction(m.ctx, req)
+	assert.NoError(t, err)
+	assert.True(t, existing)
+	assert.Equal(t, concurrent.SequenceID, mtx.SequenceID)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestSubmitRawTransactionInvalid(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	_, _, err := m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{})
+	assert.Regexp(t, "FF21103", err)
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionDecode", m.ctx, mock.Anything).Return(nil, ffcapi.ErrorReasonInvalidInputs, fmt.Errorf("pop")).Once()
+	mfc.On("TransactionDecode", m.ctx, mock.Anything).Return(&ffcapi.TransactionDecodeResponse{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaaa"},
+	}, ffcapi.ErrorReason(""), nil).Once()
+
+	req := &apitypes.RawTransactionRequest{
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	}
+	_, _, err = m.submitRawTransaction(m.ctx, req)
+	assert.Regexp(t, "pop", err)
+
+	_, _, err = m.submitRawTransaction(m.ctx, req)
+	assert.Regexp(t, "FF21106", err)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestSubmitRawTransactionSignerPaused(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	mockTransactionDecode(m, "0xaaaaa", 100, "0x12345")
+	m.pausedSigners["0xaaaaa"] = &apitypes.SignerState{Signer: "0xaaaaa"}
+
+	_, _, err := m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	})
+	assert.Regexp(t, "FF21082", err)
+	assert.Empty(t, m.lockedNonces)
+
+}
+
+func TestSubmitRawTransactionSignerPolicy(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	readTestPolicyEngineInstances(t, `
+transactions:
+  signerPolicy:
+  - signer: "0xaaaaa"
+    to: ["0xccccc"]
+`)
+	var err error
+	m.signerPolicies, err = newSignerPolicies(m.ctx)
+	assert.NoError(t, err)
+
+	// Checked against the decoded transaction, before the nonce is locked or anything is recorded
+	mockTransactionDecode(m, "0xaaaaa", 100, "0x12345")
+	_, _, err = m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	})
+	assert.Regexp(t, "FF21100.*0xbbbbb", err)
+	assert.Empty(t, m.lockedNonces)
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.AssertNotCalled(t, "GetTransactionByNonce", mock.Anything, mock.Anything, mock.Anything)
+
+}
+
+func TestSubmitRawTransactionNonceOverride(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	mfc := m.connector.(*ffcapimocks.API)
+	decoded := &ffcapi.TransactionDecodeResponse{}
+	mfc.On("TransactionDecode", m.ctx, mock.Anything).Return(decoded, ffcapi.ErrorReason(""), nil)
+	submit := func(nonce int64) {
+		*decoded = ffcapi.TransactionDecodeResponse{
+			TransactionHeaders: ffcapi.TransactionHeaders{
+				From:  "0xaaaaa",
+				Nonce: fftypes.NewFFBigInt(nonce),
+			},
+		}
+		_, _, err := m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{
+			SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+		})
+		assert.NoError(t, err)
+	}
+
+	ln := m.lockNonce(m.ctx, "", "0xaaaaa")
+	err := m.setNonceOverride(m.ctx, "0xaaaaa", 5)
+	assert.NoError(t, err)
+	ln.complete(m.ctx)
+
+	// A signed transaction with a different nonce leaves the override for the next nonce assigned
+	submit(100)
+	assert.Equal(t, uint64(5), m.nonceOverrides["0xaaaaa"])
+
+	// A signed transaction with the override nonce uses it
+	submit(5)
+	_, overridden := m.nonceOverrides["0xaaaaa"]
+	assert.False(t, overridden)
+
+}
+
+func TestSubmitRawTransactionSpendLimit(t *testing.T) {
+
+	_, m, cancel := newTestManager(t)
+	defer cancel()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	config.Set(tmconfig.TransactionsSpendLimitAction, "reject")
+	sl, err := newSignerSpendLimiter(m.ctx)
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionDecode", m.ctx, mock.Anything).Return(&ffcapi.TransactionDecodeResponse{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  "0xaaaaa",
+			To:    "0xbbbbb",
+			Nonce: fftypes.NewFFBigInt(100),
+			Gas:   fftypes.NewFFBigInt(100),
+			Value: fftypes.NewFFBigInt(1),
+		},
+		GasPrice: fftypes.JSONAnyPtr(`"10"`),
+	}, ffcapi.ErrorReason(""), nil)
+
+	mtx, _, err := m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `"10"`, mtx.GasPrice.String())
+
+	// The decoded value, gas and gas price count towards the spend limit when it is broadcast
+	update, _, rejected := m.execSignedTransaction(m.ctx, &pendingState{mtx: mtx})
+	assert.Equal(t, policyengine.UpdateYes, update)
+	assert.Regexp(t, "FF21073", rejected)
+	assert.Nil(t, mtx.FirstSubmit)
+	mfc.AssertNotCalled(t, "TransactionSendRaw", mock.Anything, mock.Anything)
+
+}
+
+func TestSubmitRawTransactionNonceConflict(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	mockTransactionDecode(m, "0xaaaaa", 100, "0x12345")
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetTransactionByNonce", m.ctx, "0xaaaaa", fftypes.NewFFBigInt(100)).Return(nil, fmt.Errorf("pop")).Once()
+	mp.On("GetTransactionByNonce", m.ctx, "0xaaaaa", fftypes.NewFFBigInt(100)).Return(&apitypes.ManagedTX{ID: "existing1"}, nil).Once()
+
+	req := &apitypes.RawTransactionRequest{
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	}
+	_, _, err := m.submitRawTransaction(m.ctx, req)
+	assert.Regexp(t, "pop", err)
+
+	_, _, err = m.submitRawTransaction(m.ctx, req)
+	assert.Regexp(t, "FF21107.*0xaaaaa.*100.*existing1", err)
+	assert.Empty(t, m.lockedNonces)
+
+	mp.AssertExpectations(t)
+}
+
+func TestSubmitRawTransactionPersistFail(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	mockTransactionDecode(m, "0xaaaaa", 100, "0x12345")
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetTransactionByNonce", m.ctx, "0xaaaaa", fftypes.NewFFBigInt(100)).Return(nil, nil)
+	mp.On("WriteTransaction", m.ctx, mock.Anything, true).Return(fmt.Errorf("pop"))
+
+	_, _, err := m.submitRawTransaction(m.ctx, &apitypes.RawTransactionRequest{
+		Headers:                  apitypes.RequestHeaders{ID: "id1"},
+		SignedTransactionRequest: apitypes.SignedTransactionRequest{RawTransaction: "0xfeedbeef"},
+	})
+	assert.Regexp(t, "pop", err)
+
+	mp.AssertExpectations(t)
+}
+
+func TestHasPendingSubmissionsRawTransaction(t *testing.T) {
+
+	_, m, cancel := newTestManagerMockPersistence(t)
+	defer cancel()
+
+	// A signed transaction that has not been broadcast yet holds up a drain
+	tx := genTestSignExternallyTxn("0xaaaaa", 12345)
+	tx.RawTransaction = "0xfeedbeef"
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsPending", m.ctx, (*fftypes.UUID)(nil), pendingCountPageSize, mock.Anything).
+		Return([]*apitypes.ManagedTX{tx}, nil)
+
+	pending, err := m.hasPendingSubmissions(m.ctx)
+	assert.NoError(t, err)
+	assert.True(t, pending)
+
+}
@@ -0,0 +1,159 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"sort"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+)
+
+// restoreSignerStates loads the signers paused via the API, or parked, in a previous run, and any
+// nonce override that had not been used
+func (m *manager) restoreSignerStates(ctx context.Context) error {
+	states, err := m.persistence.ListSignerStates(ctx)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if state.Paused {
+			log.L(ctx).Infof("Transaction processing for signer '%s' is paused (reason=%s,updated=%s)", state.Signer, state.Reason, state.Updated)
+			m.pausedSigners[state.Signer] = state
+		}
+		if state.NextNonce != nil {
+			if err := m.restoreNonceOverride(ctx, state); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreNonceOverride discards the override if a transaction was created with the nonce after it was set, as
+// then the override was used - but we failed to clear it
+func (m *manager) restoreNonceOverride(ctx context.Context, state *apitypes.SignerState) error {
+	mtx, err := m.persistence.GetTransactionByNonce(ctx, state.Signer, state.NextNonce)
+	if err != nil {
+		return err
+	}
+	if mtx != nil && state.Updated != nil && !mtx.Created.Time().Before(*state.Updated.Time()) {
+		log.L(ctx).Warnf("Discarding next nonce %s for signer '%s' already assigned to transaction %s", state.NextNonce, state.Signer, mtx.ID)
+		return nil
+	}
+	log.L(ctx).Infof("Next nonce for signer '%s' is set to %s (updated=%s)", state.Signer, state.NextNonce, state.Updated)
+	m.nonceOverrides[state.Signer] = state.NextNonce.Uint64()
+	return nil
+}
+
+func (m *manager) isSignerPaused(signer string) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.pausedSigners[signer] != nil
+}
+
+// isSignerParked returns true if the signer was paused automatically, rather than by an operator
+func (m *manager) isSignerParked(signer string) bool {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	state := m.pausedSigners[signer]
+	return state != nil && state.Parked
+}
+
+// pausedSignerList returns the paused signers in sorted order
+func (m *manager) pausedSignerList() []string {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	signers := make([]string, 0, len(m.pausedSigners))
+	for signer := range m.pausedSigners {
+		signers = append(signers, signer)
+	}
+	sort.Strings(signers)
+	return signers
+}
+
+func (m *manager) pauseSigner(ctx context.Context, signer string) (*apitypes.SignerState, error) {
+	return m.setSignerPaused(ctx, signer, true)
+}
+
+func (m *manager) resumeSigner(ctx context.Context, signer string) (*apitypes.SignerState, error) {
+	parked := m.isSignerParked(signer)
+	state, err := m.setSignerPaused(ctx, signer, false)
+	if err == nil {
+		// Wake the policy loop to submit any transactions held while the signer was paused
+		m.markInflightUpdate()
+		if parked {
+			m.sendSignerAlert(ctx, apitypes.SignerResumed, state)
+		}
+	}
+	return state, err
+}
+
+// setSignerPaused persists the paused state for the signer. The nonce lock is held while we update,
+// so that once a pause has returned no further nonces are assigned to the signer.
+func (m *manager) setSignerPaused(ctx context.Context, signer string, paused bool) (*apitypes.SignerState, error) {
+	locked := m.lockNonce(ctx, "", signer)
+	defer locked.complete(ctx)
+
+	state := &apitypes.SignerState{
+		Signer: signer,
+		Paused: paused,
+	}
+	if err := m.writeSignerState(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// writeSignerState persists the state for a signer, with any nonce override, and updates the in-memory paused set.
+// The caller must hold the nonce lock for the signer.
+func (m *manager) writeSignerState(ctx context.Context, state *apitypes.SignerState) error {
+	state.Updated = fftypes.Now()
+	m.mux.Lock()
+	state.NextNonce = nil
+	if override, hasOverride := m.nonceOverrides[state.Signer]; hasOverride {
+		state.NextNonce = fftypes.NewFFBigInt(int64(override))
+	}
+	m.mux.Unlock()
+	if err := m.persistence.WriteSignerState(ctx, state); err != nil {
+		return err
+	}
+	m.mux.Lock()
+	if state.Paused {
+		m.pausedSigners[state.Signer] = state
+	} else {
+		delete(m.pausedSigners, state.Signer)
+	}
+	m.mux.Unlock()
+	log.L(ctx).Infof("Transaction processing for signer '%s' paused=%t reason=%s nextNonce=%v", state.Signer, state.Paused, state.Reason, state.NextNonce)
+	return nil
+}
+
+// writeNonceOverride persists the current nonce override for the signer, alongside its paused state.
+// The caller must hold the nonce lock for the signer.
+func (m *manager) writeNonceOverride(ctx context.Context, signer string) error {
+	state := &apitypes.SignerState{Signer: signer}
+	m.mux.Lock()
+	if paused := m.pausedSigners[signer]; paused != nil {
+		stateCopy := *paused
+		state = &stateCopy
+	}
+	m.mux.Unlock()
+	return m.writeSignerState(ctx, state)
+}
@@ -0,0 +1,90 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPauseResumeSigner(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	state, err := m.pauseSigner(m.ctx, "0xbbbbb")
+	assert.NoError(t, err)
+	assert.True(t, state.Paused)
+	assert.NotNil(t, state.Updated)
+	_, err = m.pauseSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0xaaaaa", "0xbbbbb"}, m.getPolicyLoopStatus().PausedSigners)
+
+	// No nonce is assigned to new transactions for a paused signer
+	_, err = m.assignAndLockNonce(m.ctx, "ns1:"+fftypes.NewUUID().String(), "0xaaaaa")
+	assert.Regexp(t, "FF21082.*0xaaaaa", err)
+
+	state, err = m.resumeSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	assert.False(t, state.Paused)
+	assert.Equal(t, []string{"0xbbbbb"}, m.getPolicyLoopStatus().PausedSigners)
+
+	// The state is persisted, so is restored on restart
+	m.pausedSigners = make(map[string]*apitypes.SignerState)
+	err = m.restoreSignerStates(m.ctx)
+	assert.NoError(t, err)
+	assert.True(t, m.isSignerPaused("0xbbbbb"))
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+
+}
+
+func TestRestoreSignerStatesFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListSignerStates", m.ctx).Return(nil, fmt.Errorf("pop"))
+
+	err := m.restoreSignerStates(m.ctx)
+	assert.Regexp(t, "pop", err)
+
+	mp.AssertExpectations(t)
+}
+
+func TestPauseSignerWriteFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("WriteSignerState", m.ctx, mock.MatchedBy(func(state *apitypes.SignerState) bool {
+		return state.Signer == "0xaaaaa" && state.Paused
+	})).Return(fmt.Errorf("pop"))
+
+	_, err := m.pauseSigner(m.ctx, "0xaaaaa")
+	assert.Regexp(t, "pop", err)
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+
+	mp.AssertExpectations(t)
+}
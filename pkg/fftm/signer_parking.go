@@ -0,0 +1,238 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// signerParking pauses the queue of a signer automatically when its transactions cannot be submitted,
+// such as when it has insufficient funds. Signers parked for insufficient funds have their balance
+// checked periodically, and are resumed automatically once funds arrive.
+type signerParking struct {
+	parkOnInsufficientFunds bool
+	checkInterval           time.Duration
+	minBalance              *big.Int // nil to resume once the balance covers the failed transaction
+	lastCheck               time.Time
+	checkDone               chan struct{} // non-nil while a balance check is running
+	alertTopic              string
+	alertClient             *resty.Client // nil if no webhook is configured
+}
+
+func newSignerParking(ctx context.Context) (*signerParking, error) {
+	sp := &signerParking{
+		parkOnInsufficientFunds: config.GetBool(tmconfig.TransactionsInsufficientFundsPark),
+		checkInterval:           config.GetDuration(tmconfig.TransactionsInsufficientFundsCheckInterval),
+		alertTopic:              tmconfig.SignerAlertsConfig.GetString(tmconfig.SignerAlertsTopic),
+	}
+	if minBalance := config.GetString(tmconfig.TransactionsInsufficientFundsMinBalance); minBalance != "" {
+		var ok bool
+		if sp.minBalance, ok = new(big.Int).SetString(minBalance, 0); !ok {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgMinBalanceInvalid, minBalance)
+		}
+	}
+	if tmconfig.SignerAlertsConfig.GetString(ffresty.HTTPConfigURL) != "" {
+		sp.alertClient = ffresty.New(ctx, tmconfig.SignerAlertsConfig)
+	}
+	return sp, nil
+}
+
+// parkSigner pauses transaction processing for the signer of a transaction, because the policy engine returned
+// an error with the given reason. Unlike a pause by an operator, new transactions are still accepted for a parked
+// signer. A signer that is already paused or parked is left as it is.
+func (m *manager) parkSigner(ctx context.Context, mtx *apitypes.ManagedTX, reason ffcapi.ErrorReason) {
+	signer := mtx.TransactionHeaders.From
+	locked := m.lockNonce(ctx, "", signer)
+	defer locked.complete(ctx)
+	if m.isSignerPaused(signer) {
+		return
+	}
+	state := &apitypes.SignerState{
+		Signer: signer,
+		Paused: true,
+		Parked: true,
+		Reason: reason,
+	}
+	if reason == ffcapi.ErrorReasonInsufficientFunds {
+		// Record the cost of the transaction, so we only resume once the balance covers it
+		if cost := managedTXCost(mtx); cost.Sign() > 0 {
+			state.RequiredBalance = (*fftypes.FFBigInt)(cost)
+		} else if m.signerParking.minBalance == nil {
+			log.L(ctx).Warnf("Cost of transaction %s is unknown, and no minimum balance is configured - signer '%s' will remain parked until resumed", mtx.ID, signer)
+		}
+	}
+	if err := m.writeSignerState(ctx, state); err != nil {
+		log.L(ctx).Errorf("Failed to park signer '%s': %s", signer, err)
+		return
+	}
+	log.L(ctx).Warnf("Parked signer '%s' (reason=%s,requiredBalance=%s)", signer, reason, state.RequiredBalance)
+	m.sendSignerAlert(ctx, apitypes.SignerParked, state)
+}
+
+// unparkSigner resumes a signer parked for insufficient funds, if it has not been paused
+// or resumed by an operator in the meantime
+func (m *manager) unparkSigner(ctx context.Context, signer string, balance *fftypes.FFBigInt) {
+	locked := m.lockNonce(ctx, "", signer)
+	defer locked.complete(ctx)
+	if !m.isSignerParked(signer) {
+		return
+	}
+	state := &apitypes.SignerState{
+		Signer:  signer,
+		Paused:  false,
+		Balance: balance,
+	}
+	if err := m.writeSignerState(ctx, state); err != nil {
+		log.L(ctx).Errorf("Failed to resume parked signer '%s': %s", signer, err)
+		return
+	}
+	log.L(ctx).Infof("Resumed parked signer '%s' (balance=%s)", signer, balance)
+	m.markInflightUpdate()
+	m.sendSignerAlert(ctx, apitypes.SignerResumed, state)
+}
+
+// signerBalance returns nil if the balance cannot be queried
+func (m *manager) signerBalance(ctx context.Context, signer string) *fftypes.FFBigInt {
+	res, reason, err := m.connector.BalanceForSigner(ctx, &ffcapi.BalanceForSignerRequest{
+		Signer: signer,
+	})
+	if err != nil {
+		log.L(ctx).Warnf("Failed to query balance for signer '%s' (reason=%s): %s", signer, reason, err)
+		return nil
+	}
+	return res.Balance
+}
+
+// parkedForInsufficientFunds returns the state of each signer parked for insufficient funds
+func (m *manager) parkedForInsufficientFunds() []*apitypes.SignerState {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	states := make([]*apitypes.SignerState, 0)
+	for _, state := range m.pausedSigners {
+		if state.Parked && state.Reason == ffcapi.ErrorReasonInsufficientFunds {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// checkParkedSigners is called on each cycle of the policy loop, and starts a check of the balance of the
+// signers parked for insufficient funds once per check interval. The balances are queried off the policy loop,
+// so a slow connector does not hold up transaction processing.
+func (m *manager) checkParkedSigners(ctx context.Context) {
+	sp := m.signerParking
+	if sp.checkDone != nil {
+		select {
+		case <-sp.checkDone:
+			sp.checkDone = nil
+		default:
+			return
+		}
+	}
+	if time.Since(sp.lastCheck) < sp.checkInterval {
+		return
+	}
+	sp.lastCheck = time.Now()
+	parked := m.parkedForInsufficientFunds()
+	if len(parked) == 0 {
+		return
+	}
+	checkDone := make(chan struct{})
+	sp.checkDone = checkDone
+	go func() {
+		defer close(checkDone)
+		m.checkParkedSignerBalances(ctx, parked)
+	}()
+}
+
+// waitParkedSignersCheck waits for any running balance check to complete, so it does not outlive the policy loop
+func (m *manager) waitParkedSignersCheck() {
+	if m.signerParking.checkDone != nil {
+		<-m.signerParking.checkDone
+		m.signerParking.checkDone = nil
+	}
+}
+
+func (m *manager) checkParkedSignerBalances(ctx context.Context, parked []*apitypes.SignerState) {
+	for _, state := range parked {
+		balance := m.signerBalance(ctx, state.Signer)
+		if m.signerParking.fundsArrived(state, balance) {
+			m.unparkSigner(ctx, state.Signer, balance)
+		} else {
+			log.L(ctx).Debugf("Signer '%s' remains parked for insufficient funds (balance=%s,requiredBalance=%s)", state.Signer, balance, state.RequiredBalance)
+		}
+	}
+}
+
+// fundsArrived returns true once the balance covers both the configured minimum balance, and the cost of the
+// transaction that failed. If neither is known the signer remains parked until resumed by an operator, as any
+// deposit - however small - would otherwise resume a signer that cannot pay for its transactions.
+func (sp *signerParking) fundsArrived(state *apitypes.SignerState, balance *fftypes.FFBigInt) bool {
+	required := new(big.Int)
+	if sp.minBalance != nil {
+		required.Set(sp.minBalance)
+	}
+	if state.RequiredBalance != nil && state.RequiredBalance.Int().Cmp(required) > 0 {
+		required.Set(state.RequiredBalance.Int())
+	}
+	return balance != nil && required.Sign() > 0 && balance.Int().Cmp(required) >= 0
+}
+
+// sendSignerAlert notifies on the signer alerts topic of the websocket, and the webhook if configured, that a signer
+// has been parked or resumed. Alerts are not sent as replies, so they are not delivered to clients that only process
+// transaction updates. This is best-effort - failures to deliver the webhook are logged, and not retried.
+func (m *manager) sendSignerAlert(ctx context.Context, replyType apitypes.ReplyType, state *apitypes.SignerState) {
+	alert := &apitypes.SignerStateReply{
+		Headers: apitypes.ReplyHeaders{
+			Type: replyType,
+		},
+		SignerState: *state,
+	}
+	_, broadcast, _ := m.wsServer.GetChannels(m.signerParking.alertTopic)
+	broadcast <- alert
+	if m.signerParking.alertClient != nil {
+		go func() {
+			if err := m.postSignerAlert(alert); err != nil {
+				log.L(ctx).Errorf("Failed to send %s alert for signer '%s' to webhook: %s", replyType, state.Signer, err)
+			}
+		}()
+	}
+}
+
+func (m *manager) postSignerAlert(alert *apitypes.SignerStateReply) error {
+	res, err := m.signerParking.alertClient.R().
+		SetContext(m.ctx).
+		SetBody(alert).
+		Post("")
+	if err == nil && res.IsError() {
+		err = i18n.NewError(m.ctx, tmmsgs.MsgWebhookFailedStatus, res.StatusCode())
+	}
+	return err
+}
@@ -0,0 +1,382 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/ws"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testAlertWSServer struct {
+	ws.WebSocketServer
+	topic     string
+	broadcast chan interface{}
+	alerts    []*apitypes.SignerStateReply
+}
+
+func newTestAlertWSServer(m *manager) *testAlertWSServer {
+	wss := &testAlertWSServer{
+		WebSocketServer: m.wsServer,
+		broadcast:       make(chan interface{}, 10),
+	}
+	m.wsServer = wss
+	return wss
+}
+
+func (s *testAlertWSServer) GetChannels(topic string) (chan<- interface{}, chan<- interface{}, <-chan *ws.WebSocketCommandMessageOrError) {
+	s.topic = topic
+	return nil, s.broadcast, nil
+}
+
+func (s *testAlertWSServer) SendReply(message interface{}) {
+	panic("signer alerts must not be sent as replies")
+}
+
+func (s *testAlertWSServer) received() []*apitypes.SignerStateReply {
+	for {
+		select {
+		case message := <-s.broadcast:
+			s.alerts = append(s.alerts, message.(*apitypes.SignerStateReply))
+		default:
+			return s.alerts
+		}
+	}
+}
+
+func mockSignerBalance(m *manager, signer string, balance int64) *mock.Call {
+	mfc := m.connector.(*ffcapimocks.API)
+	return mfc.On("BalanceForSigner", m.ctx, &ffcapi.BalanceForSignerRequest{Signer: signer}).
+		Return(&ffcapi.BalanceForSignerResponse{Balance: fftypes.NewFFBigInt(balance)}, ffcapi.ErrorReason(""), nil)
+}
+
+func TestNewSignerParkingMinBalance(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsInsufficientFundsMinBalance, "0x10")
+	sp, err := newSignerParking(m.ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(16), sp.minBalance.Int64())
+	assert.True(t, sp.parkOnInsufficientFunds)
+	assert.Nil(t, sp.alertClient)
+
+	config.Set(tmconfig.TransactionsInsufficientFundsMinBalance, "lots")
+	err = m.initServices(m.ctx)
+	assert.Regexp(t, "FF21094.*lots", err)
+
+}
+
+func TestParkOnInsufficientFundsAutoResume(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	wss := newTestAlertWSServer(m)
+	mockPolicyEngineError(m, ffcapi.ErrorReasonInsufficientFunds)
+
+	// The cost of the transaction is the estimated gas of 100000 at the gas price
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	mtx.GasPrice = fftypes.JSONAnyPtr(`"10"`)
+	pending := &pendingState{mtx: mtx}
+
+	err := m.execPolicy(m.ctx, pending, false)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxStatusPending, mtx.Status)
+	assert.True(t, m.isSignerParked("0xaaaaa"))
+	alerts := wss.received()
+	assert.Equal(t, "fftm_signer_alerts", wss.topic)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, apitypes.SignerParked, alerts[0].Headers.Type)
+	assert.Equal(t, ffcapi.ErrorReasonInsufficientFunds, alerts[0].Reason)
+	assert.Equal(t, int64(1000000), alerts[0].RequiredBalance.Int64())
+
+	// New transactions are accepted while parked
+	locked, err := m.assignAndLockNonce(m.ctx, "ns1:"+fftypes.NewUUID().String(), "0xaaaaa")
+	assert.NoError(t, err)
+	locked.complete(m.ctx)
+
+	// Further errors do not re-park
+	err = m.execPolicy(m.ctx, &pendingState{mtx: mtx}, false)
+	assert.NoError(t, err)
+	assert.Len(t, wss.received(), 1)
+
+	// A deposit that does not cover the transaction does not resume
+	mockSignerBalance(m, "0xaaaaa", 999999).Once()
+	m.checkParkedSignerBalances(m.ctx, m.parkedForInsufficientFunds())
+	assert.True(t, m.isSignerParked("0xaaaaa"))
+
+	mockSignerBalance(m, "0xaaaaa", 1000000).Once()
+	m.checkParkedSignerBalances(m.ctx, m.parkedForInsufficientFunds())
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+	alerts = wss.received()
+	assert.Len(t, alerts, 2)
+	assert.Equal(t, apitypes.SignerResumed, alerts[1].Headers.Type)
+	assert.Equal(t, int64(1000000), alerts[1].Balance.Int64())
+
+}
+
+func TestParkOnInsufficientFundsDisabled(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.signerParking.parkOnInsufficientFunds = false
+	mockPolicyEngineError(m, ffcapi.ErrorReasonInsufficientFunds)
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	err := m.execPolicy(m.ctx, &pendingState{mtx: mtx}, false)
+	assert.NoError(t, err)
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+
+}
+
+func TestParkOnInsufficientFundsFailureRulePrecedence(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.failureRules = []*failureRule{
+		{reasons: map[ffcapi.ErrorReason]bool{ffcapi.ErrorReasonInsufficientFunds: true}, action: failureActionRetry},
+	}
+	mockPolicyEngineError(m, ffcapi.ErrorReasonInsufficientFunds)
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	err := m.execPolicy(m.ctx, &pendingState{mtx: mtx}, false)
+	assert.NoError(t, err)
+	assert.False(t, m.isSignerPaused("0xaaaaa"))
+
+}
+
+func TestParkSignerOperatorPrecedence(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	wss := newTestAlertWSServer(m)
+	mtx := genTestTxn("0xaaaaa", 12345, apitypes.TxStatusPending)
+
+	// An operator pause is not replaced by parking
+	_, err := m.pauseSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	m.parkSigner(m.ctx, mtx, ffcapi.ErrorReasonInsufficientFunds)
+	assert.False(t, m.isSignerParked("0xaaaaa"))
+	assert.Empty(t, m.parkedForInsufficientFunds())
+
+	// An operator resume of a paused signer does not alert
+	_, err = m.resumeSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	assert.Empty(t, wss.received())
+
+	// An operator resume of a parked signer alerts
+	m.parkSigner(m.ctx, mtx, ffcapi.ErrorReasonInsufficientFunds)
+	assert.True(t, m.isSignerParked("0xaaaaa"))
+	_, err = m.resumeSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	alerts := wss.received()
+	assert.Len(t, alerts, 2)
+	assert.Equal(t, apitypes.SignerResumed, alerts[1].Headers.Type)
+
+	// An unpark after an operator pause leaves the signer paused
+	_, err = m.pauseSigner(m.ctx, "0xaaaaa")
+	assert.NoError(t, err)
+	m.unparkSigner(m.ctx, "0xaaaaa", fftypes.NewFFBigInt(100))
+	assert.True(t, m.isSignerPaused("0xaaaaa"))
+
+}
+
+func TestParkedSignerRestored(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	mtx := genTestTxn("0xaaaaa", 12345, apitypes.TxStatusPending)
+	mtx.Gas = fftypes.NewFFBigInt(100)
+	mtx.GasPrice = fftypes.JSONAnyPtr(`{"maxFeePerGas":"20"}`)
+	m.parkSigner(m.ctx, mtx, ffcapi.ErrorReasonInsufficientFunds)
+
+	m.pausedSigners = make(map[string]*apitypes.SignerState)
+	err := m.restoreSignerStates(m.ctx)
+	assert.NoError(t, err)
+	parked := m.parkedForInsufficientFunds()
+	assert.Len(t, parked, 1)
+	assert.Equal(t, "0xaaaaa", parked[0].Signer)
+	assert.Equal(t, int64(2000), parked[0].RequiredBalance.Int64())
+
+}
+
+func TestParkSignerUnknownCost(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	// Without a cost or a minimum balance, a parked signer is not resumed by any balance
+	m.parkSigner(m.ctx, genTestTxn("0xaaaaa", 12345, apitypes.TxStatusPending), ffcapi.ErrorReasonInsufficientFunds)
+	parked := m.parkedForInsufficientFunds()
+	assert.Len(t, parked, 1)
+	assert.Nil(t, parked[0].RequiredBalance)
+
+	mockSignerBalance(m, "0xaaaaa", 1000000).Once()
+	m.checkParkedSignerBalances(m.ctx, parked)
+	assert.True(t, m.isSignerParked("0xaaaaa"))
+
+}
+
+func TestCheckParkedSigners(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	// No check is started without parked signers
+	m.signerParking.checkInterval = 0
+	m.checkParkedSigners(m.ctx)
+	assert.Nil(t, m.signerParking.checkDone)
+
+	release := make(chan struct{})
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("BalanceForSigner", m.ctx, mock.Anything).
+		Run(func(args mock.Arguments) { <-release }).
+		Return(nil, ffcapi.ErrorReason(""), fmt.Errorf("pop")).Twice()
+	m.parkSigner(m.ctx, genTestTxn("0xaaaaa", 12345, apitypes.TxStatusPending), ffcapi.ErrorReasonInsufficientFunds)
+
+	// The balances are checked off the policy loop, and a check is not started while one is running
+	m.checkParkedSigners(m.ctx)
+	m.checkParkedSigners(m.ctx)
+	close(release)
+	<-m.signerParking.checkDone
+
+	// Once complete the next check starts, and is waited for
+	m.checkParkedSigners(m.ctx)
+	m.waitParkedSignersCheck()
+	assert.True(t, m.isSignerParked("0xaaaaa"))
+
+	// The next check is not due until the interval passes
+	m.signerParking.checkInterval = 1 * time.Hour
+	m.checkParkedSigners(m.ctx)
+	assert.Nil(t, m.signerParking.checkDone)
+
+	mfc.AssertExpectations(t)
+
+}
+
+func TestUnparkSignerWriteFail(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("WriteSignerState", m.ctx, mock.Anything).Return(fmt.Errorf("pop"))
+
+	m.pausedSigners["0xaaaaa"] = &apitypes.SignerState{Signer: "0xaaaaa", Paused: true, Parked: true}
+	m.unparkSigner(m.ctx, "0xaaaaa", fftypes.NewFFBigInt(100))
+	assert.True(t, m.isSignerParked("0xaaaaa"))
+
+	mp.AssertExpectations(t)
+
+}
+
+func TestSignerParkingFundsArrived(t *testing.T) {
+
+	sp := &signerParking{}
+	assert.False(t, sp.fundsArrived(&apitypes.SignerState{}, fftypes.NewFFBigInt(1000)))
+
+	parked := &apitypes.SignerState{RequiredBalance: fftypes.NewFFBigInt(100)}
+	assert.False(t, sp.fundsArrived(parked, nil))
+	assert.False(t, sp.fundsArrived(parked, fftypes.NewFFBigInt(99)))
+	assert.True(t, sp.fundsArrived(parked, fftypes.NewFFBigInt(100)))
+
+	// The minimum balance applies in addition to the cost of the transaction
+	sp.minBalance = fftypes.NewFFBigInt(150).Int()
+	assert.False(t, sp.fundsArrived(parked, fftypes.NewFFBigInt(100)))
+	assert.True(t, sp.fundsArrived(parked, fftypes.NewFFBigInt(150)))
+	assert.True(t, sp.fundsArrived(&apitypes.SignerState{}, fftypes.NewFFBigInt(150)))
+	assert.True(t, sp.fundsArrived(&apitypes.SignerState{RequiredBalance: fftypes.NewFFBigInt(200)}, fftypes.NewFFBigInt(200)))
+	assert.False(t, sp.fundsArrived(&apitypes.SignerState{RequiredBalance: fftypes.NewFFBigInt(200)}, fftypes.NewFFBigInt(199)))
+
+}
+
+func TestSignerAlertWebhook(t *testing.T) {
+
+	alerts := make(chan *apitypes.SignerStateReply, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var alert apitypes.SignerStateReply
+		err := json.NewDecoder(r.Body).Decode(&alert)
+		assert.NoError(t, err)
+		alerts <- &alert
+	}))
+	defer server.Close()
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	tmconfig.SignerAlertsConfig.Set(ffresty.HTTPConfigURL, server.URL)
+	sp, err := newSignerParking(m.ctx)
+	assert.NoError(t, err)
+	m.signerParking = sp
+
+	m.sendSignerAlert(m.ctx, apitypes.SignerParked, &apitypes.SignerState{
+		Signer: "0xaaaaa",
+		Paused: true,
+		Parked: true,
+		Reason: ffcapi.ErrorReasonInsufficientFunds,
+	})
+	alert := <-alerts
+	assert.Equal(t, apitypes.SignerParked, alert.Headers.Type)
+	assert.Equal(t, "0xaaaaa", alert.Signer)
+	assert.Equal(t, ffcapi.ErrorReasonInsufficientFunds, alert.Reason)
+
+}
+
+func TestSignerAlertWebhookFail(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	tmconfig.SignerAlertsConfig.Set(ffresty.HTTPConfigURL, server.URL)
+	sp, err := newSignerParking(m.ctx)
+	assert.NoError(t, err)
+	m.signerParking = sp
+
+	err = m.postSignerAlert(&apitypes.SignerStateReply{
+		Headers:     apitypes.ReplyHeaders{Type: apitypes.SignerResumed},
+		SignerState: apitypes.SignerState{Signer: "0xaaaaa"},
+	})
+	assert.Regexp(t, "FF21035.*500", err)
+
+}
@@ -0,0 +1,90 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// signerPolicy restricts the signers that can submit transactions, and what each signer can do.
+// Only the signers in the policy are permitted, unless the policy is empty.
+type signerPolicy struct {
+	to       map[string]bool // empty permits any address
+	maxValue *big.Int        // nil permits any value
+}
+
+// newSignerPolicies returns a nil map if no signer policy is configured
+func newSignerPolicies(ctx context.Context) (map[string]*signerPolicy, error) {
+	policyCount := tmconfig.TransactionsSignerPolicyConfig.ArraySize()
+	if policyCount == 0 {
+		return nil, nil
+	}
+	policies := make(map[string]*signerPolicy, policyCount)
+	for i := 0; i < policyCount; i++ {
+		policyConfig := tmconfig.TransactionsSignerPolicyConfig.ArrayEntry(i)
+		signer := strings.ToLower(policyConfig.GetString(tmconfig.SignerPolicySigner))
+		if signer == "" {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgSignerPolicySignerMissing, i)
+		}
+		policy := &signerPolicy{
+			to: make(map[string]bool),
+		}
+		for _, to := range policyConfig.GetStringSlice(tmconfig.SignerPolicyTo) {
+			policy.to[strings.ToLower(to)] = true
+		}
+		if maxValue := policyConfig.GetString(tmconfig.SignerPolicyMaxValue); maxValue != "" {
+			var ok bool
+			if policy.maxValue, ok = new(big.Int).SetString(maxValue, 0); !ok {
+				return nil, i18n.NewError(ctx, tmmsgs.MsgSignerPolicyMaxValueInvalid, maxValue, signer)
+			}
+		}
+		policies[signer] = policy
+	}
+	return policies, nil
+}
+
+// checkSignerPolicy must be called before a nonce is allocated for the request, so a rejected
+// request has no effect. Every rejection is logged, for audit.
+func (m *manager) checkSignerPolicy(ctx context.Context, requestID string, headers *ffcapi.TransactionHeaders, deploy bool) (err error) {
+	if m.signerPolicies == nil {
+		return nil
+	}
+	signer := strings.ToLower(headers.From)
+	policy := m.signerPolicies[signer]
+	switch {
+	case policy == nil:
+		err = i18n.NewError(ctx, tmmsgs.MsgSignerNotPermitted, headers.From)
+	case len(policy.to) > 0 && deploy:
+		err = i18n.NewError(ctx, tmmsgs.MsgSignerDeployNotPermitted, headers.From)
+	case len(policy.to) > 0 && !policy.to[strings.ToLower(headers.To)]:
+		err = i18n.NewError(ctx, tmmsgs.MsgSignerToNotPermitted, headers.From, headers.To)
+	case policy.maxValue != nil && headers.Value != nil && headers.Value.Int().Cmp(policy.maxValue) > 0:
+		err = i18n.NewError(ctx, tmmsgs.MsgSignerMaxValueExceeded, headers.Value.String(), policy.maxValue.String(), headers.From)
+	}
+	if err != nil {
+		log.L(ctx).Warnf("Signer policy rejected request '%s' (from=%s,to=%s,value=%s,deploy=%t): %s", requestID, headers.From, headers.To, headers.Value, deploy, err)
+	}
+	return err
+}
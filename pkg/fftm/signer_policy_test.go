@@ -0,0 +1,178 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSignerPoliciesOK(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+transactions:
+  signerPolicy:
+  - signer: "0xAAAAA"
+    to: ["0xCCCCC", "0xddddd"]
+    maxValue: "0x10"
+  - signer: "0xbbbbb"
+`)
+
+	policies, err := newSignerPolicies(m.ctx)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+	assert.True(t, policies["0xaaaaa"].to["0xccccc"])
+	assert.True(t, policies["0xaaaaa"].to["0xddddd"])
+	assert.Equal(t, int64(16), policies["0xaaaaa"].maxValue.Int64())
+	assert.Empty(t, policies["0xbbbbb"].to)
+	assert.Nil(t, policies["0xbbbbb"].maxValue)
+
+}
+
+func TestNewSignerPoliciesNone(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	policies, err := newSignerPolicies(m.ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, policies)
+
+	err = m.checkSignerPolicy(m.ctx, "id1", &ffcapi.TransactionHeaders{From: "0xaaaaa"}, false)
+	assert.NoError(t, err)
+
+}
+
+func TestNewSignerPoliciesMissingSigner(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+transactions:
+  signerPolicy:
+  - to: ["0xccccc"]
+`)
+
+	err := m.initServices(m.ctx)
+	assert.Regexp(t, "FF21097", err)
+
+}
+
+func TestNewSignerPoliciesBadMaxValue(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+transactions:
+  signerPolicy:
+  - signer: "0xaaaaa"
+    maxValue: lots
+`)
+
+	_, err := newSignerPolicies(m.ctx)
+	assert.Regexp(t, "FF21098.*lots", err)
+
+}
+
+func TestCheckSignerPolicy(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	readTestPolicyEngineInstances(t, `
+transactions:
+  signerPolicy:
+  - signer: "0xaaaaa"
+    to: ["0xccccc"]
+    maxValue: "100"
+  - signer: "0xbbbbb"
+`)
+	var err error
+	m.signerPolicies, err = newSignerPolicies(m.ctx)
+	assert.NoError(t, err)
+
+	err = m.checkSignerPolicy(m.ctx, "id1", &ffcapi.TransactionHeaders{From: "0xAAAAA", To: "0xCCCCC", Value: fftypes.NewFFBigInt(100)}, false)
+	assert.NoError(t, err)
+
+	err = m.checkSignerPolicy(m.ctx, "id1", &ffcapi.TransactionHeaders{From: "0xaaaaa", To: "0xccccc"}, false)
+	assert.NoError(t, err)
+
+	err = m.checkSignerPolicy(m.ctx, "id1", &ffcapi.TransactionHeaders{From: "0xBBBBB"}, true)
+	assert.NoError(t, err)
+
+	err = m.checkSignerPolicy(m.ctx, "id1", &ffcapi.TransactionHeaders{From: "0xeeeee", To: "0xccccc"}, false)
+	assert.Regexp(t, "FF21099.*0xeeeee", err)
+
+	err = m.checkSignerPolicy(m.ctx, "id1", &ffcapi.TransactionHeaders{From: "0xaaaaa", To: "0xddddd"}, false)
+	assert.Regexp(t, "FF21100.*0xddddd", err)
+
+	err = m.checkSignerPolicy(m.ctx, "id1", &ffcapi.TransactionHeaders{From: "0xaaaaa"}, true)
+	assert.Regexp(t, "FF21101", err)
+
+	err = m.checkSignerPolicy(m.ctx, "id1", &ffcapi.TransactionHeaders{From: "0xaaaaa", To: "0xccccc", Value: fftypes.NewFFBigInt(101)}, false)
+	assert.Regexp(t, "FF21102.*101.*100", err)
+
+}
+
+func TestSendTXSignerPolicyRejected(t *testing.T) {
+
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	m.signerPolicies = map[string]*signerPolicy{
+		"0xaaaaa": {to: map[string]bool{"0xccccc": true}},
+	}
+
+	// Rejected before the connector is asked to prepare the transaction, or a nonce is allocated
+	_, _, err := m.sendManagedTransaction(m.ctx, &apitypes.TransactionRequest{
+		TransactionInput: ffcapi.TransactionInput{
+			TransactionHeaders: ffcapi.TransactionHeaders{From: "0xbbbbb", To: "0xccccc"},
+		},
+	})
+	assert.Regexp(t, "FF21099", err)
+
+	_, _, err = m.sendManagedContractDeployment(m.ctx, &apitypes.ContractDeployRequest{
+		ContractDeployPrepareRequest: ffcapi.ContractDeployPrepareRequest{
+			TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaaa"},
+		},
+	})
+	assert.Regexp(t, "FF21101", err)
+
+}
+
+func TestSendTXSignerPolicyPermitted(t *testing.T) {
+
+	_, m, done := newTestManager(t)
+	defer done()
+
+	m.signerPolicies = map[string]*signerPolicy{
+		"0xaaaaa": {to: map[string]bool{}},
+	}
+
+	mtx := sendSampleTX(t, m, "0xaaaaa", 12345)
+	assert.Equal(t, int64(12345), mtx.Nonce.Int64())
+
+}
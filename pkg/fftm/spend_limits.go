@@ -0,0 +1,391 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/persistence"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/spf13/cast"
+)
+
+type spendLimitAction string
+
+const (
+	spendLimitActionHold   spendLimitAction = "hold"
+	spendLimitActionReject spendLimitAction = "reject"
+)
+
+// signerSpendLimiter tracks the cumulative cost of the transactions submitted by each signer, over one
+// or more rolling windows (such as per-hour and per-day), where cost is the value plus the gas multiplied
+// by the gas price. A transaction counts against each window from the time it was first submitted.
+//
+// Spend is tracked in memory, and rebuilt at startup from the transactions submitted within the longest window.
+type signerSpendLimiter struct {
+	mux       sync.Mutex
+	windows   []*spendWindow
+	maxWindow time.Duration
+	action    spendLimitAction
+	signers   map[string]*signerSpend // keyed by lower case signer, so each signer has one budget whatever the case
+}
+
+type spendWindow struct {
+	window       time.Duration
+	defaultLimit *big.Int
+	signerLimits map[string]*big.Int
+}
+
+type signerSpend struct {
+	limits  []*big.Int             // for each window, or nil if there is no limit for the signer in that window
+	entries map[string]*spendEntry // keyed by transaction ID, so a re-submission replaces the previous cost
+}
+
+type spendEntry struct {
+	time time.Time
+	cost *big.Int
+}
+
+func parseSpendLimit(ctx context.Context, signer, limitStr string) (*big.Int, error) {
+	limit, ok := new(big.Int).SetString(limitStr, 0)
+	if !ok {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgSpendLimitInvalid, limitStr, signer)
+	}
+	return limit, nil
+}
+
+func newSpendWindow(ctx context.Context, window time.Duration, defaultLimit string, signerLimits map[string]interface{}) (sw *spendWindow, err error) {
+	sw = &spendWindow{
+		window:       window,
+		signerLimits: make(map[string]*big.Int),
+	}
+	if defaultLimit != "" {
+		if sw.defaultLimit, err = parseSpendLimit(ctx, "*", defaultLimit); err != nil {
+			return nil, err
+		}
+	}
+	for signer, limit := range signerLimits {
+		if sw.signerLimits[strings.ToLower(signer)], err = parseSpendLimit(ctx, signer, cast.ToString(limit)); err != nil {
+			return nil, err
+		}
+	}
+	if sw.defaultLimit == nil && len(sw.signerLimits) == 0 {
+		return nil, nil
+	}
+	return sw, nil
+}
+
+// newSignerSpendLimiter returns nil if no spend limit is configured
+func newSignerSpendLimiter(ctx context.Context) (*signerSpendLimiter, error) {
+	sl := &signerSpendLimiter{
+		action:  spendLimitAction(config.GetString(tmconfig.TransactionsSpendLimitAction)),
+		signers: make(map[string]*signerSpend),
+	}
+	sw, err := newSpendWindow(ctx,
+		config.GetDuration(tmconfig.TransactionsSpendLimitWindow),
+		config.GetString(tmconfig.TransactionsSpendLimitLimit),
+		config.GetObject(tmconfig.TransactionsSpendLimitSigners))
+	if err != nil {
+		return nil, err
+	}
+	windows := []*spendWindow{sw}
+	for i := 0; i < tmconfig.TransactionsSpendLimitWindowsConfig.ArraySize(); i++ {
+		windowConf := tmconfig.TransactionsSpendLimitWindowsConfig.ArrayEntry(i)
+		if sw, err = newSpendWindow(ctx,
+			windowConf.GetDuration(tmconfig.SpendLimitWindowWindow),
+			windowConf.GetString(tmconfig.SpendLimitWindowLimit),
+			windowConf.GetObject(tmconfig.SpendLimitWindowSigners)); err != nil {
+			return nil, err
+		}
+		windows = append(windows, sw)
+	}
+	for _, sw := range windows {
+		if sw != nil {
+			sl.windows = append(sl.windows, sw)
+			if sw.window > sl.maxWindow {
+				sl.maxWindow = sw.window
+			}
+		}
+	}
+	switch sl.action {
+	case spendLimitActionHold, spendLimitActionReject:
+	default:
+		return nil, i18n.NewError(ctx, tmmsgs.MsgSpendLimitActionInvalid, sl.action)
+	}
+	if len(sl.windows) == 0 {
+		return nil, nil
+	}
+	return sl, nil
+}
+
+// gasPriceValue extracts an integer gas price from the JSON passed to the connector, which is either a simple
+// value, or a structure (such as for EIP-1559 where we use maxFeePerGas as the worst case)
+func gasPriceValue(gasPrice *fftypes.JSONAny) *big.Int {
+	var gp fftypes.FFBigInt
+	if err := json.Unmarshal(gasPrice.Bytes(), &gp); err == nil {
+		return gp.Int()
+	}
+	obj := gasPrice.JSONObjectNowarn()
+	for _, field := range []string{"maxFeePerGas", "gasPrice"} {
+		if v, ok := obj[field]; ok {
+			b, _ := json.Marshal(v)
+			if err := json.Unmarshal(b, &gp); err == nil {
+				return gp.Int()
+			}
+		}
+	}
+	return big.NewInt(0)
+}
+
+// transactionCost is the maximum that a signer could spend on a transaction - the value plus the gas multiplied by the gas price
+func transactionCost(req *ffcapi.TransactionSendRequest) *big.Int {
+	cost := new(big.Int)
+	if req.Gas != nil && !req.GasPrice.IsNil() {
+		cost.Mul(req.Gas.Int(), gasPriceValue(req.GasPrice))
+	}
+	if req.Value != nil {
+		cost.Add(cost, req.Value.Int())
+	}
+	return cost
+}
+
+// managedTXCost is the transactionCost of a managed transaction, using the gas estimated when it was prepared
+// if the gas is not set in its headers
+func managedTXCost(mtx *apitypes.ManagedTX) *big.Int {
+	req := &ffcapi.TransactionSendRequest{
+		GasPrice:           mtx.GasPrice,
+		TransactionHeaders: mtx.TransactionHeaders,
+	}
+	if req.Gas == nil {
+		req.Gas = mtx.Gas
+	}
+	return transactionCost(req)
+}
+
+// spendForSigner returns the tracked spend for the signer, with entries pruned once they are outside every window,
+// or nil if there is no limit for the signer. Must be called with the mutex held.
+func (sl *signerSpendLimiter) spendForSigner(signer string, now time.Time) *signerSpend {
+	signer = strings.ToLower(signer)
+	ss := sl.signers[signer]
+	if ss == nil {
+		limited := false
+		limits := make([]*big.Int, len(sl.windows))
+		for i, sw := range sl.windows {
+			limit, ok := sw.signerLimits[signer]
+			if !ok {
+				limit = sw.defaultLimit
+			}
+			limits[i] = limit
+			limited = limited || limit != nil
+		}
+		if !limited {
+			return nil
+		}
+		ss = &signerSpend{limits: limits, entries: make(map[string]*spendEntry)}
+		sl.signers[signer] = ss
+	}
+	for txID, e := range ss.entries {
+		if now.Sub(e.time) > sl.maxWindow {
+			delete(ss.entries, txID)
+		}
+	}
+	return ss
+}
+
+// spent returns the total and number of transactions in the window, excluding any previous submission of the transaction itself
+func (ss *signerSpend) spent(now time.Time, window time.Duration, excludeTxID string) (*big.Int, int) {
+	total := new(big.Int)
+	count := 0
+	for txID, e := range ss.entries {
+		if txID != excludeTxID && now.Sub(e.time) <= window {
+			total.Add(total, e.cost)
+			count++
+		}
+	}
+	return total, count
+}
+
+// check returns an error if the submission of the transaction would exceed a spend limit for the signer
+func (sl *signerSpendLimiter) check(ctx context.Context, txID string, req *ffcapi.TransactionSendRequest) error {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+
+	now := time.Now()
+	ss := sl.spendForSigner(req.From, now)
+	if ss == nil {
+		return nil
+	}
+	cost := transactionCost(req)
+	for i, sw := range sl.windows {
+		if ss.limits[i] == nil {
+			continue
+		}
+		spent, _ := ss.spent(now, sw.window, txID)
+		if new(big.Int).Add(spent, cost).Cmp(ss.limits[i]) > 0 {
+			return i18n.NewError(ctx, tmmsgs.MsgSpendLimitExceeded, req.From, cost.String(), ss.limits[i].String(), sw.window, spent.String())
+		}
+	}
+	return nil
+}
+
+// record adds the cost of a successful submission to the windows for the signer. A re-submission replaces
+// the cost of the previous submission, but counts from the time of the first submission.
+func (sl *signerSpendLimiter) record(txID string, req *ffcapi.TransactionSendRequest) {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+
+	now := time.Now()
+	if ss := sl.spendForSigner(req.From, now); ss != nil {
+		if e := ss.entries[txID]; e != nil {
+			e.cost = transactionCost(req)
+		} else {
+			ss.entries[txID] = &spendEntry{time: now, cost: transactionCost(req)}
+		}
+	}
+}
+
+// restore adds the cost of a transaction submitted before a restart, if its first submission is within the longest window
+func (sl *signerSpendLimiter) restore(mtx *apitypes.ManagedTX, now time.Time) bool {
+	if mtx.FirstSubmit == nil || now.Sub(*mtx.FirstSubmit.Time()) > sl.maxWindow {
+		return false
+	}
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+
+	ss := sl.spendForSigner(mtx.TransactionHeaders.From, now)
+	if ss == nil {
+		return false
+	}
+	ss.entries[mtx.ID] = &spendEntry{time: *mtx.FirstSubmit.Time(), cost: managedTXCost(mtx)}
+	return true
+}
+
+// reset clears the spend recorded for a signer, as an operator override
+func (sl *signerSpendLimiter) reset(signer string) {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	delete(sl.signers, strings.ToLower(signer))
+}
+
+// status returns the spend of each signer in each window that it has a limit for
+func (sl *signerSpendLimiter) status() []*apitypes.SpendLimitStatus {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+
+	now := time.Now()
+	statuses := make([]*apitypes.SpendLimitStatus, 0, len(sl.signers))
+	for signer := range sl.signers {
+		ss := sl.spendForSigner(signer, now)
+		for i, sw := range sl.windows {
+			if ss.limits[i] == nil {
+				continue
+			}
+			spent, count := ss.spent(now, sw.window, "")
+			statuses = append(statuses, &apitypes.SpendLimitStatus{
+				Signer:       signer,
+				Limit:        (*fftypes.FFBigInt)(ss.limits[i]),
+				Window:       fftypes.FFDuration(sw.window),
+				Spent:        (*fftypes.FFBigInt)(spent),
+				Transactions: count,
+			})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Signer == statuses[j].Signer {
+			return statuses[i].Window < statuses[j].Window
+		}
+		return statuses[i].Signer < statuses[j].Signer
+	})
+	return statuses
+}
+
+// restoreSpendLimits rebuilds the spend in the windows for each signer from the persisted transactions, so
+// a restart does not reset the budget of every signer. Pending transactions are all checked, as they might
+// have been created before the window and first submitted within it. Then the transactions created within the
+// longest window are checked, newest first.
+func (m *manager) restoreSpendLimits(ctx context.Context) error {
+	if m.spendLimiter == nil {
+		return nil
+	}
+	now := time.Now()
+	restored := 0
+
+	var afterSeq *fftypes.UUID
+	for {
+		pending, err := m.persistence.ListTransactionsPending(ctx, afterSeq, pendingCountPageSize, persistence.SortDirectionAscending)
+		if err != nil {
+			return err
+		}
+		for _, mtx := range pending {
+			if m.spendLimiter.restore(mtx, now) {
+				restored++
+			}
+		}
+		if len(pending) < pendingCountPageSize {
+			break
+		}
+		afterSeq = pending[len(pending)-1].SequenceID
+	}
+
+	var afterTX *apitypes.ManagedTX
+	for afterTX == nil || now.Sub(*afterTX.Created.Time()) <= m.spendLimiter.maxWindow {
+		txns, err := m.persistence.ListTransactionsByCreateTime(ctx, afterTX, pendingCountPageSize, persistence.SortDirectionDescending)
+		if err != nil {
+			return err
+		}
+		for _, mtx := range txns {
+			if mtx.Status != apitypes.TxStatusPending && m.spendLimiter.restore(mtx, now) {
+				restored++
+			}
+		}
+		if len(txns) < pendingCountPageSize {
+			break
+		}
+		afterTX = txns[len(txns)-1]
+	}
+	log.L(ctx).Infof("Restored spend for %d transactions submitted in the last %s", restored, m.spendLimiter.maxWindow)
+	return nil
+}
+
+func (m *manager) getSpendLimits() []*apitypes.SpendLimitStatus {
+	if m.spendLimiter == nil {
+		return []*apitypes.SpendLimitStatus{}
+	}
+	return m.spendLimiter.status()
+}
+
+func (m *manager) resetSpendLimit(signer string) []*apitypes.SpendLimitStatus {
+	if m.spendLimiter != nil {
+		m.spendLimiter.reset(signer)
+		// Held transactions can now be re-evaluated
+		m.markInflightUpdate()
+	}
+	return m.getSpendLimits()
+}
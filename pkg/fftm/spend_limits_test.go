@@ -0,0 +1,407 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/persistencemocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func sampleSpendTX(signer string, value, gas int64, gasPrice string) *ffcapi.TransactionSendRequest {
+	return &ffcapi.TransactionSendRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  signer,
+			Value: fftypes.NewFFBigInt(value),
+			Gas:   fftypes.NewFFBigInt(gas),
+		},
+		GasPrice: fftypes.JSONAnyPtr(gasPrice),
+	}
+}
+
+func TestSpendLimiterDisabledByDefault(t *testing.T) {
+	tmconfig.Reset()
+	sl, err := newSignerSpendLimiter(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, sl)
+}
+
+func TestSpendLimiterBadDefault(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "lots")
+	_, err := newSignerSpendLimiter(context.Background())
+	assert.Regexp(t, "FF21074", err)
+}
+
+func TestSpendLimiterBadSignerLimit(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsSpendLimitSigners, map[string]interface{}{
+		"0xaaaaa": "lots",
+	})
+	_, err := newSignerSpendLimiter(context.Background())
+	assert.Regexp(t, "FF21074", err)
+}
+
+func TestSpendLimiterBadAction(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	config.Set(tmconfig.TransactionsSpendLimitAction, "wrong")
+	_, err := newSignerSpendLimiter(context.Background())
+	assert.Regexp(t, "FF21075", err)
+}
+
+func TestTransactionCost(t *testing.T) {
+	assert.Equal(t, int64(2010), transactionCost(sampleSpendTX("0xaaaaa", 10, 100, `20`)).Int64())
+	assert.Equal(t, int64(2010), transactionCost(sampleSpendTX("0xaaaaa", 10, 100, `"0x14"`)).Int64())
+	assert.Equal(t, int64(3010), transactionCost(sampleSpendTX("0xaaaaa", 10, 100, `{"maxFeePerGas":"30","maxPriorityFeePerGas":"1"}`)).Int64())
+	assert.Equal(t, int64(4010), transactionCost(sampleSpendTX("0xaaaaa", 10, 100, `{"gasPrice":40}`)).Int64())
+	assert.Equal(t, int64(10), transactionCost(sampleSpendTX("0xaaaaa", 10, 100, `{"gasPrice":"bad"}`)).Int64())
+	assert.Equal(t, int64(0), transactionCost(&ffcapi.TransactionSendRequest{}).Int64())
+}
+
+func TestSpendLimiterCheckRecordReset(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	config.Set(tmconfig.TransactionsSpendLimitWindow, "1h")
+	config.Set(tmconfig.TransactionsSpendLimitSigners, map[string]interface{}{
+		"0xBBBBB": "0x10",
+	})
+	ctx := context.Background()
+
+	sl, err := newSignerSpendLimiter(ctx)
+	assert.NoError(t, err)
+
+	tx1 := sampleSpendTX("0xaaaaa", 100, 10, "50") // 600
+	assert.NoError(t, sl.check(ctx, "tx1", tx1))
+	sl.record("tx1", tx1)
+
+	// Re-submission of the same transaction replaces the previous cost
+	assert.NoError(t, sl.check(ctx, "tx1", tx1))
+	sl.record("tx1", tx1)
+
+	tx2 := sampleSpendTX("0xaaaaa", 0, 10, "50") // 500
+	assert.Regexp(t, "FF21073", sl.check(ctx, "tx2", tx2))
+
+	// Signer override matched case-insensitively
+	tx3 := sampleSpendTX("0xbbbbb", 17, 0, "0")
+	assert.Regexp(t, "FF21073", sl.check(ctx, "tx3", tx3))
+
+	statuses := sl.status()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "0xaaaaa", statuses[0].Signer)
+	assert.Equal(t, int64(600), statuses[0].Spent.Int64())
+	assert.Equal(t, int64(1000), statuses[0].Limit.Int64())
+	assert.Equal(t, 1, statuses[0].Transactions)
+	assert.Equal(t, "0xbbbbb", statuses[1].Signer)
+	assert.Equal(t, int64(16), statuses[1].Limit.Int64())
+
+	// Entries expire out of the window
+	sl.signers["0xaaaaa"].entries["tx1"].time = time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, sl.check(ctx, "tx2", tx2))
+	sl.record("tx2", tx2)
+	assert.Regexp(t, "FF21073", sl.check(ctx, "tx4", tx1))
+
+	// Operator override
+	sl.reset("0xaaaaa")
+	assert.NoError(t, sl.check(ctx, "tx4", tx1))
+}
+
+func TestSpendLimiterMixedCaseSigner(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	ctx := context.Background()
+
+	sl, err := newSignerSpendLimiter(ctx)
+	assert.NoError(t, err)
+
+	// One budget for the signer, whatever the case of the address
+	tx1 := sampleSpendTX("0xAbCdE", 600, 0, "0")
+	assert.NoError(t, sl.check(ctx, "tx1", tx1))
+	sl.record("tx1", tx1)
+	assert.Regexp(t, "FF21073", sl.check(ctx, "tx2", sampleSpendTX("0xabcde", 600, 0, "0")))
+	assert.Regexp(t, "FF21073", sl.check(ctx, "tx2", sampleSpendTX("0xABCDE", 600, 0, "0")))
+
+	statuses := sl.status()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "0xabcde", statuses[0].Signer)
+
+	// Reset whatever the case of the address
+	sl.reset("0xABCDE")
+	assert.NoError(t, sl.check(ctx, "tx2", sampleSpendTX("0xabcde", 600, 0, "0")))
+}
+
+func TestSpendLimiterMultipleWindows(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	config.Set(tmconfig.TransactionsSpendLimitWindow, "24h")
+	readTestPolicyEngineInstances(t, `
+transactions:
+  spendLimit:
+    windows:
+    - window: 1h
+      limit: "500"
+    - window: 10m
+      signers:
+        "0xBBBBB": "10"
+`)
+	ctx := context.Background()
+
+	sl, err := newSignerSpendLimiter(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, sl.windows, 3)
+	assert.Equal(t, 24*time.Hour, sl.maxWindow)
+
+	// Within the daily limit, but not the hourly limit
+	tx1 := sampleSpendTX("0xaaaaa", 400, 0, "0")
+	assert.NoError(t, sl.check(ctx, "tx1", tx1))
+	sl.record("tx1", tx1)
+	assert.Regexp(t, "FF21073.*500 within 1h", sl.check(ctx, "tx2", tx1))
+
+	// A re-submission counts from the time of the first submission
+	sl.signers["0xaaaaa"].entries["tx1"].time = time.Now().Add(-2 * time.Hour)
+	sl.record("tx1", tx1)
+	assert.True(t, sl.signers["0xaaaaa"].entries["tx1"].time.Before(time.Now().Add(-time.Hour)))
+	assert.NoError(t, sl.check(ctx, "tx2", tx1))
+	sl.record("tx2", tx1)
+
+	// Then the daily limit applies
+	assert.Regexp(t, "FF21073.*1000 within 24h", sl.check(ctx, "tx3", sampleSpendTX("0xaaaaa", 300, 0, "0")))
+
+	// Only the windows with a limit for the signer are reported
+	tx4 := sampleSpendTX("0xbbbbb", 6, 0, "0")
+	assert.NoError(t, sl.check(ctx, "tx4", tx4))
+	sl.record("tx4", tx4)
+	assert.Regexp(t, "FF21073.*10 within 10m", sl.check(ctx, "tx5", tx4))
+
+	statuses := sl.status()
+	assert.Len(t, statuses, 5)
+	assert.Equal(t, "0xaaaaa", statuses[0].Signer)
+	assert.Equal(t, fftypes.FFDuration(time.Hour), statuses[0].Window)
+	assert.Equal(t, int64(400), statuses[0].Spent.Int64())
+	assert.Equal(t, 1, statuses[0].Transactions)
+	assert.Equal(t, fftypes.FFDuration(24*time.Hour), statuses[1].Window)
+	assert.Equal(t, int64(800), statuses[1].Spent.Int64())
+	assert.Equal(t, 2, statuses[1].Transactions)
+	assert.Equal(t, "0xbbbbb", statuses[2].Signer)
+	assert.Equal(t, fftypes.FFDuration(10*time.Minute), statuses[2].Window)
+	assert.Equal(t, int64(10), statuses[2].Limit.Int64())
+}
+
+func TestSpendLimiterBadWindowLimit(t *testing.T) {
+	tmconfig.Reset()
+	readTestPolicyEngineInstances(t, `
+transactions:
+  spendLimit:
+    windows:
+    - window: 1h
+      limit: lots
+`)
+	_, err := newSignerSpendLimiter(context.Background())
+	assert.Regexp(t, "FF21074", err)
+}
+
+func TestSpendLimiterWindowOnly(t *testing.T) {
+	tmconfig.Reset()
+	readTestPolicyEngineInstances(t, `
+transactions:
+  spendLimit:
+    windows:
+    - window: 1h
+      limit: "100"
+`)
+	sl, err := newSignerSpendLimiter(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, sl.windows, 1)
+	assert.Equal(t, time.Hour, sl.maxWindow)
+}
+
+func TestSpendLimiterSignerOnly(t *testing.T) {
+	tmconfig.Reset()
+	config.Set(tmconfig.TransactionsSpendLimitSigners, map[string]interface{}{
+		"0xaaaaa": "100",
+	})
+	ctx := context.Background()
+
+	sl, err := newSignerSpendLimiter(ctx)
+	assert.NoError(t, err)
+
+	// No limit for other signers
+	tx := sampleSpendTX("0xbbbbb", 1000, 0, "0")
+	assert.NoError(t, sl.check(ctx, "tx1", tx))
+	sl.record("tx1", tx)
+	assert.Empty(t, sl.status())
+}
+
+func TestGetSpendLimitsDisabled(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	assert.Empty(t, m.getSpendLimits())
+	assert.Empty(t, m.resetSpendLimit("0xaaaaa"))
+}
+
+func TestNewManagerBadSpendLimitConfig(t *testing.T) {
+
+	_ = testManagerCommonInit(t)
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "lots")
+
+	_, err := NewManager(context.Background(), nil)
+	assert.Regexp(t, "FF21074", err)
+
+}
+
+func timeAgo(d time.Duration) *fftypes.FFTime {
+	t := fftypes.FFTime(time.Now().Add(-d))
+	return &t
+}
+
+func writeSpendTX(t *testing.T, m *manager, status apitypes.TxStatus, nonce int64, value int64, created, lastSubmit time.Duration) {
+	mtx := &apitypes.ManagedTX{
+		ID:         fmt.Sprintf("ns1:%s", fftypes.NewUUID()),
+		Created:    timeAgo(created),
+		Status:     status,
+		SequenceID: apitypes.NewULID(),
+		Nonce:      fftypes.NewFFBigInt(nonce),
+		Gas:        fftypes.NewFFBigInt(10),
+		GasPrice:   fftypes.JSONAnyPtr(`"2"`),
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From:  "0xaaaaa",
+			Value: fftypes.NewFFBigInt(value),
+		},
+	}
+	if lastSubmit > 0 {
+		mtx.FirstSubmit = timeAgo(lastSubmit)
+		mtx.LastSubmit = mtx.FirstSubmit
+	}
+	err := m.persistence.WriteTransaction(m.ctx, mtx, true)
+	assert.NoError(t, err)
+}
+
+func TestRestoreSpendLimits(t *testing.T) {
+	_, m, done := newTestManager(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "100000")
+	config.Set(tmconfig.TransactionsSpendLimitWindow, "1h")
+	sl, err := newSignerSpendLimiter(m.ctx)
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+
+	// Created before the window, but re-submitted within it
+	writeSpendTX(t, m, apitypes.TxStatusPending, 1, 100, 2*time.Hour, 10*time.Minute)
+	// Not yet submitted
+	writeSpendTX(t, m, apitypes.TxStatusPending, 2, 1000, time.Minute, 0)
+	// Submitted and completed within the window - across more than one page
+	for i := 0; i < pendingCountPageSize; i++ {
+		writeSpendTX(t, m, apitypes.TxStatusSucceeded, int64(3+i), 1, 5*time.Minute, 5*time.Minute)
+	}
+	// Submitted before the window
+	writeSpendTX(t, m, apitypes.TxStatusSucceeded, 1000, 10000, 3*time.Hour, 3*time.Hour)
+
+	err = m.restoreSpendLimits(m.ctx)
+	assert.NoError(t, err)
+
+	statuses := m.getSpendLimits()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, 1+pendingCountPageSize, statuses[0].Transactions)
+	assert.Equal(t, int64(100+20+pendingCountPageSize*(1+20)), statuses[0].Spent.Int64())
+}
+
+func TestRestoreSpendLimitsDisabled(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	assert.NoError(t, m.restoreSpendLimits(m.ctx))
+}
+
+func TestRestoreSpendLimitsPendingFail(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	m.spendLimiter, _ = newSignerSpendLimiter(m.ctx)
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsPending", m.ctx, mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("pop"))
+
+	err := m.restoreSpendLimits(m.ctx)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestRestoreSpendLimitsCreatedFail(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "1000")
+	m.spendLimiter, _ = newSignerSpendLimiter(m.ctx)
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsPending", m.ctx, mock.Anything, mock.Anything, mock.Anything).Return([]*apitypes.ManagedTX{}, nil)
+	mp.On("ListTransactionsByCreateTime", m.ctx, mock.Anything, mock.Anything, mock.Anything).Return(nil, fmt.Errorf("pop"))
+
+	err := m.restoreSpendLimits(m.ctx)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestRestoreSpendLimitsPendingPages(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsSpendLimitSigners, map[string]interface{}{
+		"0xaaaaa": "1000",
+	})
+	m.spendLimiter, _ = newSignerSpendLimiter(m.ctx)
+
+	// A full page of pending transactions, of which only those for the signer with a limit are restored
+	page := make([]*apitypes.ManagedTX, pendingCountPageSize)
+	for i := range page {
+		signer := "0xbbbbb"
+		if i == 0 {
+			signer = "0xaaaaa"
+		}
+		page[i] = &apitypes.ManagedTX{
+			ID:                 fmt.Sprintf("tx%d", i),
+			SequenceID:         apitypes.NewULID(),
+			FirstSubmit:        timeAgo(time.Minute),
+			TransactionHeaders: ffcapi.TransactionHeaders{From: signer, Value: fftypes.NewFFBigInt(10)},
+		}
+	}
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("ListTransactionsPending", m.ctx, (*fftypes.UUID)(nil), pendingCountPageSize, mock.Anything).Return(page, nil).Once()
+	mp.On("ListTransactionsPending", m.ctx, page[len(page)-1].SequenceID, pendingCountPageSize, mock.Anything).Return([]*apitypes.ManagedTX{}, nil).Once()
+	mp.On("ListTransactionsByCreateTime", m.ctx, mock.Anything, mock.Anything, mock.Anything).Return([]*apitypes.ManagedTX{}, nil)
+
+	err := m.restoreSpendLimits(m.ctx)
+	assert.NoError(t, err)
+
+	statuses := m.getSpendLimits()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "0xaaaaa", statuses[0].Signer)
+	assert.Equal(t, int64(10), statuses[0].Spent.Int64())
+
+	mp.AssertExpectations(t)
+}
@@ -19,7 +19,9 @@ package fftm
 import (
 	"context"
 
+	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
 )
 
@@ -36,6 +38,9 @@ func (m *manager) getLiveStatus(ctx context.Context) (resp *apitypes.LiveStatus,
 }
 
 func (m *manager) getReadyStatus(ctx context.Context) (resp *apitypes.ReadyStatus, err error) {
+	if m.isDraining() {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgDraining)
+	}
 	resp = &apitypes.ReadyStatus{}
 	status, _, err := m.connector.IsReady(ctx)
 	if err == nil {
@@ -44,5 +49,27 @@ func (m *manager) getReadyStatus(ctx context.Context) (resp *apitypes.ReadyStatu
 		log.L(ctx).Warnf("Failed to fetch ready status: %s", err)
 		return nil, err
 	}
+	if m.resilience != nil && m.resilience.breaker != nil {
+		// Calls to the connector are rejected while the circuit breaker is open, or testing the connector while half open
+		resp.CircuitBreaker = m.resilience.breaker.getStatus()
+		if resp.CircuitBreaker.State != apitypes.CircuitBreakerStateClosed {
+			resp.Ready = false
+		}
+	}
 	return resp, nil
 }
+
+func (m *manager) getPolicyLoopStatus() *apitypes.PolicyLoopStatus {
+	pausedSigners := m.pausedSignerList()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	status := &apitypes.PolicyLoopStatus{
+		Workers:       make([]*apitypes.PolicyLoopWorkerStatus, len(m.workerStatus)),
+		PausedSigners: pausedSigners,
+	}
+	for i, ws := range m.workerStatus {
+		wsCopy := *ws
+		status.Workers[i] = &wsCopy
+	}
+	return status
+}
@@ -0,0 +1,123 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// guardedConnector is passed to the policy engine in place of the connector, so that TransactionSend
+// calls for a transaction are checked against the spend limit and rate limit for the signer. The same
+// checks apply to TransactionSendRaw calls to broadcast a transaction signed outside of the connector.
+//
+// When a guard prevents the submission the call fails without reaching the connector, and the outcome
+// is recorded so the policy loop can act on it regardless of how the policy engine handles the error:
+// - deferred: the policy loop re-evaluates the transaction on a later cycle, without recording an error
+// - rejected: the policy loop fails the transaction
+//
+// A transaction is only rejected before it is first submitted. A re-submission that would exceed the spend
+// limit (such as with a raised gas price) is held instead, as the earlier submission can still be mined.
+type guardedConnector struct {
+	ffcapi.API
+	txID         string
+	submitted    bool
+	gasPrice     *fftypes.JSONAny // decoded from a signed transaction, as it is not passed to TransactionSendRaw
+	rateLimiter  *signerRateLimiter
+	spendLimiter *signerSpendLimiter
+	deferred     bool
+	rejected     error
+}
+
+// guardConnector returns the connector to submit a transaction with, which is only wrapped if there are
+// guards configured
+func (m *manager) guardConnector(mtx *apitypes.ManagedTX) (ffcapi.API, *guardedConnector) {
+	if m.rateLimiter == nil && m.spendLimiter == nil {
+		return m.connector, nil
+	}
+	gc := &guardedConnector{
+		API:          m.connector,
+		txID:         mtx.ID,
+		submitted:    mtx.FirstSubmit != nil,
+		gasPrice:     mtx.GasPrice,
+		rateLimiter:  m.rateLimiter,
+		spendLimiter: m.spendLimiter,
+	}
+	return gc, gc
+}
+
+// check returns an error if the spend limit or rate limit for the signer prevents the submission
+func (gc *guardedConnector) check(ctx context.Context, req *ffcapi.TransactionSendRequest) (ffcapi.ErrorReason, error) {
+	if gc.spendLimiter != nil {
+		if err := gc.spendLimiter.check(ctx, gc.txID, req); err != nil {
+			if gc.spendLimiter.action == spendLimitActionReject && !gc.submitted {
+				gc.rejected = err
+			} else {
+				log.L(ctx).Debugf("Transaction %s held: %s", gc.txID, err)
+				gc.deferred = true
+			}
+			return ffcapi.ErrorReasonSpendLimitExceeded, err
+		}
+	}
+	if gc.rateLimiter != nil && !gc.rateLimiter.take(req.From) {
+		gc.deferred = true
+		log.L(ctx).Debugf("Transaction submission for signer %s deferred by rate limit", req.From)
+		return "", i18n.NewError(ctx, tmmsgs.MsgSignerRateLimited, req.From)
+	}
+	return "", nil
+}
+
+func (gc *guardedConnector) TransactionSend(ctx context.Context, req *ffcapi.TransactionSendRequest) (*ffcapi.TransactionSendResponse, ffcapi.ErrorReason, error) {
+	if reason, err := gc.check(ctx, req); err != nil {
+		return nil, reason, err
+	}
+	res, reason, err := gc.API.TransactionSend(ctx, req)
+	if err == nil && gc.spendLimiter != nil {
+		gc.spendLimiter.record(gc.txID, req)
+	}
+	return res, reason, err
+}
+
+func (gc *guardedConnector) TransactionSendRaw(ctx context.Context, req *ffcapi.TransactionSendRawRequest) (*ffcapi.TransactionSendRawResponse, ffcapi.ErrorReason, error) {
+	sendReq := &ffcapi.TransactionSendRequest{
+		GasPrice:           gc.gasPrice,
+		TransactionHeaders: req.TransactionHeaders,
+	}
+	if reason, err := gc.check(ctx, sendReq); err != nil {
+		return nil, reason, err
+	}
+	res, reason, err := gc.API.TransactionSendRaw(ctx, req)
+	if err == nil && gc.spendLimiter != nil {
+		gc.spendLimiter.record(gc.txID, sendReq)
+	}
+	return res, reason, err
+}
+
+// rejectTransaction fails a transaction, because a guard rejected its first submission.
+// The nonce was assigned, but never used on chain, so it is released.
+func (m *manager) rejectTransaction(ctx context.Context, mtx *apitypes.ManagedTX, rejected error) {
+	log.L(ctx).Errorf("Transaction %s rejected: %s", mtx.ID, rejected)
+	m.addError(mtx, ffcapi.ErrorReasonSpendLimitExceeded, rejected)
+	mtx.Status = apitypes.TxStatusFailed
+	m.releaseUnsubmittedNonce(ctx, mtx)
+}
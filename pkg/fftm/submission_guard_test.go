@@ -0,0 +1,148 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardConnectorNoGuards(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	cAPI, gc := m.guardConnector(&apitypes.ManagedTX{ID: "tx1"})
+	assert.Equal(t, m.connector, cAPI)
+	assert.Nil(t, gc)
+}
+
+func TestGuardConnectorRateLimited(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsRateLimitCount, 1)
+	config.Set(tmconfig.TransactionsRateLimitInterval, "1h")
+	m.rateLimiter = newSignerRateLimiter()
+
+	req := sampleSpendTX("0xaaaaa", 0, 0, "0")
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSend", context.Background(), req).Return(&ffcapi.TransactionSendResponse{}, ffcapi.ErrorReason(""), nil).Once()
+
+	_, gc := m.guardConnector(&apitypes.ManagedTX{ID: "tx1"})
+	_, _, err := gc.TransactionSend(context.Background(), req)
+	assert.NoError(t, err)
+	assert.False(t, gc.deferred)
+
+	_, gc = m.guardConnector(&apitypes.ManagedTX{ID: "tx2"})
+	_, _, err = gc.TransactionSend(context.Background(), req)
+	assert.Regexp(t, "FF21072", err)
+	assert.True(t, gc.deferred)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestGuardConnectorSpendLimitHold(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "100")
+	sl, err := newSignerSpendLimiter(context.Background())
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+
+	req := sampleSpendTX("0xaaaaa", 60, 0, "0")
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSend", context.Background(), req).Return(&ffcapi.TransactionSendResponse{}, ffcapi.ErrorReason(""), nil).Once()
+
+	_, gc := m.guardConnector(&apitypes.ManagedTX{ID: "tx1"})
+	_, _, err = gc.TransactionSend(context.Background(), req)
+	assert.NoError(t, err)
+
+	_, gc = m.guardConnector(&apitypes.ManagedTX{ID: "tx2"})
+	_, reason, err := gc.TransactionSend(context.Background(), req)
+	assert.Regexp(t, "FF21073", err)
+	assert.Equal(t, ffcapi.ErrorReasonSpendLimitExceeded, reason)
+	assert.True(t, gc.deferred)
+	assert.Nil(t, gc.rejected)
+
+	mfc.AssertExpectations(t)
+}
+
+func TestGuardConnectorSpendLimitReject(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "100")
+	config.Set(tmconfig.TransactionsSpendLimitAction, "reject")
+	sl, err := newSignerSpendLimiter(context.Background())
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+
+	_, gc := m.guardConnector(&apitypes.ManagedTX{ID: "tx1"})
+	_, reason, err := gc.TransactionSend(context.Background(), sampleSpendTX("0xaaaaa", 101, 0, "0"))
+	assert.Regexp(t, "FF21073", err)
+	assert.Equal(t, ffcapi.ErrorReasonSpendLimitExceeded, reason)
+	assert.False(t, gc.deferred)
+	assert.Regexp(t, "FF21073", gc.rejected)
+
+	// Once submitted, a re-submission that would exceed the limit is held, as the earlier submission can still be mined
+	_, gc = m.guardConnector(&apitypes.ManagedTX{ID: "tx1", FirstSubmit: fftypes.Now()})
+	_, reason, err = gc.TransactionSend(context.Background(), sampleSpendTX("0xaaaaa", 101, 0, "0"))
+	assert.Regexp(t, "FF21073", err)
+	assert.Equal(t, ffcapi.ErrorReasonSpendLimitExceeded, reason)
+	assert.True(t, gc.deferred)
+	assert.Nil(t, gc.rejected)
+}
+
+func TestGuardConnectorSendRawSpendLimit(t *testing.T) {
+	_, m, done := newTestManagerMockPersistence(t)
+	defer done()
+
+	config.Set(tmconfig.TransactionsSpendLimitLimit, "100")
+	sl, err := newSignerSpendLimiter(context.Background())
+	assert.NoError(t, err)
+	m.spendLimiter = sl
+
+	// The cost is from the gas price of the transaction, which is not in the raw request
+	req := &ffcapi.TransactionSendRawRequest{
+		TransactionHeaders: ffcapi.TransactionHeaders{From: "0xaaaaa", Gas: fftypes.NewFFBigInt(30), Value: fftypes.NewFFBigInt(10)},
+		RawTransaction:     "0xfeedbeef",
+	}
+	mfc := m.connector.(*ffcapimocks.API)
+	mfc.On("TransactionSendRaw", context.Background(), req).Return(&ffcapi.TransactionSendRawResponse{}, ffcapi.ErrorReason(""), nil).Once()
+
+	_, gc := m.guardConnector(&apitypes.ManagedTX{ID: "tx1", GasPrice: fftypes.JSONAnyPtr(`"2"`)})
+	_, _, err = gc.TransactionSendRaw(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(70), sl.status()[0].Spent.Int64())
+
+	_, gc = m.guardConnector(&apitypes.ManagedTX{ID: "tx2", GasPrice: fftypes.JSONAnyPtr(`"2"`)})
+	_, reason, err := gc.TransactionSendRaw(context.Background(), req)
+	assert.Regexp(t, "FF21073", err)
+	assert.Equal(t, ffcapi.ErrorReasonSpendLimitExceeded, reason)
+	assert.True(t, gc.deferred)
+
+	mfc.AssertExpectations(t)
+}
@@ -38,21 +38,18 @@ func (m *manager) getTransactionByID(ctx context.Context, txID string) (transact
 	return tx, nil
 }
 
-func (m *manager) getTransactions(ctx context.Context, afterStr, limitStr, signer string, pending bool, dirString string) (transactions []*apitypes.ManagedTX, err error) {
-	limit, err := m.parseLimit(ctx, limitStr)
-	if err != nil {
-		return nil, err
-	}
-	var dir persistence.SortDirection
+func parseSortDirection(ctx context.Context, dirString string) (persistence.SortDirection, error) {
 	switch strings.ToLower(dirString) {
 	case "", "desc", "descending":
-		dir = persistence.SortDirectionDescending // descending is default
+		return persistence.SortDirectionDescending, nil // descending is default
 	case "asc", "ascending":
-		dir = persistence.SortDirectionAscending
+		return persistence.SortDirectionAscending, nil
 	default:
-		return nil, i18n.NewError(ctx, tmmsgs.MsgInvalidSortDirection, dirString)
+		return -1, i18n.NewError(ctx, tmmsgs.MsgInvalidSortDirection, dirString)
 	}
-	var afterTx *apitypes.ManagedTX
+}
+
+func (m *manager) getAfterTransaction(ctx context.Context, afterStr string) (afterTx *apitypes.ManagedTX, err error) {
 	if afterStr != "" {
 		// Get the transaction, as we need this to exist to pick the right field depending on the index that's been chosen
 		afterTx, err = m.persistence.GetTransactionByID(ctx, afterStr)
@@ -63,6 +60,22 @@ func (m *manager) getTransactions(ctx context.Context, afterStr, limitStr, signe
 			return nil, i18n.NewError(ctx, tmmsgs.MsgPaginationErrTxNotFound, afterStr)
 		}
 	}
+	return afterTx, nil
+}
+
+func (m *manager) getTransactions(ctx context.Context, afterStr, limitStr, signer string, pending bool, dirString string) (transactions []*apitypes.ManagedTX, err error) {
+	limit, err := m.parseLimit(ctx, limitStr)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := parseSortDirection(ctx, dirString)
+	if err != nil {
+		return nil, err
+	}
+	afterTx, err := m.getAfterTransaction(ctx, afterStr)
+	if err != nil {
+		return nil, err
+	}
 	switch {
 	case signer != "" && pending:
 		return nil, i18n.NewError(ctx, tmmsgs.MsgTXConflictSignerPending)
@@ -84,6 +97,23 @@ func (m *manager) getTransactions(ctx context.Context, afterStr, limitStr, signe
 
 }
 
+// getDeployments lists the transactions that deploy a contract, with the location of each deployed contract once confirmed
+func (m *manager) getDeployments(ctx context.Context, afterStr, limitStr, dirString string) (transactions []*apitypes.ManagedTX, err error) {
+	limit, err := m.parseLimit(ctx, limitStr)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := parseSortDirection(ctx, dirString)
+	if err != nil {
+		return nil, err
+	}
+	afterTx, err := m.getAfterTransaction(ctx, afterStr)
+	if err != nil {
+		return nil, err
+	}
+	return m.persistence.ListDeployments(ctx, afterTx, limit, dir)
+}
+
 func (m *manager) requestTransactionDeletion(ctx context.Context, txID string) (status int, transaction *apitypes.ManagedTX, err error) {
 	res := m.policyEngineAPIRequest(ctx, &policyEngineAPIRequest{
 		requestType: policyEngineAPIRequestTypeDelete,
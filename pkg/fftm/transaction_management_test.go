@@ -73,3 +73,24 @@ func TestGetTransactionsErrors(t *testing.T) {
 	mp.AssertExpectations(t)
 
 }
+
+func TestGetDeploymentsErrors(t *testing.T) {
+
+	_, m, close := newTestManagerMockPersistence(t)
+	defer close()
+
+	mp := m.persistence.(*persistencemocks.Persistence)
+	mp.On("GetTransactionByID", m.ctx, mock.Anything).Return(nil, fmt.Errorf("pop")).Once()
+
+	_, err := m.getDeployments(m.ctx, "", "bad limit", "")
+	assert.Regexp(t, "FF21044", err)
+
+	_, err = m.getDeployments(m.ctx, "", "", "wrong")
+	assert.Regexp(t, "FF21064", err)
+
+	_, err = m.getDeployments(m.ctx, "after-causes-failure", "", "")
+	assert.Regexp(t, "pop", err)
+
+	mp.AssertExpectations(t)
+
+}
@@ -32,6 +32,14 @@ const (
 	UpdateDelete                   // Instructs that the transaction should be removed completely from persistence - generally only returned when TX status is TxStatusDeleteRequested
 )
 
+// GasOracleStatusProvider is an optional interface for policy engines that query gas prices,
+// to report on the status of each of their gas price sources
+type GasOracleStatusProvider interface {
+	GasOracleStatus(ctx context.Context) *apitypes.GasOracleStatus
+}
+
+// PolicyEngine is invoked by the policy loop for each in-flight transaction. When the policy loop is configured
+// with multiple workers, Execute is called concurrently for transactions from different signers.
 type PolicyEngine interface {
 	Execute(ctx context.Context, cAPI ffcapi.API, mtx *apitypes.ManagedTX) (updateType UpdateType, reason ffcapi.ErrorReason, err error)
 }
@@ -0,0 +1,74 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyengine
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// SubmitTransaction is a helper for policy engine implementations, to send (or re-send) a transaction
+// to the connector using the gas price currently set on the transaction. On success the transaction
+// hash and last submit time are updated, and the submission is recorded in the history.
+func SubmitTransaction(ctx context.Context, cAPI ffcapi.API, mtx *apitypes.ManagedTX) (reason ffcapi.ErrorReason, err error) {
+	sendTX := &ffcapi.TransactionSendRequest{
+		TransactionHeaders: mtx.TransactionHeaders,
+		GasPrice:           mtx.GasPrice,
+		TransactionData:    mtx.TransactionData,
+	}
+	sendTX.TransactionHeaders.Nonce = (*fftypes.FFBigInt)(mtx.Nonce.Int())
+	sendTX.TransactionHeaders.Gas = (*fftypes.FFBigInt)(mtx.Gas.Int())
+	log.L(ctx).Debugf("Sending transaction %s at nonce %s / %d (lastSubmit=%s)", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.LastSubmit)
+	res, reason, err := cAPI.TransactionSend(ctx, sendTX)
+	if err == nil {
+		action := apitypes.TxActionSubmitted
+		if mtx.FirstSubmit != nil {
+			action = apitypes.TxActionResubmitted
+		}
+		mtx.TransactionHash = res.TransactionHash
+		mtx.LastSubmit = fftypes.Now()
+		mtx.AddHistory(&apitypes.ManagedTXHistoryEntry{
+			Time:            mtx.LastSubmit,
+			Action:          action,
+			TransactionHash: mtx.TransactionHash,
+			GasPrice:        mtx.GasPrice,
+		})
+	} else {
+		// We have some simple rules for handling reasons from the connector, which could be enhanced by extending the connector.
+		switch reason {
+		case ffcapi.ErrorKnownTransaction, ffcapi.ErrorReasonNonceTooLow:
+			// If we already have a transaction hash, this is fine - we just return as if we submitted it
+			if mtx.TransactionHash != "" {
+				log.L(ctx).Debugf("Transaction %s at nonce %s / %d known with hash: %s (%s)", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.TransactionHash, err)
+				return "", nil
+			}
+			// Note: to cover the edge case where we had a timeout or other failure during the initial TransactionSend,
+			//       a policy engine implementation would need to be able to re-calculate the hash that we would expect for the transaction.
+			//       This would require a new FFCAPI API to calculate that hash, which requires the connector to perform the signing
+			//       without submission to the node. For example using `eth_signTransaction` for EVM JSON/RPC.
+			return reason, err
+		default:
+			return reason, err
+		}
+	}
+	log.L(ctx).Infof("Transaction %s at nonce %s / %d submitted. Hash: %s", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.TransactionHash)
+	return "", nil
+}
@@ -0,0 +1,96 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyengine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestSubmitTX() *apitypes.ManagedTX {
+	return &apitypes.ManagedTX{
+		ID: "ns1:" + fftypes.NewUUID().String(),
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From: "0x6b7cfa4cf9709d3b3f5f7c22de123d2e16aee712",
+		},
+		Nonce:           fftypes.NewFFBigInt(12345),
+		Gas:             fftypes.NewFFBigInt(50000),
+		GasPrice:        fftypes.JSONAnyPtr(`12345`),
+		TransactionData: "0x01020304",
+	}
+}
+
+func TestSubmitTransactionOK(t *testing.T) {
+	mtx := newTestSubmitTX()
+
+	mockFFCAPI := &ffcapimocks.API{}
+	mockFFCAPI.On("TransactionSend", mock.Anything, mock.MatchedBy(func(req *ffcapi.TransactionSendRequest) bool {
+		return req.Nonce.Int64() == 12345 && req.Gas.Int64() == 50000 && req.GasPrice.String() == `12345`
+	})).Return(&ffcapi.TransactionSendResponse{TransactionHash: "0x12345"}, ffcapi.ErrorReason(""), nil).Twice()
+
+	reason, err := SubmitTransaction(context.Background(), mockFFCAPI, mtx)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	assert.Equal(t, "0x12345", mtx.TransactionHash)
+	assert.NotNil(t, mtx.LastSubmit)
+	assert.Equal(t, apitypes.TxActionSubmitted, mtx.History[0].Action)
+
+	mtx.FirstSubmit = mtx.LastSubmit
+	_, err = SubmitTransaction(context.Background(), mockFFCAPI, mtx)
+	assert.NoError(t, err)
+	assert.Equal(t, apitypes.TxActionResubmitted, mtx.History[1].Action)
+
+	mockFFCAPI.AssertExpectations(t)
+}
+
+func TestSubmitTransactionKnown(t *testing.T) {
+	mtx := newTestSubmitTX()
+
+	mockFFCAPI := &ffcapimocks.API{}
+	mockFFCAPI.On("TransactionSend", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorKnownTransaction, fmt.Errorf("known"))
+
+	// Without a transaction hash, we cannot tell it was our submission
+	reason, err := SubmitTransaction(context.Background(), mockFFCAPI, mtx)
+	assert.Regexp(t, "known", err)
+	assert.Equal(t, ffcapi.ErrorKnownTransaction, reason)
+
+	mtx.TransactionHash = "0x12345"
+	reason, err = SubmitTransaction(context.Background(), mockFFCAPI, mtx)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	assert.Empty(t, mtx.History)
+}
+
+func TestSubmitTransactionFail(t *testing.T) {
+	mtx := newTestSubmitTX()
+
+	mockFFCAPI := &ffcapimocks.API{}
+	mockFFCAPI.On("TransactionSend", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason("failed"), fmt.Errorf("pop"))
+
+	reason, err := SubmitTransaction(context.Background(), mockFFCAPI, mtx)
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, ffcapi.ErrorReason("failed"), reason)
+	assert.Empty(t, mtx.TransactionHash)
+}
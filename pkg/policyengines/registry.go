@@ -20,6 +20,7 @@ import (
 	"context"
 
 	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
 	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
@@ -36,6 +37,25 @@ func NewPolicyEngine(ctx context.Context, baseConfig config.Section, name string
 	return factory.NewPolicyEngine(ctx, baseConfig.SubSection(name))
 }
 
+// NewPolicyEngineWithOverrides constructs a policy engine with a set of runtime configuration overrides
+// applied on top of the static configuration, without modifying the static configuration. The base
+// configuration is that of the default policy engine, or of a named policy engine instance.
+func NewPolicyEngineWithOverrides(ctx context.Context, baseConfig config.Section, name string, overrides fftypes.JSONObject) (policyengine.PolicyEngine, error) {
+	factory, ok := policyEngines[name]
+	if !ok {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgPolicyEngineNotRegistered, name)
+	}
+	conf := newRuntimeConfigSection(baseConfig.SubSection(name), overrides)
+	pe, err := factory.NewPolicyEngine(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.arrayOverridesError(ctx); err != nil {
+		return nil, err
+	}
+	return pe, nil
+}
+
 type Factory interface {
 	Name() string
 	InitConfig(conf config.Section)
@@ -46,5 +66,6 @@ func RegisterEngine(factory Factory) string {
 	name := factory.Name()
 	policyEngines[name] = factory
 	factory.InitConfig(tmconfig.PolicyEngineBaseConfig.SubSection(name))
+	factory.InitConfig(tmconfig.PolicyEngineInstancesConfig.SubSection(name))
 	return name
 }
@@ -20,6 +20,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
 	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengines/simple"
 	"github.com/stretchr/testify/assert"
@@ -40,3 +41,60 @@ func TestRegistry(t *testing.T) {
 	assert.Regexp(t, "FF21019", err)
 
 }
+
+func TestRegistryWithOverrides(t *testing.T) {
+
+	tmconfig.Reset()
+	RegisterEngine(&simple.PolicyEngineFactory{})
+
+	p, err := NewPolicyEngineWithOverrides(context.Background(), tmconfig.PolicyEngineBaseConfig, "simple", fftypes.JSONObject{
+		"fixedGasPrice": 12345,
+		"gasOracle": map[string]interface{}{
+			"mode": "disabled",
+		},
+	})
+	assert.NotNil(t, p)
+	assert.NoError(t, err)
+
+	p, err = NewPolicyEngineWithOverrides(context.Background(), tmconfig.PolicyEngineBaseConfig, "simple", fftypes.JSONObject{
+		"gasOracle": map[string]interface{}{
+			"mode": "restapi",
+		},
+	})
+	assert.Nil(t, p)
+	assert.Regexp(t, "FF21024", err)
+
+	p, err = NewPolicyEngineWithOverrides(context.Background(), tmconfig.PolicyEngineBaseConfig, "simple", fftypes.JSONObject{
+		"fixedGasPrice": 12345,
+		"gasOracle": map[string]interface{}{
+			"sources": []interface{}{
+				map[string]interface{}{"type": "connector"},
+			},
+		},
+	})
+	assert.Nil(t, p)
+	assert.Regexp(t, "FF21133.*gasOracle.sources", err)
+
+	p, err = NewPolicyEngineWithOverrides(context.Background(), tmconfig.PolicyEngineBaseConfig, "bob", nil)
+	assert.Nil(t, p)
+	assert.Regexp(t, "FF21019", err)
+
+}
+
+func TestRegistryWithOverridesInstance(t *testing.T) {
+
+	tmconfig.Reset()
+	RegisterEngine(&simple.PolicyEngineFactory{})
+
+	// The overrides are applied on top of the configuration of the instance
+	instanceConfig := tmconfig.PolicyEngineInstancesConfig.ArrayEntry(0)
+	instanceConfig.SubSection("simple").Set(simple.FixedGasPrice, "12345")
+	p, err := NewPolicyEngineWithOverrides(context.Background(), instanceConfig, "simple", fftypes.JSONObject{
+		"gasOracle": map[string]interface{}{
+			"mode": "disabled",
+		},
+	})
+	assert.NotNil(t, p)
+	assert.NoError(t, err)
+
+}
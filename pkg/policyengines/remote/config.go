@@ -0,0 +1,37 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+)
+
+const (
+	FallbackGasPrice = "fallbackGasPrice" // when the remote policy engine cannot be reached, transactions are submitted for the first time locally with this gas price
+)
+
+const (
+	// The policy loop waits for each call to the remote policy engine, so we use a shorter default than other HTTP clients
+	defaultRequestTimeout = "10s"
+)
+
+func (f *PolicyEngineFactory) InitConfig(conf config.Section) {
+	ffresty.InitConfig(conf)
+	conf.AddKnownKey(ffresty.HTTPConfigRequestTimeout, defaultRequestTimeout)
+	conf.AddKnownKey(FallbackGasPrice)
+}
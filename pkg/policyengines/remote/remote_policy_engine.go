@@ -0,0 +1,163 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengine"
+)
+
+// UpdateType is the update instruction returned by the remote policy engine
+type UpdateType string
+
+const (
+	UpdateTypeNo     UpdateType = "no"
+	UpdateTypeYes    UpdateType = "yes"
+	UpdateTypeDelete UpdateType = "delete"
+)
+
+// ExecuteRequest is POSTed to the remote policy engine for each execution of the policy engine against a transaction
+type ExecuteRequest struct {
+	Transaction *apitypes.ManagedTX `json:"transaction"`
+	Time        *fftypes.FFTime     `json:"time"`
+}
+
+// ExecuteResponse is returned by the remote policy engine. The gas price and policy info are set on the
+// transaction if supplied. If submit is set, FFTM submits (or re-submits) the transaction via the connector
+// with the gas price of the transaction, and the transaction is always updated.
+type ExecuteResponse struct {
+	UpdateType UpdateType       `json:"updateType,omitempty"`
+	Submit     bool             `json:"submit,omitempty"`
+	GasPrice   *fftypes.JSONAny `json:"gasPrice,omitempty"`
+	PolicyInfo *fftypes.JSONAny `json:"policyInfo,omitempty"`
+}
+
+type PolicyEngineFactory struct{}
+
+func (f *PolicyEngineFactory) Name() string {
+	return "remote"
+}
+
+// remotePolicyEngine delegates the decisions of the policy engine to an external service over HTTP:
+// - The transaction is POSTed to the service on each execution
+// - The service returns the update to apply, and whether to submit the transaction
+// - All calls to the connector are made locally
+// - If the service cannot be reached, a local fallback can submit new transactions with a fixed gas price
+func (f *PolicyEngineFactory) NewPolicyEngine(ctx context.Context, conf config.Section) (pe policyengine.PolicyEngine, err error) {
+	if conf.GetString(ffresty.HTTPConfigURL) == "" {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgMissingRemotePolicyEngineURL)
+	}
+	p := &remotePolicyEngine{
+		client: ffresty.New(ctx, conf),
+	}
+	if fallbackGasPrice := conf.GetString(FallbackGasPrice); fallbackGasPrice != "" {
+		p.fallbackGasPrice = fftypes.JSONAnyPtr(fallbackGasPrice)
+	}
+	return p, nil
+}
+
+type remotePolicyEngine struct {
+	client           *resty.Client
+	fallbackGasPrice *fftypes.JSONAny
+}
+
+func (p *remotePolicyEngine) Execute(ctx context.Context, cAPI ffcapi.API, mtx *apitypes.ManagedTX) (update policyengine.UpdateType, reason ffcapi.ErrorReason, err error) {
+	res, err := p.invoke(ctx, mtx)
+	if err != nil {
+		return p.fallback(ctx, cAPI, mtx, err)
+	}
+
+	switch res.UpdateType {
+	case "", UpdateTypeNo:
+		update = policyengine.UpdateNo
+	case UpdateTypeYes:
+		update = policyengine.UpdateYes
+	case UpdateTypeDelete:
+		return policyengine.UpdateDelete, "", nil
+	default:
+		return p.fallback(ctx, cAPI, mtx, i18n.NewError(ctx, tmmsgs.MsgRemotePolicyEngineUpdateTypeInvalid, res.UpdateType))
+	}
+	if res.GasPrice != nil {
+		mtx.GasPrice = res.GasPrice
+	}
+	if res.PolicyInfo != nil {
+		mtx.PolicyInfo = res.PolicyInfo
+	}
+	if res.Submit {
+		return p.submitTX(ctx, cAPI, mtx)
+	}
+	return update, "", nil
+}
+
+func (p *remotePolicyEngine) invoke(ctx context.Context, mtx *apitypes.ManagedTX) (*ExecuteResponse, error) {
+	var res ExecuteResponse
+	httpRes, err := p.client.R().
+		SetContext(ctx).
+		SetBody(&ExecuteRequest{
+			Transaction: mtx,
+			Time:        fftypes.Now(),
+		}).
+		SetResult(&res).
+		Post("")
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgRemotePolicyEngineError, -1, err.Error())
+	}
+	if httpRes.IsError() {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgRemotePolicyEngineError, httpRes.StatusCode(), httpRes.String())
+	}
+	return &res, nil
+}
+
+func (p *remotePolicyEngine) submitTX(ctx context.Context, cAPI ffcapi.API, mtx *apitypes.ManagedTX) (policyengine.UpdateType, ffcapi.ErrorReason, error) {
+	if reason, err := policyengine.SubmitTransaction(ctx, cAPI, mtx); err != nil {
+		return policyengine.UpdateYes, reason, err
+	}
+	if mtx.FirstSubmit == nil {
+		mtx.FirstSubmit = mtx.LastSubmit
+	}
+	return policyengine.UpdateYes, "", nil
+}
+
+// fallback is used when the remote policy engine cannot be reached, or returns an invalid response. If a fallback
+// gas price is configured we submit new transactions, and complete deletions, locally. Otherwise the error is
+// returned, and the transaction is retried on the next policy loop cycle.
+func (p *remotePolicyEngine) fallback(ctx context.Context, cAPI ffcapi.API, mtx *apitypes.ManagedTX, err error) (policyengine.UpdateType, ffcapi.ErrorReason, error) {
+	switch {
+	case p.fallbackGasPrice == nil:
+		return policyengine.UpdateNo, "", err
+	case mtx.DeleteRequested != nil:
+		log.L(ctx).Warnf("Deleting transaction %s locally, as remote policy engine failed: %s", mtx.ID, err)
+		return policyengine.UpdateDelete, "", nil
+	case mtx.FirstSubmit == nil:
+		log.L(ctx).Warnf("Submitting transaction %s locally with fallback gas price, as remote policy engine failed: %s", mtx.ID, err)
+		mtx.GasPrice = p.fallbackGasPrice
+		return p.submitTX(ctx, cAPI, mtx)
+	default:
+		log.L(ctx).Warnf("No action for submitted transaction %s, as remote policy engine failed: %s", mtx.ID, err)
+		return policyengine.UpdateNo, "", nil
+	}
+}
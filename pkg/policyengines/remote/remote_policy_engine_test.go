@@ -0,0 +1,208 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/policyengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestPolicyEngineFactory(t *testing.T) (*PolicyEngineFactory, config.Section) {
+	tmconfig.Reset()
+	conf := config.RootSection("unittest.remote")
+	f := &PolicyEngineFactory{}
+	f.InitConfig(conf)
+	assert.Equal(t, "remote", f.Name())
+	return f, conf
+}
+
+func newTestRemotePolicyEngine(t *testing.T, handler func(req *ExecuteRequest) (int, interface{})) *remotePolicyEngine {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var req ExecuteRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		assert.NoError(t, err)
+		status, body := handler(&req)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+
+	f, conf := newTestPolicyEngineFactory(t)
+	conf.Set(ffresty.HTTPConfigURL, server.URL)
+	pe, err := f.NewPolicyEngine(context.Background(), conf)
+	assert.NoError(t, err)
+	return pe.(*remotePolicyEngine)
+}
+
+func newTestTX() *apitypes.ManagedTX {
+	return &apitypes.ManagedTX{
+		ID: "ns1:" + fftypes.NewUUID().String(),
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From: "0x6b7cfa4cf9709d3b3f5f7c22de123d2e16aee712",
+		},
+		Nonce:           fftypes.NewFFBigInt(12345),
+		Gas:             fftypes.NewFFBigInt(50000),
+		TransactionData: "0x01020304",
+	}
+}
+
+func TestMissingURL(t *testing.T) {
+	f, conf := newTestPolicyEngineFactory(t)
+	_, err := f.NewPolicyEngine(context.Background(), conf)
+	assert.Regexp(t, "FF21083", err)
+}
+
+func TestRemoteSubmitOK(t *testing.T) {
+	mtx := newTestTX()
+	p := newTestRemotePolicyEngine(t, func(req *ExecuteRequest) (int, interface{}) {
+		assert.Equal(t, mtx.ID, req.Transaction.ID)
+		assert.NotNil(t, req.Time)
+		return 200, &ExecuteResponse{
+			UpdateType: UpdateTypeYes,
+			Submit:     true,
+			GasPrice:   fftypes.JSONAnyPtr(`{"maxFeePerGas":12345}`),
+			PolicyInfo: fftypes.JSONAnyPtr(`{"attempt":1}`),
+		}
+	})
+
+	mockFFCAPI := &ffcapimocks.API{}
+	mockFFCAPI.On("TransactionSend", mock.Anything, mock.MatchedBy(func(req *ffcapi.TransactionSendRequest) bool {
+		return req.GasPrice.JSONObject().GetInt64("maxFeePerGas") == 12345
+	})).Return(&ffcapi.TransactionSendResponse{TransactionHash: "0x12345"}, ffcapi.ErrorReason(""), nil)
+
+	update, reason, err := p.Execute(context.Background(), mockFFCAPI, mtx)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+	assert.Equal(t, policyengine.UpdateYes, update)
+	assert.Equal(t, "0x12345", mtx.TransactionHash)
+	assert.NotNil(t, mtx.FirstSubmit)
+	assert.Equal(t, `{"attempt":1}`, mtx.PolicyInfo.String())
+
+	mockFFCAPI.AssertExpectations(t)
+}
+
+func TestRemoteSubmitFail(t *testing.T) {
+	p := newTestRemotePolicyEngine(t, func(req *ExecuteRequest) (int, interface{}) {
+		return 200, &ExecuteResponse{Submit: true}
+	})
+
+	mockFFCAPI := &ffcapimocks.API{}
+	mockFFCAPI.On("TransactionSend", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason("failed"), fmt.Errorf("pop"))
+
+	mtx := newTestTX()
+	update, reason, err := p.Execute(context.Background(), mockFFCAPI, mtx)
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, ffcapi.ErrorReason("failed"), reason)
+	assert.Equal(t, policyengine.UpdateYes, update)
+	assert.Nil(t, mtx.FirstSubmit)
+}
+
+func TestRemoteNoUpdate(t *testing.T) {
+	p := newTestRemotePolicyEngine(t, func(req *ExecuteRequest) (int, interface{}) {
+		return 200, &ExecuteResponse{}
+	})
+
+	update, _, err := p.Execute(context.Background(), &ffcapimocks.API{}, newTestTX())
+	assert.NoError(t, err)
+	assert.Equal(t, policyengine.UpdateNo, update)
+}
+
+func TestRemoteDelete(t *testing.T) {
+	p := newTestRemotePolicyEngine(t, func(req *ExecuteRequest) (int, interface{}) {
+		return 200, &ExecuteResponse{UpdateType: UpdateTypeDelete}
+	})
+
+	update, _, err := p.Execute(context.Background(), &ffcapimocks.API{}, newTestTX())
+	assert.NoError(t, err)
+	assert.Equal(t, policyengine.UpdateDelete, update)
+}
+
+func TestRemoteErrorNoFallback(t *testing.T) {
+	p := newTestRemotePolicyEngine(t, func(req *ExecuteRequest) (int, interface{}) {
+		return 500, map[string]string{"error": "pop"}
+	})
+
+	update, _, err := p.Execute(context.Background(), &ffcapimocks.API{}, newTestTX())
+	assert.Regexp(t, "FF21084.*500.*pop", err)
+	assert.Equal(t, policyengine.UpdateNo, update)
+}
+
+func TestRemoteUnreachableNoFallback(t *testing.T) {
+	f, conf := newTestPolicyEngineFactory(t)
+	conf.Set(ffresty.HTTPConfigURL, "http://localhost:0")
+	pe, err := f.NewPolicyEngine(context.Background(), conf)
+	assert.NoError(t, err)
+
+	update, _, err := pe.Execute(context.Background(), &ffcapimocks.API{}, newTestTX())
+	assert.Regexp(t, "FF21084", err)
+	assert.Equal(t, policyengine.UpdateNo, update)
+}
+
+func TestRemoteInvalidUpdateTypeFallback(t *testing.T) {
+	f, conf := newTestPolicyEngineFactory(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"updateType":"wrong"}`))
+	}))
+	defer server.Close()
+	conf.Set(ffresty.HTTPConfigURL, server.URL)
+	conf.Set(FallbackGasPrice, `12345`)
+	pe, err := f.NewPolicyEngine(context.Background(), conf)
+	assert.NoError(t, err)
+
+	mockFFCAPI := &ffcapimocks.API{}
+	mockFFCAPI.On("TransactionSend", mock.Anything, mock.MatchedBy(func(req *ffcapi.TransactionSendRequest) bool {
+		return req.GasPrice.String() == `12345`
+	})).Return(&ffcapi.TransactionSendResponse{TransactionHash: "0x12345"}, ffcapi.ErrorReason(""), nil)
+
+	// A new transaction is submitted locally
+	mtx := newTestTX()
+	update, _, err := pe.Execute(context.Background(), mockFFCAPI, mtx)
+	assert.NoError(t, err)
+	assert.Equal(t, policyengine.UpdateYes, update)
+	assert.NotNil(t, mtx.FirstSubmit)
+
+	// No action is taken for a submitted transaction
+	update, _, err = pe.Execute(context.Background(), mockFFCAPI, mtx)
+	assert.NoError(t, err)
+	assert.Equal(t, policyengine.UpdateNo, update)
+
+	// Deletion is completed locally
+	mtx.DeleteRequested = fftypes.Now()
+	update, _, err = pe.Execute(context.Background(), mockFFCAPI, mtx)
+	assert.NoError(t, err)
+	assert.Equal(t, policyengine.UpdateDelete, update)
+
+	mockFFCAPI.AssertNumberOfCalls(t, "TransactionSend", 1)
+}
@@ -0,0 +1,212 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyengines
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/spf13/cast"
+)
+
+// runtimeConfigSection applies a JSON object of runtime overrides on top of a section of the static
+// configuration. The global configuration is never modified, so a policy engine can be constructed
+// (and validated) with a new configuration, without affecting the running policy engine.
+//
+// Keys can be nested objects in the overrides, or dotted keys (such as "auth.username") that are
+// resolved by walking the nested objects.
+//
+// Arrays cannot be overridden, as their entries cannot be merged with those of the static configuration.
+// Overrides of the arrays read by the policy engine are recorded, and rejected by arrayOverridesError.
+type runtimeConfigSection struct {
+	config.Section
+	prefix         string
+	overrides      fftypes.JSONObject
+	arrayOverrides *[]string // shared by all the sub-sections
+}
+
+func newRuntimeConfigSection(base config.Section, overrides fftypes.JSONObject) *runtimeConfigSection {
+	return newRuntimeConfigSubSection(base, "", overrides, &[]string{})
+}
+
+func newRuntimeConfigSubSection(base config.Section, prefix string, overrides fftypes.JSONObject, arrayOverrides *[]string) *runtimeConfigSection {
+	if overrides == nil {
+		overrides = fftypes.JSONObject{}
+	}
+	return &runtimeConfigSection{
+		Section:        base,
+		prefix:         prefix,
+		overrides:      overrides,
+		arrayOverrides: arrayOverrides,
+	}
+}
+
+// arrayOverridesError returns an error if the overrides included any of the arrays read from the configuration
+func (rc *runtimeConfigSection) arrayOverridesError(ctx context.Context) error {
+	if len(*rc.arrayOverrides) > 0 {
+		return i18n.NewError(ctx, tmmsgs.MsgPolicyEngineConfigArrayOverride, (*rc.arrayOverrides)[0])
+	}
+	return nil
+}
+
+func asObject(v interface{}) (fftypes.JSONObject, bool) {
+	switch vt := v.(type) {
+	case fftypes.JSONObject:
+		return vt, true
+	case map[string]interface{}:
+		return vt, true
+	default:
+		return nil, false
+	}
+}
+
+func (rc *runtimeConfigSection) lookup(key string) (interface{}, bool) {
+	parts := strings.Split(key, ".")
+	obj := rc.overrides
+	for _, part := range parts[0 : len(parts)-1] {
+		var ok bool
+		if obj, ok = asObject(obj[part]); !ok {
+			return nil, false
+		}
+	}
+	v := obj[parts[len(parts)-1]]
+	return v, v != nil
+}
+
+func (rc *runtimeConfigSection) SubSection(name string) config.Section {
+	subOverrides, _ := asObject(rc.overrides[name])
+	return newRuntimeConfigSubSection(rc.Section.SubSection(name), rc.prefix+name+".", subOverrides, rc.arrayOverrides)
+}
+
+func (rc *runtimeConfigSection) SubArray(name string) config.ArraySection {
+	if _, ok := rc.lookup(name); ok {
+		*rc.arrayOverrides = append(*rc.arrayOverrides, rc.prefix+name)
+	}
+	return rc.Section.SubArray(name)
+}
+
+func (rc *runtimeConfigSection) Set(key string, value interface{}) {
+	rc.overrides[key] = value
+}
+
+func (rc *runtimeConfigSection) IsSet(key string) bool {
+	if _, ok := rc.lookup(key); ok {
+		return true
+	}
+	return rc.Section.IsSet(key)
+}
+
+func (rc *runtimeConfigSection) GetString(key string) string {
+	if v, ok := rc.lookup(key); ok {
+		switch vt := v.(type) {
+		case string:
+			return vt
+		case fftypes.JSONObject, map[string]interface{}, []interface{}, float64:
+			// Raw JSON values (such as a fixed gas price structure) are passed through
+			b, _ := json.Marshal(vt)
+			return string(b)
+		default:
+			return cast.ToString(vt)
+		}
+	}
+	return rc.Section.GetString(key)
+}
+
+func (rc *runtimeConfigSection) GetBool(key string) bool {
+	if v, ok := rc.lookup(key); ok {
+		return cast.ToBool(v)
+	}
+	return rc.Section.GetBool(key)
+}
+
+func (rc *runtimeConfigSection) GetInt(key string) int {
+	if v, ok := rc.lookup(key); ok {
+		return cast.ToInt(v)
+	}
+	return rc.Section.GetInt(key)
+}
+
+func (rc *runtimeConfigSection) GetInt64(key string) int64 {
+	if v, ok := rc.lookup(key); ok {
+		return cast.ToInt64(v)
+	}
+	return rc.Section.GetInt64(key)
+}
+
+func (rc *runtimeConfigSection) GetFloat64(key string) float64 {
+	if v, ok := rc.lookup(key); ok {
+		return cast.ToFloat64(v)
+	}
+	return rc.Section.GetFloat64(key)
+}
+
+func (rc *runtimeConfigSection) GetByteSize(key string) int64 {
+	if v, ok := rc.lookup(key); ok {
+		return fftypes.ParseToByteSize(cast.ToString(v))
+	}
+	return rc.Section.GetByteSize(key)
+}
+
+func (rc *runtimeConfigSection) GetUint(key string) uint {
+	if v, ok := rc.lookup(key); ok {
+		return cast.ToUint(v)
+	}
+	return rc.Section.GetUint(key)
+}
+
+func (rc *runtimeConfigSection) GetDuration(key string) time.Duration {
+	if v, ok := rc.lookup(key); ok {
+		return fftypes.ParseToDuration(cast.ToString(v))
+	}
+	return rc.Section.GetDuration(key)
+}
+
+func (rc *runtimeConfigSection) GetStringSlice(key string) []string {
+	if v, ok := rc.lookup(key); ok {
+		return cast.ToStringSlice(v)
+	}
+	return rc.Section.GetStringSlice(key)
+}
+
+func (rc *runtimeConfigSection) GetObject(key string) fftypes.JSONObject {
+	if v, ok := rc.lookup(key); ok {
+		obj, _ := asObject(v)
+		return obj
+	}
+	return rc.Section.GetObject(key)
+}
+
+func (rc *runtimeConfigSection) GetObjectArray(key string) fftypes.JSONObjectArray {
+	if v, ok := rc.lookup(key); ok {
+		arr, _ := fftypes.ToJSONObjectArray(v)
+		return arr
+	}
+	return rc.Section.GetObjectArray(key)
+}
+
+func (rc *runtimeConfigSection) Get(key string) interface{} {
+	if v, ok := rc.lookup(key); ok {
+		return v
+	}
+	return rc.Section.Get(key)
+}
@@ -0,0 +1,151 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policyengines
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeConfigSectionOverrides(t *testing.T) {
+
+	config.RootConfigReset()
+	base := config.RootSection("utruntime")
+	base.AddKnownKey("string", "base")
+	base.AddKnownKey("raw")
+	base.AddKnownKey("bool", false)
+	base.AddKnownKey("int", 1)
+	base.AddKnownKey("int64", 2)
+	base.AddKnownKey("float", 3.0)
+	base.AddKnownKey("bytesize", "1kb")
+	base.AddKnownKey("uint", 4)
+	base.AddKnownKey("duration", "5s")
+	base.AddKnownKey("slice", []string{"a"})
+	base.AddKnownKey("object")
+	base.AddKnownKey("objarray")
+	base.AddKnownKey("auth.username", "user1")
+	base.SubSection("sub").AddKnownKey("key", "base")
+
+	rc := newRuntimeConfigSection(base, fftypes.JSONObject{
+		"string":   "override",
+		"raw":      map[string]interface{}{"maxFeePerGas": 12345},
+		"bool":     true,
+		"int":      10,
+		"int64":    20,
+		"float":    30.5,
+		"bytesize": "2kb",
+		"uint":     40,
+		"duration": "50s",
+		"slice":    []interface{}{"b", "c"},
+		"object":   map[string]interface{}{"a": "b"},
+		"objarray": []interface{}{map[string]interface{}{"a": "b"}},
+		"auth":     map[string]interface{}{"username": "user2"},
+		"sub":      fftypes.JSONObject{"key": "override"},
+		"nothing":  nil,
+	})
+
+	assert.Equal(t, "override", rc.GetString("string"))
+	assert.Equal(t, `{"maxFeePerGas":12345}`, rc.GetString("raw"))
+	assert.True(t, rc.GetBool("bool"))
+	assert.Equal(t, 10, rc.GetInt("int"))
+	assert.Equal(t, int64(20), rc.GetInt64("int64"))
+	assert.Equal(t, 30.5, rc.GetFloat64("float"))
+	assert.Equal(t, int64(2048), rc.GetByteSize("bytesize"))
+	assert.Equal(t, uint(40), rc.GetUint("uint"))
+	assert.Equal(t, 50*time.Second, rc.GetDuration("duration"))
+	assert.Equal(t, []string{"b", "c"}, rc.GetStringSlice("slice"))
+	assert.Equal(t, "b", rc.GetObject("object").GetString("a"))
+	assert.Len(t, rc.GetObjectArray("objarray"), 1)
+	assert.Equal(t, "user2", rc.GetString("auth.username"))
+	assert.Equal(t, "override", rc.SubSection("sub").GetString("key"))
+	assert.Equal(t, 10, rc.Get("int"))
+	assert.True(t, rc.IsSet("int"))
+	assert.False(t, rc.IsSet("nothing"))
+	assert.False(t, rc.IsSet("string.notobject"))
+
+	rc.Set("int", 11)
+	assert.Equal(t, 11, rc.GetInt("int"))
+	assert.Equal(t, 1, base.GetInt("int"))
+
+}
+
+func TestRuntimeConfigSectionFallback(t *testing.T) {
+
+	config.RootConfigReset()
+	base := config.RootSection("utruntime")
+	base.AddKnownKey("string", "base")
+	base.AddKnownKey("bool", true)
+	base.AddKnownKey("int", 1)
+	base.AddKnownKey("int64", 2)
+	base.AddKnownKey("float", 3.0)
+	base.AddKnownKey("bytesize", "1kb")
+	base.AddKnownKey("uint", 4)
+	base.AddKnownKey("duration", "5s")
+	base.AddKnownKey("slice", []string{"a"})
+	base.AddKnownKey("object")
+	base.AddKnownKey("objarray")
+	base.AddKnownKey("auth.username", "user1")
+	base.SubSection("sub").AddKnownKey("key", "base")
+
+	rc := newRuntimeConfigSection(base, nil)
+
+	assert.Equal(t, "base", rc.GetString("string"))
+	assert.True(t, rc.GetBool("bool"))
+	assert.Equal(t, 1, rc.GetInt("int"))
+	assert.Equal(t, int64(2), rc.GetInt64("int64"))
+	assert.Equal(t, 3.0, rc.GetFloat64("float"))
+	assert.Equal(t, int64(1024), rc.GetByteSize("bytesize"))
+	assert.Equal(t, uint(4), rc.GetUint("uint"))
+	assert.Equal(t, 5*time.Second, rc.GetDuration("duration"))
+	assert.Equal(t, []string{"a"}, rc.GetStringSlice("slice"))
+	assert.Empty(t, rc.GetObject("object"))
+	assert.Empty(t, rc.GetObjectArray("objarray"))
+	assert.Equal(t, "user1", rc.GetString("auth.username"))
+	assert.Equal(t, "base", rc.SubSection("sub").GetString("key"))
+	assert.Equal(t, "base", rc.Get("string"))
+
+}
+
+func TestRuntimeConfigSectionArrayOverride(t *testing.T) {
+
+	config.RootConfigReset()
+	base := config.RootSection("utruntime")
+	base.SubSection("sub").SubArray("list").AddKnownKey("key", "base")
+	base.SubArray("other").AddKnownKey("key", "base")
+
+	rc := newRuntimeConfigSection(base, fftypes.JSONObject{
+		"sub": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{"key": "override"},
+			},
+		},
+	})
+
+	// Arrays without overrides are read from the static configuration
+	assert.Equal(t, 0, rc.SubArray("other").ArraySize())
+	assert.NoError(t, rc.arrayOverridesError(context.Background()))
+
+	// The override of an array is not applied, and is reported
+	assert.Equal(t, 0, rc.SubSection("sub").SubArray("list").ArraySize())
+	assert.Regexp(t, "FF21133.*sub.list", rc.arrayOverridesError(context.Background()))
+
+}
@@ -31,6 +31,12 @@ const (
 	GasOracleMethod        = "method"
 	GasOracleTemplate      = "template"
 	GasOracleQueryInterval = "queryInterval"
+	GasOracleAggregation   = "aggregation"
+	GasOracleFloor         = "floor"
+	GasOracleCeiling       = "ceiling"
+	GasOracleSources       = "sources"
+	GasOracleSourceName    = "name"
+	GasOracleSourceType    = "type"
 )
 
 const (
@@ -39,11 +45,18 @@ const (
 	GasOracleModeConnector = "connector"
 )
 
+const (
+	GasOracleAggregationFirstSuccess = "firstSuccess"
+	GasOracleAggregationMedian       = "median"
+	GasOracleAggregationMax          = "max"
+)
+
 const (
 	defaultResubmitInterval       = "5m"
 	defaultGasOracleQueryInterval = "5m"
 	defaultGasOracleMethod        = http.MethodGet
 	defaultGasOracleMode          = GasOracleModeConnector
+	defaultGasOracleAggregation   = GasOracleAggregationFirstSuccess
 )
 
 func (f *PolicyEngineFactory) InitConfig(conf config.Section) {
@@ -56,5 +69,19 @@ func (f *PolicyEngineFactory) InitConfig(conf config.Section) {
 	gasOracleConfig.AddKnownKey(GasOracleMode, defaultGasOracleMode)
 	gasOracleConfig.AddKnownKey(GasOracleQueryInterval, defaultGasOracleQueryInterval)
 	gasOracleConfig.AddKnownKey(GasOracleTemplate)
+	gasOracleConfig.AddKnownKey(GasOracleAggregation, defaultGasOracleAggregation)
+	gasOracleConfig.AddKnownKey(GasOracleFloor)
+	gasOracleConfig.AddKnownKey(GasOracleCeiling)
+
+	initGasSourcesConfig(gasOracleConfig.SubArray(GasOracleSources))
+}
 
+// initGasSourcesConfig registers the keys of each gas source. Known keys are held on the array
+// section itself, so this is also called on the array used to read the configured sources.
+func initGasSourcesConfig(sourcesConfig config.ArraySection) {
+	ffresty.InitConfig(sourcesConfig)
+	sourcesConfig.AddKnownKey(GasOracleSourceName)
+	sourcesConfig.AddKnownKey(GasOracleSourceType)
+	sourcesConfig.AddKnownKey(GasOracleMethod, defaultGasOracleMethod)
+	sourcesConfig.AddKnownKey(GasOracleTemplate)
 }
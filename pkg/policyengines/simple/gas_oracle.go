@@ -0,0 +1,268 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simple
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffresty"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmmsgs"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/apitypes"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+)
+
+// gasSource is one of the sources of gas price queried by the gas oracle
+type gasSource struct {
+	name       string
+	sourceType string
+	client     *resty.Client
+	method     string
+	template   *template.Template
+
+	// status of the last query, protected by the gasOracleMux of the policy engine
+	healthy       bool
+	lastValue     *fftypes.JSONAny
+	lastSuccess   *fftypes.FFTime
+	lastError     string
+	lastErrorTime *fftypes.FFTime
+}
+
+// gasPriceValue is a gas price, with its numeric value when that is required for aggregation or limits
+type gasPriceValue struct {
+	raw *fftypes.JSONAny
+	num *big.Float
+}
+
+// initGasOracle builds the list of gas sources. A list of sources can be configured, or otherwise the
+// single source set by the gas oracle mode is used.
+func (p *simplePolicyEngine) initGasOracle(ctx context.Context, conf config.Section) (err error) {
+	sourcesConfig := conf.SubArray(GasOracleSources)
+	initGasSourcesConfig(sourcesConfig)
+	sourceCount := sourcesConfig.ArraySize()
+	if sourceCount > 0 {
+		for i := 0; i < sourceCount; i++ {
+			sourceConfig := sourcesConfig.ArrayEntry(i)
+			name := sourceConfig.GetString(GasOracleSourceName)
+			if name == "" {
+				name = fmt.Sprintf("%s[%d]", GasOracleSources, i)
+			}
+			s, err := newGasSource(ctx, name, sourceConfig.GetString(GasOracleSourceType), sourceConfig)
+			if err != nil {
+				return err
+			}
+			p.gasSources = append(p.gasSources, s)
+		}
+	} else {
+		switch mode := conf.GetString(GasOracleMode); mode {
+		case GasOracleModeConnector, GasOracleModeRESTAPI:
+			s, err := newGasSource(ctx, mode, mode, conf)
+			if err != nil {
+				return err
+			}
+			p.gasSources = []*gasSource{s}
+		}
+	}
+
+	switch p.gasOracleAggregation {
+	case GasOracleAggregationFirstSuccess, GasOracleAggregationMedian, GasOracleAggregationMax:
+	default:
+		return i18n.NewError(ctx, tmmsgs.MsgGasOracleAggregationInvalid, p.gasOracleAggregation)
+	}
+	if p.gasOracleFloor, err = parseGasPriceLimit(ctx, GasOracleFloor, conf.GetString(GasOracleFloor)); err != nil {
+		return err
+	}
+	p.gasOracleCeiling, err = parseGasPriceLimit(ctx, GasOracleCeiling, conf.GetString(GasOracleCeiling))
+	return err
+}
+
+func newGasSource(ctx context.Context, name, sourceType string, conf config.Section) (s *gasSource, err error) {
+	s = &gasSource{
+		name:       name,
+		sourceType: sourceType,
+	}
+	switch sourceType {
+	case GasOracleModeConnector:
+		// No initialization required
+	case GasOracleModeRESTAPI:
+		s.client = ffresty.New(ctx, conf)
+		s.method = conf.GetString(GasOracleMethod)
+		templateString := conf.GetString(GasOracleTemplate)
+		if templateString == "" {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgMissingGOTemplate)
+		}
+		s.template, err = template.New("").Funcs(sprig.FuncMap()).Parse(templateString)
+		if err != nil {
+			return nil, i18n.NewError(ctx, tmmsgs.MsgBadGOTemplate, err)
+		}
+	default:
+		return nil, i18n.NewError(ctx, tmmsgs.MsgGasOracleSourceTypeInvalid, sourceType, name)
+	}
+	return s, nil
+}
+
+func parseGasPriceLimit(ctx context.Context, name, value string) (*gasPriceValue, error) {
+	if value == "" {
+		return nil, nil
+	}
+	raw := fftypes.JSONAnyPtr(value)
+	num, err := parseGasPriceNumber(ctx, name, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &gasPriceValue{raw: raw, num: num}, nil
+}
+
+// parseGasPriceNumber accepts a JSON number, or a JSON string containing a decimal or 0x prefixed hex number
+func parseGasPriceNumber(ctx context.Context, name string, raw *fftypes.JSONAny) (*big.Float, error) {
+	str := strings.TrimSpace(raw.String())
+	var jsonString string
+	if err := json.Unmarshal([]byte(str), &jsonString); err == nil {
+		str = jsonString
+	}
+	num, ok := new(big.Float).SetString(str)
+	if !ok {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgGasPriceNotNumeric, name, raw)
+	}
+	return num, nil
+}
+
+func (s *gasSource) query(ctx context.Context, cAPI ffcapi.API) (*fftypes.JSONAny, error) {
+	if s.sourceType == GasOracleModeConnector {
+		res, _, err := cAPI.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
+		if err != nil {
+			return nil, err
+		}
+		return res.GasPrice, nil
+	}
+
+	// Make a REST call against an endpoint, and extract a value/structure to pass to the connector
+	var jsonResponse map[string]interface{}
+	res, err := s.client.R().
+		SetResult(&jsonResponse).
+		Execute(s.method, "")
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgErrorQueryingGasOracleAPI, -1, err.Error())
+	}
+	if res.IsError() {
+		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgErrorQueryingGasOracleAPI, res.StatusCode(), res.RawResponse)
+	}
+	buff := new(bytes.Buffer)
+	err = s.template.Execute(buff, jsonResponse)
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgGasOracleResultError)
+	}
+	return fftypes.JSONAnyPtr(buff.String()), nil
+}
+
+// recordResult must be called holding the gasOracleMux of the policy engine
+func (s *gasSource) recordResult(value *fftypes.JSONAny, err error) {
+	s.healthy = err == nil
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorTime = fftypes.Now()
+	} else {
+		s.lastValue = value
+		s.lastSuccess = fftypes.Now()
+	}
+}
+
+// queryGasSources queries the sources in order, and aggregates the results. For first-success only
+// the sources up to the first that succeeds are queried. Must be called without holding gasOracleMux,
+// so the status of the sources can be reported while they are queried.
+func (p *simplePolicyEngine) queryGasSources(ctx context.Context, cAPI ffcapi.API) (*fftypes.JSONAny, error) {
+	needNumeric := p.gasOracleAggregation != GasOracleAggregationFirstSuccess || p.gasOracleFloor != nil || p.gasOracleCeiling != nil
+	var values []*gasPriceValue
+	var lastErr error
+	for _, s := range p.gasSources {
+		v := &gasPriceValue{}
+		var err error
+		v.raw, err = s.query(ctx, cAPI)
+		if err == nil && needNumeric {
+			v.num, err = parseGasPriceNumber(ctx, s.name, v.raw)
+		}
+		p.gasOracleMux.Lock()
+		s.recordResult(v.raw, err)
+		p.gasOracleMux.Unlock()
+		if err != nil {
+			log.L(ctx).Warnf("Gas oracle source '%s' failed: %s", s.name, err)
+			lastErr = err
+			continue
+		}
+		values = append(values, v)
+		if p.gasOracleAggregation == GasOracleAggregationFirstSuccess {
+			break
+		}
+	}
+	if len(values) == 0 {
+		return nil, lastErr
+	}
+
+	result := values[0]
+	if p.gasOracleAggregation != GasOracleAggregationFirstSuccess {
+		sort.SliceStable(values, func(i, j int) bool { return values[i].num.Cmp(values[j].num) < 0 })
+		if p.gasOracleAggregation == GasOracleAggregationMedian {
+			// For an even number of values this is the higher of the two middle values
+			result = values[len(values)/2]
+		} else {
+			result = values[len(values)-1]
+		}
+	}
+	if p.gasOracleFloor != nil && result.num.Cmp(p.gasOracleFloor.num) < 0 {
+		result = p.gasOracleFloor
+	}
+	if p.gasOracleCeiling != nil && result.num.Cmp(p.gasOracleCeiling.num) > 0 {
+		result = p.gasOracleCeiling
+	}
+	return result.raw, nil
+}
+
+// GasOracleStatus reports the status of each gas oracle source, from the most recent queries
+func (p *simplePolicyEngine) GasOracleStatus(ctx context.Context) *apitypes.GasOracleStatus {
+	p.gasOracleMux.Lock()
+	defer p.gasOracleMux.Unlock()
+	status := &apitypes.GasOracleStatus{
+		Aggregation: p.gasOracleAggregation,
+		LastValue:   p.gasOracleQueryValue,
+		LastQuery:   p.gasOracleLastQueryTime,
+		Sources:     make([]*apitypes.GasOracleSourceStatus, len(p.gasSources)),
+	}
+	for i, s := range p.gasSources {
+		status.Sources[i] = &apitypes.GasOracleSourceStatus{
+			Name:          s.name,
+			Type:          s.sourceType,
+			Healthy:       s.healthy,
+			LastValue:     s.lastValue,
+			LastSuccess:   s.lastSuccess,
+			LastError:     s.lastError,
+			LastErrorTime: s.lastErrorTime,
+		}
+	}
+	return status
+}
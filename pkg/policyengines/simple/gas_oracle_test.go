@@ -0,0 +1,372 @@
+// Copyright © 2022 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simple
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-transaction-manager/internal/tmconfig"
+	"github.com/hyperledger/firefly-transaction-manager/mocks/ffcapimocks"
+	"github.com/hyperledger/firefly-transaction-manager/pkg/ffcapi"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestGasServer(t *testing.T, price string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(fmt.Sprintf(`{"price": %s}`, price)))
+	}))
+	t.Cleanup(server.Close)
+	return fmt.Sprintf("http://%s", server.Listener.Addr())
+}
+
+func newTestGasOracleEngine(t *testing.T, yaml string) (*simplePolicyEngine, error) {
+	tmconfig.Reset()
+	conf := config.RootSection("unittest.simple")
+	f := &PolicyEngineFactory{}
+	f.InitConfig(conf)
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	pe, err := f.NewPolicyEngine(context.Background(), conf)
+	if err != nil {
+		return nil, err
+	}
+	return pe.(*simplePolicyEngine), nil
+}
+
+func mockConnectorGasPrice(price string, err error) *ffcapimocks.API {
+	mockFFCAPI := &ffcapimocks.API{}
+	if err != nil {
+		mockFFCAPI.On("GasPriceEstimate", mock.Anything, mock.Anything).Return(nil, ffcapi.ErrorReason(""), err)
+	} else {
+		mockFFCAPI.On("GasPriceEstimate", mock.Anything, mock.Anything).Return(&ffcapi.GasPriceEstimateResponse{
+			GasPrice: fftypes.JSONAnyPtr(price),
+		}, ffcapi.ErrorReason(""), nil)
+	}
+	return mockFFCAPI
+}
+
+func TestGasOracleFirstSuccessFallsThrough(t *testing.T) {
+	url := newTestGasServer(t, "2000")
+	p, err := newTestGasOracleEngine(t, fmt.Sprintf(`
+unittest:
+  simple:
+    gasOracle:
+      sources:
+      - name: node
+        type: connector
+      - name: station
+        type: restapi
+        url: %s
+        template: '{{ .price }}'
+      - name: unused
+        type: connector
+`, url))
+	assert.NoError(t, err)
+
+	gasPrice, err := p.getGasPrice(context.Background(), mockConnectorGasPrice("", fmt.Errorf("pop")))
+	assert.NoError(t, err)
+	assert.Equal(t, "2000", gasPrice.String())
+
+	status := p.GasOracleStatus(context.Background())
+	assert.Equal(t, GasOracleAggregationFirstSuccess, status.Aggregation)
+	assert.Equal(t, "2000", status.LastValue.String())
+	assert.NotNil(t, status.LastQuery)
+	assert.Len(t, status.Sources, 3)
+	assert.Equal(t, "node", status.Sources[0].Name)
+	assert.False(t, status.Sources[0].Healthy)
+	assert.Regexp(t, "pop", status.Sources[0].LastError)
+	assert.NotNil(t, status.Sources[0].LastErrorTime)
+	assert.Equal(t, "station", status.Sources[1].Name)
+	assert.Equal(t, GasOracleModeRESTAPI, status.Sources[1].Type)
+	assert.True(t, status.Sources[1].Healthy)
+	assert.Equal(t, "2000", status.Sources[1].LastValue.String())
+	assert.NotNil(t, status.Sources[1].LastSuccess)
+	assert.False(t, status.Sources[2].Healthy)
+	assert.Nil(t, status.Sources[2].LastSuccess)
+}
+
+func TestGasOracleMedianAndMax(t *testing.T) {
+	url1 := newTestGasServer(t, "3000")
+	url2 := newTestGasServer(t, `"0x3e8"`)
+	sources := fmt.Sprintf(`
+      sources:
+      - type: connector
+      - type: restapi
+        url: %s
+        template: '{{ .price }}'
+      - type: restapi
+        url: %s
+        template: '"{{ .price }}"'
+`, url1, url2)
+
+	p, err := newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      aggregation: median`+sources)
+	assert.NoError(t, err)
+	gasPrice, err := p.queryGasSources(context.Background(), mockConnectorGasPrice(`"2000"`, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, `"2000"`, gasPrice.String())
+	assert.Equal(t, "sources[1]", p.GasOracleStatus(context.Background()).Sources[1].Name)
+
+	p, err = newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      aggregation: max`+sources)
+	assert.NoError(t, err)
+	gasPrice, err = p.queryGasSources(context.Background(), mockConnectorGasPrice(`"2000"`, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "3000", gasPrice.String())
+}
+
+func TestGasOracleMedianEvenSkipsNonNumeric(t *testing.T) {
+	url := newTestGasServer(t, "3000")
+	p, err := newTestGasOracleEngine(t, fmt.Sprintf(`
+unittest:
+  simple:
+    gasOracle:
+      aggregation: median
+      sources:
+      - type: connector
+      - type: restapi
+        url: %s
+        template: '{{ .price }}'
+      - type: restapi
+        url: %s
+        template: '{"maxFeePerGas": {{ .price }}}'
+`, url, url))
+	assert.NoError(t, err)
+
+	// The higher of the two middle values is used
+	gasPrice, err := p.queryGasSources(context.Background(), mockConnectorGasPrice("1000", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "3000", gasPrice.String())
+
+	status := p.GasOracleStatus(context.Background())
+	assert.False(t, status.Sources[2].Healthy)
+	assert.Regexp(t, "FF21081", status.Sources[2].LastError)
+}
+
+func TestGasOracleFloorAndCeiling(t *testing.T) {
+	p, err := newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      mode: connector
+      floor: 1000
+      ceiling: '"5000"'
+`)
+	assert.NoError(t, err)
+
+	gasPrice, err := p.queryGasSources(context.Background(), mockConnectorGasPrice("999", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "1000", gasPrice.String())
+
+	gasPrice, err = p.queryGasSources(context.Background(), mockConnectorGasPrice("3000", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "3000", gasPrice.String())
+
+	gasPrice, err = p.queryGasSources(context.Background(), mockConnectorGasPrice(`"0x1389"`, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, `"5000"`, gasPrice.String())
+}
+
+func TestGasOracleFixedFallback(t *testing.T) {
+	p, err := newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    fixedGasPrice: 12345
+    gasOracle:
+      mode: connector
+`)
+	assert.NoError(t, err)
+
+	mockFFCAPI := mockConnectorGasPrice("", fmt.Errorf("pop"))
+	gasPrice, err := p.getGasPrice(context.Background(), mockFFCAPI)
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", gasPrice.String())
+	assert.Nil(t, p.gasOracleQueryValue)
+
+	// The failure is cached, so the fallback is used without querying the sources again until the interval passes
+	gasPrice, err = p.getGasPrice(context.Background(), mockFFCAPI)
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", gasPrice.String())
+	mockFFCAPI.AssertNumberOfCalls(t, "GasPriceEstimate", 1)
+
+	lastQuery := fftypes.FFTime(time.Now().Add(-1 * time.Hour))
+	p.gasOracleLastQueryTime = &lastQuery
+	gasPrice, err = p.getGasPrice(context.Background(), mockConnectorGasPrice("23456", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "23456", gasPrice.String())
+}
+
+func TestGasOracleFailureCachedNoFallback(t *testing.T) {
+	p, err := newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      mode: connector
+`)
+	assert.NoError(t, err)
+
+	mockFFCAPI := mockConnectorGasPrice("", fmt.Errorf("pop"))
+	for i := 0; i < 2; i++ {
+		_, err = p.getGasPrice(context.Background(), mockFFCAPI)
+		assert.Regexp(t, "pop", err)
+	}
+	mockFFCAPI.AssertNumberOfCalls(t, "GasPriceEstimate", 1)
+}
+
+func TestGasOracleSingleQuery(t *testing.T) {
+	p, err := newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      mode: connector
+`)
+	assert.NoError(t, err)
+
+	// A query of the sources that blocks until we release it
+	querying := make(chan struct{})
+	release := make(chan struct{})
+	mockFFCAPI := &ffcapimocks.API{}
+	mockFFCAPI.On("GasPriceEstimate", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		close(querying)
+		<-release
+	}).Return(&ffcapi.GasPriceEstimateResponse{GasPrice: fftypes.JSONAnyPtr("2000")}, ffcapi.ErrorReason(""), nil).Once()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gasPrice, err := p.getGasPrice(context.Background(), mockFFCAPI)
+		assert.NoError(t, err)
+		assert.Equal(t, "2000", gasPrice.String())
+	}()
+	<-querying
+
+	// The status is available while the sources are queried
+	status := p.GasOracleStatus(context.Background())
+	assert.Nil(t, status.LastValue)
+
+	// Without a previous value, other workers wait for the query in progress rather than querying themselves
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.getGasPrice(ctx, mockFFCAPI)
+	assert.Regexp(t, "FF00154", err)
+
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		gasPrice, err := p.getGasPrice(context.Background(), mockFFCAPI)
+		assert.NoError(t, err)
+		assert.Equal(t, "2000", gasPrice.String())
+	}()
+	close(release)
+	<-done
+	<-waited
+
+	// With a previous value, other workers use it while the query is in progress
+	lastQuery := fftypes.FFTime(time.Now().Add(-1 * time.Hour))
+	p.gasOracleLastQueryTime = &lastQuery
+	p.gasOracleQuerying = make(chan struct{})
+	gasPrice, err := p.getGasPrice(context.Background(), mockFFCAPI)
+	assert.NoError(t, err)
+	assert.Equal(t, "2000", gasPrice.String())
+
+	mockFFCAPI.AssertExpectations(t)
+}
+
+func TestGasOracleCancelledQueryNotCached(t *testing.T) {
+	p, err := newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    fixedGasPrice: 12345
+    gasOracle:
+      mode: connector
+`)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.getGasPrice(ctx, mockConnectorGasPrice("", fmt.Errorf("pop")))
+	assert.Regexp(t, "pop", err)
+	assert.Nil(t, p.gasOracleLastQueryTime)
+	assert.Nil(t, p.gasOracleQuerying)
+
+	gasPrice, err := p.getGasPrice(context.Background(), mockConnectorGasPrice("23456", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "23456", gasPrice.String())
+}
+
+func TestGasOracleConfigErrors(t *testing.T) {
+	_, err := newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      sources:
+      - name: wrong
+        type: wrong
+`)
+	assert.Regexp(t, "FF21079.*wrong", err)
+
+	_, err = newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      sources:
+      - type: restapi
+`)
+	assert.Regexp(t, "FF21024", err)
+
+	_, err = newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      aggregation: wrong
+`)
+	assert.Regexp(t, "FF21080", err)
+
+	_, err = newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      floor: '{"not":"numeric"}'
+`)
+	assert.Regexp(t, "FF21081.*floor", err)
+
+	_, err = newTestGasOracleEngine(t, `
+unittest:
+  simple:
+    gasOracle:
+      ceiling: wrong
+`)
+	assert.Regexp(t, "FF21081.*ceiling", err)
+}
@@ -17,16 +17,12 @@
 package simple
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"html/template"
+	"sync"
 	"time"
 
-	"github.com/Masterminds/sprig/v3"
-	"github.com/go-resty/resty/v2"
 	"github.com/hyperledger/firefly-common/pkg/config"
-	"github.com/hyperledger/firefly-common/pkg/ffresty"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
@@ -52,27 +48,14 @@ func (f *PolicyEngineFactory) NewPolicyEngine(ctx context.Context, conf config.S
 		resubmitInterval: conf.GetDuration(ResubmitInterval),
 		fixedGasPrice:    fftypes.JSONAnyPtr(conf.GetString(FixedGasPrice)),
 
-		gasOracleMethod:        gasOracleConfig.GetString(GasOracleMethod),
 		gasOracleQueryInterval: gasOracleConfig.GetDuration(GasOracleQueryInterval),
-		gasOracleMode:          gasOracleConfig.GetString(GasOracleMode),
+		gasOracleAggregation:   gasOracleConfig.GetString(GasOracleAggregation),
 	}
-	switch p.gasOracleMode {
-	case GasOracleModeConnector:
-		// No initialization required
-	case GasOracleModeRESTAPI:
-		p.gasOracleClient = ffresty.New(ctx, gasOracleConfig)
-		templateString := gasOracleConfig.GetString(GasOracleTemplate)
-		if templateString == "" {
-			return nil, i18n.NewError(ctx, tmmsgs.MsgMissingGOTemplate)
-		}
-		p.gasOracleTemplate, err = template.New("").Funcs(sprig.FuncMap()).Parse(templateString)
-		if err != nil {
-			return nil, i18n.NewError(ctx, tmmsgs.MsgBadGOTemplate, err)
-		}
-	default:
-		if p.fixedGasPrice.IsNil() {
-			return nil, i18n.NewError(ctx, tmmsgs.MsgNoGasConfigSetForPolicyEngine)
-		}
+	if err := p.initGasOracle(ctx, gasOracleConfig); err != nil {
+		return nil, err
+	}
+	if len(p.gasSources) == 0 && p.fixedGasPrice.IsNil() {
+		return nil, i18n.NewError(ctx, tmmsgs.MsgNoGasConfigSetForPolicyEngine)
 	}
 	return p, nil
 }
@@ -81,13 +64,16 @@ type simplePolicyEngine struct {
 	fixedGasPrice    *fftypes.JSONAny
 	resubmitInterval time.Duration
 
-	gasOracleMode          string
-	gasOracleClient        *resty.Client
-	gasOracleMethod        string
-	gasOracleTemplate      *template.Template
+	gasSources             []*gasSource
+	gasOracleAggregation   string
+	gasOracleFloor         *gasPriceValue
+	gasOracleCeiling       *gasPriceValue
 	gasOracleQueryInterval time.Duration
+	gasOracleMux           sync.Mutex // held only to access the state below, and never across a query of the sources
 	gasOracleQueryValue    *fftypes.JSONAny
+	gasOracleQueryErr      error
 	gasOracleLastQueryTime *fftypes.FFTime
+	gasOracleQuerying      chan struct{} // closed once the query in progress completes
 }
 
 type simplePolicyInfo struct {
@@ -112,41 +98,6 @@ func (p *simplePolicyEngine) withPolicyInfo(ctx context.Context, mtx *apitypes.M
 	return update, reason, err
 }
 
-func (p *simplePolicyEngine) submitTX(ctx context.Context, cAPI ffcapi.API, mtx *apitypes.ManagedTX) (reason ffcapi.ErrorReason, err error) {
-	sendTX := &ffcapi.TransactionSendRequest{
-		TransactionHeaders: mtx.TransactionHeaders,
-		GasPrice:           mtx.GasPrice,
-		TransactionData:    mtx.TransactionData,
-	}
-	sendTX.TransactionHeaders.Nonce = (*fftypes.FFBigInt)(mtx.Nonce.Int())
-	sendTX.TransactionHeaders.Gas = (*fftypes.FFBigInt)(mtx.Gas.Int())
-	log.L(ctx).Debugf("Sending transaction %s at nonce %s / %d (lastSubmit=%s)", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.LastSubmit)
-	res, reason, err := cAPI.TransactionSend(ctx, sendTX)
-	if err == nil {
-		mtx.TransactionHash = res.TransactionHash
-		mtx.LastSubmit = fftypes.Now()
-	} else {
-		// We have some simple rules for handling reasons from the connector, which could be enhanced by extending the connector.
-		switch reason {
-		case ffcapi.ErrorKnownTransaction, ffcapi.ErrorReasonNonceTooLow:
-			// If we already have a transaction hash, this is fine - we just return as if we submitted it
-			if mtx.TransactionHash != "" {
-				log.L(ctx).Debugf("Transaction %s at nonce %s / %d known with hash: %s (%s)", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.TransactionHash, err)
-				return "", nil
-			}
-			// Note: to cover the edge case where we had a timeout or other failure during the initial TransactionSend,
-			//       a policy engine implementation would need to be able to re-calculate the hash that we would expect for the transaction.
-			//       This would require a new FFCAPI API to calculate that hash, which requires the connector to perform the signing
-			//       without submission to the node. For example using `eth_signTransaction` for EVM JSON/RPC.
-			return reason, err
-		default:
-			return reason, err
-		}
-	}
-	log.L(ctx).Infof("Transaction %s at nonce %s / %d submitted. Hash: %s", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), mtx.TransactionHash)
-	return "", nil
-}
-
 func (p *simplePolicyEngine) Execute(ctx context.Context, cAPI ffcapi.API, mtx *apitypes.ManagedTX) (update policyengine.UpdateType, reason ffcapi.ErrorReason, err error) {
 
 	// Simply policy engine allows deletion of the transaction without additional checks ( ensuring the TX has not been submitted / gap filling the nonce etc. )
@@ -162,7 +113,7 @@ func (p *simplePolicyEngine) Execute(ctx context.Context, cAPI ffcapi.API, mtx *
 			return policyengine.UpdateNo, "", err
 		}
 		// Submit the first time
-		if reason, err := p.submitTX(ctx, cAPI, mtx); err != nil {
+		if reason, err := policyengine.SubmitTransaction(ctx, cAPI, mtx); err != nil {
 			return policyengine.UpdateYes, reason, err
 		}
 		mtx.FirstSubmit = mtx.LastSubmit
@@ -184,7 +135,7 @@ func (p *simplePolicyEngine) Execute(ctx context.Context, cAPI ffcapi.API, mtx *
 				log.L(ctx).Infof("Transaction %s at nonce %s / %d has not been mined after %.2fs", mtx.ID, mtx.TransactionHeaders.From, mtx.Nonce.Int64(), secsSinceSubmit)
 				info.LastWarnTime = now
 				// We do a resubmit at this point - as it might no longer be in the TX pool
-				if reason, err := p.submitTX(ctx, cAPI, mtx); err != nil {
+				if reason, err := policyengine.SubmitTransaction(ctx, cAPI, mtx); err != nil {
 					if reason != ffcapi.ErrorKnownTransaction {
 						return policyengine.UpdateYes, reason, err
 					}
@@ -199,54 +150,79 @@ func (p *simplePolicyEngine) Execute(ctx context.Context, cAPI ffcapi.API, mtx *
 	return policyengine.UpdateNo, "", nil
 }
 
-// getGasPrice either uses a fixed gas price, or invokes a gas station API
+// getGasPrice either uses a fixed gas price, or queries the gas oracle sources. The fixed gas price,
+// if set, is used as a fallback when all of the gas oracle sources fail.
+//
+// The result of each query is shared by all the policy loop workers until the query interval has passed,
+// including a failure - so during an outage of the sources the fallback is used without querying them again
+// for every transaction. Only one worker queries at a time, and the others use the previous value if there
+// is one rather than waiting for the query.
 func (p *simplePolicyEngine) getGasPrice(ctx context.Context, cAPI ffcapi.API) (gasPrice *fftypes.JSONAny, err error) {
-	if p.gasOracleQueryValue != nil && p.gasOracleLastQueryTime != nil &&
-		time.Since(*p.gasOracleLastQueryTime.Time()) < p.gasOracleQueryInterval {
-		return p.gasOracleQueryValue, nil
-	}
-	switch p.gasOracleMode {
-	case GasOracleModeRESTAPI:
-		// Make a REST call against an endpoint, and extract a value/structure to pass to the connector
-		gasPrice, err := p.getGasPriceAPI(ctx)
-		if err != nil {
-			return nil, err
-		}
-		p.gasOracleQueryValue = gasPrice
-		p.gasOracleLastQueryTime = fftypes.Now()
-		return p.gasOracleQueryValue, nil
-	case GasOracleModeConnector:
-		// Call the connector
-		res, _, err := cAPI.GasPriceEstimate(ctx, &ffcapi.GasPriceEstimateRequest{})
-		if err != nil {
-			return nil, err
-		}
-		p.gasOracleQueryValue = res.GasPrice
-		p.gasOracleLastQueryTime = fftypes.Now()
-		return p.gasOracleQueryValue, nil
-	default:
+	if len(p.gasSources) == 0 {
 		// Disabled - just a fixed value - note that the fixed value can be any JSON structure,
 		// as interpreted by the connector. For example EVMConnect support a simple value, or a
 		// post EIP-1559 structure.
 		return p.fixedGasPrice, nil
 	}
+
+	for {
+		p.gasOracleMux.Lock()
+		querying := p.gasOracleQuerying
+		switch {
+		case p.gasOracleLastQueryTime != nil && time.Since(*p.gasOracleLastQueryTime.Time()) < p.gasOracleQueryInterval:
+			gasPrice, err = p.gasOracleResult()
+			p.gasOracleMux.Unlock()
+			return gasPrice, err
+		case querying != nil && p.gasOracleQueryValue != nil:
+			gasPrice = p.gasOracleQueryValue
+			p.gasOracleMux.Unlock()
+			return gasPrice, nil
+		case querying == nil:
+			p.gasOracleQuerying = make(chan struct{})
+			p.gasOracleMux.Unlock()
+			return p.queryGasOracle(ctx, cAPI)
+		}
+		p.gasOracleMux.Unlock()
+		select {
+		case <-querying:
+		case <-ctx.Done():
+			return nil, i18n.NewError(ctx, i18n.MsgContextCanceled)
+		}
+	}
 }
 
-func (p *simplePolicyEngine) getGasPriceAPI(ctx context.Context) (gasPrice *fftypes.JSONAny, err error) {
-	var jsonResponse map[string]interface{}
-	res, err := p.gasOracleClient.R().
-		SetResult(&jsonResponse).
-		Execute(p.gasOracleMethod, "")
+// queryGasOracle is called by the one worker querying the sources, once it has set gasOracleQuerying
+func (p *simplePolicyEngine) queryGasOracle(ctx context.Context, cAPI ffcapi.API) (*fftypes.JSONAny, error) {
+	gasPrice, err := p.queryGasSources(ctx, cAPI)
 	if err != nil {
-		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgErrorQueryingGasOracleAPI, -1, err.Error())
+		if p.fixedGasPrice.IsNil() {
+			log.L(ctx).Errorf("All gas oracle sources failed: %s", err)
+		} else {
+			log.L(ctx).Warnf("Using fixed gas price for %s as all gas oracle sources failed: %s", p.gasOracleQueryInterval, err)
+		}
 	}
-	if res.IsError() {
-		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgErrorQueryingGasOracleAPI, res.StatusCode(), res.RawResponse)
+
+	p.gasOracleMux.Lock()
+	defer p.gasOracleMux.Unlock()
+	close(p.gasOracleQuerying)
+	p.gasOracleQuerying = nil
+	if err != nil && ctx.Err() != nil {
+		// The failure is of this worker's context, not of the sources, so is not shared with the others
+		return nil, err
 	}
-	buff := new(bytes.Buffer)
-	err = p.gasOracleTemplate.Execute(buff, jsonResponse)
-	if err != nil {
-		return nil, i18n.WrapError(ctx, err, tmmsgs.MsgGasOracleResultError)
+	p.gasOracleQueryValue = gasPrice
+	p.gasOracleQueryErr = err
+	p.gasOracleLastQueryTime = fftypes.Now()
+	return p.gasOracleResult()
+}
+
+// gasOracleResult returns the result of the last query, or the fallback if it failed. Must be called holding gasOracleMux.
+func (p *simplePolicyEngine) gasOracleResult() (*fftypes.JSONAny, error) {
+	if p.gasOracleQueryErr != nil {
+		if p.fixedGasPrice.IsNil() {
+			return nil, p.gasOracleQueryErr
+		}
+		return p.fixedGasPrice, nil
 	}
-	return fftypes.JSONAnyPtr(buff.String()), nil
+	return p.gasOracleQueryValue, nil
 }
@@ -92,6 +92,10 @@ func TestFixedGasPriceOK(t *testing.T) {
 		"maxPriorityFee":32.146027800733336,
 		"maxFee":32.14602781673334
 	}`, mtx.GasPrice.String())
+	assert.Len(t, mtx.History, 1)
+	assert.Equal(t, apitypes.TxActionSubmitted, mtx.History[0].Action)
+	assert.Equal(t, "0x12345", mtx.History[0].TransactionHash)
+	assert.Equal(t, mtx.GasPrice, mtx.History[0].GasPrice)
 
 	mockFFCAPI.AssertExpectations(t)
 }
@@ -411,6 +415,39 @@ func TestWarnStaleWarningCannotParse(t *testing.T) {
 	mockFFCAPI.AssertExpectations(t)
 }
 
+func TestWarnStaleResubmitRecordsHistory(t *testing.T) {
+	f, conf := newTestPolicyEngineFactory(t)
+	conf.Set(FixedGasPrice, `12345`)
+	p, err := f.NewPolicyEngine(context.Background(), conf)
+	assert.NoError(t, err)
+
+	submitTime := fftypes.FFTime(time.Now().Add(-100 * time.Hour))
+	mtx := &apitypes.ManagedTX{
+		TransactionData: "SOME_RAW_TX_BYTES",
+		FirstSubmit:     &submitTime,
+		GasPrice:        fftypes.JSONAnyPtr(`12345`),
+		TransactionHeaders: ffcapi.TransactionHeaders{
+			From: "0x6b7cfa4cf9709d3b3f5f7c22de123d2e16aee712",
+		},
+	}
+
+	mockFFCAPI := &ffcapimocks.API{}
+	mockFFCAPI.On("TransactionSend", mock.Anything, mock.Anything).Return(&ffcapi.TransactionSendResponse{
+		TransactionHash: "0x23456",
+	}, ffcapi.ErrorReason(""), nil)
+
+	ctx := context.Background()
+	updated, _, err := p.Execute(ctx, mockFFCAPI, mtx)
+	assert.NoError(t, err)
+	assert.Equal(t, policyengine.UpdateYes, updated)
+	assert.Len(t, mtx.History, 1)
+	assert.Equal(t, apitypes.TxActionResubmitted, mtx.History[0].Action)
+	assert.Equal(t, "0x23456", mtx.History[0].TransactionHash)
+	assert.Equal(t, `12345`, mtx.History[0].GasPrice.String())
+
+	mockFFCAPI.AssertExpectations(t)
+}
+
 func TestKnownTransactionHashKnown(t *testing.T) {
 	f, conf := newTestPolicyEngineFactory(t)
 	conf.Set(FixedGasPrice, `12345`)